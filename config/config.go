@@ -8,10 +8,27 @@ import (
 
 type (
 	Config struct {
-		App           `yaml:"app"`
-		HTTP          `yaml:"http"`
-		Log           `yaml:"logger"`
-		GCloudStorage `yaml:"gcloud_storage"`
+		App               `yaml:"app"`
+		HTTP              `yaml:"http"`
+		Log               `yaml:"logger"`
+		GCloudStorage     `yaml:"gcloud_storage"`
+		Scanning          `yaml:"scanning"`
+		Thumbnails        `yaml:"thumbnails"`
+		Webhooks          `yaml:"webhooks"`
+		Broker            `yaml:"broker"`
+		Notifications     `yaml:"notifications"`
+		Audit             `yaml:"audit"`
+		Metrics           `yaml:"metrics"`
+		Tracing           `yaml:"tracing"`
+		Quota             `yaml:"quota"`
+		Deduplication     `yaml:"deduplication"`
+		Search            `yaml:"search"`
+		Retention         `yaml:"retention"`
+		Sharing           `yaml:"sharing"`
+		AccessControl     `yaml:"access_control"`
+		RateLimit         `yaml:"rate_limit"`
+		StorageResilience `yaml:"storage_resilience"`
+		Tenants           map[string]Tenant `yaml:"tenants"`
 	}
 
 	App struct {
@@ -20,10 +37,16 @@ type (
 	}
 
 	HTTP struct {
-		Port            string `env-required:"true" yaml:"port" env:"HTTP_PORT"`
-		ReadTimeout     int64  `env-required:"true" yaml:"read_timeout" env:"HTTP_READ_TIMEOUT"`
-		WriteTimeout    int64  `env-required:"true" yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
-		ShutdownTimeout int64  `env-required:"true" yaml:"shutdown_timeout" env:"HTTP_SHUTDOWN_TIMEOUT"`
+		Port         string `env-required:"true" yaml:"port" env:"HTTP_PORT"`
+		ReadTimeout  int64  `env-required:"true" yaml:"read_timeout" env:"HTTP_READ_TIMEOUT"`
+		WriteTimeout int64  `env-required:"true" yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+		// StreamWriteTimeout replaces WriteTimeout for streamed downloads and archives.
+		StreamWriteTimeout int64 `yaml:"stream_write_timeout" env:"HTTP_STREAM_WRITE_TIMEOUT" env-default:"300000000000"`
+		ShutdownTimeout    int64 `env-required:"true" yaml:"shutdown_timeout" env:"HTTP_SHUTDOWN_TIMEOUT"`
+		ShutdownDelay      int64 `yaml:"shutdown_delay" env:"HTTP_SHUTDOWN_DELAY" env-default:"0"`
+		HealthTimeout      int64 `yaml:"health_timeout" env:"HTTP_HEALTH_TIMEOUT" env-default:"2000000000"`
+		// TrustedProxies are proxies whose X-Forwarded-For header gives the client address.
+		TrustedProxies []string `yaml:"trusted_proxies" env:"HTTP_TRUSTED_PROXIES" env-separator:","`
 	}
 
 	Log struct {
@@ -31,15 +54,167 @@ type (
 	}
 
 	GCloudStorage struct {
-		ProjectName       string `env-required:"true" yaml:"project_name"    env:"GCLOUD_PROJECT_NAME"`
-		BucketName        string `env-required:"true" yaml:"bucket_name" env:"GCLOUD_STORAGE_BUCKET_NAME"`
-		UrlExpirationTime int    `env-required:"true" yaml:"url_expiration_time" env:"GCLOUD_STORAGE_URL_EXPIRATION_TIME"`
-		UseEmulator       bool   `env-required:"true" yaml:"use_emulator" env:"GCLOUD_STORAGE_USE_EMULATOR" env-default:"false"`
-		EmulatorPort      int    `env-required:"false" yaml:"emulator_port" env:"GCLOUD_STORAGE_EMULATOR_PORT"`
-		UseCredentials    bool   `yaml:"use_credentials" env:"GCLOUD_STORAGE_USE_CREDENTIALS" env-default:"false"`
-		AccessId          string `yaml:"access_id" env:"GCLOUD_STORAGE_ACCESS_ID"`
-		PrivateKeyBase64  string `yaml:"private_key_base_64" env:"GCLOUD_STORAGE_PRIVATE_KEY_BASE_64"`
-		Insecure          bool   `yaml:"insecure" env:"GCLOUD_STORAGE_INSECURE" env-default:"false"`
+		ProjectName          string `env-required:"true" yaml:"project_name"    env:"GCLOUD_PROJECT_NAME"`
+		BucketName           string `env-required:"true" yaml:"bucket_name" env:"GCLOUD_STORAGE_BUCKET_NAME"`
+		UrlExpirationTime    int    `env-required:"true" yaml:"url_expiration_time" env:"GCLOUD_STORAGE_URL_EXPIRATION_TIME"`
+		MaxUrlExpirationTime int    `yaml:"max_url_expiration_time" env:"GCLOUD_STORAGE_MAX_URL_EXPIRATION_TIME"`
+		UseEmulator          bool   `env-required:"true" yaml:"use_emulator" env:"GCLOUD_STORAGE_USE_EMULATOR" env-default:"false"`
+		EmulatorPort         int    `env-required:"false" yaml:"emulator_port" env:"GCLOUD_STORAGE_EMULATOR_PORT"`
+		Signer               string `yaml:"signer" env:"GCLOUD_STORAGE_SIGNER" env-default:"none"`
+		// UseCredentials is deprecated, it selects the private_key signer when no other is set.
+		UseCredentials   bool   `yaml:"use_credentials" env:"GCLOUD_STORAGE_USE_CREDENTIALS" env-default:"false"`
+		AccessId         string `yaml:"access_id" env:"GCLOUD_STORAGE_ACCESS_ID"`
+		PrivateKeyBase64 string `yaml:"private_key_base_64" env:"GCLOUD_STORAGE_PRIVATE_KEY_BASE_64"`
+		Insecure         bool   `yaml:"insecure" env:"GCLOUD_STORAGE_INSECURE" env-default:"false"`
+	}
+
+	Scanning struct {
+		Scanner      string `yaml:"scanner" env:"SCANNING_SCANNER" env-default:"none"`
+		ClamdAddress string `yaml:"clamd_address" env:"SCANNING_CLAMD_ADDRESS"`
+		Timeout      int64  `yaml:"timeout" env:"SCANNING_TIMEOUT"`
+		Workers      int    `yaml:"workers" env:"SCANNING_WORKERS" env-default:"2"`
+		QueueSize    int    `yaml:"queue_size" env:"SCANNING_QUEUE_SIZE" env-default:"100"`
+		RetryDelay   int64  `yaml:"retry_delay" env:"SCANNING_RETRY_DELAY" env-default:"1000000000"`
+		MaxAttempts  int    `yaml:"max_attempts" env:"SCANNING_MAX_ATTEMPTS" env-default:"10"`
+	}
+
+	Thumbnails struct {
+		Enabled   bool  `yaml:"enabled" env:"THUMBNAILS_ENABLED" env-default:"false"`
+		Sizes     []int `yaml:"sizes" env:"THUMBNAILS_SIZES" env-separator:","`
+		Workers   int   `yaml:"workers" env:"THUMBNAILS_WORKERS" env-default:"2"`
+		QueueSize int   `yaml:"queue_size" env:"THUMBNAILS_QUEUE_SIZE" env-default:"100"`
+	}
+
+	Webhooks struct {
+		Workers        int   `yaml:"workers" env:"WEBHOOKS_WORKERS" env-default:"2"`
+		QueueSize      int   `yaml:"queue_size" env:"WEBHOOKS_QUEUE_SIZE" env-default:"100"`
+		MaxAttempts    int   `yaml:"max_attempts" env:"WEBHOOKS_MAX_ATTEMPTS" env-default:"5"`
+		InitialBackoff int64 `yaml:"initial_backoff" env:"WEBHOOKS_INITIAL_BACKOFF" env-default:"1000000000"`
+		MaxBackoff     int64 `yaml:"max_backoff" env:"WEBHOOKS_MAX_BACKOFF" env-default:"60000000000"`
+		Timeout        int64 `yaml:"timeout" env:"WEBHOOKS_TIMEOUT" env-default:"10000000000"`
+		// AllowPrivateTargets permits private addresses, for local development only.
+		AllowPrivateTargets bool `yaml:"allow_private_targets" env:"WEBHOOKS_ALLOW_PRIVATE_TARGETS" env-default:"false"`
+	}
+
+	// Broker selects where file events are published besides webhooks: "none" or "pubsub".
+	Broker struct {
+		Publisher      string `yaml:"publisher" env:"BROKER_PUBLISHER" env-default:"none"`
+		ProjectName    string `yaml:"project_name" env:"BROKER_PROJECT_NAME"`
+		Topic          string `yaml:"topic" env:"BROKER_TOPIC"`
+		CreateTopic    bool   `yaml:"create_topic" env:"BROKER_CREATE_TOPIC" env-default:"false"`
+		RelayInterval  int64  `yaml:"relay_interval" env:"BROKER_RELAY_INTERVAL" env-default:"1000000000"`
+		RelayBatchSize int    `yaml:"relay_batch_size" env:"BROKER_RELAY_BATCH_SIZE" env-default:"100"`
+		// RelayMaxAttempts is how many times an event may fail before the relay gives up on it.
+		RelayMaxAttempts int `yaml:"relay_max_attempts" env:"BROKER_RELAY_MAX_ATTEMPTS" env-default:"5"`
+		// RelayRememberedEvents bounds how many published event ids are kept to drop duplicates.
+		RelayRememberedEvents int `yaml:"relay_remembered_events" env:"BROKER_RELAY_REMEMBERED_EVENTS" env-default:"10000"`
+	}
+
+	// Notifications registers the bucket notifications endpoint when Token is set.
+	Notifications struct {
+		Token string `yaml:"token" env:"NOTIFICATIONS_TOKEN"`
+	}
+
+	// Audit sets how long audit entries are kept; zero keeps them forever.
+	Audit struct {
+		Retention     int64 `yaml:"retention" env:"AUDIT_RETENTION" env-default:"31536000000000000"`
+		PurgeInterval int64 `yaml:"purge_interval" env:"AUDIT_PURGE_INTERVAL" env-default:"3600000000000"`
+	}
+
+	Metrics struct {
+		Enabled bool `yaml:"enabled" env:"METRICS_ENABLED" env-default:"true"`
+	}
+
+	// Quota limits bytes and files per tenant and per reference; zero means unlimited.
+	Quota struct {
+		MaxBytes          int64 `yaml:"max_bytes" env:"QUOTA_MAX_BYTES" env-default:"0"`
+		MaxFiles          int   `yaml:"max_files" env:"QUOTA_MAX_FILES" env-default:"0"`
+		MaxReferenceBytes int64 `yaml:"max_reference_bytes" env:"QUOTA_MAX_REFERENCE_BYTES" env-default:"0"`
+		MaxReferenceFiles int   `yaml:"max_reference_files" env:"QUOTA_MAX_REFERENCE_FILES" env-default:"0"`
+	}
+
+	// Deduplication stores identical uploads of a tenant once, keyed by the SHA-256 of the content.
+	Deduplication struct {
+		Enabled bool `yaml:"enabled" env:"DEDUPLICATION_ENABLED" env-default:"false"`
+	}
+
+	// Search keeps its index under IndexPath, or in memory when it's empty.
+	Search struct {
+		Enabled   bool   `yaml:"enabled" env:"SEARCH_ENABLED" env-default:"false"`
+		IndexPath string `yaml:"index_path" env:"SEARCH_INDEX_PATH"`
+		Workers   int    `yaml:"workers" env:"SEARCH_WORKERS" env-default:"2"`
+		QueueSize int    `yaml:"queue_size" env:"SEARCH_QUEUE_SIZE" env-default:"100"`
+	}
+
+	// Retention deletes expired files every ExpirationInterval.
+	Retention struct {
+		ExpirationInterval int64 `yaml:"expiration_interval" env:"RETENTION_EXPIRATION_INTERVAL" env-default:"3600000000000"`
+		ObjectHolds        bool  `yaml:"object_holds" env:"RETENTION_OBJECT_HOLDS" env-default:"false"`
+	}
+
+	// Sharing caps how long share links stay valid, UrlExpiration is that of the urls they open.
+	Sharing struct {
+		MaxExpiration int64 `yaml:"max_expiration" env:"SHARING_MAX_EXPIRATION" env-default:"2592000000000000"`
+		UrlExpiration int64 `yaml:"url_expiration" env:"SHARING_URL_EXPIRATION" env-default:"60000000000"`
+	}
+
+	// AccessControl checks grants on files and references of Callers, authenticated by their X-API-Key.
+	AccessControl struct {
+		Enabled bool     `yaml:"enabled" env:"ACCESS_CONTROL_ENABLED" env-default:"false"`
+		Callers []Caller `yaml:"callers"`
+	}
+
+	// Caller is a user or a service authenticated by ApiKey, Groups name the groups it is granted access as.
+	Caller struct {
+		ApiKey string   `yaml:"api_key"`
+		ID     string   `yaml:"id"`
+		Groups []string `yaml:"groups"`
+	}
+
+	// RateLimit refills token buckets by rate per second; a zero rate or count disables a limit.
+	RateLimit struct {
+		TenantRate           float64 `yaml:"tenant_rate" env:"RATE_LIMIT_TENANT_RATE" env-default:"0"`
+		TenantBurst          int     `yaml:"tenant_burst" env:"RATE_LIMIT_TENANT_BURST" env-default:"0"`
+		ClientRate           float64 `yaml:"client_rate" env:"RATE_LIMIT_CLIENT_RATE" env-default:"0"`
+		ClientBurst          int     `yaml:"client_burst" env:"RATE_LIMIT_CLIENT_BURST" env-default:"0"`
+		MaxConcurrentUploads int     `yaml:"max_concurrent_uploads" env:"RATE_LIMIT_MAX_CONCURRENT_UPLOADS" env-default:"0"`
+		// ApiKeys tell clients apart by X-API-Key, clients without one are told apart by address.
+		ApiKeys []string `yaml:"api_keys" env:"RATE_LIMIT_API_KEYS" env-separator:","`
+	}
+
+	// StorageResilience retries transient storage errors and stops calling it after BreakerThreshold failures.
+	StorageResilience struct {
+		MaxAttempts      int   `yaml:"max_attempts" env:"STORAGE_MAX_ATTEMPTS" env-default:"3"`
+		InitialBackoff   int64 `yaml:"initial_backoff" env:"STORAGE_INITIAL_BACKOFF" env-default:"100000000"`
+		MaxBackoff       int64 `yaml:"max_backoff" env:"STORAGE_MAX_BACKOFF" env-default:"2000000000"`
+		UploadTimeout    int64 `yaml:"upload_timeout" env:"STORAGE_UPLOAD_TIMEOUT" env-default:"60000000000"`
+		ReadTimeout      int64 `yaml:"read_timeout" env:"STORAGE_READ_TIMEOUT" env-default:"300000000000"`
+		DeleteTimeout    int64 `yaml:"delete_timeout" env:"STORAGE_DELETE_TIMEOUT" env-default:"10000000000"`
+		BreakerThreshold int   `yaml:"breaker_threshold" env:"STORAGE_BREAKER_THRESHOLD" env-default:"5"`
+		BreakerOpenTime  int64 `yaml:"breaker_open_time" env:"STORAGE_BREAKER_OPEN_TIME" env-default:"30000000000"`
+	}
+
+	// Tracing selects the span exporter: "none", "stdout" or "otlp" sending over gRPC to Endpoint.
+	Tracing struct {
+		Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER" env-default:"none"`
+		Endpoint    string  `yaml:"endpoint" env:"TRACING_ENDPOINT"`
+		Insecure    bool    `yaml:"insecure" env:"TRACING_INSECURE" env-default:"false"`
+		SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" env-default:"1"`
+	}
+
+	// Tenant holds per-tenant overrides; zero values fall back to the global settings.
+	Tenant struct {
+		UrlExpirationTime    int              `yaml:"url_expiration_time"`
+		MaxUrlExpirationTime int              `yaml:"max_url_expiration_time"`
+		Encryption           TenantEncryption `yaml:"encryption"`
+		Quota                Quota            `yaml:"quota"`
+	}
+
+	// TenantEncryption Mode is "csek" or "envelope", Keys are base64 encoded AES-256 keys by id.
+	TenantEncryption struct {
+		Mode       string            `yaml:"mode"`
+		PrimaryKey string            `yaml:"primary_key"`
+		Keys       map[string]string `yaml:"keys"`
 	}
 )
 
@@ -55,6 +230,9 @@ func NewConfig(path string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	if cfg.GCloudStorage.UseCredentials && (cfg.GCloudStorage.Signer == "" || cfg.GCloudStorage.Signer == "none") {
+		cfg.GCloudStorage.Signer = "private_key"
+	}
 
 	return cfg, nil
 }
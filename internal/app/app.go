@@ -9,35 +9,66 @@ import (
 	"syscall"
 	"time"
 
+	"cloud.google.com/go/pubsub"
 	"cloud.google.com/go/storage"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/marcinlovescode/go-gcloudstorage-fileupload/config"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/auditlog"
+	auditAdapters "github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/auditlog/adapters"
 	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
 	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/adapters"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
 	httpRouter "github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/http"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/notifications"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/access"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/clamav"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/encryption"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/events"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/gcloudpubsub"
 	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/gcloudstorage"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/health"
 	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/httpserver"
 	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/logger"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/metrics"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/ratelimit"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/resilience"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/tracing"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/webhooks"
+	webhooksAdapters "github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/webhooks/adapters"
+)
+
+const (
+	_tracerName         = "github.com/marcinlovescode/go-gcloudstorage-fileupload"
+	_outboxDrainTimeout = 5 * time.Second
 )
 
 func Run(cfg *config.Config) {
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
 	zerologLogger := logger.NewZerologLogger(cfg.Log.Level)
-	handler, err := CreateHttpHandlers(ctx, zerologLogger, cfg)
+	readiness := health.NewReadiness()
+	workers := &Workers{}
+	handler, err := CreateHttpHandlers(ctx, zerologLogger, cfg, readiness, workers)
 	if err != nil {
 		zerologLogger.Error(fmt.Errorf("app - Run - init: %w", err))
 		cancel()
+		workers.Wait()
 		return
 	}
 	appendSwagger(handler)
 	httpServer := httpserver.New(handler,
 		httpserver.Port(cfg.HTTP.Port),
 		httpserver.ShutdownTimeout(time.Duration(cfg.HTTP.ShutdownTimeout)),
+		httpserver.ShutdownDelay(time.Duration(cfg.HTTP.ShutdownDelay)),
+		httpserver.Readiness(readiness),
 		httpserver.WriteTimeout(time.Duration(cfg.HTTP.WriteTimeout)),
+		httpserver.StreamWriteTimeout(time.Duration(cfg.HTTP.StreamWriteTimeout)),
 		httpserver.ReadTimeout(time.Duration(cfg.HTTP.ReadTimeout)))
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
@@ -49,20 +80,98 @@ func Run(cfg *config.Config) {
 		zerologLogger.Error(fmt.Errorf("app - Run - httpServer.Notify: %w", err))
 	}
 
-	cancel()
+	// requests in flight may still queue work, so the workers are stopped once the server is down
 	err = httpServer.Shutdown()
 	if err != nil {
 		zerologLogger.Error(fmt.Errorf("app - Run - httpServer.Shutdown: %w", err))
 	}
+	cancel()
+	workers.Wait()
+}
+
+// Workers collects what the application runs in the background, so Run can wait for it to stop
+// once the context is cancelled. A nil Workers stops everything on its own when the context is done.
+type Workers struct {
+	stops []func()
+}
+
+// add registers stop, which has to return once the worker stopped after ctx was cancelled.
+func (workers *Workers) add(ctx context.Context, stop func()) {
+	if workers == nil {
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
+		return
+	}
+	workers.stops = append(workers.stops, stop)
+}
+
+// Wait stops the workers in the reverse order they were started in.
+func (workers *Workers) Wait() {
+	for i := len(workers.stops) - 1; i >= 0; i-- {
+		workers.stops[i]()
+	}
 }
 
-func CreateHttpHandlers(ctx context.Context, logger logger.Logger, cfg *config.Config) (*gin.Engine, error) {
-	handler := gin.Default()
-	useCase, err := createFilesUseCase(ctx, cfg.GCloudStorage)
+// CreateHttpHandlers builds the application; readiness may be nil when nothing reports shutdown
+// and workers may be nil when nothing waits for the background workers.
+func CreateHttpHandlers(ctx context.Context, logger logger.Logger, cfg *config.Config, readiness *health.Readiness, workers *Workers) (*gin.Engine, error) {
+	handler := gin.New()
+	err := handler.SetTrustedProxies(cfg.HTTP.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("app - CreateHttpHandlers: invalid trusted proxies; %w", err)
+	}
+	handler.Use(httpRouter.RequestID(), httpRouter.AccessLog(logger), httpRouter.Recovery(logger))
+	tracerProvider, err := tracing.NewTracerProvider(ctx, tracing.Options{
+		ServiceName:    cfg.App.Name,
+		ServiceVersion: cfg.App.Version,
+		Exporter:       tracing.Exporter(cfg.Tracing.Exporter),
+		Endpoint:       cfg.Tracing.Endpoint,
+		Insecure:       cfg.Tracing.Insecure,
+		SampleRatio:    cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("app - createHttpHandlers: can't create tracer provider; %w", err)
+	}
+	workers.add(ctx, func() {
+		if err := tracerProvider.Shutdown(context.Background()); err != nil {
+			logger.Error(fmt.Errorf("app - createHttpHandlers - tracerProvider.Shutdown: %w", err))
+		}
+	})
+	handler.Use(otelgin.Middleware(cfg.App.Name, otelgin.WithTracerProvider(tracerProvider)))
+	tracer := tracerProvider.Tracer(_tracerName)
+	checker := health.NewChecker(time.Duration(cfg.HTTP.HealthTimeout), readiness)
+	httpRouter.AppendHealthRoutes(handler, checker)
+	var appMetrics *metrics.Metrics
+	if cfg.Metrics.Enabled {
+		appMetrics = metrics.New()
+		handler.Use(httpRouter.Metrics(appMetrics))
+		handler.GET("/metrics", gin.WrapH(appMetrics.Handler()))
+	}
+	eventBus := events.NewBus(logger)
+	webhooksUseCase, err := createWebhooksUseCase(ctx, logger, cfg.Webhooks, eventBus, workers)
+	if err != nil {
+		return nil, fmt.Errorf("app - createHttpHandlers: can't create Webhooks UseCase; %w", err)
+	}
+	err = subscribeBroker(ctx, logger, cfg.Broker, eventBus, workers)
+	if err != nil {
+		return nil, fmt.Errorf("app - createHttpHandlers: can't connect event broker; %w", err)
+	}
+	auditUseCase, err := createAuditUseCase(ctx, logger, cfg.Audit, workers)
+	if err != nil {
+		return nil, fmt.Errorf("app - createHttpHandlers: can't create Audit UseCase; %w", err)
+	}
+	useCase, err := createFilesUseCase(ctx, logger, cfg, eventBus, auditUseCase, appMetrics, tracer, checker, workers)
 	if err != nil {
 		return nil, fmt.Errorf("app - createHttpHandlers: can't create Files UseCase; %w", err)
 	}
-	err = httpRouter.NewGinHttpRouter(logger, useCase, handler)
+	notificationsUseCase, err := notifications.NewDefaultNotificationsUseCase(useCase, cfg.GCloudStorage.BucketName)
+	if err != nil {
+		return nil, fmt.Errorf("app - createHttpHandlers: can't create Notifications UseCase; %w", err)
+	}
+	err = httpRouter.NewGinHttpRouter(logger, useCase, webhooksUseCase, notificationsUseCase, cfg.Notifications.Token, auditUseCase,
+		createMiddleware(logger, cfg.RateLimit, cfg.AccessControl), handler)
 	if err != nil {
 		return nil, fmt.Errorf("app - createHttpHandlers: can't create router; %w", err)
 	}
@@ -74,25 +183,298 @@ func appendSwagger(handler *gin.Engine) {
 	handler.GET("/swagger/*any", swaggerHandler)
 }
 
-func createFilesUseCase(ctx context.Context, gcloudConfig config.GCloudStorage) (files.UseCase, error) {
+func createResilientFileStorage(next ports.FileStorage, cfg config.StorageResilience) *adapters.ResilientFileStorage {
+	retry := resilience.Retry{
+		MaxAttempts: cfg.MaxAttempts,
+		Backoff: resilience.Backoff{
+			Initial:    time.Duration(cfg.InitialBackoff),
+			Max:        time.Duration(cfg.MaxBackoff),
+			Multiplier: 2,
+		},
+		Retryable: gcloudstorage.IsRetryable,
+	}
+	var breaker *resilience.CircuitBreaker
+	if cfg.BreakerThreshold > 0 {
+		breaker = resilience.NewCircuitBreaker(cfg.BreakerThreshold, time.Duration(cfg.BreakerOpenTime))
+	}
+	return adapters.NewResilientFileStorage(next, retry, breaker, adapters.StorageTimeouts{
+		Upload: time.Duration(cfg.UploadTimeout),
+		Read:   time.Duration(cfg.ReadTimeout),
+		Delete: time.Duration(cfg.DeleteTimeout),
+	})
+}
+
+// createMiddleware authenticates callers when access control is on, limits requests per tenant and
+// per client, and uploads in flight per tenant.
+func createMiddleware(logger logger.Logger, cfg config.RateLimit, accessControl config.AccessControl) httpRouter.Middleware {
+	var middleware httpRouter.Middleware
+	if accessControl.Enabled {
+		middleware.Callers = make(map[string]access.Caller, len(accessControl.Callers))
+		for _, caller := range accessControl.Callers {
+			middleware.Callers[caller.ApiKey] = access.Caller{ID: caller.ID, Groups: caller.Groups}
+		}
+	}
+	store := ratelimit.NewInMemoryStore()
+	tenantLimit := ratelimit.Limit{Rate: cfg.TenantRate, Burst: cfg.TenantBurst}
+	if tenantLimit.Enabled() {
+		middleware.Api = append(middleware.Api, httpRouter.RateLimit(logger, store, tenantLimit, httpRouter.TenantKey))
+	}
+	clientLimit := ratelimit.Limit{Rate: cfg.ClientRate, Burst: cfg.ClientBurst}
+	if clientLimit.Enabled() {
+		middleware.Api = append(middleware.Api, httpRouter.RateLimit(logger, store, clientLimit, httpRouter.ClientKey(cfg.ApiKeys)))
+	}
+	if cfg.MaxConcurrentUploads > 0 {
+		limiter := ratelimit.NewConcurrencyLimiter(cfg.MaxConcurrentUploads)
+		middleware.Upload = append(middleware.Upload, httpRouter.ConcurrentUploads(limiter, httpRouter.TenantKey))
+	}
+	return middleware
+}
+
+func createFilesUseCase(ctx context.Context, logger logger.Logger, cfg *config.Config, eventPublisher ports.EventPublisher, auditRecorder ports.AuditRecorder, appMetrics *metrics.Metrics, tracer trace.Tracer, checker *health.Checker, workers *Workers) (files.UseCase, error) {
+	gcloudConfig, tenantsConfig := cfg.GCloudStorage, cfg.Tenants
 	gcloudClient, err := storage.NewClient(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("http - router - newFilesUseCase: can't create Google Cloud Storage Client; %w", err)
 	}
-	var gCSCredentials *gcloudstorage.GCloudAuthCredentials
-	if gcloudConfig.UseCredentials {
-		privateKey, err := b64.StdEncoding.DecodeString(gcloudConfig.PrivateKeyBase64)
-		if err != nil {
-			return nil, fmt.Errorf("http - router - newFilesUseCase: can't decode private key; %w", err)
+	signer, err := createSigner(ctx, gcloudConfig)
+	if err != nil {
+		return nil, fmt.Errorf("http - router - newFilesUseCase: can't create url signer; %w", err)
+	}
+	csekKeyrings, err := createKeyrings(tenantsConfig, "csek")
+	if err != nil {
+		return nil, fmt.Errorf("http - router - newFilesUseCase: can't create CSEK keyrings; %w", err)
+	}
+	envelopeKeyrings, err := createKeyrings(tenantsConfig, "envelope")
+	if err != nil {
+		return nil, fmt.Errorf("http - router - newFilesUseCase: can't create envelope keyrings; %w", err)
+	}
+	gcloudService := gcloudstorage.NewGCloudStorageService(gcloudClient, gcloudConfig.ProjectName, gcloudConfig.BucketName, signer,
+		gcloudstorage.Insecure(gcloudConfig.Insecure),
+		gcloudstorage.CustomerSuppliedKeys(csekKeyrings))
+	checker.Register("storage", gcloudService)
+	resilientService := createResilientFileStorage(adapters.NewGCloudFileStorage(gcloudService), cfg.StorageResilience)
+	var fileService fileStorage = adapters.NewEnvelopeEncryptingFileStorage(resilientService, envelopeKeyrings, adapters.DefaultMaxEnvelopeFileSize)
+	inMemoryRepository, err := adapters.NewInMemoryFilesRepository(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("http - router - newFilesUseCase: can't create files repository; %w", err)
+	}
+	checker.Register("repository", inMemoryRepository)
+	var fileRepository ports.FileRepository = inMemoryRepository
+	if appMetrics != nil {
+		fileService = adapters.NewInstrumentedFileStorage(fileService, appMetrics)
+		fileRepository = adapters.NewInstrumentedFileRepository(fileRepository, appMetrics)
+	}
+	fileService = adapters.NewTracedFileStorage(fileService, tracer)
+	fileRepository = adapters.NewTracedFileRepository(fileRepository, tracer)
+	idGen := adapters.NewGuidBasedIdGenerator()
+	quotaLimits := models.QuotaLimits{
+		MaxBytes:          cfg.Quota.MaxBytes,
+		MaxFiles:          cfg.Quota.MaxFiles,
+		MaxReferenceBytes: cfg.Quota.MaxReferenceBytes,
+		MaxReferenceFiles: cfg.Quota.MaxReferenceFiles,
+	}
+	opts := []files.Option{
+		files.EncryptionKeyRotator(fileService),
+		files.Events(eventPublisher),
+		files.Audit(auditRecorder),
+		files.Logger(logger),
+		files.Quotas(adapters.NewInMemoryQuotaStore(), quotaLimits),
+		files.Retention(adapters.NewInMemoryRetentionStore()),
+		files.Sharing(adapters.NewInMemoryShareRepository(), time.Duration(cfg.Sharing.MaxExpiration), time.Duration(cfg.Sharing.UrlExpiration)),
+	}
+	if cfg.Retention.ObjectHolds {
+		opts = append(opts, files.ObjectHolds(fileService))
+	}
+	if cfg.AccessControl.Enabled {
+		if len(cfg.AccessControl.Callers) == 0 {
+			logger.Warn("http - router - newFilesUseCase: access control is enabled without callers, all requests will be rejected")
 		}
-		gCSCredentials = &gcloudstorage.GCloudAuthCredentials{
-			AccessID:   gcloudConfig.AccessId,
-			PrivateKey: privateKey,
+		opts = append(opts, files.AccessControl(adapters.NewInMemoryReferenceAccessStore()))
+	}
+	if cfg.Deduplication.Enabled {
+		opts = append(opts, files.Deduplication(adapters.NewInMemoryContentRepository()))
+	}
+	scanner, err := createScanner(cfg.Scanning)
+	if err != nil {
+		return nil, fmt.Errorf("http - router - newFilesUseCase: can't create antivirus scanner; %w", err)
+	}
+	if cfg.Thumbnails.Enabled {
+		thumbnailPipeline := files.NewThumbnailPipeline(fileService, fileRepository, logger, cfg.Thumbnails.Sizes, cfg.Thumbnails.Workers, cfg.Thumbnails.QueueSize)
+		thumbnailPipeline.Start(ctx)
+		workers.add(ctx, thumbnailPipeline.Wait)
+		opts = append(opts, files.Thumbnails(thumbnailPipeline))
+	}
+	if cfg.Search.Enabled {
+		searchIndex, err := adapters.NewBleveSearchIndex(cfg.Search.IndexPath)
+		if err != nil {
+			return nil, fmt.Errorf("http - router - newFilesUseCase: can't open search index; %w", err)
 		}
+		indexPipeline := files.NewIndexPipeline(searchIndex, fileRepository, logger, cfg.Search.Workers, cfg.Search.QueueSize)
+		indexPipeline.Start(ctx)
+		workers.add(ctx, func() {
+			indexPipeline.Wait()
+			if err := searchIndex.Close(); err != nil {
+				logger.Error(fmt.Errorf("app - createFilesUseCase - searchIndex.Close: %w", err))
+			}
+		})
+		opts = append(opts, files.Indexing(indexPipeline))
+	}
+	if pinger, ok := scanner.(health.Pinger); ok {
+		checker.Register("antivirus", pinger)
+	}
+	if scanner != nil {
+		scanPipeline := files.NewScanPipeline(scanner, fileService, fileRepository, logger, cfg.Scanning.Workers, cfg.Scanning.QueueSize, time.Duration(cfg.Scanning.RetryDelay), cfg.Scanning.MaxAttempts)
+		scanPipeline.Start(ctx)
+		workers.add(ctx, scanPipeline.Wait)
+		opts = append(opts, files.Scanning(scanPipeline))
+	}
+
+	useCase, err := files.NewDefaultFilesUseCase(fileService, fileRepository, idGen, gcloudConfig, tenantsConfig, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("http - router - newFilesUseCase: %w", err)
+	}
+	tracedUseCase := files.NewTracedUseCase(useCase, tracer)
+	expirationJob := files.NewExpirationJob(tracedUseCase, logger, time.Duration(cfg.Retention.ExpirationInterval))
+	expirationJob.Start(ctx)
+	workers.add(ctx, expirationJob.Wait)
+	return tracedUseCase, nil
+}
+
+// fileStorage is a file storage that can also rotate encryption keys of stored files and hold them.
+type fileStorage interface {
+	ports.FileStorage
+	ports.EncryptionKeyRotator
+	ports.ObjectHolder
+}
+
+func createScanner(scanningConfig config.Scanning) (ports.Scanner, error) {
+	switch scanningConfig.Scanner {
+	case "clamav":
+		return clamav.NewClient(scanningConfig.ClamdAddress, time.Duration(scanningConfig.Timeout)), nil
+	case "fake":
+		return adapters.NewFakeScanner(), nil
+	case "none", "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("app - createScanner: unknown scanner %q", scanningConfig.Scanner)
+	}
+}
+
+func createAuditUseCase(ctx context.Context, logger logger.Logger, auditConfig config.Audit, workers *Workers) (auditlog.UseCase, error) {
+	auditStore, err := auditAdapters.NewInMemoryAuditStore(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("app - createAuditUseCase: can't create audit store; %w", err)
+	}
+	useCase, err := auditlog.NewDefaultAuditLogUseCase(auditStore, adapters.NewGuidBasedIdGenerator(), time.Duration(auditConfig.Retention))
+	if err != nil {
+		return nil, fmt.Errorf("app - createAuditUseCase: %w", err)
+	}
+	retentionJob := auditlog.NewRetentionJob(useCase, logger, time.Duration(auditConfig.PurgeInterval))
+	retentionJob.Start(ctx)
+	workers.add(ctx, retentionJob.Wait)
+	return useCase, nil
+}
+
+func createWebhooksUseCase(ctx context.Context, logger logger.Logger, webhooksConfig config.Webhooks, eventBus *events.Bus, workers *Workers) (webhooks.UseCase, error) {
+	subscriptionRepository, err := webhooksAdapters.NewInMemorySubscriptionRepository(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("app - createWebhooksUseCase: can't create subscription repository; %w", err)
+	}
+	deadLetterStore, err := webhooksAdapters.NewInMemoryDeadLetterStore(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("app - createWebhooksUseCase: can't create dead letter store; %w", err)
 	}
-	fileService := gcloudstorage.NewGCloudStorageService(gcloudClient, gcloudConfig.ProjectName, gcloudConfig.BucketName, gCSCredentials)
-	fileRepository, err := adapters.NewInMemoryFilesRepository(ctx)
 	idGen := adapters.NewGuidBasedIdGenerator()
+	dispatcher := webhooks.NewDispatcher(subscriptionRepository, deadLetterStore, idGen, logger, webhooks.DeliveryPolicy{
+		Workers:             webhooksConfig.Workers,
+		QueueSize:           webhooksConfig.QueueSize,
+		MaxAttempts:         webhooksConfig.MaxAttempts,
+		InitialBackoff:      time.Duration(webhooksConfig.InitialBackoff),
+		MaxBackoff:          time.Duration(webhooksConfig.MaxBackoff),
+		Timeout:             time.Duration(webhooksConfig.Timeout),
+		AllowPrivateTargets: webhooksConfig.AllowPrivateTargets,
+	})
+	dispatcher.Start(ctx)
+	workers.add(ctx, dispatcher.Wait)
+	eventBus.Subscribe(dispatcher.Handle)
+	return webhooks.NewDefaultWebhooksUseCase(subscriptionRepository, deadLetterStore, idGen, webhooksConfig.AllowPrivateTargets)
+}
+
+func subscribeBroker(ctx context.Context, logger logger.Logger, brokerConfig config.Broker, eventBus *events.Bus, workers *Workers) error {
+	switch brokerConfig.Publisher {
+	case "pubsub":
+		client, err := pubsub.NewClient(ctx, brokerConfig.ProjectName)
+		if err != nil {
+			return fmt.Errorf("app - subscribeBroker: can't create Pub/Sub client; %w", err)
+		}
+		publisher := gcloudpubsub.NewPublisher(client, brokerConfig.Topic)
+		if brokerConfig.CreateTopic {
+			err = publisher.EnsureTopic(ctx, client)
+			if err != nil {
+				return fmt.Errorf("app - subscribeBroker: %w", err)
+			}
+		}
+		// The store lives in the process: events not yet published are lost on restart.
+		outbox := events.NewOutbox(events.NewInMemoryOutboxStore(brokerConfig.RelayRememberedEvents), publisher.Publish, logger,
+			time.Duration(brokerConfig.RelayInterval), brokerConfig.RelayBatchSize, brokerConfig.RelayMaxAttempts)
+		outbox.Start(ctx)
+		workers.add(ctx, func() {
+			outbox.Wait()
+			// the last events were handed over after the relay's final tick
+			drainCtx, cancel := context.WithTimeout(context.Background(), _outboxDrainTimeout)
+			defer cancel()
+			if _, err := outbox.Flush(drainCtx); err != nil {
+				logger.Error(fmt.Errorf("app - subscribeBroker - outbox.Flush: %w", err))
+			}
+			publisher.Stop()
+		})
+		eventBus.Subscribe(outbox.Handle)
+		return nil
+	case "none", "":
+		return nil
+	default:
+		return fmt.Errorf("app - subscribeBroker: unknown publisher %q", brokerConfig.Publisher)
+	}
+}
+
+func createSigner(ctx context.Context, gcloudConfig config.GCloudStorage) (gcloudstorage.Signer, error) {
+	switch gcloudConfig.Signer {
+	case "private_key":
+		privateKey, err := b64.StdEncoding.DecodeString(gcloudConfig.PrivateKeyBase64)
+		if err != nil {
+			return nil, fmt.Errorf("app - createSigner: can't decode private key; %w", err)
+		}
+		return gcloudstorage.NewPrivateKeySigner(gcloudConfig.AccessId, privateKey)
+	case "iam":
+		return gcloudstorage.NewIAMSigner(ctx, gcloudConfig.AccessId)
+	case "fake":
+		return gcloudstorage.NewFakeSigner(gcloudConfig.AccessId), nil
+	case "none", "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("app - createSigner: unknown signer %q", gcloudConfig.Signer)
+	}
+}
 
-	return files.NewDefaultFilesUseCase(fileService, fileRepository, idGen, gcloudConfig)
+func createKeyrings(tenantsConfig map[string]config.Tenant, mode string) (map[string]*encryption.Keyring, error) {
+	keyrings := make(map[string]*encryption.Keyring)
+	for tenant, tenantConfig := range tenantsConfig {
+		if tenantConfig.Encryption.Mode != mode {
+			continue
+		}
+		keys := make(map[string][]byte, len(tenantConfig.Encryption.Keys))
+		for id, encodedKey := range tenantConfig.Encryption.Keys {
+			key, err := b64.StdEncoding.DecodeString(encodedKey)
+			if err != nil {
+				return nil, fmt.Errorf("app - createKeyrings: can't decode key %q of tenant %q; %w", id, tenant, err)
+			}
+			keys[id] = key
+		}
+		keyring, err := encryption.NewKeyring(tenantConfig.Encryption.PrimaryKey, keys)
+		if err != nil {
+			return nil, fmt.Errorf("app - createKeyrings: invalid keyring of tenant %q; %w", tenant, err)
+		}
+		keyrings[tenant] = keyring
+	}
+	return keyrings, nil
 }
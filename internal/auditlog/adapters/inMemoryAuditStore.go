@@ -0,0 +1,76 @@
+package adapters
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/auditlog/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/audit"
+)
+
+type InMemoryAuditStore struct {
+	mu      sync.RWMutex
+	entries []audit.Entry
+}
+
+func NewInMemoryAuditStore(_ context.Context) (*InMemoryAuditStore, error) {
+	return &InMemoryAuditStore{}, nil
+}
+
+func (store *InMemoryAuditStore) Append(_ context.Context, entry *audit.Entry) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.entries = append(store.entries, *entry)
+	return nil
+}
+
+func (store *InMemoryAuditStore) ListBy(_ context.Context, tenant string, query models.ListEntriesQuery) (*[]audit.Entry, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	result := []audit.Entry{}
+	for i := len(store.entries) - 1; i >= 0; i-- {
+		entry := store.entries[i]
+		if entry.Tenant != tenant || !matches(entry, query) {
+			continue
+		}
+		result = append(result, entry)
+		if query.Limit > 0 && len(result) == query.Limit {
+			break
+		}
+	}
+	return &result, nil
+}
+
+func (store *InMemoryAuditStore) DeleteBefore(_ context.Context, before time.Time) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	kept := store.entries[:0]
+	for _, entry := range store.entries {
+		if !entry.OccurredAt.Before(before) {
+			kept = append(kept, entry)
+		}
+	}
+	deleted := len(store.entries) - len(kept)
+	store.entries = kept
+	return deleted, nil
+}
+
+func matches(entry audit.Entry, query models.ListEntriesQuery) bool {
+	if query.FileID != "" && entry.FileID != query.FileID {
+		return false
+	}
+	if query.ActorID != "" && entry.ActorID != query.ActorID {
+		return false
+	}
+	if query.Action != "" && entry.Action != query.Action {
+		return false
+	}
+	if !query.From.IsZero() && entry.OccurredAt.Before(query.From) {
+		return false
+	}
+	if !query.To.IsZero() && !entry.OccurredAt.Before(query.To) {
+		return false
+	}
+	return true
+}
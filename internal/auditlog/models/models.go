@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/audit"
+)
+
+// ListEntriesQuery narrows the audit trail; zero values match everything.
+type ListEntriesQuery struct {
+	FileID  string
+	ActorID string
+	Action  audit.Action
+	From    time.Time
+	To      time.Time
+	Limit   int
+}
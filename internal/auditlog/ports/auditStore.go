@@ -0,0 +1,17 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/auditlog/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/audit"
+)
+
+// AuditStore is append-only; entries leave it only once they are older than the retention period.
+type AuditStore interface {
+	Append(ctx context.Context, entry *audit.Entry) error
+	// ListBy returns matching entries of the tenant, newest first.
+	ListBy(ctx context.Context, tenant string, query models.ListEntriesQuery) (*[]audit.Entry, error)
+	DeleteBefore(ctx context.Context, before time.Time) (int, error)
+}
@@ -0,0 +1,5 @@
+package ports
+
+type IdGenerator interface {
+	MakeId() string
+}
@@ -0,0 +1,47 @@
+package auditlog
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/logger"
+)
+
+// RetentionJob purges expired audit entries periodically.
+type RetentionJob struct {
+	useCase  UseCase
+	logger   logger.Logger
+	interval time.Duration
+	wg       sync.WaitGroup
+}
+
+func NewRetentionJob(useCase UseCase, logger logger.Logger, interval time.Duration) *RetentionJob {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	return &RetentionJob{useCase: useCase, logger: logger, interval: interval}
+}
+
+func (job *RetentionJob) Start(ctx context.Context) {
+	job.wg.Add(1)
+	go func() {
+		defer job.wg.Done()
+		ticker := time.NewTicker(job.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := job.useCase.PurgeExpired(ctx); err != nil {
+					job.logger.Error(err, "auditlog - RetentionJob")
+				}
+			}
+		}
+	}()
+}
+
+func (job *RetentionJob) Wait() {
+	job.wg.Wait()
+}
@@ -0,0 +1,76 @@
+package auditlog
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/auditlog/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/audit"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/logger"
+)
+
+type ShowAuditQuery struct {
+	FileID  string    `form:"fileId"`
+	ActorID string    `form:"actorId"`
+	Action  string    `form:"action"`
+	From    time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To      time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit   int       `form:"limit" binding:"omitempty,min=1"`
+}
+
+type AuditEntries []audit.Entry
+
+func AppendAuditRoutes(handler *gin.RouterGroup, logger logger.Logger, useCase UseCase) {
+	handler.GET("/audit", showAuditEntries(logger, useCase))
+}
+
+// showAuditEntries godoc
+//
+// @Summary     Show audit trail
+// @Description Get audit entries of the tenant, newest first
+// @ID          get-audit-entries
+// @Tags  	    audit
+// @Produce     json
+// @Param		fileId	query	string	false "File id"
+// @Param		actorId	query	string	false "Actor id"
+// @Param		action	query	string	false "Action" Enums(upload, url_issued, download, delete, rotate_key, register, unregister, copy, move, link, unlink, update_metadata, legal_hold, release_legal_hold, share, revoke_share, shared_download, grant_access, revoke_access, set_retention_rule, unset_retention_rule)
+// @Param		from	query	string	false "Entries at or after, RFC 3339"
+// @Param		to	query	string	false "Entries before, RFC 3339"
+// @Param		limit	query	int	false "Maximum number of entries, 100 by default"
+// @Success     200 {object} AuditEntries
+// @Failure     400 {string} Error
+// @Failure     500 {string} Error
+// @Router      /audit [get]
+func showAuditEntries(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var query ShowAuditQuery
+		if err := ginCtx.ShouldBindQuery(&query); err != nil {
+			logger.Ctx(ctx).Debug(err, "auditlog - showAuditEntries")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		result, err := useCase.ListBy(ctx, "tenant1", models.ListEntriesQuery{
+			FileID:  query.FileID,
+			ActorID: query.ActorID,
+			Action:  audit.Action(query.Action),
+			From:    query.From,
+			To:      query.To,
+			Limit:   query.Limit,
+		})
+		if errors.Is(err, ErrInvalidQuery) {
+			logger.Ctx(ctx).Debug(err, "auditlog - showAuditEntries")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			logger.Ctx(ctx).Error(err, "auditlog - showAuditEntries")
+			ginCtx.String(http.StatusInternalServerError, "can't get audit entries")
+			return
+		}
+		ginCtx.JSON(http.StatusOK, *result)
+	}
+}
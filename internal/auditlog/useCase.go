@@ -0,0 +1,87 @@
+package auditlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/auditlog/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/auditlog/ports"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/audit"
+)
+
+const (
+	_defaultListLimit = 100
+	_maxListLimit     = 1000
+)
+
+var ErrInvalidQuery = errors.New("invalid audit query")
+
+type UseCase interface {
+	Record(ctx context.Context, entry audit.Entry) error
+	ListBy(ctx context.Context, tenant string, query models.ListEntriesQuery) (*[]audit.Entry, error)
+	PurgeExpired(ctx context.Context) (int, error)
+}
+
+type DefaultAuditLogUseCase struct {
+	store     ports.AuditStore
+	idGen     ports.IdGenerator
+	retention time.Duration
+}
+
+// NewDefaultAuditLogUseCase keeps entries for the retention period; zero keeps them forever.
+func NewDefaultAuditLogUseCase(store ports.AuditStore, idGen ports.IdGenerator, retention time.Duration) (*DefaultAuditLogUseCase, error) {
+	return &DefaultAuditLogUseCase{store: store, idGen: idGen, retention: retention}, nil
+}
+
+// Record stamps the entry with an id and the current time and fills the actor and IP address
+// from the request context. An actor set by the caller is kept.
+func (useCase *DefaultAuditLogUseCase) Record(ctx context.Context, entry audit.Entry) error {
+	actor := audit.ActorFrom(ctx)
+	if entry.ActorID == "" {
+		entry.ActorID = actor.ID
+	}
+	if entry.IP == "" {
+		entry.IP = actor.IP
+	}
+	entry.ID = useCase.idGen.MakeId()
+	entry.OccurredAt = time.Now().UTC()
+	err := useCase.store.Append(ctx, &entry)
+	if err != nil {
+		return fmt.Errorf("DefaultAuditLogUseCase - Record: can't append entry; %w", err)
+	}
+	return nil
+}
+
+func (useCase *DefaultAuditLogUseCase) ListBy(ctx context.Context, tenant string, query models.ListEntriesQuery) (*[]audit.Entry, error) {
+	if query.Limit == 0 {
+		query.Limit = _defaultListLimit
+	}
+	if query.Limit < 0 || query.Limit > _maxListLimit {
+		return nil, fmt.Errorf("DefaultAuditLogUseCase - ListBy: limit must be between 1 and %d; %w", _maxListLimit, ErrInvalidQuery)
+	}
+	if query.Action != "" && !query.Action.Known() {
+		return nil, fmt.Errorf("DefaultAuditLogUseCase - ListBy: unknown action %q; %w", query.Action, ErrInvalidQuery)
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		return nil, fmt.Errorf("DefaultAuditLogUseCase - ListBy: from must be before to; %w", ErrInvalidQuery)
+	}
+	entries, err := useCase.store.ListBy(ctx, tenant, query)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultAuditLogUseCase - ListBy: can't list entries; %w", err)
+	}
+	return entries, nil
+}
+
+// PurgeExpired deletes entries older than the retention period and returns how many were removed.
+func (useCase *DefaultAuditLogUseCase) PurgeExpired(ctx context.Context) (int, error) {
+	if useCase.retention <= 0 {
+		return 0, nil
+	}
+	deleted, err := useCase.store.DeleteBefore(ctx, time.Now().UTC().Add(-useCase.retention))
+	if err != nil {
+		return 0, fmt.Errorf("DefaultAuditLogUseCase - PurgeExpired: can't delete entries; %w", err)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,95 @@
+package files
+
+import (
+	"fmt"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/access"
+)
+
+var _roleRanks = map[models.Role]int{
+	models.RoleReader: 1,
+	models.RoleWriter: 2,
+	models.RoleOwner:  3,
+}
+
+// includesRole tells whether the granted role allows what the required one does.
+func includesRole(granted, required models.Role) bool {
+	return _roleRanks[granted] >= _roleRanks[required]
+}
+
+// callerRole is the highest role the grants give to the caller, directly or through its groups,
+// and empty when they give none.
+func callerRole(grants []models.Grant, caller access.Caller) models.Role {
+	var role models.Role
+	for _, grant := range grants {
+		granted := grant.PrincipalType == models.PrincipalUser && grant.PrincipalID == caller.ID ||
+			grant.PrincipalType == models.PrincipalGroup && caller.InGroup(grant.PrincipalID)
+		if granted && _roleRanks[grant.Role] > _roleRanks[role] {
+			role = grant.Role
+		}
+	}
+	return role
+}
+
+func ownerGrant(caller access.Caller) models.Grant {
+	return models.Grant{PrincipalType: models.PrincipalUser, PrincipalID: caller.ID, Role: models.RoleOwner}
+}
+
+func validateGrant(grant models.Grant) error {
+	if grant.PrincipalType != models.PrincipalUser && grant.PrincipalType != models.PrincipalGroup {
+		return fmt.Errorf("%w: principal type must be user or group", ErrInvalidGrant)
+	}
+	if grant.PrincipalID == "" {
+		return fmt.Errorf("%w: principal id is empty", ErrInvalidGrant)
+	}
+	if _, ok := _roleRanks[grant.Role]; !ok {
+		return fmt.Errorf("%w: role must be owner, writer or reader", ErrInvalidGrant)
+	}
+	return nil
+}
+
+// setGrant returns the grants with the one of the principal replaced or added.
+func setGrant(grants []models.Grant, grant models.Grant) []models.Grant {
+	result := make([]models.Grant, 0, len(grants)+1)
+	replaced := false
+	for _, existing := range grants {
+		if existing.PrincipalType == grant.PrincipalType && existing.PrincipalID == grant.PrincipalID {
+			existing, replaced = grant, true
+		}
+		result = append(result, existing)
+	}
+	if !replaced {
+		result = append(result, grant)
+	}
+	return result
+}
+
+// removeGrant returns the grants without the one of the principal and whether it was there.
+func removeGrant(grants []models.Grant, principalType models.PrincipalType, principalID string) ([]models.Grant, bool) {
+	result := make([]models.Grant, 0, len(grants))
+	for _, existing := range grants {
+		if existing.PrincipalType != principalType || existing.PrincipalID != principalID {
+			result = append(result, existing)
+		}
+	}
+	return result, len(result) < len(grants)
+}
+
+// checkOwnerKept fails when the change leaves grants that had an owner without one, since nobody
+// could manage them afterwards.
+func checkOwnerKept(before, after []models.Grant) error {
+	if hasOwner(before) && !hasOwner(after) {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+func hasOwner(grants []models.Grant) bool {
+	for _, grant := range grants {
+		if grant.Role == models.RoleOwner {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/regexp"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
+	index "github.com/blevesearch/bleve_index_api"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+)
+
+const (
+	_tenantField   = "tenant"
+	_fileIDField   = "fileId"
+	_fileNameField = "fileName"
+	_tagsField     = "tags"
+	_textField     = "text"
+	// _wordsAnalyzer splits on anything but letters and digits and ignores the case, so
+	// Invoice-2023.pdf is found by invoice, 2023 and pdf
+	_wordsAnalyzer = "words"
+)
+
+// BleveSearchIndex keeps documents of all tenants in a single bleve index, on disk or in memory.
+// Every query is limited to the documents of one tenant.
+type BleveSearchIndex struct {
+	index bleve.Index
+}
+
+// NewBleveSearchIndex opens the index at path, creating it when it doesn't exist yet. An empty
+// path keeps the index in memory.
+func NewBleveSearchIndex(path string) (*BleveSearchIndex, error) {
+	indexMapping, err := makeSearchMapping()
+	if err != nil {
+		return nil, fmt.Errorf("BleveSearchIndex - NewBleveSearchIndex: can't make index mapping; %w", err)
+	}
+	var searchIndex bleve.Index
+	if path == "" {
+		searchIndex, err = bleve.NewMemOnly(indexMapping)
+	} else {
+		searchIndex, err = bleve.Open(path)
+		if errors.Is(err, bleve.ErrorIndexPathDoesNotExist) {
+			searchIndex, err = bleve.New(path, indexMapping)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("BleveSearchIndex - NewBleveSearchIndex: can't open index; %w", err)
+	}
+	return &BleveSearchIndex{index: searchIndex}, nil
+}
+
+func makeSearchMapping() (*mapping.IndexMappingImpl, error) {
+	indexMapping := bleve.NewIndexMapping()
+	err := indexMapping.AddCustomTokenizer("letters_and_digits", map[string]interface{}{
+		"type":   regexp.Name,
+		"regexp": `[\p{L}\p{N}]+`,
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = indexMapping.AddCustomAnalyzer(_wordsAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     "letters_and_digits",
+		"token_filters": []string{lowercase.Name},
+	})
+	if err != nil {
+		return nil, err
+	}
+	keywordField := bleve.NewKeywordFieldMapping()
+	fileNameField := bleve.NewTextFieldMapping()
+	fileNameField.Analyzer = _wordsAnalyzer
+	textField := bleve.NewTextFieldMapping()
+	textField.Analyzer = _wordsAnalyzer
+	documentMapping := bleve.NewDocumentStaticMapping()
+	documentMapping.AddFieldMappingsAt(_tenantField, keywordField)
+	documentMapping.AddFieldMappingsAt(_fileIDField, keywordField)
+	documentMapping.AddFieldMappingsAt(_fileNameField, fileNameField)
+	documentMapping.AddFieldMappingsAt(_tagsField, keywordField)
+	documentMapping.AddFieldMappingsAt(_textField, textField)
+	indexMapping.DefaultMapping = documentMapping
+	return indexMapping, nil
+}
+
+func (searchIndex *BleveSearchIndex) Index(_ context.Context, tenant string, document models.SearchDocument) error {
+	err := searchIndex.index.Index(makeDocumentID(tenant, document.FileID), map[string]interface{}{
+		_tenantField:   tenant,
+		_fileIDField:   document.FileID,
+		_fileNameField: document.FileName,
+		_tagsField:     document.Tags,
+		_textField:     document.Text,
+	})
+	if err != nil {
+		return fmt.Errorf("BleveSearchIndex - Index: can't index document; %w", err)
+	}
+	return nil
+}
+
+func (searchIndex *BleveSearchIndex) Read(_ context.Context, tenant, fileID string) (*models.SearchDocument, error) {
+	stored, err := searchIndex.index.Document(makeDocumentID(tenant, fileID))
+	if err != nil {
+		return nil, fmt.Errorf("BleveSearchIndex - Read: can't read document; %w", err)
+	}
+	if stored == nil {
+		return nil, nil
+	}
+	document := &models.SearchDocument{FileID: fileID}
+	stored.VisitFields(func(field index.Field) {
+		switch field.Name() {
+		case _fileNameField:
+			document.FileName = string(field.Value())
+		case _tagsField:
+			document.Tags = append(document.Tags, string(field.Value()))
+		case _textField:
+			document.Text = string(field.Value())
+		}
+	})
+	return document, nil
+}
+
+func (searchIndex *BleveSearchIndex) Remove(_ context.Context, tenant, fileID string) error {
+	err := searchIndex.index.Delete(makeDocumentID(tenant, fileID))
+	if err != nil {
+		return fmt.Errorf("BleveSearchIndex - Remove: can't delete document; %w", err)
+	}
+	return nil
+}
+
+// Search matches every word of the query against the name, the tags and the text of files; a
+// word matches a tag only as a whole.
+func (searchIndex *BleveSearchIndex) Search(ctx context.Context, tenant, text string, limit int) ([]string, error) {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return nil, nil
+	}
+	tenantQuery := bleve.NewTermQuery(tenant)
+	tenantQuery.SetField(_tenantField)
+	conjuncts := []query.Query{tenantQuery}
+	for _, word := range words {
+		conjuncts = append(conjuncts, makeWordQuery(word))
+	}
+	request := bleve.NewSearchRequestOptions(bleve.NewConjunctionQuery(conjuncts...), limit, 0, false)
+	request.Fields = []string{_fileIDField}
+	result, err := searchIndex.index.SearchInContext(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("BleveSearchIndex - Search: can't search index; %w", err)
+	}
+	fileIDs := make([]string, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		if fileID, ok := hit.Fields[_fileIDField].(string); ok {
+			fileIDs = append(fileIDs, fileID)
+		}
+	}
+	return fileIDs, nil
+}
+
+// Close releases the index, which can't be used afterwards.
+func (searchIndex *BleveSearchIndex) Close() error {
+	return searchIndex.index.Close()
+}
+
+func makeWordQuery(word string) query.Query {
+	fileNameQuery := bleve.NewMatchQuery(word)
+	fileNameQuery.SetField(_fileNameField)
+	fileNameQuery.SetOperator(query.MatchQueryOperatorAnd)
+	tagQuery := bleve.NewTermQuery(strings.ToLower(word))
+	tagQuery.SetField(_tagsField)
+	textQuery := bleve.NewMatchQuery(word)
+	textQuery.SetField(_textField)
+	textQuery.SetOperator(query.MatchQueryOperatorAnd)
+	return bleve.NewDisjunctionQuery(fileNameQuery, tagQuery, textQuery)
+}
+
+func makeDocumentID(tenant, fileID string) string {
+	return tenant + "/" + fileID
+}
@@ -0,0 +1,145 @@
+package adapters
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/encryption"
+)
+
+// DefaultMaxEnvelopeFileSize caps files of envelope tenants, an envelope is sealed in one piece
+// so it's held whole in memory while it's encrypted or decrypted.
+const DefaultMaxEnvelopeFileSize int64 = 64 << 20
+
+// _maxEnvelopeOverhead bounds what an envelope adds to the file: its header, the wrapped key and the seal.
+const _maxEnvelopeOverhead = 1 << 10
+
+// EnvelopeEncryptingFileStorage encrypts files of tenants with a keyring before they reach
+// the underlying storage. Tenants without a keyring are passed through untouched.
+type EnvelopeEncryptingFileStorage struct {
+	next        ports.FileStorage
+	keyrings    map[string]*encryption.Keyring
+	maxFileSize int64
+}
+
+func NewEnvelopeEncryptingFileStorage(next ports.FileStorage, keyrings map[string]*encryption.Keyring, maxFileSize int64) *EnvelopeEncryptingFileStorage {
+	return &EnvelopeEncryptingFileStorage{
+		next:        next,
+		keyrings:    keyrings,
+		maxFileSize: maxFileSize,
+	}
+}
+
+func (storage *EnvelopeEncryptingFileStorage) UploadFile(ctx context.Context, tenant, fileName string, file []byte) error {
+	keyring, ok := storage.keyrings[tenant]
+	if !ok {
+		return storage.next.UploadFile(ctx, tenant, fileName, file)
+	}
+	if int64(len(file)) > storage.maxFileSize {
+		return fmt.Errorf("EnvelopeEncryptingFileStorage - UploadFile: file exceeds %d bytes; %w", storage.maxFileSize, ports.ErrFileTooLarge)
+	}
+	envelope, err := encryption.Seal(keyring, file)
+	if err != nil {
+		return fmt.Errorf("EnvelopeEncryptingFileStorage - UploadFile: can't encrypt file; %w", err)
+	}
+	return storage.next.UploadFile(ctx, tenant, fileName, envelope)
+}
+
+func (storage *EnvelopeEncryptingFileStorage) ReadFile(ctx context.Context, tenant, fileName string) (io.ReadCloser, error) {
+	keyring, ok := storage.keyrings[tenant]
+	if !ok {
+		return storage.next.ReadFile(ctx, tenant, fileName)
+	}
+	envelope, err := storage.readAll(ctx, tenant, fileName)
+	if err != nil {
+		return nil, fmt.Errorf("EnvelopeEncryptingFileStorage - ReadFile: %w", err)
+	}
+	plaintext, err := encryption.Open(keyring, envelope)
+	if err != nil {
+		return nil, fmt.Errorf("EnvelopeEncryptingFileStorage - ReadFile: can't decrypt file; %w", err)
+	}
+	return io.NopCloser(bytes.NewReader(plaintext)), nil
+}
+
+func (storage *EnvelopeEncryptingFileStorage) GetExpiringUrl(tenant, fileName string, options models.SignedUrlOptions) (string, error) {
+	if _, ok := storage.keyrings[tenant]; ok {
+		return "", fmt.Errorf("EnvelopeEncryptingFileStorage - GetExpiringUrl: file is encrypted by the application; %w", ports.ErrSignedUrlNotSupported)
+	}
+	return storage.next.GetExpiringUrl(tenant, fileName, options)
+}
+
+func (storage *EnvelopeEncryptingFileStorage) DeleteFile(ctx context.Context, tenant, fileName string) error {
+	return storage.next.DeleteFile(ctx, tenant, fileName)
+}
+
+// CopyFile copies the sealed content as is, the copy stays readable with the tenant's keyring.
+func (storage *EnvelopeEncryptingFileStorage) CopyFile(ctx context.Context, tenant, sourceName, targetName string) error {
+	return storage.next.CopyFile(ctx, tenant, sourceName, targetName)
+}
+
+// SetMetadata passes metadata through unencrypted, it's meant for labels the storage may show.
+func (storage *EnvelopeEncryptingFileStorage) SetMetadata(ctx context.Context, tenant, fileName string, metadata map[string]string) error {
+	return storage.next.SetMetadata(ctx, tenant, fileName, metadata)
+}
+
+// RotateEncryptionKey re-wraps the data key of a file with the tenant's primary key.
+// The underlying storage must replace the file in place, so it's never left without content.
+// It reports false when the file already uses the primary key.
+func (storage *EnvelopeEncryptingFileStorage) RotateEncryptionKey(ctx context.Context, tenant, fileName string) (bool, error) {
+	keyring, ok := storage.keyrings[tenant]
+	if !ok {
+		if rotator, ok := storage.next.(ports.EncryptionKeyRotator); ok {
+			return rotator.RotateEncryptionKey(ctx, tenant, fileName)
+		}
+		return false, nil
+	}
+	envelope, err := storage.readAll(ctx, tenant, fileName)
+	if err != nil {
+		return false, fmt.Errorf("EnvelopeEncryptingFileStorage - RotateEncryptionKey: %w", err)
+	}
+	rewrapped, rotated, err := encryption.Rewrap(keyring, envelope)
+	if err != nil {
+		return false, fmt.Errorf("EnvelopeEncryptingFileStorage - RotateEncryptionKey: can't rewrap data key; %w", err)
+	}
+	if !rotated {
+		return false, nil
+	}
+	replacer, ok := storage.next.(ports.FileReplacer)
+	if !ok {
+		return false, fmt.Errorf("EnvelopeEncryptingFileStorage - RotateEncryptionKey: %w", ports.ErrReplaceNotSupported)
+	}
+	if err := replacer.ReplaceFile(ctx, tenant, fileName, rewrapped); err != nil {
+		return false, fmt.Errorf("EnvelopeEncryptingFileStorage - RotateEncryptionKey: can't store rewrapped file; %w", err)
+	}
+	return true, nil
+}
+
+// SetHold holds the sealed object, keys of held files can't be rotated since it's replaced then.
+func (storage *EnvelopeEncryptingFileStorage) SetHold(ctx context.Context, tenant, fileName string, hold bool) error {
+	holder, ok := storage.next.(ports.ObjectHolder)
+	if !ok {
+		return ports.ErrObjectHoldsNotSupported
+	}
+	return holder.SetHold(ctx, tenant, fileName, hold)
+}
+
+func (storage *EnvelopeEncryptingFileStorage) readAll(ctx context.Context, tenant, fileName string) ([]byte, error) {
+	reader, err := storage.next.ReadFile(ctx, tenant, fileName)
+	if err != nil {
+		return nil, fmt.Errorf("can't open file; %w", err)
+	}
+	defer reader.Close()
+	limit := storage.maxFileSize + _maxEnvelopeOverhead
+	envelope, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("can't read file; %w", err)
+	}
+	if int64(len(envelope)) > limit {
+		return nil, fmt.Errorf("file exceeds %d bytes; %w", storage.maxFileSize, ports.ErrFileTooLarge)
+	}
+	return envelope, nil
+}
@@ -0,0 +1,34 @@
+package adapters
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+)
+
+const _eicarSignature = "Eicar-Test-Signature"
+
+var _eicarPattern = []byte(`X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`)
+
+// FakeScanner reports the EICAR test file as infected and everything else as clean.
+// It is meant for tests and local development without clamd.
+type FakeScanner struct {
+}
+
+func NewFakeScanner() *FakeScanner {
+	return &FakeScanner{}
+}
+
+func (scanner *FakeScanner) Scan(_ context.Context, content io.Reader) (models.ScanResult, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return models.ScanResult{}, fmt.Errorf("FakeScanner - Scan: can't read content; %w", err)
+	}
+	if bytes.Contains(data, _eicarPattern) {
+		return models.ScanResult{Infected: true, Signature: _eicarSignature}, nil
+	}
+	return models.ScanResult{}, nil
+}
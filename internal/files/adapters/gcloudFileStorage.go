@@ -0,0 +1,88 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/gcloudstorage"
+)
+
+// gcloudService is the bucket of the gcloudstorage package.
+type gcloudService interface {
+	UploadFile(ctx context.Context, tenant, fileName string, file []byte) error
+	ReplaceFile(ctx context.Context, tenant, fileName string, file []byte) error
+	ReadFile(ctx context.Context, tenant, fileName string) (io.ReadCloser, error)
+	MakeSignedUrl(tenant, fileName string, options gcloudstorage.SignedUrlOptions) (string, error)
+	DeleteFile(ctx context.Context, tenant, fileName string) error
+	CopyFile(ctx context.Context, tenant, sourceName, targetName string) error
+	SetMetadata(ctx context.Context, tenant, fileName string, metadata map[string]string) error
+	RotateEncryptionKey(ctx context.Context, tenant, fileName string) (bool, error)
+	SetHold(ctx context.Context, tenant, fileName string, hold bool) error
+}
+
+// GCloudFileStorage stores files in the bucket of the gcloudstorage service, translating its
+// options and errors to those of the ports.
+type GCloudFileStorage struct {
+	service gcloudService
+}
+
+func NewGCloudFileStorage(service gcloudService) *GCloudFileStorage {
+	return &GCloudFileStorage{service: service}
+}
+
+func (storage *GCloudFileStorage) UploadFile(ctx context.Context, tenant, fileName string, file []byte) error {
+	err := storage.service.UploadFile(ctx, tenant, fileName, file)
+	if errors.Is(err, gcloudstorage.ErrObjectExists) {
+		return fmt.Errorf("%v; %w", err, ports.ErrFileExists)
+	}
+	return err
+}
+
+func (storage *GCloudFileStorage) ReplaceFile(ctx context.Context, tenant, fileName string, file []byte) error {
+	return storage.service.ReplaceFile(ctx, tenant, fileName, file)
+}
+
+func (storage *GCloudFileStorage) ReadFile(ctx context.Context, tenant, fileName string) (io.ReadCloser, error) {
+	return storage.service.ReadFile(ctx, tenant, fileName)
+}
+
+func (storage *GCloudFileStorage) GetExpiringUrl(tenant, fileName string, options models.SignedUrlOptions) (string, error) {
+	url, err := storage.service.MakeSignedUrl(tenant, fileName, gcloudstorage.SignedUrlOptions{
+		Expiry:      options.Expiry,
+		Method:      options.Method,
+		Headers:     options.Headers,
+		ContentType: options.ContentType,
+	})
+	if errors.Is(err, gcloudstorage.ErrSignedUrlNotSupported) {
+		return "", fmt.Errorf("%v; %w", err, ports.ErrSignedUrlNotSupported)
+	}
+	return url, err
+}
+
+func (storage *GCloudFileStorage) DeleteFile(ctx context.Context, tenant, fileName string) error {
+	err := storage.service.DeleteFile(ctx, tenant, fileName)
+	if errors.Is(err, gcloudstorage.ErrObjectNotExist) {
+		return fmt.Errorf("%v; %w", err, ports.ErrFileNotFound)
+	}
+	return err
+}
+
+func (storage *GCloudFileStorage) CopyFile(ctx context.Context, tenant, sourceName, targetName string) error {
+	return storage.service.CopyFile(ctx, tenant, sourceName, targetName)
+}
+
+func (storage *GCloudFileStorage) SetMetadata(ctx context.Context, tenant, fileName string, metadata map[string]string) error {
+	return storage.service.SetMetadata(ctx, tenant, fileName, metadata)
+}
+
+func (storage *GCloudFileStorage) RotateEncryptionKey(ctx context.Context, tenant, fileName string) (bool, error) {
+	return storage.service.RotateEncryptionKey(ctx, tenant, fileName)
+}
+
+func (storage *GCloudFileStorage) SetHold(ctx context.Context, tenant, fileName string, hold bool) error {
+	return storage.service.SetHold(ctx, tenant, fileName, hold)
+}
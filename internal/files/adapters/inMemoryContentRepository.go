@@ -0,0 +1,48 @@
+package adapters
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type contentKey struct {
+	tenant     string
+	objectName string
+}
+
+// InMemoryContentRepository keeps reference counts in the process, next to the in-memory file records.
+type InMemoryContentRepository struct {
+	mu     sync.Mutex
+	counts map[contentKey]int
+}
+
+func NewInMemoryContentRepository() *InMemoryContentRepository {
+	return &InMemoryContentRepository{
+		counts: make(map[contentKey]int),
+	}
+}
+
+func (repository *InMemoryContentRepository) Acquire(_ context.Context, tenant, objectName string) (bool, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	key := contentKey{tenant: tenant, objectName: objectName}
+	repository.counts[key]++
+	return repository.counts[key] == 1, nil
+}
+
+func (repository *InMemoryContentRepository) Release(_ context.Context, tenant, objectName string) (bool, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	key := contentKey{tenant: tenant, objectName: objectName}
+	count, ok := repository.counts[key]
+	if !ok {
+		return false, fmt.Errorf("InMemoryContentRepository - Release: object %s isn't counted", objectName)
+	}
+	if count == 1 {
+		delete(repository.counts, key)
+		return true, nil
+	}
+	repository.counts[key] = count - 1
+	return false, nil
+}
@@ -0,0 +1,80 @@
+package adapters
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+)
+
+type usageKey struct {
+	tenant      string
+	referenceID string
+}
+
+// InMemoryQuotaStore keeps usage in the process, next to the in-memory file records it counts.
+type InMemoryQuotaStore struct {
+	mu    sync.Mutex
+	usage map[usageKey]models.UsageCounters
+}
+
+func NewInMemoryQuotaStore() *InMemoryQuotaStore {
+	return &InMemoryQuotaStore{
+		usage: make(map[usageKey]models.UsageCounters),
+	}
+}
+
+func (store *InMemoryQuotaStore) Reserve(_ context.Context, tenant, referenceID string, size int64, limits models.QuotaLimits) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	tenantKey := usageKey{tenant: tenant}
+	referenceKey := usageKey{tenant: tenant, referenceID: referenceID}
+	tenantUsage := store.usage[tenantKey]
+	referenceUsage := store.usage[referenceKey]
+	if exceeds(tenantUsage, size, limits.MaxBytes, limits.MaxFiles) {
+		return fmt.Errorf("InMemoryQuotaStore - Reserve: tenant %s; %w", tenant, ports.ErrQuotaExceeded)
+	}
+	if exceeds(referenceUsage, size, limits.MaxReferenceBytes, limits.MaxReferenceFiles) {
+		return fmt.Errorf("InMemoryQuotaStore - Reserve: reference %s; %w", referenceID, ports.ErrQuotaExceeded)
+	}
+	store.usage[tenantKey] = models.UsageCounters{Bytes: tenantUsage.Bytes + size, Files: tenantUsage.Files + 1}
+	store.usage[referenceKey] = models.UsageCounters{Bytes: referenceUsage.Bytes + size, Files: referenceUsage.Files + 1}
+	return nil
+}
+
+func (store *InMemoryQuotaStore) Release(_ context.Context, tenant, referenceID string, size int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.release(usageKey{tenant: tenant}, size)
+	store.release(usageKey{tenant: tenant, referenceID: referenceID}, size)
+	return nil
+}
+
+func (store *InMemoryQuotaStore) Usage(_ context.Context, tenant, referenceID string) (models.UsageCounters, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.usage[usageKey{tenant: tenant, referenceID: referenceID}], nil
+}
+
+func (store *InMemoryQuotaStore) release(key usageKey, size int64) {
+	usage, ok := store.usage[key]
+	if !ok {
+		return
+	}
+	usage.Bytes -= size
+	usage.Files--
+	if usage.Files <= 0 {
+		delete(store.usage, key)
+		return
+	}
+	if usage.Bytes < 0 {
+		usage.Bytes = 0
+	}
+	store.usage[key] = usage
+}
+
+func exceeds(usage models.UsageCounters, size, maxBytes int64, maxFiles int) bool {
+	return (maxBytes > 0 && usage.Bytes+size > maxBytes) || (maxFiles > 0 && usage.Files+1 > maxFiles)
+}
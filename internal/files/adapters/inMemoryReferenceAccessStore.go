@@ -0,0 +1,68 @@
+package adapters
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+)
+
+type accessKey struct {
+	tenant      string
+	referenceID string
+}
+
+// InMemoryReferenceAccessStore keeps grants on references in the process, in the order they were
+// first given.
+type InMemoryReferenceAccessStore struct {
+	mu     sync.RWMutex
+	grants map[accessKey][]models.Grant
+}
+
+func NewInMemoryReferenceAccessStore() *InMemoryReferenceAccessStore {
+	return &InMemoryReferenceAccessStore{
+		grants: make(map[accessKey][]models.Grant),
+	}
+}
+
+func (store *InMemoryReferenceAccessStore) Grant(_ context.Context, tenant, referenceID string, grant models.Grant) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	key := accessKey{tenant, referenceID}
+	for i, existing := range store.grants[key] {
+		if existing.PrincipalType == grant.PrincipalType && existing.PrincipalID == grant.PrincipalID {
+			store.grants[key][i] = grant
+			return nil
+		}
+	}
+	store.grants[key] = append(store.grants[key], grant)
+	return nil
+}
+
+func (store *InMemoryReferenceAccessStore) Revoke(_ context.Context, tenant, referenceID string, principalType models.PrincipalType, principalID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	key := accessKey{tenant, referenceID}
+	grants := store.grants[key]
+	for i, existing := range grants {
+		if existing.PrincipalType == principalType && existing.PrincipalID == principalID {
+			store.grants[key] = append(grants[:i:i], grants[i+1:]...)
+			if len(store.grants[key]) == 0 {
+				delete(store.grants, key)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("InMemoryReferenceAccessStore - Revoke: %s %s; %w", principalType, principalID, ports.ErrGrantNotFound)
+}
+
+func (store *InMemoryReferenceAccessStore) List(_ context.Context, tenant, referenceID string) ([]models.Grant, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	grants := store.grants[accessKey{tenant, referenceID}]
+	result := make([]models.Grant, len(grants))
+	copy(result, grants)
+	return result, nil
+}
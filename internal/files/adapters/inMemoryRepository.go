@@ -2,21 +2,39 @@ package adapters
 
 import (
 	"context"
+	"fmt"
+	"sync"
 
 	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
 )
 
 type InMemoryFilesRepository struct {
+	mu    sync.RWMutex
 	files map[string][]models.File
+	links map[fileKey][]string
+}
+
+type fileKey struct {
+	tenant string
+	fileID string
 }
 
 func NewInMemoryFilesRepository(_ context.Context) (*InMemoryFilesRepository, error) {
 	return &InMemoryFilesRepository{
 		files: make(map[string][]models.File),
+		links: make(map[fileKey][]string),
 	}, nil
 }
 
+// Ping always succeeds, the repository lives in the process.
+func (repository *InMemoryFilesRepository) Ping(_ context.Context) error {
+	return nil
+}
+
 func (repository *InMemoryFilesRepository) ListBy(_ context.Context, tenant, referenceID string) (*[]models.File, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
 	data, ok := repository.files[tenant]
 	if !ok {
 		return &[]models.File{}, nil
@@ -24,7 +42,7 @@ func (repository *InMemoryFilesRepository) ListBy(_ context.Context, tenant, ref
 	var result []models.File
 
 	for i := range data {
-		if data[i].ReferenceID == referenceID {
+		if indexOf(repository.links[fileKey{tenant, data[i].ID}], referenceID) >= 0 {
 			result = append(result, data[i])
 		}
 	}
@@ -32,6 +50,8 @@ func (repository *InMemoryFilesRepository) ListBy(_ context.Context, tenant, ref
 }
 
 func (repository *InMemoryFilesRepository) ReadBy(_ context.Context, tenant, fileID string) (*models.File, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
 	data, ok := repository.files[tenant]
 	if !ok {
 		return &models.File{}, nil
@@ -39,23 +59,92 @@ func (repository *InMemoryFilesRepository) ReadBy(_ context.Context, tenant, fil
 
 	for i := range data {
 		if data[i].ID == fileID {
-			return &data[i], nil
+			file := data[i]
+			return &file, nil
 		}
 	}
 	return nil, nil
 }
 
 func (repository *InMemoryFilesRepository) Add(_ context.Context, tenant string, file *models.File) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
 	data, ok := repository.files[tenant]
 	if !ok {
 		repository.files[tenant] = []models.File{}
 		data = repository.files[tenant]
 	}
 	repository.files[tenant] = append(data, *file)
+	repository.links[fileKey{tenant, file.ID}] = []string{file.ReferenceID}
+	return nil
+}
+
+func (repository *InMemoryFilesRepository) Update(_ context.Context, tenant string, file *models.File) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	data := repository.files[tenant]
+	for i := range data {
+		if data[i].ID == file.ID {
+			if data[i].ReferenceID != file.ReferenceID {
+				repository.moveLink(fileKey{tenant, file.ID}, data[i].ReferenceID, file.ReferenceID)
+			}
+			stored := data[i]
+			data[i] = *file
+			data[i].Status = stored.Status
+			data[i].Thumbnails = stored.Thumbnails
+			data[i].ObjectName = stored.ObjectName
+			data[i].ContentHash = stored.ContentHash
+			break
+		}
+	}
 	return nil
 }
 
+func (repository *InMemoryFilesRepository) UpdateStatus(_ context.Context, tenant, fileID string, status models.FileStatus) error {
+	repository.update(tenant, fileID, func(file *models.File) {
+		file.Status = status
+	})
+	return nil
+}
+
+func (repository *InMemoryFilesRepository) UpdateThumbnails(_ context.Context, tenant, fileID string, thumbnails []models.Thumbnail) error {
+	repository.update(tenant, fileID, func(file *models.File) {
+		file.Thumbnails = thumbnails
+	})
+	return nil
+}
+
+func (repository *InMemoryFilesRepository) Unshare(_ context.Context, tenant, fileID, objectName string) error {
+	repository.update(tenant, fileID, func(file *models.File) {
+		file.ContentHash = ""
+		file.ObjectName = objectName
+	})
+	return nil
+}
+
+func (repository *InMemoryFilesRepository) UpdateObject(_ context.Context, tenant, fileID, objectName string, thumbnails []models.Thumbnail) error {
+	repository.update(tenant, fileID, func(file *models.File) {
+		file.ObjectName = objectName
+		file.Thumbnails = thumbnails
+	})
+	return nil
+}
+
+func (repository *InMemoryFilesRepository) update(tenant, fileID string, change func(file *models.File)) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	data := repository.files[tenant]
+	for i := range data {
+		if data[i].ID == fileID {
+			change(&data[i])
+			return
+		}
+	}
+}
+
 func (repository *InMemoryFilesRepository) Delete(_ context.Context, tenant, fileID string) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
 	data, ok := repository.files[tenant]
 	if !ok {
 		return nil
@@ -63,8 +152,95 @@ func (repository *InMemoryFilesRepository) Delete(_ context.Context, tenant, fil
 	for i := range data {
 		if data[i].ID == fileID {
 			repository.files[tenant] = append(data[:i], data[i+1:]...)
+			delete(repository.links, fileKey{tenant, fileID})
 			break
 		}
 	}
 	return nil
 }
+
+func (repository *InMemoryFilesRepository) Search(_ context.Context, tenant string, filter models.FileFilter) (*[]models.File, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+	var result []models.File
+	for _, file := range repository.files[tenant] {
+		if matches(&file, filter) {
+			result = append(result, file)
+		}
+	}
+	return &result, nil
+}
+
+func matches(file *models.File, filter models.FileFilter) bool {
+	for _, tag := range filter.Tags {
+		if indexOf(file.Tags, tag) < 0 {
+			return false
+		}
+	}
+	for key, value := range filter.Metadata {
+		if actual, ok := file.Metadata[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (repository *InMemoryFilesRepository) Link(_ context.Context, tenant, fileID, referenceID string) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	key := fileKey{tenant, fileID}
+	links, ok := repository.links[key]
+	if !ok {
+		return fmt.Errorf("InMemoryFilesRepository - Link: file %s doesn't exist", fileID)
+	}
+	if indexOf(links, referenceID) < 0 {
+		repository.links[key] = append(links, referenceID)
+	}
+	return nil
+}
+
+func (repository *InMemoryFilesRepository) Unlink(_ context.Context, tenant, fileID, referenceID string) ([]string, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	key := fileKey{tenant, fileID}
+	links := repository.links[key]
+	i := indexOf(links, referenceID)
+	if i < 0 {
+		return nil, ports.ErrLinkNotFound
+	}
+	remaining := append(append([]string{}, links[:i]...), links[i+1:]...)
+	repository.links[key] = remaining
+	return append([]string{}, remaining...), nil
+}
+
+func (repository *InMemoryFilesRepository) ListLinks(_ context.Context, tenant, fileID string) ([]string, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+	return append([]string{}, repository.links[fileKey{tenant, fileID}]...), nil
+}
+
+// moveLink replaces the link to the previous owner, keeping the position; when the new owner is
+// already linked the old link is just dropped.
+func (repository *InMemoryFilesRepository) moveLink(key fileKey, from, to string) {
+	links := repository.links[key]
+	if indexOf(links, to) >= 0 {
+		if i := indexOf(links, from); i >= 0 {
+			repository.links[key] = append(append([]string{}, links[:i]...), links[i+1:]...)
+		}
+		return
+	}
+	if i := indexOf(links, from); i >= 0 {
+		links[i] = to
+		return
+	}
+	repository.links[key] = append(links, to)
+}
+
+func indexOf(values []string, value string) int {
+	for i := range values {
+		if values[i] == value {
+			return i
+		}
+	}
+	return -1
+}
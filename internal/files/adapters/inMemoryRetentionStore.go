@@ -0,0 +1,73 @@
+package adapters
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+)
+
+// InMemoryRetentionStore keeps retention rules in the process, by tenant and reference.
+type InMemoryRetentionStore struct {
+	mu    sync.RWMutex
+	rules map[string]map[string]models.RetentionRule
+}
+
+func NewInMemoryRetentionStore() *InMemoryRetentionStore {
+	return &InMemoryRetentionStore{
+		rules: make(map[string]map[string]models.RetentionRule),
+	}
+}
+
+func (store *InMemoryRetentionStore) Set(_ context.Context, tenant string, rule models.RetentionRule) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	tenantRules, ok := store.rules[tenant]
+	if !ok {
+		tenantRules = make(map[string]models.RetentionRule)
+		store.rules[tenant] = tenantRules
+	}
+	tenantRules[rule.ReferenceID] = rule
+	return nil
+}
+
+func (store *InMemoryRetentionStore) Remove(_ context.Context, tenant, referenceID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.rules[tenant][referenceID]; !ok {
+		return fmt.Errorf("InMemoryRetentionStore - Remove: reference %q; %w", referenceID, ports.ErrRetentionRuleNotFound)
+	}
+	delete(store.rules[tenant], referenceID)
+	if len(store.rules[tenant]) == 0 {
+		delete(store.rules, tenant)
+	}
+	return nil
+}
+
+// List returns the rule of the whole tenant first, followed by rules of references by id.
+func (store *InMemoryRetentionStore) List(_ context.Context, tenant string) ([]models.RetentionRule, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	result := make([]models.RetentionRule, 0, len(store.rules[tenant]))
+	for _, rule := range store.rules[tenant] {
+		result = append(result, rule)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ReferenceID < result[j].ReferenceID
+	})
+	return result, nil
+}
+
+func (store *InMemoryRetentionStore) Tenants(_ context.Context) ([]string, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	result := make([]string, 0, len(store.rules))
+	for tenant := range store.rules {
+		result = append(result, tenant)
+	}
+	sort.Strings(result)
+	return result, nil
+}
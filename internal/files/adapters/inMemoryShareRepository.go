@@ -0,0 +1,111 @@
+package adapters
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+)
+
+// InMemoryShareRepository keeps shares of all tenants in the process, by token.
+type InMemoryShareRepository struct {
+	mu     sync.RWMutex
+	shares map[string]models.Share
+}
+
+func NewInMemoryShareRepository() *InMemoryShareRepository {
+	return &InMemoryShareRepository{
+		shares: make(map[string]models.Share),
+	}
+}
+
+func (repository *InMemoryShareRepository) Add(_ context.Context, share *models.Share) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	if _, ok := repository.shares[share.Token]; ok {
+		return fmt.Errorf("InMemoryShareRepository - Add: share %s already exists", share.Token)
+	}
+	repository.shares[share.Token] = *share
+	return nil
+}
+
+func (repository *InMemoryShareRepository) ReadBy(_ context.Context, token string) (*models.Share, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+	share, ok := repository.shares[token]
+	if !ok {
+		return nil, nil
+	}
+	return &share, nil
+}
+
+// ListBy returns shares of the file, the oldest first.
+func (repository *InMemoryShareRepository) ListBy(_ context.Context, tenant, fileID string) ([]models.Share, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+	var result []models.Share
+	for _, share := range repository.shares {
+		if share.Tenant == tenant && share.FileID == fileID {
+			result = append(result, share)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].CreatedAt != result[j].CreatedAt {
+			return result[i].CreatedAt < result[j].CreatedAt
+		}
+		return result[i].Token < result[j].Token
+	})
+	return result, nil
+}
+
+func (repository *InMemoryShareRepository) Delete(_ context.Context, tenant, token string) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	share, ok := repository.shares[token]
+	if !ok || share.Tenant != tenant {
+		return fmt.Errorf("InMemoryShareRepository - Delete: %w", ports.ErrShareNotFound)
+	}
+	delete(repository.shares, token)
+	return nil
+}
+
+func (repository *InMemoryShareRepository) DeleteBy(_ context.Context, tenant, fileID string) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	for token, share := range repository.shares {
+		if share.Tenant == tenant && share.FileID == fileID {
+			delete(repository.shares, token)
+		}
+	}
+	return nil
+}
+
+func (repository *InMemoryShareRepository) CountDownload(_ context.Context, token string) (*models.Share, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	share, ok := repository.shares[token]
+	if !ok {
+		return nil, fmt.Errorf("InMemoryShareRepository - CountDownload: %w", ports.ErrShareNotFound)
+	}
+	if share.MaxDownloads > 0 && share.Downloads >= share.MaxDownloads {
+		return nil, fmt.Errorf("InMemoryShareRepository - CountDownload: %w", ports.ErrShareExhausted)
+	}
+	share.Downloads++
+	repository.shares[token] = share
+	return &share, nil
+}
+
+func (repository *InMemoryShareRepository) CountFailedAttempt(_ context.Context, token string) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	share, ok := repository.shares[token]
+	if !ok {
+		return fmt.Errorf("InMemoryShareRepository - CountFailedAttempt: %w", ports.ErrShareNotFound)
+	}
+	share.FailedAttempts++
+	repository.shares[token] = share
+	return nil
+}
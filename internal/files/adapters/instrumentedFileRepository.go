@@ -0,0 +1,111 @@
+package adapters
+
+import (
+	"context"
+	"time"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/metrics"
+)
+
+// InstrumentedFileRepository records latency and errors of the wrapped repository.
+type InstrumentedFileRepository struct {
+	next    ports.FileRepository
+	metrics *metrics.Metrics
+}
+
+func NewInstrumentedFileRepository(next ports.FileRepository, metrics *metrics.Metrics) *InstrumentedFileRepository {
+	return &InstrumentedFileRepository{next: next, metrics: metrics}
+}
+
+func (repository *InstrumentedFileRepository) ListBy(ctx context.Context, tenant, referenceID string) (*[]models.File, error) {
+	start := time.Now()
+	result, err := repository.next.ListBy(ctx, tenant, referenceID)
+	repository.metrics.ObserveCall(metrics.PortFileRepository, "ListBy", time.Since(start), err)
+	return result, err
+}
+
+func (repository *InstrumentedFileRepository) ReadBy(ctx context.Context, tenant, fileID string) (*models.File, error) {
+	start := time.Now()
+	result, err := repository.next.ReadBy(ctx, tenant, fileID)
+	repository.metrics.ObserveCall(metrics.PortFileRepository, "ReadBy", time.Since(start), err)
+	return result, err
+}
+
+func (repository *InstrumentedFileRepository) Add(ctx context.Context, tenant string, file *models.File) error {
+	start := time.Now()
+	err := repository.next.Add(ctx, tenant, file)
+	repository.metrics.ObserveCall(metrics.PortFileRepository, "Add", time.Since(start), err)
+	return err
+}
+
+func (repository *InstrumentedFileRepository) Update(ctx context.Context, tenant string, file *models.File) error {
+	start := time.Now()
+	err := repository.next.Update(ctx, tenant, file)
+	repository.metrics.ObserveCall(metrics.PortFileRepository, "Update", time.Since(start), err)
+	return err
+}
+
+func (repository *InstrumentedFileRepository) UpdateStatus(ctx context.Context, tenant, fileID string, status models.FileStatus) error {
+	start := time.Now()
+	err := repository.next.UpdateStatus(ctx, tenant, fileID, status)
+	repository.metrics.ObserveCall(metrics.PortFileRepository, "UpdateStatus", time.Since(start), err)
+	return err
+}
+
+func (repository *InstrumentedFileRepository) UpdateThumbnails(ctx context.Context, tenant, fileID string, thumbnails []models.Thumbnail) error {
+	start := time.Now()
+	err := repository.next.UpdateThumbnails(ctx, tenant, fileID, thumbnails)
+	repository.metrics.ObserveCall(metrics.PortFileRepository, "UpdateThumbnails", time.Since(start), err)
+	return err
+}
+
+func (repository *InstrumentedFileRepository) Unshare(ctx context.Context, tenant, fileID, objectName string) error {
+	start := time.Now()
+	err := repository.next.Unshare(ctx, tenant, fileID, objectName)
+	repository.metrics.ObserveCall(metrics.PortFileRepository, "Unshare", time.Since(start), err)
+	return err
+}
+
+func (repository *InstrumentedFileRepository) UpdateObject(ctx context.Context, tenant, fileID, objectName string, thumbnails []models.Thumbnail) error {
+	start := time.Now()
+	err := repository.next.UpdateObject(ctx, tenant, fileID, objectName, thumbnails)
+	repository.metrics.ObserveCall(metrics.PortFileRepository, "UpdateObject", time.Since(start), err)
+	return err
+}
+
+func (repository *InstrumentedFileRepository) Delete(ctx context.Context, tenant, fileID string) error {
+	start := time.Now()
+	err := repository.next.Delete(ctx, tenant, fileID)
+	repository.metrics.ObserveCall(metrics.PortFileRepository, "Delete", time.Since(start), err)
+	return err
+}
+
+func (repository *InstrumentedFileRepository) Search(ctx context.Context, tenant string, filter models.FileFilter) (*[]models.File, error) {
+	start := time.Now()
+	result, err := repository.next.Search(ctx, tenant, filter)
+	repository.metrics.ObserveCall(metrics.PortFileRepository, "Search", time.Since(start), err)
+	return result, err
+}
+
+func (repository *InstrumentedFileRepository) Link(ctx context.Context, tenant, fileID, referenceID string) error {
+	start := time.Now()
+	err := repository.next.Link(ctx, tenant, fileID, referenceID)
+	repository.metrics.ObserveCall(metrics.PortFileRepository, "Link", time.Since(start), err)
+	return err
+}
+
+func (repository *InstrumentedFileRepository) Unlink(ctx context.Context, tenant, fileID, referenceID string) ([]string, error) {
+	start := time.Now()
+	result, err := repository.next.Unlink(ctx, tenant, fileID, referenceID)
+	repository.metrics.ObserveCall(metrics.PortFileRepository, "Unlink", time.Since(start), err)
+	return result, err
+}
+
+func (repository *InstrumentedFileRepository) ListLinks(ctx context.Context, tenant, fileID string) ([]string, error) {
+	start := time.Now()
+	result, err := repository.next.ListLinks(ctx, tenant, fileID)
+	repository.metrics.ObserveCall(metrics.PortFileRepository, "ListLinks", time.Since(start), err)
+	return result, err
+}
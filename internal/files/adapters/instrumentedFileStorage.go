@@ -0,0 +1,116 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/metrics"
+)
+
+// InstrumentedFileStorage records latency, errors and transferred bytes of the wrapped storage.
+type InstrumentedFileStorage struct {
+	next    ports.FileStorage
+	metrics *metrics.Metrics
+}
+
+func NewInstrumentedFileStorage(next ports.FileStorage, metrics *metrics.Metrics) *InstrumentedFileStorage {
+	return &InstrumentedFileStorage{next: next, metrics: metrics}
+}
+
+func (storage *InstrumentedFileStorage) UploadFile(ctx context.Context, tenant, fileName string, file []byte) error {
+	done := storage.metrics.UploadStarted(len(file))
+	start := time.Now()
+	err := storage.next.UploadFile(ctx, tenant, fileName, file)
+	storage.metrics.ObserveCall(metrics.PortFileStorage, "UploadFile", time.Since(start), err)
+	done(err)
+	return err
+}
+
+func (storage *InstrumentedFileStorage) ReadFile(ctx context.Context, tenant, fileName string) (io.ReadCloser, error) {
+	start := time.Now()
+	content, err := storage.next.ReadFile(ctx, tenant, fileName)
+	storage.metrics.ObserveCall(metrics.PortFileStorage, "ReadFile", time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+	return &countingReadCloser{ReadCloser: content, metrics: storage.metrics}, nil
+}
+
+func (storage *InstrumentedFileStorage) GetExpiringUrl(tenant, fileName string, options models.SignedUrlOptions) (string, error) {
+	start := time.Now()
+	url, err := storage.next.GetExpiringUrl(tenant, fileName, options)
+	if errors.Is(err, ports.ErrSignedUrlNotSupported) {
+		// an expected answer for application-encrypted files, not a failure
+		storage.metrics.ObserveCall(metrics.PortFileStorage, "GetExpiringUrl", time.Since(start), nil)
+		return url, err
+	}
+	storage.metrics.ObserveCall(metrics.PortFileStorage, "GetExpiringUrl", time.Since(start), err)
+	return url, err
+}
+
+func (storage *InstrumentedFileStorage) DeleteFile(ctx context.Context, tenant, fileName string) error {
+	start := time.Now()
+	err := storage.next.DeleteFile(ctx, tenant, fileName)
+	storage.metrics.ObserveCall(metrics.PortFileStorage, "DeleteFile", time.Since(start), err)
+	return err
+}
+
+func (storage *InstrumentedFileStorage) CopyFile(ctx context.Context, tenant, sourceName, targetName string) error {
+	start := time.Now()
+	err := storage.next.CopyFile(ctx, tenant, sourceName, targetName)
+	storage.metrics.ObserveCall(metrics.PortFileStorage, "CopyFile", time.Since(start), err)
+	return err
+}
+
+func (storage *InstrumentedFileStorage) SetMetadata(ctx context.Context, tenant, fileName string, metadata map[string]string) error {
+	start := time.Now()
+	err := storage.next.SetMetadata(ctx, tenant, fileName, metadata)
+	storage.metrics.ObserveCall(metrics.PortFileStorage, "SetMetadata", time.Since(start), err)
+	return err
+}
+
+// RotateEncryptionKey keeps key rotation available when the wrapped storage supports it.
+func (storage *InstrumentedFileStorage) RotateEncryptionKey(ctx context.Context, tenant, fileName string) (bool, error) {
+	rotator, ok := storage.next.(ports.EncryptionKeyRotator)
+	if !ok {
+		return false, nil
+	}
+	start := time.Now()
+	rotated, err := rotator.RotateEncryptionKey(ctx, tenant, fileName)
+	storage.metrics.ObserveCall(metrics.PortFileStorage, "RotateEncryptionKey", time.Since(start), err)
+	return rotated, err
+}
+
+// SetHold keeps object holds available when the wrapped storage supports them.
+func (storage *InstrumentedFileStorage) SetHold(ctx context.Context, tenant, fileName string, hold bool) error {
+	holder, ok := storage.next.(ports.ObjectHolder)
+	if !ok {
+		return ports.ErrObjectHoldsNotSupported
+	}
+	start := time.Now()
+	err := holder.SetHold(ctx, tenant, fileName, hold)
+	storage.metrics.ObserveCall(metrics.PortFileStorage, "SetHold", time.Since(start), err)
+	return err
+}
+
+// countingReadCloser reports the number of bytes read once the download is closed.
+type countingReadCloser struct {
+	io.ReadCloser
+	metrics *metrics.Metrics
+	read    int64
+}
+
+func (reader *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := reader.ReadCloser.Read(p)
+	reader.read += int64(n)
+	return n, err
+}
+
+func (reader *countingReadCloser) Close() error {
+	reader.metrics.ObserveDownload(reader.read)
+	return reader.ReadCloser.Close()
+}
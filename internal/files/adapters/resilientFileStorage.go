@@ -0,0 +1,171 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/resilience"
+)
+
+// StorageTimeouts bound a single attempt of each operation; zero means no timeout. Copies share
+// the upload timeout, as do metadata updates. The read timeout covers streaming the content too, since the reader uses
+// the attempt context.
+type StorageTimeouts struct {
+	Upload time.Duration
+	Read   time.Duration
+	Delete time.Duration
+}
+
+// ResilientFileStorage retries transient failures of the wrapped storage and stops calling it
+// while the circuit breaker is open. Signing urls, key rotation and replacing files are passed
+// through: signing doesn't reach the bucket, and the others aren't safe to repeat halfway.
+type ResilientFileStorage struct {
+	next     ports.FileStorage
+	retry    resilience.Retry
+	breaker  *resilience.CircuitBreaker
+	timeouts StorageTimeouts
+}
+
+func NewResilientFileStorage(next ports.FileStorage, retry resilience.Retry, breaker *resilience.CircuitBreaker, timeouts StorageTimeouts) *ResilientFileStorage {
+	return &ResilientFileStorage{
+		next:     next,
+		retry:    retry,
+		breaker:  breaker,
+		timeouts: timeouts,
+	}
+}
+
+// UploadFile retries failed uploads. An attempt that timed out may still have stored the file, so
+// a retry finding the file already stored counts as success. File names aren't reused, so the
+// file found is the one uploaded by the earlier attempt.
+func (storage *ResilientFileStorage) UploadFile(ctx context.Context, tenant, fileName string, file []byte) error {
+	attempts := 0
+	err := storage.retry.Do(ctx, storage.breaker, func(ctx context.Context) error {
+		attempts++
+		attemptCtx, cancel := withTimeout(ctx, storage.timeouts.Upload)
+		defer cancel()
+		err := storage.next.UploadFile(attemptCtx, tenant, fileName, file)
+		if attempts > 1 && errors.Is(err, ports.ErrFileExists) {
+			return nil
+		}
+		return err
+	})
+	return storage.classify("UploadFile", err)
+}
+
+func (storage *ResilientFileStorage) ReadFile(ctx context.Context, tenant, fileName string) (io.ReadCloser, error) {
+	var content io.ReadCloser
+	err := storage.retry.Do(ctx, storage.breaker, func(ctx context.Context) error {
+		attemptCtx, cancel := withTimeout(ctx, storage.timeouts.Read)
+		reader, err := storage.next.ReadFile(attemptCtx, tenant, fileName)
+		if err != nil {
+			cancel()
+			return err
+		}
+		content = &cancelingReadCloser{ReadCloser: reader, cancel: cancel}
+		return nil
+	})
+	if err != nil {
+		return nil, storage.classify("ReadFile", err)
+	}
+	return content, nil
+}
+
+func (storage *ResilientFileStorage) GetExpiringUrl(tenant, fileName string, options models.SignedUrlOptions) (string, error) {
+	return storage.next.GetExpiringUrl(tenant, fileName, options)
+}
+
+// DeleteFile retries failed deletes. A retry not finding the file counts as success, since the
+// attempt that failed may have deleted it before its response was lost.
+func (storage *ResilientFileStorage) DeleteFile(ctx context.Context, tenant, fileName string) error {
+	attempts := 0
+	err := storage.retry.Do(ctx, storage.breaker, func(ctx context.Context) error {
+		attempts++
+		attemptCtx, cancel := withTimeout(ctx, storage.timeouts.Delete)
+		defer cancel()
+		err := storage.next.DeleteFile(attemptCtx, tenant, fileName)
+		if attempts > 1 && errors.Is(err, ports.ErrFileNotFound) {
+			return nil
+		}
+		return err
+	})
+	return storage.classify("DeleteFile", err)
+}
+
+func (storage *ResilientFileStorage) CopyFile(ctx context.Context, tenant, sourceName, targetName string) error {
+	err := storage.retry.Do(ctx, storage.breaker, func(ctx context.Context) error {
+		attemptCtx, cancel := withTimeout(ctx, storage.timeouts.Upload)
+		defer cancel()
+		return storage.next.CopyFile(attemptCtx, tenant, sourceName, targetName)
+	})
+	return storage.classify("CopyFile", err)
+}
+
+func (storage *ResilientFileStorage) SetMetadata(ctx context.Context, tenant, fileName string, metadata map[string]string) error {
+	err := storage.retry.Do(ctx, storage.breaker, func(ctx context.Context) error {
+		attemptCtx, cancel := withTimeout(ctx, storage.timeouts.Upload)
+		defer cancel()
+		return storage.next.SetMetadata(attemptCtx, tenant, fileName, metadata)
+	})
+	return storage.classify("SetMetadata", err)
+}
+
+func (storage *ResilientFileStorage) RotateEncryptionKey(ctx context.Context, tenant, fileName string) (bool, error) {
+	rotator, ok := storage.next.(ports.EncryptionKeyRotator)
+	if !ok {
+		return false, nil
+	}
+	return rotator.RotateEncryptionKey(ctx, tenant, fileName)
+}
+
+func (storage *ResilientFileStorage) ReplaceFile(ctx context.Context, tenant, fileName string, file []byte) error {
+	replacer, ok := storage.next.(ports.FileReplacer)
+	if !ok {
+		return ports.ErrReplaceNotSupported
+	}
+	return replacer.ReplaceFile(ctx, tenant, fileName, file)
+}
+
+func (storage *ResilientFileStorage) SetHold(ctx context.Context, tenant, fileName string, hold bool) error {
+	holder, ok := storage.next.(ports.ObjectHolder)
+	if !ok {
+		return ports.ErrObjectHoldsNotSupported
+	}
+	err := storage.retry.Do(ctx, storage.breaker, func(ctx context.Context) error {
+		attemptCtx, cancel := withTimeout(ctx, storage.timeouts.Upload)
+		defer cancel()
+		return holder.SetHold(attemptCtx, tenant, fileName, hold)
+	})
+	return storage.classify("SetHold", err)
+}
+
+// classify reports an open breaker as ports.ErrStorageUnavailable; other errors are returned as they are.
+func (storage *ResilientFileStorage) classify(method string, err error) error {
+	if errors.Is(err, resilience.ErrCircuitOpen) {
+		return fmt.Errorf("ResilientFileStorage - %s: %v; %w", method, err, ports.ErrStorageUnavailable)
+	}
+	return err
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// cancelingReadCloser releases the attempt context once the content is read.
+type cancelingReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (reader *cancelingReadCloser) Close() error {
+	defer reader.cancel()
+	return reader.ReadCloser.Close()
+}
@@ -0,0 +1,123 @@
+package adapters
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/tracing"
+)
+
+// TracedFileRepository wraps every repository call in a span.
+type TracedFileRepository struct {
+	next   ports.FileRepository
+	tracer trace.Tracer
+}
+
+func NewTracedFileRepository(next ports.FileRepository, tracer trace.Tracer) *TracedFileRepository {
+	return &TracedFileRepository{next: next, tracer: tracer}
+}
+
+func (repository *TracedFileRepository) ListBy(ctx context.Context, tenant, referenceID string) (*[]models.File, error) {
+	ctx, span := repository.start(ctx, "FileRepository.ListBy", tenant, tracing.AttributeReferenceID.String(referenceID))
+	result, err := repository.next.ListBy(ctx, tenant, referenceID)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (repository *TracedFileRepository) ReadBy(ctx context.Context, tenant, fileID string) (*models.File, error) {
+	ctx, span := repository.start(ctx, "FileRepository.ReadBy", tenant, tracing.AttributeFileID.String(fileID))
+	result, err := repository.next.ReadBy(ctx, tenant, fileID)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (repository *TracedFileRepository) Add(ctx context.Context, tenant string, file *models.File) error {
+	ctx, span := repository.start(ctx, "FileRepository.Add", tenant, tracing.AttributeFileID.String(file.ID))
+	err := repository.next.Add(ctx, tenant, file)
+	tracing.End(span, err)
+	return err
+}
+
+func (repository *TracedFileRepository) Update(ctx context.Context, tenant string, file *models.File) error {
+	ctx, span := repository.start(ctx, "FileRepository.Update", tenant, tracing.AttributeFileID.String(file.ID))
+	err := repository.next.Update(ctx, tenant, file)
+	tracing.End(span, err)
+	return err
+}
+
+func (repository *TracedFileRepository) UpdateStatus(ctx context.Context, tenant, fileID string, status models.FileStatus) error {
+	ctx, span := repository.start(ctx, "FileRepository.UpdateStatus", tenant, tracing.AttributeFileID.String(fileID))
+	err := repository.next.UpdateStatus(ctx, tenant, fileID, status)
+	tracing.End(span, err)
+	return err
+}
+
+func (repository *TracedFileRepository) UpdateThumbnails(ctx context.Context, tenant, fileID string, thumbnails []models.Thumbnail) error {
+	ctx, span := repository.start(ctx, "FileRepository.UpdateThumbnails", tenant, tracing.AttributeFileID.String(fileID))
+	err := repository.next.UpdateThumbnails(ctx, tenant, fileID, thumbnails)
+	tracing.End(span, err)
+	return err
+}
+
+func (repository *TracedFileRepository) Unshare(ctx context.Context, tenant, fileID, objectName string) error {
+	ctx, span := repository.start(ctx, "FileRepository.Unshare", tenant, tracing.AttributeFileID.String(fileID))
+	err := repository.next.Unshare(ctx, tenant, fileID, objectName)
+	tracing.End(span, err)
+	return err
+}
+
+func (repository *TracedFileRepository) UpdateObject(ctx context.Context, tenant, fileID, objectName string, thumbnails []models.Thumbnail) error {
+	ctx, span := repository.start(ctx, "FileRepository.UpdateObject", tenant, tracing.AttributeFileID.String(fileID))
+	err := repository.next.UpdateObject(ctx, tenant, fileID, objectName, thumbnails)
+	tracing.End(span, err)
+	return err
+}
+
+func (repository *TracedFileRepository) Delete(ctx context.Context, tenant, fileID string) error {
+	ctx, span := repository.start(ctx, "FileRepository.Delete", tenant, tracing.AttributeFileID.String(fileID))
+	err := repository.next.Delete(ctx, tenant, fileID)
+	tracing.End(span, err)
+	return err
+}
+
+func (repository *TracedFileRepository) Search(ctx context.Context, tenant string, filter models.FileFilter) (*[]models.File, error) {
+	ctx, span := repository.tracer.Start(ctx, "FileRepository.Search",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(tracing.AttributeTenant.String(tenant)))
+	result, err := repository.next.Search(ctx, tenant, filter)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (repository *TracedFileRepository) Link(ctx context.Context, tenant, fileID, referenceID string) error {
+	ctx, span := repository.start(ctx, "FileRepository.Link", tenant, tracing.AttributeFileID.String(fileID))
+	span.SetAttributes(tracing.AttributeReferenceID.String(referenceID))
+	err := repository.next.Link(ctx, tenant, fileID, referenceID)
+	tracing.End(span, err)
+	return err
+}
+
+func (repository *TracedFileRepository) Unlink(ctx context.Context, tenant, fileID, referenceID string) ([]string, error) {
+	ctx, span := repository.start(ctx, "FileRepository.Unlink", tenant, tracing.AttributeFileID.String(fileID))
+	span.SetAttributes(tracing.AttributeReferenceID.String(referenceID))
+	result, err := repository.next.Unlink(ctx, tenant, fileID, referenceID)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (repository *TracedFileRepository) ListLinks(ctx context.Context, tenant, fileID string) ([]string, error) {
+	ctx, span := repository.start(ctx, "FileRepository.ListLinks", tenant, tracing.AttributeFileID.String(fileID))
+	result, err := repository.next.ListLinks(ctx, tenant, fileID)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (repository *TracedFileRepository) start(ctx context.Context, name, tenant string, fileAttribute attribute.KeyValue) (context.Context, trace.Span) {
+	return repository.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(tracing.AttributeTenant.String(tenant), fileAttribute))
+}
@@ -0,0 +1,95 @@
+package adapters
+
+import (
+	"context"
+	"io"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/tracing"
+)
+
+// TracedFileStorage wraps every storage call in a span.
+type TracedFileStorage struct {
+	next   ports.FileStorage
+	tracer trace.Tracer
+}
+
+func NewTracedFileStorage(next ports.FileStorage, tracer trace.Tracer) *TracedFileStorage {
+	return &TracedFileStorage{next: next, tracer: tracer}
+}
+
+func (storage *TracedFileStorage) UploadFile(ctx context.Context, tenant, fileName string, file []byte) error {
+	ctx, span := storage.start(ctx, "FileStorage.UploadFile", tenant, fileName)
+	span.SetAttributes(tracing.AttributeFileSize.Int(len(file)))
+	err := storage.next.UploadFile(ctx, tenant, fileName, file)
+	tracing.End(span, err)
+	return err
+}
+
+// ReadFile spans opening the object; reading the content is left to the caller's span.
+func (storage *TracedFileStorage) ReadFile(ctx context.Context, tenant, fileName string) (io.ReadCloser, error) {
+	ctx, span := storage.start(ctx, "FileStorage.ReadFile", tenant, fileName)
+	content, err := storage.next.ReadFile(ctx, tenant, fileName)
+	tracing.End(span, err)
+	return content, err
+}
+
+// GetExpiringUrl isn't traced: the port passes no context to attach the span to and signing
+// doesn't leave the process.
+func (storage *TracedFileStorage) GetExpiringUrl(tenant, fileName string, options models.SignedUrlOptions) (string, error) {
+	return storage.next.GetExpiringUrl(tenant, fileName, options)
+}
+
+func (storage *TracedFileStorage) DeleteFile(ctx context.Context, tenant, fileName string) error {
+	ctx, span := storage.start(ctx, "FileStorage.DeleteFile", tenant, fileName)
+	err := storage.next.DeleteFile(ctx, tenant, fileName)
+	tracing.End(span, err)
+	return err
+}
+
+func (storage *TracedFileStorage) CopyFile(ctx context.Context, tenant, sourceName, targetName string) error {
+	ctx, span := storage.start(ctx, "FileStorage.CopyFile", tenant, sourceName)
+	err := storage.next.CopyFile(ctx, tenant, sourceName, targetName)
+	tracing.End(span, err)
+	return err
+}
+
+func (storage *TracedFileStorage) SetMetadata(ctx context.Context, tenant, fileName string, metadata map[string]string) error {
+	ctx, span := storage.start(ctx, "FileStorage.SetMetadata", tenant, fileName)
+	err := storage.next.SetMetadata(ctx, tenant, fileName, metadata)
+	tracing.End(span, err)
+	return err
+}
+
+// RotateEncryptionKey keeps key rotation available when the wrapped storage supports it.
+func (storage *TracedFileStorage) RotateEncryptionKey(ctx context.Context, tenant, fileName string) (bool, error) {
+	rotator, ok := storage.next.(ports.EncryptionKeyRotator)
+	if !ok {
+		return false, nil
+	}
+	ctx, span := storage.start(ctx, "FileStorage.RotateEncryptionKey", tenant, fileName)
+	rotated, err := rotator.RotateEncryptionKey(ctx, tenant, fileName)
+	tracing.End(span, err)
+	return rotated, err
+}
+
+// SetHold keeps object holds available when the wrapped storage supports them.
+func (storage *TracedFileStorage) SetHold(ctx context.Context, tenant, fileName string, hold bool) error {
+	holder, ok := storage.next.(ports.ObjectHolder)
+	if !ok {
+		return ports.ErrObjectHoldsNotSupported
+	}
+	ctx, span := storage.start(ctx, "FileStorage.SetHold", tenant, fileName)
+	err := holder.SetHold(ctx, tenant, fileName, hold)
+	tracing.End(span, err)
+	return err
+}
+
+func (storage *TracedFileStorage) start(ctx context.Context, name, tenant, fileName string) (context.Context, trace.Span) {
+	return storage.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(tracing.AttributeTenant.String(tenant), tracing.AttributeFileName.String(fileName)))
+}
@@ -0,0 +1,134 @@
+package files
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+)
+
+// _contentsPrefix holds deduplicated content as <tenant>/contents/<sha256><extension>. The
+// extension is kept, so the storage serves the object with the right content type.
+const _contentsPrefix = "contents"
+
+// contentStore keeps identical content of a tenant in a single object counted by the repository.
+// Counting and storing or removing the object of the same content are serialized, so an object
+// isn't removed while an upload counts on it. The locks cover this instance only, like the
+// in-memory repositories.
+type contentStore struct {
+	repository  ports.ContentRepository
+	fileStorage ports.FileStorage
+	mu          sync.Mutex
+	locks       map[string]*contentLock
+}
+
+type contentLock struct {
+	sync.Mutex
+	holders int
+}
+
+func newContentStore(repository ports.ContentRepository, fileStorage ports.FileStorage) *contentStore {
+	return &contentStore{
+		repository:  repository,
+		fileStorage: fileStorage,
+		locks:       make(map[string]*contentLock),
+	}
+}
+
+// store counts one more file of the content and uploads it unless it's stored already.
+func (store *contentStore) store(ctx context.Context, tenant, objectName string, content []byte) error {
+	unlock := store.lock(tenant, objectName)
+	defer unlock()
+	first, err := store.repository.Acquire(ctx, tenant, objectName)
+	if err != nil {
+		return fmt.Errorf("can't count content reference; %w", err)
+	}
+	if !first {
+		return nil
+	}
+	err = store.fileStorage.UploadFile(ctx, tenant, objectName, content)
+	if err != nil {
+		_, _ = store.repository.Release(ctx, tenant, objectName)
+		return fmt.Errorf("can't upload content to file storage; %w", err)
+	}
+	return nil
+}
+
+// acquire counts one more file of content another file already stored. It fails with
+// ErrFileNotFound when the last file of the content was removed in the meantime.
+func (store *contentStore) acquire(ctx context.Context, tenant, objectName string) error {
+	unlock := store.lock(tenant, objectName)
+	defer unlock()
+	first, err := store.repository.Acquire(ctx, tenant, objectName)
+	if err != nil {
+		return fmt.Errorf("can't count content reference; %w", err)
+	}
+	if first {
+		_, _ = store.repository.Release(ctx, tenant, objectName)
+		return ErrFileNotFound
+	}
+	return nil
+}
+
+// release counts one file less and removes the object with the last one.
+func (store *contentStore) release(ctx context.Context, tenant, objectName string) error {
+	unlock := store.lock(tenant, objectName)
+	defer unlock()
+	last, err := store.repository.Release(ctx, tenant, objectName)
+	if err != nil {
+		return fmt.Errorf("can't release content reference; %w", err)
+	}
+	if !last {
+		return nil
+	}
+	err = store.fileStorage.DeleteFile(ctx, tenant, objectName)
+	if err != nil {
+		return fmt.Errorf("can't delete content from storage; %w", err)
+	}
+	return nil
+}
+
+func (store *contentStore) lock(tenant, objectName string) func() {
+	key := tenant + "/" + objectName
+	store.mu.Lock()
+	lock, ok := store.locks[key]
+	if !ok {
+		lock = &contentLock{}
+		store.locks[key] = lock
+	}
+	lock.holders++
+	store.mu.Unlock()
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		store.mu.Lock()
+		lock.holders--
+		if lock.holders == 0 {
+			delete(store.locks, key)
+		}
+		store.mu.Unlock()
+	}
+}
+
+func hashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func makeContentName(contentHash, fileName string) string {
+	return fmt.Sprintf("%s/%s%s", _contentsPrefix, contentHash, filepath.Ext(fileName))
+}
+
+// thumbnailObjectName is the name thumbnails of the file are named after. Files sharing
+// deduplicated content get thumbnails of their own, so they can be removed with the file.
+func thumbnailObjectName(file *models.File) string {
+	if file.ContentHash != "" {
+		return makeObjectName(file.ID, file.ContentHash)
+	}
+	return file.StorageName()
+}
@@ -0,0 +1,47 @@
+package files
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/logger"
+)
+
+// ExpirationJob deletes files past the expiration of their retention rule periodically.
+type ExpirationJob struct {
+	useCase  UseCase
+	logger   logger.Logger
+	interval time.Duration
+	wg       sync.WaitGroup
+}
+
+func NewExpirationJob(useCase UseCase, logger logger.Logger, interval time.Duration) *ExpirationJob {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	return &ExpirationJob{useCase: useCase, logger: logger, interval: interval}
+}
+
+func (job *ExpirationJob) Start(ctx context.Context) {
+	job.wg.Add(1)
+	go func() {
+		defer job.wg.Done()
+		ticker := time.NewTicker(job.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := job.useCase.DeleteExpiredFiles(ctx); err != nil {
+					job.logger.Error(err, "files - ExpirationJob")
+				}
+			}
+		}
+	}()
+}
+
+func (job *ExpirationJob) Wait() {
+	job.wg.Wait()
+}
@@ -0,0 +1,69 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"path/filepath"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/logger"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/textextract"
+)
+
+// IndexPipeline indexes clean files for search in the background: their names and tags, and the
+// text of plain text and PDF documents.
+type IndexPipeline struct {
+	fileRepository ports.FileRepository
+	indexer        *searchIndexer
+	queue          *jobQueue
+}
+
+func NewIndexPipeline(index ports.SearchIndex, fileRepository ports.FileRepository, logger logger.Logger, workers, queueSize int) *IndexPipeline {
+	pipeline := &IndexPipeline{
+		fileRepository: fileRepository,
+		indexer:        newSearchIndexer(index, fileRepository),
+	}
+	pipeline.queue = newJobQueue("IndexPipeline", workers, queueSize, logger, pipeline.process)
+	return pipeline
+}
+
+// Start runs the workers until ctx is cancelled.
+func (pipeline *IndexPipeline) Start(ctx context.Context) {
+	pipeline.queue.start(ctx)
+}
+
+// Wait blocks until all workers have stopped.
+func (pipeline *IndexPipeline) Wait() {
+	pipeline.queue.wait()
+}
+
+func (pipeline *IndexPipeline) Enqueue(tenant, fileID string, content []byte) error {
+	return pipeline.queue.enqueue(fileJob{tenant: tenant, fileID: fileID, content: content})
+}
+
+func (pipeline *IndexPipeline) process(ctx context.Context, job fileJob) error {
+	file, err := pipeline.fileRepository.ReadBy(ctx, job.tenant, job.fileID)
+	if err != nil {
+		return fmt.Errorf("IndexPipeline - process: can't read file %s; %w", job.fileID, err)
+	}
+	if file == nil || file.ID == "" {
+		return nil
+	}
+	text := ""
+	contentType := mime.TypeByExtension(filepath.Ext(file.FileName))
+	if textextract.Supported(contentType) {
+		text, err = textextract.Extract(job.content, contentType)
+		if errors.Is(err, textextract.ErrUnsupportedDocument) {
+			// broken documents are still found by name and tags
+			text = ""
+		} else if err != nil {
+			return fmt.Errorf("IndexPipeline - process: can't extract text of file %s; %w", job.fileID, err)
+		}
+	}
+	if err := pipeline.indexer.indexText(ctx, job.tenant, job.fileID, text); err != nil {
+		return fmt.Errorf("IndexPipeline - process: can't index file %s; %w", job.fileID, err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/logger"
+)
+
+var ErrQueueFull = errors.New("processing queue is full")
+
+type fileJob struct {
+	tenant  string
+	fileID  string
+	content []byte
+	attempt int
+}
+
+// fileProcessor processes clean files in the background.
+type fileProcessor interface {
+	Enqueue(tenant, fileID string, content []byte) error
+}
+
+// jobQueue is a bounded queue drained by a fixed number of background workers.
+type jobQueue struct {
+	name    string
+	jobs    chan fileJob
+	workers int
+	handle  func(ctx context.Context, job fileJob) error
+	logger  logger.Logger
+	wg      sync.WaitGroup
+}
+
+func newJobQueue(name string, workers, queueSize int, logger logger.Logger, handle func(ctx context.Context, job fileJob) error) *jobQueue {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &jobQueue{
+		name:    name,
+		jobs:    make(chan fileJob, queueSize),
+		workers: workers,
+		handle:  handle,
+		logger:  logger,
+	}
+}
+
+func (queue *jobQueue) start(ctx context.Context) {
+	for i := 0; i < queue.workers; i++ {
+		queue.wg.Add(1)
+		go func() {
+			defer queue.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-queue.jobs:
+					if err := queue.handle(ctx, job); err != nil {
+						queue.logger.Error(err, "files - "+queue.name)
+					}
+				}
+			}
+		}()
+	}
+}
+
+func (queue *jobQueue) enqueue(job fileJob) error {
+	select {
+	case queue.jobs <- job:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// requeue enqueues the job again once the delay passes, waiting for another delay while the queue
+// is full. The job is dropped when ctx is done first.
+func (queue *jobQueue) requeue(ctx context.Context, job fileJob, delay time.Duration) {
+	queue.wg.Add(1)
+	go func() {
+		defer queue.wg.Done()
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+				if queue.enqueue(job) == nil {
+					return
+				}
+				timer.Reset(delay)
+			}
+		}
+	}()
+}
+
+func (queue *jobQueue) wait() {
+	queue.wg.Wait()
+}
@@ -0,0 +1,95 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Limits keep labels within the 8 KiB the storage allows for custom metadata of an object.
+const (
+	_maxMetadataEntries = 16
+	_maxMetadataValue   = 256
+	_maxTags            = 32
+	// _tagsMetadataKey holds the tags in the object metadata, joined with commas
+	_tagsMetadataKey = "tags"
+)
+
+var (
+	ErrInvalidMetadata = errors.New("invalid metadata or tags")
+
+	// keys end up in HTTP headers of the storage, which don't keep the case
+	_metadataKeyPattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+	_tagPattern         = regexp.MustCompile(`^[a-z0-9_.:-]{1,64}$`)
+)
+
+func validateMetadata(metadata map[string]string) error {
+	if len(metadata) > _maxMetadataEntries {
+		return fmt.Errorf("at most %d metadata entries are allowed; %w", _maxMetadataEntries, ErrInvalidMetadata)
+	}
+	for key, value := range metadata {
+		if !_metadataKeyPattern.MatchString(key) || key == _tagsMetadataKey {
+			return fmt.Errorf("metadata key %q isn't allowed; %w", key, ErrInvalidMetadata)
+		}
+		if len(value) > _maxMetadataValue {
+			return fmt.Errorf("metadata value of %q is longer than %d bytes; %w", key, _maxMetadataValue, ErrInvalidMetadata)
+		}
+	}
+	return nil
+}
+
+func validateTags(tags []string) error {
+	if len(tags) > _maxTags {
+		return fmt.Errorf("at most %d tags are allowed; %w", _maxTags, ErrInvalidMetadata)
+	}
+	for _, tag := range tags {
+		if !_tagPattern.MatchString(tag) {
+			return fmt.Errorf("tag %q isn't allowed; %w", tag, ErrInvalidMetadata)
+		}
+	}
+	return nil
+}
+
+// mergeMetadata applies changes to a copy of the metadata; empty values remove keys.
+func mergeMetadata(current, changes map[string]string) map[string]string {
+	result := make(map[string]string, len(current)+len(changes))
+	for key, value := range current {
+		result[key] = value
+	}
+	for key, value := range changes {
+		if value == "" {
+			delete(result, key)
+			continue
+		}
+		result[key] = value
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// uniqueTags drops repeated tags, keeping the order.
+func uniqueTags(tags []string) []string {
+	var result []string
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+func objectMetadata(metadata map[string]string, tags []string) map[string]string {
+	result := make(map[string]string, len(metadata)+1)
+	for key, value := range metadata {
+		result[key] = value
+	}
+	if len(tags) > 0 {
+		result[_tagsMetadataKey] = strings.Join(tags, ",")
+	}
+	return result
+}
@@ -1,24 +1,267 @@
 package models
 
-import "io"
+import (
+	"io"
+	"time"
+)
 
 type UploadFileCommand struct {
 	CreatorId   string
 	FileName    string
 	ReferenceID string
 	File        io.Reader
+	Metadata    map[string]string
+	Tags        []string
+}
+
+// StoredObject is a file put into the bucket by another producer as <tenant>/<reference>/<name>.
+// ObjectName is the object name within the tenant, <reference>/<name>.
+type StoredObject struct {
+	Tenant      string
+	ReferenceID string
+	FileName    string
+	ObjectName  string
+	Size        int64
+}
+
+type FileStatus string
+
+const (
+	FileStatusPending  FileStatus = "pending"
+	FileStatusClean    FileStatus = "clean"
+	FileStatusInfected FileStatus = "infected"
+	// FileStatusScanFailed marks files the scanner kept failing on, they're never served.
+	FileStatusScanFailed FileStatus = "scan_failed"
+)
+
+// CopyFileCommand copies a file to the reference; an empty FileName keeps the source name.
+type CopyFileCommand struct {
+	FileID      string
+	ReferenceID string
+	FileName    string
+	CreatorId   string
+}
+
+// MoveFileCommand attaches a file to another reference or renames it; empty fields are kept.
+type MoveFileCommand struct {
+	FileID      string
+	ReferenceID string
+	FileName    string
+}
+
+// UpdateMetadataCommand merges Metadata into the file's metadata, an empty value removes the key.
+// Tags replace the file's tags unless nil.
+type UpdateMetadataCommand struct {
+	FileID   string
+	Metadata map[string]string
+	Tags     *[]string
+}
+
+// FileFilter matches files having all the tags and all the metadata values.
+type FileFilter struct {
+	Tags     []string
+	Metadata map[string]string
+}
+
+// SearchFilesQuery finds files matching every word of Text in their name, tags or content, and
+// the filter. Either of them may be empty.
+type SearchFilesQuery struct {
+	Text             string
+	Filter           FileFilter
+	UrlExpiresIn     time.Duration
+	IncludeUnscanned bool
+}
+
+// SearchDocument is what the search index knows of a file: Text is extracted from its content.
+type SearchDocument struct {
+	FileID   string
+	FileName string
+	Tags     []string
+	Text     string
+}
+
+type ListFilesQuery struct {
+	ReferenceID      string
+	UrlExpiresIn     time.Duration
+	IncludeUnscanned bool
+}
+
+type ArchiveQuery struct {
+	ReferenceID string
+	FileIDs     []string
 }
 
 type Attachment struct {
-	ID       string
+	ID         string
+	FileName   string
+	Url        string
+	Status     FileStatus
+	Thumbnails []AttachmentThumbnail `json:",omitempty"`
+	Metadata   map[string]string     `json:",omitempty"`
+	Tags       []string              `json:",omitempty"`
+	LegalHold  bool                  `json:",omitempty"`
+}
+
+type AttachmentThumbnail struct {
+	Size int
+	Url  string
+}
+
+type FileContent struct {
 	FileName string
-	Url      string
+	Content  io.ReadCloser
 }
 
 type File struct {
 	ID          string
 	FileName    string
+	ObjectName  string
 	ReferenceID string
 	CreatedAt   int64
 	CreatorId   string
+	Status      FileStatus
+	Size        int64
+	Thumbnails  []Thumbnail
+	// ContentHash is the SHA-256 of deduplicated content, whose object other files may share.
+	ContentHash string
+	Metadata    map[string]string
+	Tags        []string
+	// LegalHold keeps the file from being deleted or replaced until the hold is released.
+	LegalHold bool
+	// Grants give access to the file itself, on top of grants on the references it's linked to.
+	Grants []Grant
+}
+
+// StorageName is the name of the file's object in the storage. Copied, renamed and deduplicated
+// files are stored under ObjectName, the others under their own name.
+func (file *File) StorageName() string {
+	if file.ObjectName != "" {
+		return file.ObjectName
+	}
+	return file.FileName
+}
+
+type Thumbnail struct {
+	Size     int
+	FileName string
+}
+
+type ScanResult struct {
+	Infected  bool
+	Signature string
+}
+
+type SignedUrlOptions struct {
+	Expiry      time.Duration
+	Method      string
+	Headers     []string
+	ContentType string
+}
+
+// QuotaLimits caps what a tenant and each of its references may store; zero means unlimited.
+type QuotaLimits struct {
+	MaxBytes          int64
+	MaxFiles          int
+	MaxReferenceBytes int64
+	MaxReferenceFiles int
+}
+
+type UsageCounters struct {
+	Bytes int64
+	Files int
+}
+
+// RetentionRule applies to files of the tenant, or of the reference when ReferenceID isn't empty,
+// counting days from the upload. Files can't be deleted for RetainDays and are deleted after
+// ExpireDays; zero disables either.
+type RetentionRule struct {
+	ReferenceID string `json:",omitempty"`
+	RetainDays  int
+	ExpireDays  int
+}
+
+// Role is what a grant allows; every role includes the ones before it. Readers list and download
+// files, writers change and share them, and owners manage their grants.
+type Role string
+
+const (
+	RoleReader Role = "reader"
+	RoleWriter Role = "writer"
+	RoleOwner  Role = "owner"
+)
+
+type PrincipalType string
+
+const (
+	PrincipalUser  PrincipalType = "user"
+	PrincipalGroup PrincipalType = "group"
+)
+
+// Grant gives the role to a user, or to every member of a group.
+type Grant struct {
+	PrincipalType PrincipalType
+	PrincipalID   string
+	Role          Role
+}
+
+// CreateShareCommand shares a file by a link valid for ExpiresIn. Zero MaxDownloads doesn't limit
+// downloads and an empty Password leaves the link unprotected.
+type CreateShareCommand struct {
+	FileID       string
+	ExpiresIn    time.Duration
+	MaxDownloads int
+	Password     string
+	CreatorId    string
+}
+
+// Share is a link to a file served by the app to anyone knowing its token until it expires or
+// runs out of downloads.
+type Share struct {
+	Token        string
+	Tenant       string
+	FileID       string
+	CreatorId    string
+	CreatedAt    int64
+	ExpiresAt    int64
+	MaxDownloads int
+	Downloads    int
+	// PasswordHash is the bcrypt hash of the password, empty when the link isn't protected.
+	PasswordHash string
+	// FailedAttempts counts wrong passwords given for the link.
+	FailedAttempts int
+}
+
+// ShareLink is a share as shown to its creator; Url is filled in by the api.
+type ShareLink struct {
+	Token             string
+	FileID            string
+	Url               string `json:",omitempty"`
+	ExpiresAt         int64
+	MaxDownloads      int `json:",omitempty"`
+	Downloads         int
+	PasswordProtected bool
+}
+
+// SharedFile is served for an opened share: a short-lived signed url, or the content itself when
+// the storage can't sign one.
+type SharedFile struct {
+	Url     string
+	Content *FileContent
+}
+
+type Usage struct {
+	Tenant    string
+	Bytes     int64
+	Files     int
+	MaxBytes  int64
+	MaxFiles  int
+	Reference *ReferenceUsage `json:",omitempty"`
+}
+
+type ReferenceUsage struct {
+	ReferenceID string
+	Bytes       int64
+	Files       int
+	MaxBytes    int64
+	MaxFiles    int
 }
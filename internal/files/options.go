@@ -0,0 +1,108 @@
+package files
+
+import (
+	"time"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/logger"
+)
+
+type Option func(*DefaultFilesUseCase)
+
+func EncryptionKeyRotator(rotator ports.EncryptionKeyRotator) Option {
+	return func(useCase *DefaultFilesUseCase) {
+		useCase.keyRotator = rotator
+	}
+}
+
+// Scanning holds uploaded files as pending until the pipeline marks them clean.
+func Scanning(pipeline *ScanPipeline) Option {
+	return func(useCase *DefaultFilesUseCase) {
+		useCase.scanPipeline = pipeline
+	}
+}
+
+// Thumbnails makes thumbnails of uploaded images once they are clean.
+func Thumbnails(pipeline *ThumbnailPipeline) Option {
+	return func(useCase *DefaultFilesUseCase) {
+		useCase.thumbnailPipeline = pipeline
+	}
+}
+
+// Indexing indexes names, tags and text of files once they are clean, so they can be found by text.
+func Indexing(pipeline *IndexPipeline) Option {
+	return func(useCase *DefaultFilesUseCase) {
+		useCase.indexPipeline = pipeline
+	}
+}
+
+// Events publishes file lifecycle events.
+func Events(publisher ports.EventPublisher) Option {
+	return func(useCase *DefaultFilesUseCase) {
+		useCase.eventPublisher = publisher
+	}
+}
+
+// Logger reports failures that don't fail the operation, like an event that couldn't be published
+// after the file was stored. Nothing is logged without it.
+func Logger(logger logger.Logger) Option {
+	return func(useCase *DefaultFilesUseCase) {
+		useCase.logger = logger
+	}
+}
+
+// Audit records every operation on files, including issued signed urls, in the audit trail.
+func Audit(recorder ports.AuditRecorder) Option {
+	return func(useCase *DefaultFilesUseCase) {
+		useCase.auditRecorder = recorder
+	}
+}
+
+// Deduplication stores identical content of a tenant once, in an object shared by the files
+// counted in the repository. Quotas still count every file in full.
+func Deduplication(repository ports.ContentRepository) Option {
+	return func(useCase *DefaultFilesUseCase) {
+		useCase.contentRepository = repository
+	}
+}
+
+// Quotas tracks usage and rejects uploads over the limits; tenant overrides take precedence.
+func Quotas(store ports.QuotaStore, limits models.QuotaLimits) Option {
+	return func(useCase *DefaultFilesUseCase) {
+		useCase.quotaStore = store
+		useCase.quotaLimits = limits
+	}
+}
+
+// Retention enforces retention rules of tenants and references on deletes and lets files expire.
+func Retention(store ports.RetentionStore) Option {
+	return func(useCase *DefaultFilesUseCase) {
+		useCase.retentionStore = store
+	}
+}
+
+// ObjectHolds mirrors legal holds of files on their objects, so the storage refuses to delete them too.
+func ObjectHolds(holder ports.ObjectHolder) Option {
+	return func(useCase *DefaultFilesUseCase) {
+		useCase.objectHolder = holder
+	}
+}
+
+// Sharing lets files be shared by links valid for at most maxExpiration, which redirect to signed
+// urls valid for urlExpiration.
+func Sharing(repository ports.ShareRepository, maxExpiration, urlExpiration time.Duration) Option {
+	return func(useCase *DefaultFilesUseCase) {
+		useCase.shareRepository = repository
+		useCase.maxShareExpiration = maxExpiration
+		useCase.shareUrlExpiration = urlExpiration
+	}
+}
+
+// AccessControl checks grants of callers on files and references. Files are owned by who created
+// them and references by who first added files to them.
+func AccessControl(store ports.ReferenceAccessStore) Option {
+	return func(useCase *DefaultFilesUseCase) {
+		useCase.accessStore = store
+	}
+}
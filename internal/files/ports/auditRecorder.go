@@ -0,0 +1,11 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/audit"
+)
+
+type AuditRecorder interface {
+	Record(ctx context.Context, entry audit.Entry) error
+}
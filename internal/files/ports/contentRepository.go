@@ -0,0 +1,13 @@
+package ports
+
+import "context"
+
+// ContentRepository counts files sharing an object of deduplicated content.
+type ContentRepository interface {
+	// Acquire counts one more file of the object and reports whether it's the first one, which
+	// has to store the object.
+	Acquire(ctx context.Context, tenant, objectName string) (bool, error)
+	// Release counts one file less and reports whether it was the last one, after which the
+	// object can be removed.
+	Release(ctx context.Context, tenant, objectName string) (bool, error)
+}
@@ -0,0 +1,11 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/events"
+)
+
+type EventPublisher interface {
+	Publish(ctx context.Context, event events.Event) error
+}
@@ -2,13 +2,38 @@ package ports
 
 import (
 	"context"
+	"errors"
 
 	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
 )
 
+var ErrLinkNotFound = errors.New("file isn't linked to the reference")
+
+// FileRepository keeps files and their links to references. A file is always linked to the
+// reference in its ReferenceID; Add creates that link and Update moves it when ReferenceID
+// changes. ListBy returns every file linked to the reference, not only the ones it owns.
 type FileRepository interface {
 	ListBy(ctx context.Context, tenant, referenceID string) (*[]models.File, error)
 	ReadBy(ctx context.Context, tenant, fileID string) (*models.File, error)
 	Add(ctx context.Context, tenant string, file *models.File) error
+	// Update replaces the file, except for its status, thumbnails and object, which the pipelines
+	// change concurrently; UpdateObject moves the file to another object.
+	Update(ctx context.Context, tenant string, file *models.File) error
+	// UpdateStatus, UpdateThumbnails and Unshare change only their fields of the file, so the
+	// pipelines don't overwrite what users changed in the meantime, nor the other way around.
+	UpdateStatus(ctx context.Context, tenant, fileID string, status models.FileStatus) error
+	UpdateThumbnails(ctx context.Context, tenant, fileID string, thumbnails []models.Thumbnail) error
+	// Unshare moves the deduplicated file to an object of its own.
+	Unshare(ctx context.Context, tenant, fileID, objectName string) error
+	// UpdateObject moves the file to the object and its thumbnails.
+	UpdateObject(ctx context.Context, tenant, fileID, objectName string, thumbnails []models.Thumbnail) error
 	Delete(ctx context.Context, tenant, fileID string) error
+	// Link attaches the file to one more reference; linking it twice is a no-op.
+	Link(ctx context.Context, tenant, fileID, referenceID string) error
+	// Unlink detaches the file from the reference and returns the references it's still linked
+	// to, or ErrLinkNotFound when it wasn't linked.
+	Unlink(ctx context.Context, tenant, fileID, referenceID string) ([]string, error)
+	ListLinks(ctx context.Context, tenant, fileID string) ([]string, error)
+	// Search lists files of the tenant matching the filter.
+	Search(ctx context.Context, tenant string, filter models.FileFilter) (*[]models.File, error)
 }
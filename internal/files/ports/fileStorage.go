@@ -1,9 +1,60 @@
 package ports
 
-import "context"
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+)
+
+// ErrSignedUrlNotSupported is returned by GetExpiringUrl when the stored bytes can't be
+// served directly by the storage, e.g. because they are encrypted by the application.
+var ErrSignedUrlNotSupported = errors.New("signed urls are not supported for this file")
+
+// ErrObjectHoldsNotSupported is returned by SetHold when the storage can't hold objects.
+var ErrObjectHoldsNotSupported = errors.New("file storage doesn't support object holds")
+
+// ErrStorageUnavailable is returned while calls to the storage are stopped after repeated failures.
+var ErrStorageUnavailable = errors.New("file storage is temporarily unavailable")
+
+// ErrFileExists is returned by UploadFile when the file is already stored; uploads never overwrite.
+var ErrFileExists = errors.New("file already exists in storage")
+
+// ErrFileNotFound is returned by DeleteFile when there is no such file.
+var ErrFileNotFound = errors.New("file doesn't exist in storage")
+
+// ErrFileTooLarge is returned when a file is bigger than the storage can handle.
+var ErrFileTooLarge = errors.New("file is too large for the storage")
 
 type FileStorage interface {
 	UploadFile(context context.Context, tenant, fileName string, file []byte) error
-	GetExpiringUrl(tenant, fileName string, expiresInNumberOfMinutes int, insecure bool) (string, error)
+	ReadFile(context context.Context, tenant, fileName string) (io.ReadCloser, error)
+	GetExpiringUrl(tenant, fileName string, options models.SignedUrlOptions) (string, error)
 	DeleteFile(context context.Context, tenant, fileName string) error
+	// CopyFile copies the file within the tenant without passing the content through the service.
+	CopyFile(context context.Context, tenant, sourceName, targetName string) error
+	// SetMetadata replaces the custom metadata of the file's object. Copies keep the metadata of
+	// their source.
+	SetMetadata(context context.Context, tenant, fileName string, metadata map[string]string) error
+}
+
+// EncryptionKeyRotator re-encrypts a stored file with the tenant's current primary key.
+type EncryptionKeyRotator interface {
+	RotateEncryptionKey(context context.Context, tenant, fileName string) (bool, error)
+}
+
+// ErrReplaceNotSupported is returned when the storage can't overwrite a file in place.
+var ErrReplaceNotSupported = errors.New("file storage doesn't support replacing files")
+
+// FileReplacer overwrites the content of a stored file in one step, keeping its custom metadata.
+// The old content stays when replacing fails, and a file changed meanwhile isn't overwritten.
+type FileReplacer interface {
+	ReplaceFile(context context.Context, tenant, fileName string, file []byte) error
+}
+
+// ObjectHolder places a hold on a stored file, while which the storage refuses to delete or
+// replace it.
+type ObjectHolder interface {
+	SetHold(context context.Context, tenant, fileName string, hold bool) error
 }
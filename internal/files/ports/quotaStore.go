@@ -0,0 +1,20 @@
+package ports
+
+import (
+	"context"
+	"errors"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+)
+
+// ErrQuotaExceeded is returned by Reserve when the file doesn't fit the tenant or reference limits.
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// QuotaStore tracks stored bytes and file count per tenant and per reference.
+type QuotaStore interface {
+	// Reserve counts the file in unless it exceeds the limits; checking and counting are atomic.
+	Reserve(ctx context.Context, tenant, referenceID string, size int64, limits models.QuotaLimits) error
+	Release(ctx context.Context, tenant, referenceID string, size int64) error
+	// Usage reports the whole tenant when referenceID is empty.
+	Usage(ctx context.Context, tenant, referenceID string) (models.UsageCounters, error)
+}
@@ -0,0 +1,19 @@
+package ports
+
+import (
+	"context"
+	"errors"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+)
+
+// ErrGrantNotFound is returned by Revoke when the principal has no grant on the reference.
+var ErrGrantNotFound = errors.New("grant not found")
+
+// ReferenceAccessStore keeps grants on references, which apply to every file linked to them.
+type ReferenceAccessStore interface {
+	// Grant gives the role to the principal, replacing the one it had.
+	Grant(ctx context.Context, tenant, referenceID string, grant models.Grant) error
+	Revoke(ctx context.Context, tenant, referenceID string, principalType models.PrincipalType, principalID string) error
+	List(ctx context.Context, tenant, referenceID string) ([]models.Grant, error)
+}
@@ -0,0 +1,22 @@
+package ports
+
+import (
+	"context"
+	"errors"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+)
+
+// ErrRetentionRuleNotFound is returned by Remove when the tenant has no rule for the reference.
+var ErrRetentionRuleNotFound = errors.New("retention rule not found")
+
+// RetentionStore keeps retention rules of tenants, at most one per reference and one for the
+// whole tenant.
+type RetentionStore interface {
+	// Set adds the rule or replaces the one of the same reference.
+	Set(ctx context.Context, tenant string, rule models.RetentionRule) error
+	Remove(ctx context.Context, tenant, referenceID string) error
+	List(ctx context.Context, tenant string) ([]models.RetentionRule, error)
+	// Tenants lists tenants having any rule.
+	Tenants(ctx context.Context) ([]string, error)
+}
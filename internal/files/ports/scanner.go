@@ -0,0 +1,12 @@
+package ports
+
+import (
+	"context"
+	"io"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+)
+
+type Scanner interface {
+	Scan(ctx context.Context, content io.Reader) (models.ScanResult, error)
+}
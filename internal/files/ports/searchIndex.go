@@ -0,0 +1,18 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+)
+
+// SearchIndex indexes names, tags and text of files for full-text search within a tenant.
+type SearchIndex interface {
+	// Index adds the document of the file or replaces the one indexed before.
+	Index(ctx context.Context, tenant string, document models.SearchDocument) error
+	// Read returns the indexed document of the file, nil when the file isn't indexed.
+	Read(ctx context.Context, tenant, fileID string) (*models.SearchDocument, error)
+	Remove(ctx context.Context, tenant, fileID string) error
+	// Search returns ids of at most limit files matching every word of the query, best matches first.
+	Search(ctx context.Context, tenant, query string, limit int) ([]string, error)
+}
@@ -0,0 +1,30 @@
+package ports
+
+import (
+	"context"
+	"errors"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+)
+
+// ErrShareNotFound is returned when no share has the token, or it belongs to another tenant.
+var ErrShareNotFound = errors.New("share not found")
+
+// ErrShareExhausted is returned by CountDownload when the share has no downloads left.
+var ErrShareExhausted = errors.New("share has no downloads left")
+
+// ShareRepository keeps shares by their token, which is unique across tenants.
+type ShareRepository interface {
+	Add(ctx context.Context, share *models.Share) error
+	// ReadBy returns nil when no share has the token.
+	ReadBy(ctx context.Context, token string) (*models.Share, error)
+	ListBy(ctx context.Context, tenant, fileID string) ([]models.Share, error)
+	Delete(ctx context.Context, tenant, token string) error
+	// DeleteBy removes all shares of the file.
+	DeleteBy(ctx context.Context, tenant, fileID string) error
+	// CountDownload counts one more download of the share unless its limit is reached, so
+	// concurrent downloads can't exceed it.
+	CountDownload(ctx context.Context, token string) (*models.Share, error)
+	// CountFailedAttempt counts one more wrong password given for the share.
+	CountFailedAttempt(ctx context.Context, token string) error
+}
@@ -0,0 +1,73 @@
+package files
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+)
+
+// resolveRetentionRule picks the rule of the reference, falling back to the rule of the tenant.
+// Files without a rule get a zero one, which neither retains nor expires them.
+func resolveRetentionRule(rules []models.RetentionRule, referenceID string) models.RetentionRule {
+	var tenantRule models.RetentionRule
+	for _, rule := range rules {
+		if rule.ReferenceID == "" {
+			tenantRule = rule
+		} else if rule.ReferenceID == referenceID {
+			return rule
+		}
+	}
+	return tenantRule
+}
+
+func validateRetentionRule(rule models.RetentionRule) error {
+	if rule.RetainDays < 0 || rule.ExpireDays < 0 {
+		return fmt.Errorf("%w: days can't be negative", ErrInvalidRetentionRule)
+	}
+	if rule.ExpireDays > 0 && rule.ExpireDays < rule.RetainDays {
+		return fmt.Errorf("%w: files can't expire before their retention ends", ErrInvalidRetentionRule)
+	}
+	return nil
+}
+
+// resolveRetentionRules picks the rule of every reference the file is linked to.
+func resolveRetentionRules(rules []models.RetentionRule, references []string) []models.RetentionRule {
+	result := make([]models.RetentionRule, 0, len(references))
+	for _, referenceID := range references {
+		result = append(result, resolveRetentionRule(rules, referenceID))
+	}
+	return result
+}
+
+// retentionEnd is when the file can be deleted, which is when the longest retention of its
+// references ends; files that aren't retained can be deleted since their upload.
+func retentionEnd(file *models.File, rules []models.RetentionRule) time.Time {
+	retainDays := 0
+	for _, rule := range rules {
+		if rule.RetainDays > retainDays {
+			retainDays = rule.RetainDays
+		}
+	}
+	return time.Unix(file.CreatedAt, 0).AddDate(0, 0, retainDays)
+}
+
+// checkRetained fails while any of the rules retains the file.
+func checkRetained(file *models.File, rules []models.RetentionRule, now time.Time) error {
+	retainedUntil := retentionEnd(file, rules)
+	if now.Before(retainedUntil) {
+		return fmt.Errorf("%w until %s", ErrFileRetained, retainedUntil.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// expired tells whether the rules of all references of the file expire it by now; a reference
+// whose rule doesn't expire files keeps it.
+func expired(file *models.File, rules []models.RetentionRule, now time.Time) bool {
+	for _, rule := range rules {
+		if rule.ExpireDays == 0 || now.Before(time.Unix(file.CreatedAt, 0).AddDate(0, 0, rule.ExpireDays)) {
+			return false
+		}
+	}
+	return len(rules) > 0
+}
@@ -1,12 +1,19 @@
 package files
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/httpserver"
 	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/logger"
 )
 
@@ -14,14 +21,134 @@ type FileRequest struct {
 	ID string `uri:"id" binding:"required"`
 }
 
+type FileLinkRequest struct {
+	ID          string `uri:"id" binding:"required"`
+	ReferenceID string `uri:"referenceId" binding:"required"`
+}
+
+type ArchiveRequestQuery struct {
+	FileIDs []string `form:"fileId"`
+}
+
+type CopyFileBody struct {
+	ReferenceID string `json:"referenceId" binding:"required"`
+	FileName    string `json:"fileName"`
+}
+
+type MoveFileBody struct {
+	ReferenceID string `json:"referenceId"`
+	FileName    string `json:"fileName"`
+}
+
+// UpdateMetadataBody merges metadata, an empty value removes the key; tags replace the current ones when given.
+type UpdateMetadataBody struct {
+	Metadata map[string]string `json:"metadata"`
+	Tags     *[]string         `json:"tags"`
+}
+
+type SearchFilesQuery struct {
+	Text             string   `form:"q"`
+	Tags             []string `form:"tag"`
+	ExpiresIn        int      `form:"expiresIn" binding:"omitempty,min=1"`
+	IncludeUnscanned bool     `form:"includeUnscanned"`
+}
+
+type UsageRequest struct {
+	TenantID string `uri:"id" binding:"required"`
+}
+
+type UsageQuery struct {
+	ReferenceID string `form:"referenceId"`
+}
+
+type ShareRequest struct {
+	ID    string `uri:"id" binding:"required"`
+	Token string `uri:"token" binding:"required"`
+}
+
+type OpenShareRequest struct {
+	Token string `uri:"token" binding:"required"`
+}
+
+// CreateShareBody shares the file for expiresIn minutes; zero maxDownloads doesn't limit downloads
+// and an empty password leaves the link unprotected.
+type CreateShareBody struct {
+	ExpiresIn    int    `json:"expiresIn" binding:"required,min=1"`
+	MaxDownloads int    `json:"maxDownloads" binding:"min=0"`
+	Password     string `json:"password"`
+}
+
+type AccessRequest struct {
+	ID            string `uri:"id" binding:"required"`
+	PrincipalType string `uri:"principalType" binding:"required,oneof=user group"`
+	PrincipalID   string `uri:"principalId" binding:"required"`
+}
+
+// GrantBody gives the role to the user or group, replacing the role it had.
+type GrantBody struct {
+	PrincipalType string `json:"principalType" binding:"required,oneof=user group"`
+	PrincipalID   string `json:"principalId" binding:"required"`
+	Role          string `json:"role" binding:"required,oneof=owner writer reader"`
+}
+
+type RetentionQuery struct {
+	ReferenceID string `form:"referenceId"`
+}
+
+// RetentionRuleBody sets the rule of the tenant, or of the reference when referenceId is given.
+type RetentionRuleBody struct {
+	ReferenceID string `json:"referenceId"`
+	RetainDays  int    `json:"retainDays" binding:"min=0"`
+	ExpireDays  int    `json:"expireDays" binding:"min=0"`
+}
+
+type ShowFilesQuery struct {
+	ExpiresIn        int  `form:"expiresIn" binding:"omitempty,min=1"`
+	IncludeUnscanned bool `form:"includeUnscanned"`
+}
+
 type Attachments []models.Attachment
 
-func AppendFileRoutes(handler *gin.RouterGroup, logger logger.Logger, useCase UseCase) {
+type RetentionRules []models.RetentionRule
+
+type ShareLinks []models.ShareLink
+
+type Grants []models.Grant
+
+// AppendFileRoutes registers the file routes; uploadMiddleware runs before uploads only.
+func AppendFileRoutes(handler *gin.RouterGroup, logger logger.Logger, useCase UseCase, uploadMiddleware ...gin.HandlerFunc) {
 	routerGroup := handler.Group("/files")
 	routerGroup.GET("/ping", pingHandler)
-	routerGroup.GET("/reference/:id", showFiles(logger, useCase))
-	routerGroup.POST("", uploadFile(logger, useCase))
+	routerGroup.GET("/reference/:id", showFiles(logger, useCase, routerGroup.BasePath()))
+	routerGroup.GET("/reference/:id/archive", downloadArchive(logger, useCase))
+	routerGroup.GET("/search", searchFiles(logger, useCase, routerGroup.BasePath()))
+	uploadHandlers := append(append([]gin.HandlerFunc{}, uploadMiddleware...), uploadFile(logger, useCase))
+	routerGroup.POST("", uploadHandlers...)
+	routerGroup.GET("/:id/content", downloadFile(logger, useCase))
+	routerGroup.POST("/:id/rotate-key", rotateEncryptionKey(logger, useCase))
+	routerGroup.POST("/:id/copy", copyFile(logger, useCase))
+	routerGroup.PATCH("/:id", moveFile(logger, useCase))
+	routerGroup.PATCH("/:id/metadata", updateMetadata(logger, useCase))
+	routerGroup.PUT("/:id/references/:referenceId", linkFile(logger, useCase))
+	routerGroup.DELETE("/:id/references/:referenceId", unlinkFile(logger, useCase))
+	routerGroup.PUT("/:id/legal-hold", placeLegalHold(logger, useCase))
+	routerGroup.DELETE("/:id/legal-hold", releaseLegalHold(logger, useCase))
+	routerGroup.POST("/:id/shares", createShare(logger, useCase, handler.BasePath()))
+	routerGroup.GET("/:id/shares", showShares(logger, useCase, handler.BasePath()))
+	routerGroup.DELETE("/:id/shares/:token", revokeShare(logger, useCase))
+	routerGroup.GET("/:id/access", showFileAccess(logger, useCase))
+	routerGroup.PUT("/:id/access", grantFileAccess(logger, useCase))
+	routerGroup.DELETE("/:id/access/:principalType/:principalId", revokeFileAccess(logger, useCase))
+	routerGroup.GET("/reference/:id/access", showReferenceAccess(logger, useCase))
+	routerGroup.PUT("/reference/:id/access", grantReferenceAccess(logger, useCase))
+	routerGroup.DELETE("/reference/:id/access/:principalType/:principalId", revokeReferenceAccess(logger, useCase))
 	routerGroup.DELETE(":id", deleteFile(logger, useCase))
+	handler.GET("/shares/:token", openShare(logger, useCase))
+	handler.POST("/shares/:token", openProtectedShare(logger, useCase))
+	handler.GET("/tenants/:id/usage", showUsage(logger, useCase))
+	handler.GET("/retention", showRetentionRules(logger, useCase))
+	handler.PUT("/retention", setRetentionRule(logger, useCase))
+	handler.DELETE("/retention", removeRetentionRule(logger, useCase))
 
 }
 
@@ -49,29 +176,194 @@ func pingHandler(ginCtx *gin.Context) {
 // @Accept      json
 // @Produce     json
 // @Param		id	path string	true "FileDto ID"
+// @Param		expiresIn	query int	false "Signed url expiration time in minutes, longer than the tenant maximum is rejected"
+// @Param		includeUnscanned	query bool	false "Include files that are pending or failed the antivirus scan, without urls"
 // @Success     200 {object} Attachments
 // @Failure     400 {string} Error
 // @Failure     500 {string} Error
 // @Router      /files/reference/{id} [get]
-func showFiles(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+func showFiles(logger logger.Logger, useCase UseCase, basePath string) gin.HandlerFunc {
 	return func(ginCtx *gin.Context) {
 		ctx := ginCtx.Copy()
 		var file FileRequest
 		if err := ginCtx.ShouldBindUri(&file); err != nil {
-			logger.Debug(err, "files - showFiles")
+			logger.Ctx(ctx).Debug(err, "files - showFiles")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		var query ShowFilesQuery
+		if err := ginCtx.ShouldBindQuery(&query); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - showFiles")
 			ginCtx.String(http.StatusBadRequest, err.Error())
 			return
 		}
-		result, err := useCase.ListBy(ctx, "tenant1", file.ID)
+		result, err := useCase.ListBy(ctx, "tenant1", models.ListFilesQuery{
+			ReferenceID:      file.ID,
+			UrlExpiresIn:     time.Duration(query.ExpiresIn) * time.Minute,
+			IncludeUnscanned: query.IncludeUnscanned,
+		})
+		if errors.Is(err, ErrUrlExpirationTooLong) {
+			logger.Ctx(ctx).Debug(err, "files - showFiles")
+			ginCtx.String(http.StatusBadRequest, ErrUrlExpirationTooLong.Error())
+			return
+		}
 		if err != nil {
-			logger.Error(err, "files - showFiles")
+			logger.Ctx(ctx).Error(err, "files - showFiles")
 			ginCtx.String(http.StatusInternalServerError, "can't get files")
 			return
 		}
+		fillContentUrls(*result, basePath)
+		ginCtx.JSON(http.StatusOK, *result)
+	}
+}
+
+// fillContentUrls points clean files without a signed url to the download endpoint.
+func fillContentUrls(attachments []models.Attachment, basePath string) {
+	for i := range attachments {
+		if attachments[i].Url == "" && attachments[i].Status == models.FileStatusClean {
+			attachments[i].Url = fmt.Sprintf("%s/%s/content", basePath, attachments[i].ID)
+		}
+	}
+}
+
+// searchFiles godoc
+//
+// @Summary     Search files
+// @Description Get files of the tenant matching every word of q in their name, tags or text, best matches first, and having all the given tags and metadata values, e.g. ?q=quarterly report&tag=signed&metadata[language]=en
+// @ID          search-files
+// @Tags  	    files
+// @Accept      json
+// @Produce     json
+// @Param		q	query string	false "Words to find"
+// @Param		tag	query []string	false "Tag" collectionFormat(multi)
+// @Param		metadata[key]	query string	false "Metadata value of the key"
+// @Param		expiresIn	query int	false "Url expiration time in minutes, longer than the tenant maximum is rejected"
+// @Param		includeUnscanned	query bool	false "Include pending and infected files"
+// @Success     200 {object} Attachments
+// @Failure     400 {string} Error
+// @Failure     500 {string} Error
+// @Failure     501 {string} Error
+// @Router      /files/search [get]
+func searchFiles(logger logger.Logger, useCase UseCase, basePath string) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var query SearchFilesQuery
+		if err := ginCtx.ShouldBindQuery(&query); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - searchFiles")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		metadata := ginCtx.QueryMap("metadata")
+		if strings.TrimSpace(query.Text) == "" && len(query.Tags) == 0 && len(metadata) == 0 {
+			ginCtx.String(http.StatusBadRequest, "q, tag or metadata is required")
+			return
+		}
+		result, err := useCase.SearchFiles(ctx, "tenant1", models.SearchFilesQuery{
+			Text:             query.Text,
+			Filter:           models.FileFilter{Tags: query.Tags, Metadata: metadata},
+			UrlExpiresIn:     time.Duration(query.ExpiresIn) * time.Minute,
+			IncludeUnscanned: query.IncludeUnscanned,
+		})
+		if errors.Is(err, ErrUrlExpirationTooLong) {
+			logger.Ctx(ctx).Debug(err, "files - searchFiles")
+			ginCtx.String(http.StatusBadRequest, ErrUrlExpirationTooLong.Error())
+			return
+		}
+		if errors.Is(err, ErrSearchNotEnabled) {
+			ginCtx.String(http.StatusNotImplemented, ErrSearchNotEnabled.Error())
+			return
+		}
+		if err != nil {
+			logger.Ctx(ctx).Error(err, "files - searchFiles")
+			ginCtx.String(http.StatusInternalServerError, "can't search files")
+			return
+		}
+		fillContentUrls(*result, basePath)
 		ginCtx.JSON(http.StatusOK, *result)
 	}
 }
 
+// downloadArchive godoc
+//
+// @Summary     Download all files as zip
+// @Description Stream a zip archive of the files attached to the reference, optionally narrowed to the given file ids
+// @ID          download-reference-archive
+// @Tags  	    files
+// @Produce     application/zip
+// @Param		id	path string	true "Reference Object ID"
+// @Param		fileId	query []string	false "File IDs to include" collectionFormat(multi)
+// @Success     200 {file} binary
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     404 {string} Error
+// @Failure     409 {string} Error
+// @Failure     500 {string} Error
+// @Router      /files/reference/{id}/archive [get]
+func downloadArchive(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var reference FileRequest
+		if err := ginCtx.ShouldBindUri(&reference); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - downloadArchive")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		var query ArchiveRequestQuery
+		if err := ginCtx.ShouldBindQuery(&query); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - downloadArchive")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := httpserver.ExtendWriteDeadline(ginCtx.Request); err != nil {
+			logger.Ctx(ctx).Warn(err, "files - downloadArchive")
+		}
+		writer := &archiveWriter{ginCtx: ginCtx, fileName: reference.ID + ".zip"}
+		err := useCase.WriteArchive(ctx, "tenant1", models.ArchiveQuery{
+			ReferenceID: reference.ID,
+			FileIDs:     query.FileIDs,
+		}, writer)
+		if err == nil {
+			return
+		}
+		if writer.written {
+			// the archive is already partially sent, all we can do is cut it short
+			logger.Ctx(ctx).Error(err, "files - downloadArchive")
+			_ = ginCtx.Error(err)
+			ginCtx.Abort()
+			return
+		}
+		switch {
+		case errors.Is(err, ErrFileNotFound):
+			ginCtx.String(http.StatusNotFound, err.Error())
+		case errors.Is(err, ErrAccessDenied):
+			ginCtx.String(http.StatusForbidden, ErrAccessDenied.Error())
+		case errors.Is(err, ErrFileNotClean):
+			ginCtx.String(http.StatusConflict, err.Error())
+		default:
+			logger.Ctx(ctx).Error(err, "files - downloadArchive")
+			ginCtx.String(http.StatusInternalServerError, "can't create archive")
+		}
+	}
+}
+
+// archiveWriter sends zip headers with the first chunk, so errors found before it can still be
+// reported with a regular status code.
+type archiveWriter struct {
+	ginCtx   *gin.Context
+	fileName string
+	written  bool
+}
+
+func (writer *archiveWriter) Write(p []byte) (int, error) {
+	if !writer.written {
+		writer.written = true
+		writer.ginCtx.Header("Content-Type", "application/zip")
+		writer.ginCtx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", writer.fileName))
+		writer.ginCtx.Status(http.StatusOK)
+	}
+	return writer.ginCtx.Writer.Write(p)
+}
+
 // uploadFile godoc
 //
 // @Summary     Upload file
@@ -82,28 +374,35 @@ func showFiles(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
 // @Produce     json
 // @Param		file formData file true "FileDto"
 // @Param		referenceObjectId formData string true "Reference Object ID"
+// @Param		tags formData []string false "Tag" collectionFormat(multi)
+// @Param		metadata[key] formData string false "Metadata value of the key"
 // @Success     204
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     413 {string} Error
+// @Failure     429 {string} Error
 // @Failure     500 {string} Error
+// @Failure     503 {string} Error
 // @Router      /files/ [post]
 func uploadFile(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
 	return func(ginCtx *gin.Context) {
 		ctx := ginCtx.Copy()
 		referenceObjectId := ginCtx.PostForm("referenceObjectId")
 		if referenceObjectId == "" {
-			logger.Debug("files - uploadFile - referenceObjectId is empty")
+			logger.Ctx(ctx).Debug("files - uploadFile - referenceObjectId is empty")
 			ginCtx.String(http.StatusBadRequest, "referenceObjectId is empty")
 		}
 
 		file, err := ginCtx.FormFile("file")
 		if err != nil {
-			logger.Debug(err, "files - uploadFile")
+			logger.Ctx(ctx).Debug(err, "files - uploadFile")
 			ginCtx.String(http.StatusBadRequest, "corrupted file")
 			return
 		}
 		filename := filepath.Base(file.Filename)
 		fileHandler, err := file.Open()
 		if err != nil {
-			logger.Debug(err, "files - uploadFile")
+			logger.Ctx(ctx).Debug(err, "files - uploadFile")
 			ginCtx.String(http.StatusBadRequest, "corrupted file")
 			return
 		}
@@ -112,9 +411,39 @@ func uploadFile(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
 			FileName:    filename,
 			ReferenceID: referenceObjectId,
 			File:        fileHandler,
+			Metadata:    ginCtx.PostFormMap("metadata"),
+			Tags:        ginCtx.PostFormArray("tags"),
 		})
+		if errors.Is(err, ErrQueueFull) {
+			logger.Ctx(ctx).Warn(err, "files - uploadFile")
+			ginCtx.String(http.StatusServiceUnavailable, ErrQueueFull.Error())
+			return
+		}
+		if errors.Is(err, ErrStorageUnavailable) {
+			storageUnavailable(ctx, logger, ginCtx, err, "files - uploadFile")
+			return
+		}
+		if errors.Is(err, ErrInvalidMetadata) || errors.Is(err, ErrReservedReference) {
+			logger.Ctx(ctx).Debug(err, "files - uploadFile")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		if errors.Is(err, ErrQuotaExceeded) {
+			logger.Ctx(ctx).Info(err, "files - uploadFile")
+			ginCtx.String(http.StatusRequestEntityTooLarge, ErrQuotaExceeded.Error())
+			return
+		}
+		if errors.Is(err, ErrFileTooLarge) {
+			logger.Ctx(ctx).Info(err, "files - uploadFile")
+			ginCtx.String(http.StatusRequestEntityTooLarge, ErrFileTooLarge.Error())
+			return
+		}
+		if errors.Is(err, ErrAccessDenied) {
+			ginCtx.String(http.StatusForbidden, ErrAccessDenied.Error())
+			return
+		}
 		if err != nil {
-			logger.Error(err, "files - uploadFile")
+			logger.Ctx(ctx).Error(err, "files - uploadFile")
 			ginCtx.String(http.StatusBadRequest, "can't upload file")
 			return
 		}
@@ -122,10 +451,126 @@ func uploadFile(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
 	}
 }
 
+// downloadFile godoc
+//
+// @Summary     Download file
+// @Description Stream file content through the service, used when a signed url can't be issued
+// @ID          download-file-by-id
+// @Tags  	    files
+// @Produce     octet-stream
+// @Param		id	path string	true "FileID"
+// @Success     200 {file} binary
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     404 {string} Error
+// @Failure     409 {string} Error
+// @Failure     500 {string} Error
+// @Failure     503 {string} Error
+// @Router      /files/{id}/content [get]
+func downloadFile(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var file FileRequest
+		if err := ginCtx.ShouldBindUri(&file); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - downloadFile")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		result, err := useCase.DownloadFile(ctx, "tenant1", file.ID)
+		if errors.Is(err, ErrFileNotFound) {
+			ginCtx.String(http.StatusNotFound, ErrFileNotFound.Error())
+			return
+		}
+		if errors.Is(err, ErrFileNotClean) {
+			ginCtx.String(http.StatusConflict, ErrFileNotClean.Error())
+			return
+		}
+		if errors.Is(err, ErrStorageUnavailable) {
+			storageUnavailable(ctx, logger, ginCtx, err, "files - downloadFile")
+			return
+		}
+		if errors.Is(err, ErrAccessDenied) {
+			ginCtx.String(http.StatusForbidden, ErrAccessDenied.Error())
+			return
+		}
+		if err != nil {
+			logger.Ctx(ctx).Error(err, "files - downloadFile")
+			ginCtx.String(http.StatusInternalServerError, "can't download file")
+			return
+		}
+		writeContent(ginCtx, result)
+	}
+}
+
+// writeContent streams the file as an attachment and closes it, with the stream write timeout.
+func writeContent(ginCtx *gin.Context, file *models.FileContent) {
+	defer file.Content.Close()
+	// without it the content is cut off once the regular write timeout passes
+	_ = httpserver.ExtendWriteDeadline(ginCtx.Request)
+	contentType := mime.TypeByExtension(filepath.Ext(file.FileName))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	ginCtx.DataFromReader(http.StatusOK, -1, contentType, file.Content, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=\"%s\"", file.FileName),
+	})
+}
+
+// rotateEncryptionKey godoc
+//
+// @Summary     Rotate file encryption key
+// @Description Re-encrypt file with the tenant's current primary key
+// @ID          rotate-file-encryption-key
+// @Tags  	    files
+// @Accept      json
+// @Produce     json
+// @Param		id	path string	true "FileID"
+// @Success     204
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     404 {string} Error
+// @Failure     409 {string} Error
+// @Failure     500 {string} Error
+// @Router      /files/{id}/rotate-key [post]
+func rotateEncryptionKey(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var file FileRequest
+		if err := ginCtx.ShouldBindUri(&file); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - rotateEncryptionKey")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		err := useCase.RotateEncryptionKey(ctx, "tenant1", file.ID)
+		if errors.Is(err, ErrFileNotFound) {
+			ginCtx.String(http.StatusNotFound, ErrFileNotFound.Error())
+			return
+		}
+		if errors.Is(err, ErrKeyRotationUnsupported) {
+			ginCtx.String(http.StatusBadRequest, ErrKeyRotationUnsupported.Error())
+			return
+		}
+		if errors.Is(err, ErrFileOnLegalHold) {
+			ginCtx.String(http.StatusConflict, ErrFileOnLegalHold.Error())
+			return
+		}
+		if errors.Is(err, ErrAccessDenied) {
+			ginCtx.String(http.StatusForbidden, ErrAccessDenied.Error())
+			return
+		}
+		if err != nil {
+			logger.Ctx(ctx).Error(err, "files - rotateEncryptionKey")
+			ginCtx.String(http.StatusInternalServerError, "can't rotate encryption key")
+			return
+		}
+		ginCtx.Status(http.StatusNoContent)
+	}
+}
+
 // deleteFile godoc
 //
 // @Summary     Remove file
-// @Description Remove file by id
+// @Description Remove file by id, unless it's on legal hold or still retained
 // @ID          remove-file-by-id
 // @Tags  	    files
 // @Accept      json
@@ -133,23 +578,1027 @@ func uploadFile(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
 // @Param		id	path string	true "FileID"
 // @Success     204
 // @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     404 {string} Error
+// @Failure     409 {string} Error
 // @Failure     500 {string} Error
+// @Failure     503 {string} Error
 // @Router      /files/{id} [delete]
 func deleteFile(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
 	return func(ginCtx *gin.Context) {
 		ctx := ginCtx.Copy()
 		var file FileRequest
 		if err := ginCtx.ShouldBindUri(&file); err != nil {
-			logger.Debug(err, "files - deleteFile")
+			logger.Ctx(ctx).Debug(err, "files - deleteFile")
 			ginCtx.String(http.StatusBadRequest, err.Error())
 			return
 		}
 		err := useCase.DeleteFile(ctx, "tenant1", file.ID)
+		if errors.Is(err, ErrFileNotFound) {
+			ginCtx.String(http.StatusNotFound, ErrFileNotFound.Error())
+			return
+		}
+		if errors.Is(err, ErrFileOnLegalHold) {
+			ginCtx.String(http.StatusConflict, ErrFileOnLegalHold.Error())
+			return
+		}
+		if errors.Is(err, ErrFileRetained) {
+			ginCtx.String(http.StatusConflict, ErrFileRetained.Error())
+			return
+		}
+		if errors.Is(err, ErrStorageUnavailable) {
+			storageUnavailable(ctx, logger, ginCtx, err, "files - deleteFile")
+			return
+		}
+		if errors.Is(err, ErrAccessDenied) {
+			ginCtx.String(http.StatusForbidden, ErrAccessDenied.Error())
+			return
+		}
 		if err != nil {
-			logger.Error(err, "files - deleteFile")
+			logger.Ctx(ctx).Error(err, "files - deleteFile")
 			ginCtx.String(http.StatusInternalServerError, "can't remove file")
 			return
 		}
 		ginCtx.Status(http.StatusNoContent)
 	}
 }
+
+// copyFile godoc
+//
+// @Summary     Copy file
+// @Description Copy a clean file to the reference, optionally under another name; the content is copied by the storage
+// @ID          copy-file
+// @Tags  	    files
+// @Accept      json
+// @Produce     json
+// @Param		id	path string	true "File ID"
+// @Param		copy	body CopyFileBody	true "Target reference and name"
+// @Success     201 {object} models.Attachment
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     404 {string} Error
+// @Failure     409 {string} Error
+// @Failure     413 {string} Error
+// @Failure     500 {string} Error
+// @Failure     503 {string} Error
+// @Router      /files/{id}/copy [post]
+func copyFile(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var file FileRequest
+		if err := ginCtx.ShouldBindUri(&file); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - copyFile")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		var body CopyFileBody
+		if err := ginCtx.ShouldBindJSON(&body); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - copyFile")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		copied, err := useCase.CopyFile(ctx, "tenant1", models.CopyFileCommand{
+			FileID:      file.ID,
+			ReferenceID: body.ReferenceID,
+			FileName:    body.FileName,
+			CreatorId:   "UserId",
+		})
+		if err != nil {
+			relocationFailed(ctx, logger, ginCtx, err, "files - copyFile", "can't copy file")
+			return
+		}
+		ginCtx.JSON(http.StatusCreated, copied)
+	}
+}
+
+// moveFile godoc
+//
+// @Summary     Move or rename file
+// @Description Attach a clean file to another reference and/or rename it; omitted fields are kept
+// @ID          move-file
+// @Tags  	    files
+// @Accept      json
+// @Produce     json
+// @Param		id	path string	true "File ID"
+// @Param		move	body MoveFileBody	true "New reference and name"
+// @Success     200 {object} models.Attachment
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     404 {string} Error
+// @Failure     409 {string} Error
+// @Failure     413 {string} Error
+// @Failure     500 {string} Error
+// @Failure     503 {string} Error
+// @Router      /files/{id} [patch]
+func moveFile(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var file FileRequest
+		if err := ginCtx.ShouldBindUri(&file); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - moveFile")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		var body MoveFileBody
+		if err := ginCtx.ShouldBindJSON(&body); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - moveFile")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		moved, err := useCase.MoveFile(ctx, "tenant1", models.MoveFileCommand{
+			FileID:      file.ID,
+			ReferenceID: body.ReferenceID,
+			FileName:    body.FileName,
+		})
+		if err != nil {
+			relocationFailed(ctx, logger, ginCtx, err, "files - moveFile", "can't move file")
+			return
+		}
+		ginCtx.JSON(http.StatusOK, moved)
+	}
+}
+
+// updateMetadata godoc
+//
+// @Summary     Update file metadata
+// @Description Merge key/value metadata of the file, an empty value removes the key, and replace its tags when given
+// @ID          update-file-metadata
+// @Tags  	    files
+// @Accept      json
+// @Produce     json
+// @Param		id	path string	true "File ID"
+// @Param		metadata	body UpdateMetadataBody	true "Metadata and tags"
+// @Success     200 {object} models.Attachment
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     404 {string} Error
+// @Failure     500 {string} Error
+// @Failure     503 {string} Error
+// @Router      /files/{id}/metadata [patch]
+func updateMetadata(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var file FileRequest
+		if err := ginCtx.ShouldBindUri(&file); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - updateMetadata")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		var body UpdateMetadataBody
+		if err := ginCtx.ShouldBindJSON(&body); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - updateMetadata")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		updated, err := useCase.UpdateMetadata(ctx, "tenant1", models.UpdateMetadataCommand{
+			FileID:   file.ID,
+			Metadata: body.Metadata,
+			Tags:     body.Tags,
+		})
+		switch {
+		case errors.Is(err, ErrFileNotFound):
+			ginCtx.String(http.StatusNotFound, ErrFileNotFound.Error())
+		case errors.Is(err, ErrInvalidMetadata):
+			logger.Ctx(ctx).Debug(err, "files - updateMetadata")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+		case errors.Is(err, ErrStorageUnavailable):
+			storageUnavailable(ctx, logger, ginCtx, err, "files - updateMetadata")
+		case errors.Is(err, ErrAccessDenied):
+			ginCtx.String(http.StatusForbidden, ErrAccessDenied.Error())
+		case err != nil:
+			logger.Ctx(ctx).Error(err, "files - updateMetadata")
+			ginCtx.String(http.StatusInternalServerError, "can't update metadata")
+		default:
+			ginCtx.JSON(http.StatusOK, updated)
+		}
+	}
+}
+
+// linkFile godoc
+//
+// @Summary     Link file
+// @Description Attach a clean file to one more reference without copying it; linking it again does nothing
+// @ID          link-file
+// @Tags  	    files
+// @Produce     json
+// @Param		id	path string	true "File ID"
+// @Param		referenceId	path string	true "Reference Object ID"
+// @Success     204
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     404 {string} Error
+// @Failure     409 {string} Error
+// @Failure     500 {string} Error
+// @Router      /files/{id}/references/{referenceId} [put]
+func linkFile(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var link FileLinkRequest
+		if err := ginCtx.ShouldBindUri(&link); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - linkFile")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		err := useCase.LinkFile(ctx, "tenant1", link.ID, link.ReferenceID)
+		if err != nil {
+			relocationFailed(ctx, logger, ginCtx, err, "files - linkFile", "can't link file")
+			return
+		}
+		ginCtx.Status(http.StatusNoContent)
+	}
+}
+
+// unlinkFile godoc
+//
+// @Summary     Unlink file
+// @Description Detach the file from the reference; the file is deleted when it was its last reference
+// @ID          unlink-file
+// @Tags  	    files
+// @Produce     json
+// @Param		id	path string	true "File ID"
+// @Param		referenceId	path string	true "Reference Object ID"
+// @Success     204
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     404 {string} Error
+// @Failure     409 {string} Error
+// @Failure     500 {string} Error
+// @Failure     503 {string} Error
+// @Router      /files/{id}/references/{referenceId} [delete]
+func unlinkFile(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var link FileLinkRequest
+		if err := ginCtx.ShouldBindUri(&link); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - unlinkFile")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		err := useCase.UnlinkFile(ctx, "tenant1", link.ID, link.ReferenceID)
+		if errors.Is(err, ErrLinkNotFound) {
+			ginCtx.String(http.StatusNotFound, ErrLinkNotFound.Error())
+			return
+		}
+		if err != nil {
+			relocationFailed(ctx, logger, ginCtx, err, "files - unlinkFile", "can't unlink file")
+			return
+		}
+		ginCtx.Status(http.StatusNoContent)
+	}
+}
+
+// placeLegalHold godoc
+//
+// @Summary     Place legal hold
+// @Description Place a legal hold on the file; held files can't be deleted, moved or re-encrypted until it's released
+// @ID          place-file-legal-hold
+// @Tags  	    files
+// @Produce     json
+// @Param		id	path string	true "File ID"
+// @Success     204
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     404 {string} Error
+// @Failure     500 {string} Error
+// @Failure     503 {string} Error
+// @Router      /files/{id}/legal-hold [put]
+func placeLegalHold(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return setLegalHold(logger, useCase, true)
+}
+
+// releaseLegalHold godoc
+//
+// @Summary     Release legal hold
+// @Description Release the legal hold of the file
+// @ID          release-file-legal-hold
+// @Tags  	    files
+// @Produce     json
+// @Param		id	path string	true "File ID"
+// @Success     204
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     404 {string} Error
+// @Failure     500 {string} Error
+// @Failure     503 {string} Error
+// @Router      /files/{id}/legal-hold [delete]
+func releaseLegalHold(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return setLegalHold(logger, useCase, false)
+}
+
+func setLegalHold(logger logger.Logger, useCase UseCase, hold bool) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var file FileRequest
+		if err := ginCtx.ShouldBindUri(&file); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - setLegalHold")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		err := useCase.SetLegalHold(ctx, "tenant1", file.ID, hold)
+		switch {
+		case errors.Is(err, ErrFileNotFound):
+			ginCtx.String(http.StatusNotFound, ErrFileNotFound.Error())
+		case errors.Is(err, ErrStorageUnavailable):
+			storageUnavailable(ctx, logger, ginCtx, err, "files - setLegalHold")
+		case errors.Is(err, ErrAccessDenied):
+			ginCtx.String(http.StatusForbidden, ErrAccessDenied.Error())
+		case err != nil:
+			logger.Ctx(ctx).Error(err, "files - setLegalHold")
+			ginCtx.String(http.StatusInternalServerError, "can't set legal hold")
+		default:
+			ginCtx.Status(http.StatusNoContent)
+		}
+	}
+}
+
+// createShare godoc
+//
+// @Summary     Share file
+// @Description Create a link to a clean file served by the app until it expires, is revoked or runs out of downloads; an optional password is asked for when it's opened
+// @ID          create-file-share
+// @Tags  	    shares
+// @Accept      json
+// @Produce     json
+// @Param		id	path string	true "File ID"
+// @Param		share	body CreateShareBody	true "Expiration in minutes, download limit and password"
+// @Success     201 {object} models.ShareLink
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     404 {string} Error
+// @Failure     409 {string} Error
+// @Failure     500 {string} Error
+// @Failure     501 {string} Error
+// @Router      /files/{id}/shares [post]
+func createShare(logger logger.Logger, useCase UseCase, basePath string) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var file FileRequest
+		if err := ginCtx.ShouldBindUri(&file); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - createShare")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		var body CreateShareBody
+		if err := ginCtx.ShouldBindJSON(&body); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - createShare")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		link, err := useCase.CreateShare(ctx, "tenant1", models.CreateShareCommand{
+			FileID:       file.ID,
+			ExpiresIn:    time.Duration(body.ExpiresIn) * time.Minute,
+			MaxDownloads: body.MaxDownloads,
+			Password:     body.Password,
+			CreatorId:    "UserId",
+		})
+		switch {
+		case errors.Is(err, ErrFileNotFound):
+			ginCtx.String(http.StatusNotFound, ErrFileNotFound.Error())
+		case errors.Is(err, ErrInvalidShare):
+			logger.Ctx(ctx).Debug(err, "files - createShare")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+		case errors.Is(err, ErrFileNotClean):
+			ginCtx.String(http.StatusConflict, ErrFileNotClean.Error())
+		case errors.Is(err, ErrSharingNotEnabled):
+			ginCtx.String(http.StatusNotImplemented, ErrSharingNotEnabled.Error())
+		case errors.Is(err, ErrAccessDenied):
+			ginCtx.String(http.StatusForbidden, ErrAccessDenied.Error())
+		case err != nil:
+			logger.Ctx(ctx).Error(err, "files - createShare")
+			ginCtx.String(http.StatusInternalServerError, "can't share file")
+		default:
+			link.Url = makeShareUrl(basePath, link.Token)
+			ginCtx.JSON(http.StatusCreated, link)
+		}
+	}
+}
+
+// showShares godoc
+//
+// @Summary     Show shares
+// @Description Get links to the file that haven't expired nor run out of downloads
+// @ID          get-file-shares
+// @Tags  	    shares
+// @Produce     json
+// @Param		id	path string	true "File ID"
+// @Success     200 {object} ShareLinks
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     404 {string} Error
+// @Failure     500 {string} Error
+// @Failure     501 {string} Error
+// @Router      /files/{id}/shares [get]
+func showShares(logger logger.Logger, useCase UseCase, basePath string) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var file FileRequest
+		if err := ginCtx.ShouldBindUri(&file); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - showShares")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		links, err := useCase.ListShares(ctx, "tenant1", file.ID)
+		switch {
+		case errors.Is(err, ErrFileNotFound):
+			ginCtx.String(http.StatusNotFound, ErrFileNotFound.Error())
+		case errors.Is(err, ErrSharingNotEnabled):
+			ginCtx.String(http.StatusNotImplemented, ErrSharingNotEnabled.Error())
+		case errors.Is(err, ErrAccessDenied):
+			ginCtx.String(http.StatusForbidden, ErrAccessDenied.Error())
+		case err != nil:
+			logger.Ctx(ctx).Error(err, "files - showShares")
+			ginCtx.String(http.StatusInternalServerError, "can't get shares")
+		default:
+			for i := range links {
+				links[i].Url = makeShareUrl(basePath, links[i].Token)
+			}
+			ginCtx.JSON(http.StatusOK, links)
+		}
+	}
+}
+
+// revokeShare godoc
+//
+// @Summary     Revoke share
+// @Description Remove the link to the file, it stops working at once
+// @ID          revoke-file-share
+// @Tags  	    shares
+// @Produce     json
+// @Param		id	path string	true "File ID"
+// @Param		token	path string	true "Share token"
+// @Success     204
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     404 {string} Error
+// @Failure     500 {string} Error
+// @Failure     501 {string} Error
+// @Router      /files/{id}/shares/{token} [delete]
+func revokeShare(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var share ShareRequest
+		if err := ginCtx.ShouldBindUri(&share); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - revokeShare")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		err := useCase.RevokeShare(ctx, "tenant1", share.Token)
+		switch {
+		case errors.Is(err, ErrShareNotFound):
+			ginCtx.String(http.StatusNotFound, ErrShareNotFound.Error())
+		case errors.Is(err, ErrSharingNotEnabled):
+			ginCtx.String(http.StatusNotImplemented, ErrSharingNotEnabled.Error())
+		case errors.Is(err, ErrAccessDenied):
+			ginCtx.String(http.StatusForbidden, ErrAccessDenied.Error())
+		case err != nil:
+			logger.Ctx(ctx).Error(err, "files - revokeShare")
+			ginCtx.String(http.StatusInternalServerError, "can't revoke share")
+		default:
+			ginCtx.Status(http.StatusNoContent)
+		}
+	}
+}
+
+// openShare godoc
+//
+// @Summary     Open share
+// @Description Download the shared file: redirects to a short-lived signed url, or streams the file when it can't be signed
+// @ID          open-share
+// @Tags  	    shares
+// @Produce     octet-stream
+// @Param		token	path string	true "Share token"
+// @Success     200 {file} binary
+// @Success     302
+// @Failure     400 {string} Error
+// @Failure     401 {string} Error
+// @Failure     403 {string} Error
+// @Failure     404 {string} Error
+// @Failure     409 {string} Error
+// @Failure     410 {string} Error
+// @Failure     500 {string} Error
+// @Failure     501 {string} Error
+// @Failure     503 {string} Error
+// @Router      /shares/{token} [get]
+func openShare(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return serveShare(logger, useCase)
+}
+
+// openProtectedShare godoc
+//
+// @Summary     Open protected share
+// @Description Download the shared file protected by a password, e.g. from an html form; answers like opening an unprotected share
+// @ID          open-protected-share
+// @Tags  	    shares
+// @Accept      x-www-form-urlencoded
+// @Produce     octet-stream
+// @Param		token	path string	true "Share token"
+// @Param		password	formData string	true "Password of the link"
+// @Success     200 {file} binary
+// @Success     302
+// @Failure     400 {string} Error
+// @Failure     401 {string} Error
+// @Failure     403 {string} Error
+// @Failure     404 {string} Error
+// @Failure     409 {string} Error
+// @Failure     410 {string} Error
+// @Failure     500 {string} Error
+// @Failure     501 {string} Error
+// @Failure     503 {string} Error
+// @Router      /shares/{token} [post]
+func openProtectedShare(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return serveShare(logger, useCase)
+}
+
+// serveShare opens the share with the password of the form, if any.
+func serveShare(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var share OpenShareRequest
+		if err := ginCtx.ShouldBindUri(&share); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - openShare")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		result, err := useCase.OpenShare(ctx, share.Token, ginCtx.PostForm("password"))
+		switch {
+		case errors.Is(err, ErrShareNotFound):
+			ginCtx.String(http.StatusNotFound, ErrShareNotFound.Error())
+		case errors.Is(err, ErrSharePasswordInvalid):
+			ginCtx.String(http.StatusUnauthorized, ErrSharePasswordInvalid.Error())
+		case errors.Is(err, ErrShareLocked):
+			ginCtx.String(http.StatusForbidden, ErrShareLocked.Error())
+		case errors.Is(err, ErrShareExpired):
+			ginCtx.String(http.StatusGone, ErrShareExpired.Error())
+		case errors.Is(err, ErrShareExhausted):
+			ginCtx.String(http.StatusGone, ErrShareExhausted.Error())
+		case errors.Is(err, ErrFileNotClean):
+			ginCtx.String(http.StatusConflict, ErrFileNotClean.Error())
+		case errors.Is(err, ErrSharingNotEnabled):
+			ginCtx.String(http.StatusNotImplemented, ErrSharingNotEnabled.Error())
+		case errors.Is(err, ErrStorageUnavailable):
+			storageUnavailable(ctx, logger, ginCtx, err, "files - openShare")
+		case err != nil:
+			logger.Ctx(ctx).Error(err, "files - openShare")
+			ginCtx.String(http.StatusInternalServerError, "can't open share")
+		case result.Content != nil:
+			writeContent(ginCtx, result.Content)
+		default:
+			// the signed url is short-lived, so it mustn't be served again from a cache
+			ginCtx.Header("Cache-Control", "no-store")
+			ginCtx.Redirect(http.StatusFound, result.Url)
+		}
+	}
+}
+
+func makeShareUrl(basePath, token string) string {
+	return fmt.Sprintf("%s/shares/%s", basePath, token)
+}
+
+// showFileAccess godoc
+//
+// @Summary     Show file access
+// @Description Get grants on the file itself; grants on its references apply to it too
+// @ID          get-file-access
+// @Tags  	    access
+// @Produce     json
+// @Param		id	path string	true "File ID"
+// @Success     200 {object} Grants
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     404 {string} Error
+// @Failure     500 {string} Error
+// @Failure     501 {string} Error
+// @Router      /files/{id}/access [get]
+func showFileAccess(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var file FileRequest
+		if err := ginCtx.ShouldBindUri(&file); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - showFileAccess")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		grants, err := useCase.ListFileAccess(ctx, "tenant1", file.ID)
+		if err != nil {
+			accessFailed(ctx, logger, ginCtx, err, "files - showFileAccess", "can't get access")
+			return
+		}
+		ginCtx.JSON(http.StatusOK, grants)
+	}
+}
+
+// grantFileAccess godoc
+//
+// @Summary     Grant file access
+// @Description Give the user or group a role on the file: readers list and download it, writers also change and share it, owners also manage its access
+// @ID          grant-file-access
+// @Tags  	    access
+// @Accept      json
+// @Produce     json
+// @Param		id	path string	true "File ID"
+// @Param		grant	body GrantBody	true "Principal and role"
+// @Success     204
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     404 {string} Error
+// @Failure     409 {string} Error
+// @Failure     500 {string} Error
+// @Failure     501 {string} Error
+// @Router      /files/{id}/access [put]
+func grantFileAccess(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var file FileRequest
+		if err := ginCtx.ShouldBindUri(&file); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - grantFileAccess")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		var body GrantBody
+		if err := ginCtx.ShouldBindJSON(&body); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - grantFileAccess")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		err := useCase.GrantFileAccess(ctx, "tenant1", file.ID, body.grant())
+		if err != nil {
+			accessFailed(ctx, logger, ginCtx, err, "files - grantFileAccess", "can't grant access")
+			return
+		}
+		ginCtx.Status(http.StatusNoContent)
+	}
+}
+
+// revokeFileAccess godoc
+//
+// @Summary     Revoke file access
+// @Description Remove the grant of the user or group on the file; the last owner can't be removed
+// @ID          revoke-file-access
+// @Tags  	    access
+// @Produce     json
+// @Param		id	path string	true "File ID"
+// @Param		principalType	path string	true "user or group"
+// @Param		principalId	path string	true "User or group ID"
+// @Success     204
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     404 {string} Error
+// @Failure     409 {string} Error
+// @Failure     500 {string} Error
+// @Failure     501 {string} Error
+// @Router      /files/{id}/access/{principalType}/{principalId} [delete]
+func revokeFileAccess(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var request AccessRequest
+		if err := ginCtx.ShouldBindUri(&request); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - revokeFileAccess")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		err := useCase.RevokeFileAccess(ctx, "tenant1", request.ID, models.PrincipalType(request.PrincipalType), request.PrincipalID)
+		if err != nil {
+			accessFailed(ctx, logger, ginCtx, err, "files - revokeFileAccess", "can't revoke access")
+			return
+		}
+		ginCtx.Status(http.StatusNoContent)
+	}
+}
+
+// showReferenceAccess godoc
+//
+// @Summary     Show reference access
+// @Description Get grants on the reference, which apply to all files attached to it; empty until someone adds files to it
+// @ID          get-reference-access
+// @Tags  	    access
+// @Produce     json
+// @Param		id	path string	true "Reference Object ID"
+// @Success     200 {object} Grants
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     500 {string} Error
+// @Failure     501 {string} Error
+// @Router      /files/reference/{id}/access [get]
+func showReferenceAccess(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var reference FileRequest
+		if err := ginCtx.ShouldBindUri(&reference); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - showReferenceAccess")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		grants, err := useCase.ListReferenceAccess(ctx, "tenant1", reference.ID)
+		if err != nil {
+			accessFailed(ctx, logger, ginCtx, err, "files - showReferenceAccess", "can't get access")
+			return
+		}
+		ginCtx.JSON(http.StatusOK, grants)
+	}
+}
+
+// grantReferenceAccess godoc
+//
+// @Summary     Grant reference access
+// @Description Give the user or group a role on all files attached to the reference; writers can also attach files to it
+// @ID          grant-reference-access
+// @Tags  	    access
+// @Accept      json
+// @Produce     json
+// @Param		id	path string	true "Reference Object ID"
+// @Param		grant	body GrantBody	true "Principal and role"
+// @Success     204
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     409 {string} Error
+// @Failure     500 {string} Error
+// @Failure     501 {string} Error
+// @Router      /files/reference/{id}/access [put]
+func grantReferenceAccess(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var reference FileRequest
+		if err := ginCtx.ShouldBindUri(&reference); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - grantReferenceAccess")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		var body GrantBody
+		if err := ginCtx.ShouldBindJSON(&body); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - grantReferenceAccess")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		err := useCase.GrantReferenceAccess(ctx, "tenant1", reference.ID, body.grant())
+		if err != nil {
+			accessFailed(ctx, logger, ginCtx, err, "files - grantReferenceAccess", "can't grant access")
+			return
+		}
+		ginCtx.Status(http.StatusNoContent)
+	}
+}
+
+// revokeReferenceAccess godoc
+//
+// @Summary     Revoke reference access
+// @Description Remove the grant of the user or group on the reference; the last owner can't be removed
+// @ID          revoke-reference-access
+// @Tags  	    access
+// @Produce     json
+// @Param		id	path string	true "Reference Object ID"
+// @Param		principalType	path string	true "user or group"
+// @Param		principalId	path string	true "User or group ID"
+// @Success     204
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     404 {string} Error
+// @Failure     409 {string} Error
+// @Failure     500 {string} Error
+// @Failure     501 {string} Error
+// @Router      /files/reference/{id}/access/{principalType}/{principalId} [delete]
+func revokeReferenceAccess(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var request AccessRequest
+		if err := ginCtx.ShouldBindUri(&request); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - revokeReferenceAccess")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		err := useCase.RevokeReferenceAccess(ctx, "tenant1", request.ID, models.PrincipalType(request.PrincipalType), request.PrincipalID)
+		if err != nil {
+			accessFailed(ctx, logger, ginCtx, err, "files - revokeReferenceAccess", "can't revoke access")
+			return
+		}
+		ginCtx.Status(http.StatusNoContent)
+	}
+}
+
+func (body GrantBody) grant() models.Grant {
+	return models.Grant{
+		PrincipalType: models.PrincipalType(body.PrincipalType),
+		PrincipalID:   body.PrincipalID,
+		Role:          models.Role(body.Role),
+	}
+}
+
+// accessFailed maps errors of managing grants to responses.
+func accessFailed(ctx context.Context, logger logger.Logger, ginCtx *gin.Context, err error, source, message string) {
+	switch {
+	case errors.Is(err, ErrFileNotFound):
+		ginCtx.String(http.StatusNotFound, ErrFileNotFound.Error())
+	case errors.Is(err, ErrGrantNotFound):
+		ginCtx.String(http.StatusNotFound, ErrGrantNotFound.Error())
+	case errors.Is(err, ErrInvalidGrant):
+		logger.Ctx(ctx).Debug(err, source)
+		ginCtx.String(http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrAccessDenied):
+		ginCtx.String(http.StatusForbidden, ErrAccessDenied.Error())
+	case errors.Is(err, ErrLastOwner):
+		ginCtx.String(http.StatusConflict, ErrLastOwner.Error())
+	case errors.Is(err, ErrAccessControlDisabled):
+		ginCtx.String(http.StatusNotImplemented, ErrAccessControlDisabled.Error())
+	default:
+		logger.Ctx(ctx).Error(err, source)
+		ginCtx.String(http.StatusInternalServerError, message)
+	}
+}
+
+// relocationFailed maps errors of copying, moving and linking files to responses.
+func relocationFailed(ctx context.Context, logger logger.Logger, ginCtx *gin.Context, err error, source, message string) {
+	switch {
+	case errors.Is(err, ErrFileNotFound):
+		ginCtx.String(http.StatusNotFound, ErrFileNotFound.Error())
+	case errors.Is(err, ErrAccessDenied):
+		ginCtx.String(http.StatusForbidden, ErrAccessDenied.Error())
+	case errors.Is(err, ErrInvalidFileName):
+		ginCtx.String(http.StatusBadRequest, ErrInvalidFileName.Error())
+	case errors.Is(err, ErrReservedReference):
+		ginCtx.String(http.StatusBadRequest, ErrReservedReference.Error())
+	case errors.Is(err, ErrFileNotClean):
+		ginCtx.String(http.StatusConflict, ErrFileNotClean.Error())
+	case errors.Is(err, ErrFileOnLegalHold):
+		ginCtx.String(http.StatusConflict, ErrFileOnLegalHold.Error())
+	case errors.Is(err, ErrFileRetained):
+		ginCtx.String(http.StatusConflict, ErrFileRetained.Error())
+	case errors.Is(err, ErrQuotaExceeded):
+		logger.Ctx(ctx).Info(err, source)
+		ginCtx.String(http.StatusRequestEntityTooLarge, ErrQuotaExceeded.Error())
+	case errors.Is(err, ErrStorageUnavailable):
+		storageUnavailable(ctx, logger, ginCtx, err, source)
+	default:
+		logger.Ctx(ctx).Error(err, source)
+		ginCtx.String(http.StatusInternalServerError, message)
+	}
+}
+
+// storageUnavailable answers with 503 while the storage circuit is open; clients should come back later.
+func storageUnavailable(ctx context.Context, logger logger.Logger, ginCtx *gin.Context, err error, source string) {
+	logger.Ctx(ctx).Warn(err, source)
+	ginCtx.String(http.StatusServiceUnavailable, ErrStorageUnavailable.Error())
+}
+
+// showUsage godoc
+//
+// @Summary     Show storage usage
+// @Description Get stored bytes and file count of the tenant with its quota, and of the reference when referenceId is given; zero limits are unlimited
+// @ID          get-tenant-usage
+// @Tags  	    tenants
+// @Produce     json
+// @Param		id	path string	true "Tenant ID"
+// @Param		referenceId	query string	false "Reference Object ID"
+// @Success     200 {object} models.Usage
+// @Failure     400 {string} Error
+// @Failure     404 {string} Error
+// @Failure     500 {string} Error
+// @Failure     501 {string} Error
+// @Router      /tenants/{id}/usage [get]
+func showUsage(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var request UsageRequest
+		if err := ginCtx.ShouldBindUri(&request); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - showUsage")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		var query UsageQuery
+		if err := ginCtx.ShouldBindQuery(&query); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - showUsage")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		// callers only see the usage of their own tenant
+		tenant := "tenant1"
+		if request.TenantID != tenant {
+			ginCtx.String(http.StatusNotFound, "tenant not found")
+			return
+		}
+		usage, err := useCase.Usage(ctx, tenant, query.ReferenceID)
+		if errors.Is(err, ErrUsageNotTracked) {
+			ginCtx.String(http.StatusNotImplemented, ErrUsageNotTracked.Error())
+			return
+		}
+		if err != nil {
+			logger.Ctx(ctx).Error(err, "files - showUsage")
+			ginCtx.String(http.StatusInternalServerError, "can't read usage")
+			return
+		}
+		ginCtx.JSON(http.StatusOK, usage)
+	}
+}
+
+// showRetentionRules godoc
+//
+// @Summary     Show retention rules
+// @Description Get retention rules of the tenant; the rule without referenceId applies to references without their own
+// @ID          get-tenant-retention-rules
+// @Tags  	    tenants
+// @Produce     json
+// @Success     200 {object} RetentionRules
+// @Failure     500 {string} Error
+// @Failure     501 {string} Error
+// @Router      /retention [get]
+func showRetentionRules(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		rules, err := useCase.ListRetentionRules(ctx, "tenant1")
+		if errors.Is(err, ErrRetentionNotEnabled) {
+			ginCtx.String(http.StatusNotImplemented, ErrRetentionNotEnabled.Error())
+			return
+		}
+		if err != nil {
+			logger.Ctx(ctx).Error(err, "files - showRetentionRules")
+			ginCtx.String(http.StatusInternalServerError, "can't read retention rules")
+			return
+		}
+		ginCtx.JSON(http.StatusOK, rules)
+	}
+}
+
+// setRetentionRule godoc
+//
+// @Summary     Set retention rule
+// @Description Set the retention rule of the tenant, or of the reference when referenceId is given; files can't be deleted for retainDays after upload and are deleted after expireDays, zero disables either
+// @ID          set-tenant-retention-rule
+// @Tags  	    tenants
+// @Accept      json
+// @Produce     json
+// @Param		rule	body RetentionRuleBody	true "Retention rule"
+// @Success     204
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     500 {string} Error
+// @Failure     501 {string} Error
+// @Router      /retention [put]
+func setRetentionRule(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var body RetentionRuleBody
+		if err := ginCtx.ShouldBindJSON(&body); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - setRetentionRule")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		err := useCase.SetRetentionRule(ctx, "tenant1", models.RetentionRule{
+			ReferenceID: body.ReferenceID,
+			RetainDays:  body.RetainDays,
+			ExpireDays:  body.ExpireDays,
+		})
+		switch {
+		case errors.Is(err, ErrInvalidRetentionRule):
+			logger.Ctx(ctx).Debug(err, "files - setRetentionRule")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+		case errors.Is(err, ErrAccessDenied):
+			ginCtx.String(http.StatusForbidden, ErrAccessDenied.Error())
+		case errors.Is(err, ErrRetentionNotEnabled):
+			ginCtx.String(http.StatusNotImplemented, ErrRetentionNotEnabled.Error())
+		case err != nil:
+			logger.Ctx(ctx).Error(err, "files - setRetentionRule")
+			ginCtx.String(http.StatusInternalServerError, "can't set retention rule")
+		default:
+			ginCtx.Status(http.StatusNoContent)
+		}
+	}
+}
+
+// removeRetentionRule godoc
+//
+// @Summary     Remove retention rule
+// @Description Remove the retention rule of the reference, or of the tenant when referenceId isn't given
+// @ID          remove-tenant-retention-rule
+// @Tags  	    tenants
+// @Produce     json
+// @Param		referenceId	query string	false "Reference Object ID"
+// @Success     204
+// @Failure     400 {string} Error
+// @Failure     403 {string} Error
+// @Failure     404 {string} Error
+// @Failure     500 {string} Error
+// @Failure     501 {string} Error
+// @Router      /retention [delete]
+func removeRetentionRule(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var query RetentionQuery
+		if err := ginCtx.ShouldBindQuery(&query); err != nil {
+			logger.Ctx(ctx).Debug(err, "files - removeRetentionRule")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		err := useCase.RemoveRetentionRule(ctx, "tenant1", query.ReferenceID)
+		switch {
+		case errors.Is(err, ErrRetentionRuleNotFound):
+			ginCtx.String(http.StatusNotFound, ErrRetentionRuleNotFound.Error())
+		case errors.Is(err, ErrAccessDenied):
+			ginCtx.String(http.StatusForbidden, ErrAccessDenied.Error())
+		case errors.Is(err, ErrRetentionNotEnabled):
+			ginCtx.String(http.StatusNotImplemented, ErrRetentionNotEnabled.Error())
+		case err != nil:
+			logger.Ctx(ctx).Error(err, "files - removeRetentionRule")
+			ginCtx.String(http.StatusInternalServerError, "can't remove retention rule")
+		default:
+			ginCtx.Status(http.StatusNoContent)
+		}
+	}
+}
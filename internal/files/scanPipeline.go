@@ -0,0 +1,174 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/logger"
+)
+
+const _quarantinePrefix = "quarantine"
+
+// _maxScanRetryDelay caps the backoff of files the scanner failed on.
+const _maxScanRetryDelay = 5 * time.Minute
+
+// ScanPipeline scans uploaded files in the background. Clean files are marked as such and
+// handed to the next pipelines, infected ones are moved under the quarantine prefix of their
+// tenant, so they stay encrypted like the rest of its files, and never served again. Infected
+// deduplicated files leave the shared object for one of their own in quarantine, the shared
+// object goes with the last of them. Files the scanner fails on stay pending and are scanned
+// again after a backoff starting at retryDelay, up to maxAttempts scans; after that they're marked
+// as scan_failed and their content is let go.
+type ScanPipeline struct {
+	scanner        ports.Scanner
+	fileStorage    ports.FileStorage
+	fileRepository ports.FileRepository
+	queue          *jobQueue
+	next           []fileProcessor
+	contents       *contentStore
+	retryDelay     time.Duration
+	maxAttempts    int
+}
+
+func NewScanPipeline(scanner ports.Scanner, fileStorage ports.FileStorage, fileRepository ports.FileRepository, logger logger.Logger, workers, queueSize int, retryDelay time.Duration, maxAttempts int) *ScanPipeline {
+	if retryDelay <= 0 {
+		retryDelay = time.Second
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	pipeline := &ScanPipeline{
+		scanner:        scanner,
+		fileStorage:    fileStorage,
+		fileRepository: fileRepository,
+		retryDelay:     retryDelay,
+		maxAttempts:    maxAttempts,
+	}
+	pipeline.queue = newJobQueue("ScanPipeline", workers, queueSize, logger, pipeline.process)
+	return pipeline
+}
+
+// Start runs the workers until ctx is cancelled.
+func (pipeline *ScanPipeline) Start(ctx context.Context) {
+	pipeline.queue.start(ctx)
+}
+
+// Wait blocks until all workers have stopped.
+func (pipeline *ScanPipeline) Wait() {
+	pipeline.queue.wait()
+}
+
+func (pipeline *ScanPipeline) Enqueue(tenant, fileID string, content []byte) error {
+	return pipeline.queue.enqueue(fileJob{tenant: tenant, fileID: fileID, content: content})
+}
+
+func (pipeline *ScanPipeline) process(ctx context.Context, job fileJob) error {
+	result, err := pipeline.scanner.Scan(ctx, bytes.NewReader(job.content))
+	if err != nil {
+		if job.attempt+1 >= pipeline.maxAttempts {
+			return pipeline.giveUp(ctx, job, err)
+		}
+		delay := scanRetryDelay(pipeline.retryDelay, job.attempt)
+		job.attempt++
+		pipeline.queue.requeue(ctx, job, delay)
+		return fmt.Errorf("ScanPipeline - process: can't scan file %s, it stays pending and is scanned again in %s; %w", job.fileID, delay, err)
+	}
+	file, err := pipeline.fileRepository.ReadBy(ctx, job.tenant, job.fileID)
+	if err != nil {
+		return fmt.Errorf("ScanPipeline - process: can't read file %s; %w", job.fileID, err)
+	}
+	if file == nil || file.ID == "" {
+		return nil
+	}
+	if result.Infected {
+		return pipeline.isolate(ctx, job, file, result.Signature)
+	}
+	if err := pipeline.fileRepository.UpdateStatus(ctx, job.tenant, job.fileID, models.FileStatusClean); err != nil {
+		return fmt.Errorf("ScanPipeline - process: can't update file %s status; %w", job.fileID, err)
+	}
+	var handOverErr error
+	for _, next := range pipeline.next {
+		// every pipeline gets the file, even when the one before is full
+		if err := next.Enqueue(job.tenant, job.fileID, job.content); err != nil && handOverErr == nil {
+			handOverErr = err
+		}
+	}
+	if handOverErr != nil {
+		return fmt.Errorf("ScanPipeline - process: can't hand over file %s; %w", job.fileID, handOverErr)
+	}
+	return nil
+}
+
+// giveUp marks the file the scanner failed on too many times, dropping the job releases its content.
+func (pipeline *ScanPipeline) giveUp(ctx context.Context, job fileJob, scanErr error) error {
+	if err := pipeline.fileRepository.UpdateStatus(ctx, job.tenant, job.fileID, models.FileStatusScanFailed); err != nil {
+		return fmt.Errorf("ScanPipeline - process: can't update file %s status; %w", job.fileID, err)
+	}
+	return fmt.Errorf("ScanPipeline - process: can't scan file %s in %d attempts, it's marked as scan failed; %w", job.fileID, pipeline.maxAttempts, scanErr)
+}
+
+// isolate quarantines the infected file and marks it as such. A deduplicated file gets an object of
+// its own in quarantine and releases the shared one.
+func (pipeline *ScanPipeline) isolate(ctx context.Context, job fileJob, file *models.File, signature string) error {
+	sharedObject := ""
+	storageName := file.StorageName()
+	if file.ContentHash != "" {
+		sharedObject = file.ObjectName
+		storageName = makeObjectName(file.ID, file.FileName)
+	}
+	if err := pipeline.quarantine(ctx, job, storageName, sharedObject == ""); err != nil {
+		return fmt.Errorf("ScanPipeline - process: can't quarantine file %s (%s); %w", job.fileID, signature, err)
+	}
+	if sharedObject != "" {
+		if err := pipeline.fileRepository.Unshare(ctx, job.tenant, job.fileID, storageName); err != nil {
+			return fmt.Errorf("ScanPipeline - process: can't move file %s out of shared content; %w", job.fileID, err)
+		}
+	}
+	if err := pipeline.fileRepository.UpdateStatus(ctx, job.tenant, job.fileID, models.FileStatusInfected); err != nil {
+		return fmt.Errorf("ScanPipeline - process: can't update file %s status; %w", job.fileID, err)
+	}
+	if sharedObject != "" {
+		if err := pipeline.contents.release(ctx, job.tenant, sharedObject); err != nil {
+			return fmt.Errorf("ScanPipeline - process: can't release content of file %s; %w", job.fileID, err)
+		}
+	}
+	return nil
+}
+
+// quarantine stores the content under the quarantine prefix and removes the original unless it's
+// shared with other files.
+func (pipeline *ScanPipeline) quarantine(ctx context.Context, job fileJob, fileName string, removeOriginal bool) error {
+	err := pipeline.fileStorage.UploadFile(ctx, job.tenant, quarantineName(fileName), job.content)
+	if err != nil {
+		return fmt.Errorf("can't copy file to quarantine; %w", err)
+	}
+	if !removeOriginal {
+		return nil
+	}
+	err = pipeline.fileStorage.DeleteFile(ctx, job.tenant, fileName)
+	if err != nil {
+		return fmt.Errorf("can't remove infected file; %w", err)
+	}
+	return nil
+}
+
+// quarantineName is where the infected file is kept within its tenant.
+func quarantineName(fileName string) string {
+	return fmt.Sprintf("%s/%s", _quarantinePrefix, fileName)
+}
+
+// scanRetryDelay doubles the delay with every failed attempt up to _maxScanRetryDelay.
+func scanRetryDelay(retryDelay time.Duration, attempt int) time.Duration {
+	delay := retryDelay
+	for i := 0; i < attempt && delay < _maxScanRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > _maxScanRetryDelay {
+		return _maxScanRetryDelay
+	}
+	return delay
+}
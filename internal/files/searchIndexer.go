@@ -0,0 +1,127 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+)
+
+// _maxSearchResults caps files found by text, the best matches are kept.
+const _maxSearchResults = 100
+
+// searchIndexer keeps the search index in line with the files. Writes are serialized, so text
+// indexed in the background isn't lost to a rename or new tags made in the meantime. The lock
+// covers this instance only, like the in-memory repositories. A nil indexer indexes nothing.
+type searchIndexer struct {
+	index          ports.SearchIndex
+	fileRepository ports.FileRepository
+	mu             sync.Mutex
+}
+
+func newSearchIndexer(index ports.SearchIndex, fileRepository ports.FileRepository) *searchIndexer {
+	return &searchIndexer{
+		index:          index,
+		fileRepository: fileRepository,
+	}
+}
+
+// indexText indexes the file as it's in the repository now, with the text of its content.
+func (indexer *searchIndexer) indexText(ctx context.Context, tenant, fileID, text string) error {
+	if indexer == nil {
+		return nil
+	}
+	indexer.mu.Lock()
+	defer indexer.mu.Unlock()
+	file, err := indexer.fileRepository.ReadBy(ctx, tenant, fileID)
+	if err != nil {
+		return fmt.Errorf("can't read file from repository; %w", err)
+	}
+	if file == nil || file.ID == "" {
+		return nil
+	}
+	return indexer.index.Index(ctx, tenant, makeSearchDocument(file, text))
+}
+
+// update indexes the current name and tags of the file, keeping the text indexed before.
+func (indexer *searchIndexer) update(ctx context.Context, tenant string, file *models.File) error {
+	return indexer.copy(ctx, tenant, file.ID, file)
+}
+
+// copy indexes the file with the text indexed for the source file.
+func (indexer *searchIndexer) copy(ctx context.Context, tenant, sourceID string, file *models.File) error {
+	if indexer == nil {
+		return nil
+	}
+	indexer.mu.Lock()
+	defer indexer.mu.Unlock()
+	source, err := indexer.index.Read(ctx, tenant, sourceID)
+	if err != nil {
+		return err
+	}
+	text := ""
+	if source != nil {
+		text = source.Text
+	}
+	return indexer.index.Index(ctx, tenant, makeSearchDocument(file, text))
+}
+
+func (indexer *searchIndexer) remove(ctx context.Context, tenant, fileID string) error {
+	if indexer == nil {
+		return nil
+	}
+	indexer.mu.Lock()
+	defer indexer.mu.Unlock()
+	return indexer.index.Remove(ctx, tenant, fileID)
+}
+
+// search finds files by text, best matches first. Files of the filter only are kept unless it's
+// empty. Files removed since they were indexed are left out.
+func (indexer *searchIndexer) search(ctx context.Context, tenant, text string, filter models.FileFilter) ([]models.File, error) {
+	if indexer == nil {
+		return nil, ErrSearchNotEnabled
+	}
+	fileIDs, err := indexer.index.Search(ctx, tenant, text, _maxSearchResults)
+	if err != nil {
+		return nil, fmt.Errorf("can't search index; %w", err)
+	}
+	var filtered map[string]models.File
+	if len(filter.Tags) > 0 || len(filter.Metadata) > 0 {
+		matching, err := indexer.fileRepository.Search(ctx, tenant, filter)
+		if err != nil {
+			return nil, fmt.Errorf("can't search files in repository; %w", err)
+		}
+		filtered = make(map[string]models.File, len(*matching))
+		for _, file := range *matching {
+			filtered[file.ID] = file
+		}
+	}
+	var result []models.File
+	for _, fileID := range fileIDs {
+		if filtered != nil {
+			if file, ok := filtered[fileID]; ok {
+				result = append(result, file)
+			}
+			continue
+		}
+		file, err := indexer.fileRepository.ReadBy(ctx, tenant, fileID)
+		if err != nil {
+			return nil, fmt.Errorf("can't read file from repository; %w", err)
+		}
+		if file != nil && file.ID != "" {
+			result = append(result, *file)
+		}
+	}
+	return result, nil
+}
+
+func makeSearchDocument(file *models.File, text string) models.SearchDocument {
+	return models.SearchDocument{
+		FileID:   file.ID,
+		FileName: file.FileName,
+		Tags:     file.Tags,
+		Text:     text,
+	}
+}
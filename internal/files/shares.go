@@ -0,0 +1,65 @@
+package files
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+)
+
+// _shareTokenBytes of randomness make share tokens impossible to guess.
+const _shareTokenBytes = 32
+
+// _maxSharePasswordAttempts wrong passwords lock the share, so its password can't be guessed.
+const _maxSharePasswordAttempts = 5
+
+func makeShareToken() (string, error) {
+	token := make([]byte, _shareTokenBytes)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+func hashSharePassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func checkSharePassword(share *models.Share, password string) error {
+	if share.PasswordHash == "" {
+		return nil
+	}
+	if share.FailedAttempts >= _maxSharePasswordAttempts {
+		return ErrShareLocked
+	}
+	if bcrypt.CompareHashAndPassword([]byte(share.PasswordHash), []byte(password)) != nil {
+		return ErrSharePasswordInvalid
+	}
+	return nil
+}
+
+// shareActive tells whether the share can still be opened.
+func shareActive(share *models.Share, now time.Time) bool {
+	return now.Unix() < share.ExpiresAt && (share.MaxDownloads == 0 || share.Downloads < share.MaxDownloads)
+}
+
+func makeShareLink(share *models.Share) models.ShareLink {
+	return models.ShareLink{
+		Token:             share.Token,
+		FileID:            share.FileID,
+		ExpiresAt:         share.ExpiresAt,
+		MaxDownloads:      share.MaxDownloads,
+		Downloads:         share.Downloads,
+		PasswordProtected: share.PasswordHash != "",
+	}
+}
@@ -0,0 +1,46 @@
+package files
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+)
+
+// ParseObjectName maps a bucket object name to the file it stores. Only objects laid out as
+// <tenant>/<reference>/<name> belong to external producers; files uploaded through the service
+// (<tenant>/<name>), their copies (<tenant>/objects/<id>/<name>), thumbnails and quarantined
+// files (<tenant>/quarantine/<name>) are reported as not stored objects. References can't take
+// the names of these prefixes, see validateReferenceID, so no producer's file is mistaken for them.
+func ParseObjectName(objectName string) (models.StoredObject, bool) {
+	parts := strings.SplitN(objectName, "/", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" || strings.HasSuffix(parts[2], "/") {
+		return models.StoredObject{}, false
+	}
+	if reservedReferenceID(parts[1]) {
+		return models.StoredObject{}, false
+	}
+	return models.StoredObject{
+		Tenant:      parts[0],
+		ReferenceID: parts[1],
+		FileName:    parts[2],
+		ObjectName:  parts[1] + "/" + parts[2],
+	}, true
+}
+
+// validateReferenceID refuses references named after the prefixes the service stores its own
+// objects under, their files would be indistinguishable from those in the bucket.
+func validateReferenceID(referenceID string) error {
+	if reservedReferenceID(referenceID) {
+		return fmt.Errorf("reference id %q; %w", referenceID, ErrReservedReference)
+	}
+	return nil
+}
+
+func reservedReferenceID(referenceID string) bool {
+	switch referenceID {
+	case _quarantinePrefix, _thumbnailsPrefix, _objectsPrefix, _contentsPrefix:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"path/filepath"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/imaging"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/logger"
+)
+
+const _thumbnailsPrefix = "thumbnails"
+
+// ThumbnailPipeline makes resized copies of uploaded images in the background and stores them
+// next to the original under the thumbnails prefix.
+type ThumbnailPipeline struct {
+	fileStorage    ports.FileStorage
+	fileRepository ports.FileRepository
+	sizes          []int
+	queue          *jobQueue
+}
+
+func NewThumbnailPipeline(fileStorage ports.FileStorage, fileRepository ports.FileRepository, logger logger.Logger, sizes []int, workers, queueSize int) *ThumbnailPipeline {
+	pipeline := &ThumbnailPipeline{
+		fileStorage:    fileStorage,
+		fileRepository: fileRepository,
+		sizes:          sizes,
+	}
+	pipeline.queue = newJobQueue("ThumbnailPipeline", workers, queueSize, logger, pipeline.process)
+	return pipeline
+}
+
+// Start runs the workers until ctx is cancelled.
+func (pipeline *ThumbnailPipeline) Start(ctx context.Context) {
+	pipeline.queue.start(ctx)
+}
+
+// Wait blocks until all workers have stopped.
+func (pipeline *ThumbnailPipeline) Wait() {
+	pipeline.queue.wait()
+}
+
+func (pipeline *ThumbnailPipeline) Enqueue(tenant, fileID string, content []byte) error {
+	return pipeline.queue.enqueue(fileJob{tenant: tenant, fileID: fileID, content: content})
+}
+
+func (pipeline *ThumbnailPipeline) process(ctx context.Context, job fileJob) error {
+	file, err := pipeline.fileRepository.ReadBy(ctx, job.tenant, job.fileID)
+	if err != nil {
+		return fmt.Errorf("ThumbnailPipeline - process: can't read file %s; %w", job.fileID, err)
+	}
+	if file == nil || file.ID == "" || !imaging.Supported(mime.TypeByExtension(filepath.Ext(file.FileName))) {
+		return nil
+	}
+	var thumbnails []models.Thumbnail
+	for _, size := range pipeline.sizes {
+		thumbnail, err := imaging.MakeThumbnail(job.content, size)
+		if errors.Is(err, imaging.ErrUnsupportedImage) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("ThumbnailPipeline - process: can't make %dpx thumbnail of file %s; %w", size, job.fileID, err)
+		}
+		thumbnailName := makeThumbnailName(size, thumbnailObjectName(file), thumbnail.Extension)
+		if err := pipeline.fileStorage.UploadFile(ctx, job.tenant, thumbnailName, thumbnail.Content); err != nil {
+			return fmt.Errorf("ThumbnailPipeline - process: can't store %dpx thumbnail of file %s; %w", size, job.fileID, err)
+		}
+		thumbnails = append(thumbnails, models.Thumbnail{Size: size, FileName: thumbnailName})
+	}
+	// the file could have been changed while thumbnails were made
+	file, err = pipeline.fileRepository.ReadBy(ctx, job.tenant, job.fileID)
+	if err != nil {
+		return fmt.Errorf("ThumbnailPipeline - process: can't read file %s; %w", job.fileID, err)
+	}
+	if file == nil || file.ID == "" {
+		pipeline.removeThumbnails(ctx, job.tenant, thumbnails)
+		return nil
+	}
+	if err := pipeline.fileRepository.UpdateThumbnails(ctx, job.tenant, job.fileID, thumbnails); err != nil {
+		return fmt.Errorf("ThumbnailPipeline - process: can't update file %s thumbnails; %w", job.fileID, err)
+	}
+	return nil
+}
+
+func makeThumbnailName(size int, objectName, extension string) string {
+	return fmt.Sprintf("%s/%d/%s%s", _thumbnailsPrefix, size, objectName, extension)
+}
+
+func (pipeline *ThumbnailPipeline) removeThumbnails(ctx context.Context, tenant string, thumbnails []models.Thumbnail) {
+	for _, thumbnail := range thumbnails {
+		_ = pipeline.fileStorage.DeleteFile(ctx, tenant, thumbnail.FileName)
+	}
+}
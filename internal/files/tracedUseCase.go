@@ -0,0 +1,243 @@
+package files
+
+import (
+	"context"
+	"io"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/tracing"
+)
+
+// TracedUseCase wraps every UseCase method in a span carrying tenant and file attributes.
+type TracedUseCase struct {
+	next   UseCase
+	tracer trace.Tracer
+}
+
+func NewTracedUseCase(next UseCase, tracer trace.Tracer) *TracedUseCase {
+	return &TracedUseCase{next: next, tracer: tracer}
+}
+
+func (useCase *TracedUseCase) UploadFile(ctx context.Context, tenant string, command models.UploadFileCommand) error {
+	ctx, span := useCase.start(ctx, "UseCase.UploadFile", tenant,
+		tracing.AttributeFileName.String(command.FileName), tracing.AttributeReferenceID.String(command.ReferenceID))
+	err := useCase.next.UploadFile(ctx, tenant, command)
+	tracing.End(span, err)
+	return err
+}
+
+func (useCase *TracedUseCase) ListBy(ctx context.Context, tenant string, query models.ListFilesQuery) (*[]models.Attachment, error) {
+	ctx, span := useCase.start(ctx, "UseCase.ListBy", tenant, tracing.AttributeReferenceID.String(query.ReferenceID))
+	result, err := useCase.next.ListBy(ctx, tenant, query)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (useCase *TracedUseCase) DownloadFile(ctx context.Context, tenant string, fileID string) (*models.FileContent, error) {
+	ctx, span := useCase.start(ctx, "UseCase.DownloadFile", tenant, tracing.AttributeFileID.String(fileID))
+	result, err := useCase.next.DownloadFile(ctx, tenant, fileID)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (useCase *TracedUseCase) WriteArchive(ctx context.Context, tenant string, query models.ArchiveQuery, writer io.Writer) error {
+	ctx, span := useCase.start(ctx, "UseCase.WriteArchive", tenant, tracing.AttributeReferenceID.String(query.ReferenceID))
+	err := useCase.next.WriteArchive(ctx, tenant, query, writer)
+	tracing.End(span, err)
+	return err
+}
+
+func (useCase *TracedUseCase) DeleteFile(ctx context.Context, tenant string, fileID string) error {
+	ctx, span := useCase.start(ctx, "UseCase.DeleteFile", tenant, tracing.AttributeFileID.String(fileID))
+	err := useCase.next.DeleteFile(ctx, tenant, fileID)
+	tracing.End(span, err)
+	return err
+}
+
+func (useCase *TracedUseCase) RegisterStoredFile(ctx context.Context, object models.StoredObject) error {
+	ctx, span := useCase.start(ctx, "UseCase.RegisterStoredFile", object.Tenant,
+		tracing.AttributeFileName.String(object.FileName), tracing.AttributeReferenceID.String(object.ReferenceID))
+	err := useCase.next.RegisterStoredFile(ctx, object)
+	tracing.End(span, err)
+	return err
+}
+
+func (useCase *TracedUseCase) UnregisterStoredFile(ctx context.Context, object models.StoredObject) error {
+	ctx, span := useCase.start(ctx, "UseCase.UnregisterStoredFile", object.Tenant,
+		tracing.AttributeFileName.String(object.FileName), tracing.AttributeReferenceID.String(object.ReferenceID))
+	err := useCase.next.UnregisterStoredFile(ctx, object)
+	tracing.End(span, err)
+	return err
+}
+
+func (useCase *TracedUseCase) RotateEncryptionKey(ctx context.Context, tenant string, fileID string) error {
+	ctx, span := useCase.start(ctx, "UseCase.RotateEncryptionKey", tenant, tracing.AttributeFileID.String(fileID))
+	err := useCase.next.RotateEncryptionKey(ctx, tenant, fileID)
+	tracing.End(span, err)
+	return err
+}
+
+func (useCase *TracedUseCase) Usage(ctx context.Context, tenant string, referenceID string) (*models.Usage, error) {
+	ctx, span := useCase.start(ctx, "UseCase.Usage", tenant, tracing.AttributeReferenceID.String(referenceID))
+	result, err := useCase.next.Usage(ctx, tenant, referenceID)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (useCase *TracedUseCase) CopyFile(ctx context.Context, tenant string, command models.CopyFileCommand) (*models.Attachment, error) {
+	ctx, span := useCase.start(ctx, "UseCase.CopyFile", tenant,
+		tracing.AttributeFileID.String(command.FileID), tracing.AttributeReferenceID.String(command.ReferenceID))
+	result, err := useCase.next.CopyFile(ctx, tenant, command)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (useCase *TracedUseCase) MoveFile(ctx context.Context, tenant string, command models.MoveFileCommand) (*models.Attachment, error) {
+	ctx, span := useCase.start(ctx, "UseCase.MoveFile", tenant,
+		tracing.AttributeFileID.String(command.FileID), tracing.AttributeReferenceID.String(command.ReferenceID))
+	result, err := useCase.next.MoveFile(ctx, tenant, command)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (useCase *TracedUseCase) LinkFile(ctx context.Context, tenant string, fileID, referenceID string) error {
+	ctx, span := useCase.start(ctx, "UseCase.LinkFile", tenant,
+		tracing.AttributeFileID.String(fileID), tracing.AttributeReferenceID.String(referenceID))
+	err := useCase.next.LinkFile(ctx, tenant, fileID, referenceID)
+	tracing.End(span, err)
+	return err
+}
+
+func (useCase *TracedUseCase) UnlinkFile(ctx context.Context, tenant string, fileID, referenceID string) error {
+	ctx, span := useCase.start(ctx, "UseCase.UnlinkFile", tenant,
+		tracing.AttributeFileID.String(fileID), tracing.AttributeReferenceID.String(referenceID))
+	err := useCase.next.UnlinkFile(ctx, tenant, fileID, referenceID)
+	tracing.End(span, err)
+	return err
+}
+
+func (useCase *TracedUseCase) UpdateMetadata(ctx context.Context, tenant string, command models.UpdateMetadataCommand) (*models.Attachment, error) {
+	ctx, span := useCase.start(ctx, "UseCase.UpdateMetadata", tenant, tracing.AttributeFileID.String(command.FileID))
+	result, err := useCase.next.UpdateMetadata(ctx, tenant, command)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (useCase *TracedUseCase) SearchFiles(ctx context.Context, tenant string, query models.SearchFilesQuery) (*[]models.Attachment, error) {
+	ctx, span := useCase.start(ctx, "UseCase.SearchFiles", tenant)
+	result, err := useCase.next.SearchFiles(ctx, tenant, query)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (useCase *TracedUseCase) SetLegalHold(ctx context.Context, tenant string, fileID string, hold bool) error {
+	ctx, span := useCase.start(ctx, "UseCase.SetLegalHold", tenant, tracing.AttributeFileID.String(fileID))
+	err := useCase.next.SetLegalHold(ctx, tenant, fileID, hold)
+	tracing.End(span, err)
+	return err
+}
+
+func (useCase *TracedUseCase) SetRetentionRule(ctx context.Context, tenant string, rule models.RetentionRule) error {
+	ctx, span := useCase.start(ctx, "UseCase.SetRetentionRule", tenant, tracing.AttributeReferenceID.String(rule.ReferenceID))
+	err := useCase.next.SetRetentionRule(ctx, tenant, rule)
+	tracing.End(span, err)
+	return err
+}
+
+func (useCase *TracedUseCase) RemoveRetentionRule(ctx context.Context, tenant string, referenceID string) error {
+	ctx, span := useCase.start(ctx, "UseCase.RemoveRetentionRule", tenant, tracing.AttributeReferenceID.String(referenceID))
+	err := useCase.next.RemoveRetentionRule(ctx, tenant, referenceID)
+	tracing.End(span, err)
+	return err
+}
+
+func (useCase *TracedUseCase) ListRetentionRules(ctx context.Context, tenant string) ([]models.RetentionRule, error) {
+	ctx, span := useCase.start(ctx, "UseCase.ListRetentionRules", tenant)
+	result, err := useCase.next.ListRetentionRules(ctx, tenant)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (useCase *TracedUseCase) DeleteExpiredFiles(ctx context.Context) (int, error) {
+	ctx, span := useCase.tracer.Start(ctx, "UseCase.DeleteExpiredFiles")
+	result, err := useCase.next.DeleteExpiredFiles(ctx)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (useCase *TracedUseCase) CreateShare(ctx context.Context, tenant string, command models.CreateShareCommand) (*models.ShareLink, error) {
+	ctx, span := useCase.start(ctx, "UseCase.CreateShare", tenant, tracing.AttributeFileID.String(command.FileID))
+	result, err := useCase.next.CreateShare(ctx, tenant, command)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (useCase *TracedUseCase) ListShares(ctx context.Context, tenant string, fileID string) ([]models.ShareLink, error) {
+	ctx, span := useCase.start(ctx, "UseCase.ListShares", tenant, tracing.AttributeFileID.String(fileID))
+	result, err := useCase.next.ListShares(ctx, tenant, fileID)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (useCase *TracedUseCase) RevokeShare(ctx context.Context, tenant string, token string) error {
+	ctx, span := useCase.start(ctx, "UseCase.RevokeShare", tenant)
+	err := useCase.next.RevokeShare(ctx, tenant, token)
+	tracing.End(span, err)
+	return err
+}
+
+func (useCase *TracedUseCase) OpenShare(ctx context.Context, token string, password string) (*models.SharedFile, error) {
+	ctx, span := useCase.tracer.Start(ctx, "UseCase.OpenShare")
+	result, err := useCase.next.OpenShare(ctx, token, password)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (useCase *TracedUseCase) ListFileAccess(ctx context.Context, tenant string, fileID string) ([]models.Grant, error) {
+	ctx, span := useCase.start(ctx, "UseCase.ListFileAccess", tenant, tracing.AttributeFileID.String(fileID))
+	result, err := useCase.next.ListFileAccess(ctx, tenant, fileID)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (useCase *TracedUseCase) GrantFileAccess(ctx context.Context, tenant string, fileID string, grant models.Grant) error {
+	ctx, span := useCase.start(ctx, "UseCase.GrantFileAccess", tenant, tracing.AttributeFileID.String(fileID))
+	err := useCase.next.GrantFileAccess(ctx, tenant, fileID, grant)
+	tracing.End(span, err)
+	return err
+}
+
+func (useCase *TracedUseCase) RevokeFileAccess(ctx context.Context, tenant string, fileID string, principalType models.PrincipalType, principalID string) error {
+	ctx, span := useCase.start(ctx, "UseCase.RevokeFileAccess", tenant, tracing.AttributeFileID.String(fileID))
+	err := useCase.next.RevokeFileAccess(ctx, tenant, fileID, principalType, principalID)
+	tracing.End(span, err)
+	return err
+}
+
+func (useCase *TracedUseCase) ListReferenceAccess(ctx context.Context, tenant string, referenceID string) ([]models.Grant, error) {
+	ctx, span := useCase.start(ctx, "UseCase.ListReferenceAccess", tenant, tracing.AttributeReferenceID.String(referenceID))
+	result, err := useCase.next.ListReferenceAccess(ctx, tenant, referenceID)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (useCase *TracedUseCase) GrantReferenceAccess(ctx context.Context, tenant string, referenceID string, grant models.Grant) error {
+	ctx, span := useCase.start(ctx, "UseCase.GrantReferenceAccess", tenant, tracing.AttributeReferenceID.String(referenceID))
+	err := useCase.next.GrantReferenceAccess(ctx, tenant, referenceID, grant)
+	tracing.End(span, err)
+	return err
+}
+
+func (useCase *TracedUseCase) RevokeReferenceAccess(ctx context.Context, tenant string, referenceID string, principalType models.PrincipalType, principalID string) error {
+	ctx, span := useCase.start(ctx, "UseCase.RevokeReferenceAccess", tenant, tracing.AttributeReferenceID.String(referenceID))
+	err := useCase.next.RevokeReferenceAccess(ctx, tenant, referenceID, principalType, principalID)
+	tracing.End(span, err)
+	return err
+}
+
+func (useCase *TracedUseCase) start(ctx context.Context, name, tenant string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return useCase.tracer.Start(ctx, name, trace.WithAttributes(append(attributes, tracing.AttributeTenant.String(tenant))...))
+}
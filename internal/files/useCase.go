@@ -1,43 +1,197 @@
 package files
 
 import (
+	"archive/zip"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/marcinlovescode/go-gcloudstorage-fileupload/config"
 	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
 	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/access"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/audit"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/events"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/logger"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/tracing"
+)
+
+var (
+	ErrUrlExpirationTooLong   = errors.New("requested url expiration time exceeds the tenant maximum")
+	ErrFileNotFound           = errors.New("file not found")
+	ErrKeyRotationUnsupported = errors.New("file storage doesn't support encryption key rotation")
+	ErrFileNotClean           = errors.New("file hasn't passed the antivirus scan")
+	ErrQuotaExceeded          = ports.ErrQuotaExceeded
+	ErrStorageUnavailable     = ports.ErrStorageUnavailable
+	ErrFileTooLarge           = ports.ErrFileTooLarge
+	ErrInvalidFileName        = errors.New("file name must be a plain name without a path")
+	ErrReservedReference      = errors.New("reference id is reserved")
+	ErrUsageNotTracked        = errors.New("storage usage isn't tracked")
+	ErrLinkNotFound           = ports.ErrLinkNotFound
+	ErrSearchNotEnabled       = errors.New("full-text search isn't enabled")
+	ErrFileOnLegalHold        = errors.New("file is on legal hold")
+	ErrFileRetained           = errors.New("file is retained")
+	ErrInvalidRetentionRule   = errors.New("retention rule is invalid")
+	ErrRetentionNotEnabled    = errors.New("retention rules aren't enabled")
+	ErrRetentionRuleNotFound  = ports.ErrRetentionRuleNotFound
+	ErrSharingNotEnabled      = errors.New("sharing isn't enabled")
+	ErrInvalidShare           = errors.New("share is invalid")
+	ErrShareNotFound          = ports.ErrShareNotFound
+	ErrShareExpired           = errors.New("share has expired")
+	ErrShareExhausted         = ports.ErrShareExhausted
+	ErrSharePasswordInvalid   = errors.New("share password is invalid")
+	ErrShareLocked            = errors.New("share is locked after too many wrong passwords")
+	ErrAccessDenied           = errors.New("access denied")
+	ErrAccessControlDisabled  = errors.New("access control isn't enabled")
+	ErrInvalidGrant           = errors.New("grant is invalid")
+	ErrGrantNotFound          = ports.ErrGrantNotFound
+	ErrLastOwner              = errors.New("the last owner can't be removed")
 )
 
 type UseCase interface {
 	UploadFile(ctx context.Context, tenant string, command models.UploadFileCommand) error
-	ListBy(ctx context.Context, tenant string, referenceID string) (*[]models.Attachment, error)
+	ListBy(ctx context.Context, tenant string, query models.ListFilesQuery) (*[]models.Attachment, error)
+	DownloadFile(ctx context.Context, tenant string, fileID string) (*models.FileContent, error)
+	WriteArchive(ctx context.Context, tenant string, query models.ArchiveQuery, writer io.Writer) error
 	DeleteFile(ctx context.Context, tenant string, fileID string) error
+	RegisterStoredFile(ctx context.Context, object models.StoredObject) error
+	UnregisterStoredFile(ctx context.Context, object models.StoredObject) error
+	RotateEncryptionKey(ctx context.Context, tenant string, fileID string) error
+	Usage(ctx context.Context, tenant string, referenceID string) (*models.Usage, error)
+	CopyFile(ctx context.Context, tenant string, command models.CopyFileCommand) (*models.Attachment, error)
+	MoveFile(ctx context.Context, tenant string, command models.MoveFileCommand) (*models.Attachment, error)
+	LinkFile(ctx context.Context, tenant string, fileID, referenceID string) error
+	UnlinkFile(ctx context.Context, tenant string, fileID, referenceID string) error
+	UpdateMetadata(ctx context.Context, tenant string, command models.UpdateMetadataCommand) (*models.Attachment, error)
+	SearchFiles(ctx context.Context, tenant string, query models.SearchFilesQuery) (*[]models.Attachment, error)
+	SetLegalHold(ctx context.Context, tenant string, fileID string, hold bool) error
+	SetRetentionRule(ctx context.Context, tenant string, rule models.RetentionRule) error
+	RemoveRetentionRule(ctx context.Context, tenant string, referenceID string) error
+	ListRetentionRules(ctx context.Context, tenant string) ([]models.RetentionRule, error)
+	DeleteExpiredFiles(ctx context.Context) (int, error)
+	CreateShare(ctx context.Context, tenant string, command models.CreateShareCommand) (*models.ShareLink, error)
+	ListShares(ctx context.Context, tenant string, fileID string) ([]models.ShareLink, error)
+	RevokeShare(ctx context.Context, tenant string, token string) error
+	OpenShare(ctx context.Context, token string, password string) (*models.SharedFile, error)
+	ListFileAccess(ctx context.Context, tenant string, fileID string) ([]models.Grant, error)
+	GrantFileAccess(ctx context.Context, tenant string, fileID string, grant models.Grant) error
+	RevokeFileAccess(ctx context.Context, tenant string, fileID string, principalType models.PrincipalType, principalID string) error
+	ListReferenceAccess(ctx context.Context, tenant string, referenceID string) ([]models.Grant, error)
+	GrantReferenceAccess(ctx context.Context, tenant string, referenceID string, grant models.Grant) error
+	RevokeReferenceAccess(ctx context.Context, tenant string, referenceID string, principalType models.PrincipalType, principalID string) error
+}
+
+// _objectsPrefix holds objects of copied and renamed files as <tenant>/objects/<file id>/<name>,
+// so they don't clash with uploads stored under their own name.
+const _objectsPrefix = "objects"
+
+// _storageNotificationActor is recorded for changes made by other producers writing to the bucket.
+const _storageNotificationActor = "storage-notification"
+
+type urlExpiration struct {
+	defaultTime time.Duration
+	maxTime     time.Duration
 }
 
 type DefaultFilesUseCase struct {
-	fileStorage    ports.FileStorage
-	fileRepository ports.FileRepository
-	idGen          ports.IdGenerator
-	expirationTime int
-	insecure       bool
+	fileStorage          ports.FileStorage
+	fileRepository       ports.FileRepository
+	idGen                ports.IdGenerator
+	urlExpiration        urlExpiration
+	tenantsUrlExpiration map[string]urlExpiration
+	tenantsQuota         map[string]config.Quota
+	quotaStore           ports.QuotaStore
+	quotaLimits          models.QuotaLimits
+	contentRepository    ports.ContentRepository
+	contents             *contentStore
+	keyRotator           ports.EncryptionKeyRotator
+	scanPipeline         *ScanPipeline
+	thumbnailPipeline    *ThumbnailPipeline
+	indexPipeline        *IndexPipeline
+	indexer              *searchIndexer
+	cleanPipelines       []fileProcessor
+	eventPublisher       ports.EventPublisher
+	auditRecorder        ports.AuditRecorder
+	retentionStore       ports.RetentionStore
+	objectHolder         ports.ObjectHolder
+	shareRepository      ports.ShareRepository
+	maxShareExpiration   time.Duration
+	shareUrlExpiration   time.Duration
+	accessStore          ports.ReferenceAccessStore
+	logger               logger.Logger
 }
 
-func NewDefaultFilesUseCase(fileStorage ports.FileStorage, fileRepository ports.FileRepository, idGen ports.IdGenerator, gcloudConfig config.GCloudStorage) (*DefaultFilesUseCase, error) {
-	return &DefaultFilesUseCase{fileStorage: fileStorage, expirationTime: gcloudConfig.UrlExpirationTime, insecure: gcloudConfig.Insecure, fileRepository: fileRepository, idGen: idGen}, nil
+func NewDefaultFilesUseCase(fileStorage ports.FileStorage, fileRepository ports.FileRepository, idGen ports.IdGenerator, gcloudConfig config.GCloudStorage, tenantsConfig map[string]config.Tenant, opts ...Option) (*DefaultFilesUseCase, error) {
+	defaultUrlExpiration := makeUrlExpiration(gcloudConfig.UrlExpirationTime, gcloudConfig.MaxUrlExpirationTime, urlExpiration{})
+	tenantsUrlExpiration := make(map[string]urlExpiration, len(tenantsConfig))
+	tenantsQuota := make(map[string]config.Quota, len(tenantsConfig))
+	for tenant, tenantConfig := range tenantsConfig {
+		tenantsUrlExpiration[tenant] = makeUrlExpiration(tenantConfig.UrlExpirationTime, tenantConfig.MaxUrlExpirationTime, defaultUrlExpiration)
+		tenantsQuota[tenant] = tenantConfig.Quota
+	}
+	useCase := &DefaultFilesUseCase{
+		fileStorage:          fileStorage,
+		fileRepository:       fileRepository,
+		idGen:                idGen,
+		urlExpiration:        defaultUrlExpiration,
+		logger:               logger.NewNopLogger(),
+		tenantsUrlExpiration: tenantsUrlExpiration,
+		tenantsQuota:         tenantsQuota,
+	}
+	for _, opt := range opts {
+		opt(useCase)
+	}
+	if useCase.contentRepository != nil {
+		useCase.contents = newContentStore(useCase.contentRepository, fileStorage)
+	}
+	if useCase.thumbnailPipeline != nil {
+		useCase.cleanPipelines = append(useCase.cleanPipelines, useCase.thumbnailPipeline)
+	}
+	if useCase.indexPipeline != nil {
+		useCase.indexer = useCase.indexPipeline.indexer
+		useCase.cleanPipelines = append(useCase.cleanPipelines, useCase.indexPipeline)
+	}
+	if useCase.scanPipeline != nil {
+		useCase.scanPipeline.next = useCase.cleanPipelines
+		useCase.scanPipeline.contents = useCase.contents
+	}
+	return useCase, nil
 }
 
 func (useCase *DefaultFilesUseCase) UploadFile(ctx context.Context, tenant string, command models.UploadFileCommand) error {
+	err := validateMetadata(command.Metadata)
+	if err == nil {
+		err = validateTags(command.Tags)
+	}
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - UploadFile: %w", err)
+	}
 	buf := new(bytes.Buffer)
-	_, err := buf.ReadFrom(command.File)
+	_, err = buf.ReadFrom(command.File)
 	if err != nil {
 		return fmt.Errorf("DefaultFilesUseCase - UploadFile: can't read from file; %w", err)
 	}
-	err = useCase.fileStorage.UploadFile(ctx, tenant, command.FileName, buf.Bytes())
+	// marks on the caller's span how long receiving the upload took before it is stored
+	trace.SpanFromContext(ctx).AddEvent("file buffered", trace.WithAttributes(tracing.AttributeFileSize.Int(buf.Len())))
+	size := int64(buf.Len())
+	err = validateReferenceID(command.ReferenceID)
+	if err == nil {
+		err = useCase.authorizeReference(ctx, tenant, command.ReferenceID)
+	}
 	if err != nil {
-		return fmt.Errorf("DefaultFilesUseCase - UploadFile: can't upload file to file storage; %w", err)
+		return fmt.Errorf("DefaultFilesUseCase - UploadFile: %w", err)
+	}
+	err = useCase.reserveQuota(ctx, tenant, command.ReferenceID, size)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - UploadFile: %w", err)
 	}
 	createdFile := models.File{
 		ID:          useCase.idGen.MakeId(),
@@ -45,46 +199,1707 @@ func (useCase *DefaultFilesUseCase) UploadFile(ctx context.Context, tenant strin
 		ReferenceID: command.ReferenceID,
 		CreatedAt:   time.Now().Unix(),
 		CreatorId:   command.CreatorId,
+		Status:      models.FileStatusClean,
+		Size:        size,
+		Metadata:    mergeMetadata(nil, command.Metadata),
+		Tags:        uniqueTags(command.Tags),
+		Grants:      useCase.creatorGrants(ctx),
+	}
+	err = useCase.uploadContent(ctx, tenant, &createdFile, buf.Bytes())
+	if err != nil {
+		_ = useCase.releaseQuota(ctx, tenant, command.ReferenceID, size)
+		return fmt.Errorf("DefaultFilesUseCase - UploadFile: can't upload file to file storage; %w", err)
+	}
+	if len(createdFile.Metadata) > 0 || len(createdFile.Tags) > 0 {
+		err = useCase.writeMetadata(ctx, tenant, &createdFile)
+		if err != nil {
+			useCase.removeObjects(ctx, tenant, &createdFile)
+			_ = useCase.releaseQuota(ctx, tenant, command.ReferenceID, size)
+			return fmt.Errorf("DefaultFilesUseCase - UploadFile: can't write object metadata; %w", err)
+		}
+	}
+	if useCase.scanPipeline != nil {
+		createdFile.Status = models.FileStatusPending
 	}
 	err = useCase.fileRepository.Add(ctx, tenant, &createdFile)
 	if err != nil {
+		useCase.removeObjects(ctx, tenant, &createdFile)
+		_ = useCase.releaseQuota(ctx, tenant, command.ReferenceID, size)
 		return fmt.Errorf("DefaultFilesUseCase - UploadFile: can't add file to repository; %w", err)
 	}
+	err = useCase.enqueueProcessing(tenant, createdFile.ID, buf.Bytes())
+	if err != nil {
+		_ = useCase.fileRepository.Delete(ctx, tenant, createdFile.ID)
+		useCase.removeObjects(ctx, tenant, &createdFile)
+		_ = useCase.releaseQuota(ctx, tenant, command.ReferenceID, size)
+		return fmt.Errorf("DefaultFilesUseCase - UploadFile: %w", err)
+	}
+	useCase.committed(ctx, events.FileUploaded, audit.ActionUpload, tenant, command.CreatorId, &createdFile)
 	return nil
 }
 
-func (useCase *DefaultFilesUseCase) ListBy(ctx context.Context, tenant string, referenceID string) (*[]models.Attachment, error) {
-	uploadedFiles, err := useCase.fileRepository.ListBy(ctx, tenant, referenceID)
-	var result []models.Attachment
+func (useCase *DefaultFilesUseCase) ListBy(ctx context.Context, tenant string, query models.ListFilesQuery) (*[]models.Attachment, error) {
+	expiry, err := useCase.resolveUrlExpiration(tenant, query.UrlExpiresIn)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - ListBy: invalid url expiration time; %w", err)
+	}
+	uploadedFiles, err := useCase.fileRepository.ListBy(ctx, tenant, query.ReferenceID)
 	if err != nil {
 		return nil, fmt.Errorf("DefaultFilesUseCase - ListBy: can't list files by reference id; %w", err)
 	}
-	for i := range *uploadedFiles {
-		url, err := useCase.fileStorage.GetExpiringUrl(tenant, (*uploadedFiles)[i].FileName, useCase.expirationTime, useCase.insecure)
+	readableFiles, err := useCase.readableFiles(ctx, tenant, query.ReferenceID, *uploadedFiles)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - ListBy: %w", err)
+	}
+	result, err := useCase.makeAttachments(ctx, tenant, readableFiles, expiry, query.IncludeUnscanned)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - ListBy: %w", err)
+	}
+	return &result, nil
+}
+
+// SearchFiles lists files of the tenant matching the text and having all the tags and metadata
+// values of the filter, whatever reference they are attached to. Files found by text are indexed
+// once they are clean and come best matches first.
+func (useCase *DefaultFilesUseCase) SearchFiles(ctx context.Context, tenant string, query models.SearchFilesQuery) (*[]models.Attachment, error) {
+	expiry, err := useCase.resolveUrlExpiration(tenant, query.UrlExpiresIn)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - SearchFiles: invalid url expiration time; %w", err)
+	}
+	var foundFiles []models.File
+	if query.Text != "" {
+		foundFiles, err = useCase.indexer.search(ctx, tenant, query.Text, query.Filter)
+	} else {
+		var filtered *[]models.File
+		filtered, err = useCase.fileRepository.Search(ctx, tenant, query.Filter)
+		if filtered != nil {
+			foundFiles = *filtered
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - SearchFiles: can't search files; %w", err)
+	}
+	foundFiles, err = useCase.readableFiles(ctx, tenant, "", foundFiles)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - SearchFiles: %w", err)
+	}
+	result, err := useCase.makeAttachments(ctx, tenant, foundFiles, expiry, query.IncludeUnscanned)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - SearchFiles: %w", err)
+	}
+	return &result, nil
+}
+
+// makeAttachments signs urls of clean files; the others are left out unless includeUnscanned is set.
+func (useCase *DefaultFilesUseCase) makeAttachments(ctx context.Context, tenant string, files []models.File, expiry time.Duration, includeUnscanned bool) ([]models.Attachment, error) {
+	var result []models.Attachment
+	for i := range files {
+		file := files[i]
+		if file.Status != models.FileStatusClean {
+			if includeUnscanned {
+				result = append(result, models.Attachment{
+					ID:        file.ID,
+					FileName:  file.FileName,
+					Status:    file.Status,
+					Metadata:  file.Metadata,
+					Tags:      file.Tags,
+					LegalHold: file.LegalHold,
+				})
+			}
+			continue
+		}
+		url, err := useCase.fileStorage.GetExpiringUrl(tenant, file.StorageName(), models.SignedUrlOptions{
+			Expiry: expiry,
+			Method: http.MethodGet,
+		})
+		if errors.Is(err, ports.ErrSignedUrlNotSupported) {
+			url = ""
+		} else if err != nil {
+			return nil, fmt.Errorf("can't get file url; %w", err)
+		}
+		thumbnails, err := useCase.thumbnailUrls(tenant, file.Thumbnails, expiry)
 		if err != nil {
-			return nil, fmt.Errorf("DefaultFilesUseCase - ListBy: can't get file url; %w", err)
+			return nil, fmt.Errorf("can't get thumbnail url; %w", err)
+		}
+		if url != "" || len(thumbnails) > 0 {
+			err = useCase.audit(ctx, audit.ActionUrlIssued, tenant, "", &file)
+			if err != nil {
+				return nil, err
+			}
 		}
 		result = append(result, models.Attachment{
-			ID:       (*uploadedFiles)[i].ID,
-			FileName: (*uploadedFiles)[i].FileName,
-			Url:      url,
+			ID:         file.ID,
+			FileName:   file.FileName,
+			Url:        url,
+			Status:     file.Status,
+			Thumbnails: thumbnails,
+			Metadata:   file.Metadata,
+			Tags:       file.Tags,
+			LegalHold:  file.LegalHold,
 		})
 	}
-	return &result, nil
+	return result, nil
+}
+
+func (useCase *DefaultFilesUseCase) DownloadFile(ctx context.Context, tenant string, fileID string) (*models.FileContent, error) {
+	file, err := useCase.readFile(ctx, tenant, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - DownloadFile: %w", err)
+	}
+	err = useCase.authorize(ctx, tenant, file, models.RoleReader)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - DownloadFile: %w", err)
+	}
+	if file.Status != models.FileStatusClean {
+		return nil, fmt.Errorf("DefaultFilesUseCase - DownloadFile: %w", ErrFileNotClean)
+	}
+	err = useCase.audit(ctx, audit.ActionDownload, tenant, "", file)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - DownloadFile: %w", err)
+	}
+	content, err := useCase.fileStorage.ReadFile(ctx, tenant, file.StorageName())
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - DownloadFile: can't read file from storage; %w", err)
+	}
+	return &models.FileContent{
+		FileName: file.FileName,
+		Content:  content,
+	}, nil
+}
+
+// WriteArchive streams a zip of the reference's clean files, optionally narrowed to the given
+// file ids. The selection is validated before anything is written, so callers can still report
+// errors returned before the first write. Files of envelope tenants are decrypted whole, one at a
+// time, so an entry takes at most the storage's envelope size limit in memory.
+func (useCase *DefaultFilesUseCase) WriteArchive(ctx context.Context, tenant string, query models.ArchiveQuery, writer io.Writer) error {
+	archivedFiles, err := useCase.archiveFiles(ctx, tenant, query)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - WriteArchive: %w", err)
+	}
+	for i := range archivedFiles {
+		err = useCase.audit(ctx, audit.ActionDownload, tenant, "", &archivedFiles[i])
+		if err != nil {
+			return fmt.Errorf("DefaultFilesUseCase - WriteArchive: %w", err)
+		}
+	}
+	archive := zip.NewWriter(writer)
+	entryNames := make(map[string]int)
+	for i := range archivedFiles {
+		err = useCase.writeArchiveEntry(ctx, tenant, archive, &archivedFiles[i], uniqueEntryName(entryNames, archivedFiles[i].FileName))
+		if err != nil {
+			return fmt.Errorf("DefaultFilesUseCase - WriteArchive: can't archive file %s; %w", archivedFiles[i].ID, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - WriteArchive: can't finish archive; %w", err)
+	}
+	return nil
+}
+
+func (useCase *DefaultFilesUseCase) archiveFiles(ctx context.Context, tenant string, query models.ArchiveQuery) ([]models.File, error) {
+	referenceFiles, err := useCase.fileRepository.ListBy(ctx, tenant, query.ReferenceID)
+	if err != nil {
+		return nil, fmt.Errorf("can't list files by reference id; %w", err)
+	}
+	readableFiles, err := useCase.readableFiles(ctx, tenant, query.ReferenceID, *referenceFiles)
+	if err != nil {
+		return nil, err
+	}
+	var result []models.File
+	if len(query.FileIDs) == 0 {
+		for _, file := range readableFiles {
+			if file.Status == models.FileStatusClean {
+				result = append(result, file)
+			}
+		}
+		return result, nil
+	}
+	filesByID := make(map[string]models.File, len(*referenceFiles))
+	for _, file := range *referenceFiles {
+		filesByID[file.ID] = file
+	}
+	readable := make(map[string]bool, len(readableFiles))
+	for _, file := range readableFiles {
+		readable[file.ID] = true
+	}
+	for _, fileID := range query.FileIDs {
+		file, ok := filesByID[fileID]
+		if !ok {
+			return nil, fmt.Errorf("file %s isn't attached to the reference; %w", fileID, ErrFileNotFound)
+		}
+		if !readable[fileID] {
+			return nil, fmt.Errorf("file %s; %w", fileID, ErrAccessDenied)
+		}
+		if file.Status != models.FileStatusClean {
+			return nil, fmt.Errorf("file %s; %w", fileID, ErrFileNotClean)
+		}
+		result = append(result, file)
+	}
+	return result, nil
 }
 
+func (useCase *DefaultFilesUseCase) writeArchiveEntry(ctx context.Context, tenant string, archive *zip.Writer, file *models.File, entryName string) error {
+	content, err := useCase.fileStorage.ReadFile(ctx, tenant, file.StorageName())
+	if err != nil {
+		return fmt.Errorf("can't read file from storage; %w", err)
+	}
+	defer content.Close()
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     entryName,
+		Method:   zip.Deflate,
+		Modified: time.Unix(file.CreatedAt, 0),
+	})
+	if err != nil {
+		return fmt.Errorf("can't create archive entry; %w", err)
+	}
+	if _, err := io.Copy(entry, content); err != nil {
+		return fmt.Errorf("can't copy file to archive; %w", err)
+	}
+	return nil
+}
+
+// uniqueEntryName turns repeated names into "name (1).ext", "name (2).ext" and so on.
+func uniqueEntryName(used map[string]int, fileName string) string {
+	name := fileName
+	extension := filepath.Ext(fileName)
+	base := strings.TrimSuffix(fileName, extension)
+	for used[name] > 0 {
+		name = fmt.Sprintf("%s (%d)%s", base, used[fileName], extension)
+		used[fileName]++
+	}
+	used[name]++
+	return name
+}
+
+func (useCase *DefaultFilesUseCase) RotateEncryptionKey(ctx context.Context, tenant string, fileID string) error {
+	if useCase.keyRotator == nil {
+		return fmt.Errorf("DefaultFilesUseCase - RotateEncryptionKey: %w", ErrKeyRotationUnsupported)
+	}
+	file, err := useCase.readFile(ctx, tenant, fileID)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - RotateEncryptionKey: %w", err)
+	}
+	err = useCase.authorize(ctx, tenant, file, models.RoleWriter)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - RotateEncryptionKey: %w", err)
+	}
+	if file.LegalHold {
+		// rotation replaces the object of the held file
+		return fmt.Errorf("DefaultFilesUseCase - RotateEncryptionKey: %w", ErrFileOnLegalHold)
+	}
+	_, err = useCase.keyRotator.RotateEncryptionKey(ctx, tenant, file.StorageName())
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - RotateEncryptionKey: can't rotate encryption key; %w", err)
+	}
+	useCase.committed(ctx, "", audit.ActionRotateKey, tenant, "", file)
+	return nil
+}
+
+// DeleteFile removes the file from every reference it's linked to, unless it's on legal hold or
+// still retained.
 func (useCase *DefaultFilesUseCase) DeleteFile(ctx context.Context, tenant string, fileID string) error {
-	file, err := useCase.fileRepository.ReadBy(ctx, tenant, fileID)
+	file, err := useCase.readFile(ctx, tenant, fileID)
 	if err != nil {
 		return fmt.Errorf("DefaultFilesUseCase - DeleteFile: file doesn't exist; %w", err)
 	}
-	err = useCase.fileRepository.Delete(ctx, tenant, fileID)
+	err = useCase.authorize(ctx, tenant, file, models.RoleWriter)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - DeleteFile: %w", err)
+	}
+	err = useCase.checkRetention(ctx, tenant, file)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - DeleteFile: %w", err)
+	}
+	err = useCase.deleteFile(ctx, tenant, file)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - DeleteFile: %w", err)
+	}
+	useCase.committed(ctx, events.FileDeleted, audit.ActionDelete, tenant, "", file)
+	return nil
+}
+
+// deleteFile removes the file with its objects, callers report the deletion once it's done.
+func (useCase *DefaultFilesUseCase) deleteFile(ctx context.Context, tenant string, file *models.File) error {
+	err := useCase.fileRepository.Delete(ctx, tenant, file.ID)
+	if err != nil {
+		return fmt.Errorf("can't delete file from repository; %w", err)
+	}
+	switch {
+	case file.ContentHash != "":
+		err = useCase.contents.release(ctx, tenant, file.ObjectName)
+	case file.Status == models.FileStatusInfected:
+		err = useCase.fileStorage.DeleteFile(ctx, tenant, quarantineName(file.StorageName()))
+	default:
+		err = useCase.fileStorage.DeleteFile(ctx, tenant, file.StorageName())
+	}
+	if err != nil {
+		return fmt.Errorf("can't delete file from storage; %w", err)
+	}
+	for _, thumbnail := range file.Thumbnails {
+		err = useCase.fileStorage.DeleteFile(ctx, tenant, thumbnail.FileName)
+		if err != nil {
+			return fmt.Errorf("can't delete thumbnail from storage; %w", err)
+		}
+	}
+	err = useCase.releaseQuota(ctx, tenant, file.ReferenceID, file.Size)
+	if err != nil {
+		return err
+	}
+	if useCase.shareRepository != nil {
+		err = useCase.shareRepository.DeleteBy(ctx, tenant, file.ID)
+		if err != nil {
+			return fmt.Errorf("can't delete shares of file; %w", err)
+		}
+	}
+	err = useCase.indexer.remove(ctx, tenant, file.ID)
+	if err != nil {
+		return fmt.Errorf("can't remove file from search index; %w", err)
+	}
+	return nil
+}
+
+// CopyFile copies a clean file to the reference. The object is copied by the storage, or shared
+// when the content is deduplicated, and thumbnails are copied along, so the content isn't
+// processed again.
+func (useCase *DefaultFilesUseCase) CopyFile(ctx context.Context, tenant string, command models.CopyFileCommand) (*models.Attachment, error) {
+	source, err := useCase.readFile(ctx, tenant, command.FileID)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - CopyFile: %w", err)
+	}
+	err = useCase.authorize(ctx, tenant, source, models.RoleReader)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - CopyFile: %w", err)
+	}
+	if source.Status != models.FileStatusClean {
+		return nil, fmt.Errorf("DefaultFilesUseCase - CopyFile: %w", ErrFileNotClean)
+	}
+	fileName, err := resolveFileName(command.FileName, source.FileName)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - CopyFile: %w", err)
+	}
+	err = validateReferenceID(command.ReferenceID)
+	if err == nil {
+		err = useCase.authorizeReference(ctx, tenant, command.ReferenceID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - CopyFile: %w", err)
+	}
+	err = useCase.reserveQuota(ctx, tenant, command.ReferenceID, source.Size)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - CopyFile: %w", err)
+	}
+	copiedFile := models.File{
+		ID:          useCase.idGen.MakeId(),
+		FileName:    fileName,
+		ReferenceID: command.ReferenceID,
+		CreatedAt:   time.Now().Unix(),
+		CreatorId:   command.CreatorId,
+		Status:      models.FileStatusClean,
+		Size:        source.Size,
+		Metadata:    source.Metadata,
+		Tags:        source.Tags,
+		Grants:      useCase.creatorGrants(ctx),
+	}
+	if source.ContentHash != "" {
+		copiedFile.ContentHash = source.ContentHash
+		copiedFile.ObjectName = source.ObjectName
+		err = useCase.contents.acquire(ctx, tenant, source.ObjectName)
+	} else {
+		copiedFile.ObjectName = makeObjectName(copiedFile.ID, fileName)
+		err = useCase.fileStorage.CopyFile(ctx, tenant, source.StorageName(), copiedFile.ObjectName)
+	}
+	if err != nil {
+		_ = useCase.releaseQuota(ctx, tenant, command.ReferenceID, source.Size)
+		return nil, fmt.Errorf("DefaultFilesUseCase - CopyFile: can't copy file in file storage; %w", err)
+	}
+	copiedFile.Thumbnails = useCase.copyThumbnails(ctx, tenant, source.Thumbnails, thumbnailObjectName(source), thumbnailObjectName(&copiedFile))
+	err = useCase.fileRepository.Add(ctx, tenant, &copiedFile)
+	if err != nil {
+		useCase.removeObjects(ctx, tenant, &copiedFile)
+		_ = useCase.releaseQuota(ctx, tenant, command.ReferenceID, source.Size)
+		return nil, fmt.Errorf("DefaultFilesUseCase - CopyFile: can't add file to repository; %w", err)
+	}
+	err = useCase.indexer.copy(ctx, tenant, source.ID, &copiedFile)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - CopyFile: can't index file; %w", err)
+	}
+	useCase.committed(ctx, events.FileCopied, audit.ActionCopy, tenant, command.CreatorId, &copiedFile)
+	return &models.Attachment{ID: copiedFile.ID, FileName: copiedFile.FileName, Status: copiedFile.Status}, nil
+}
+
+// MoveFile attaches a clean file to another reference, renames it or both. Renamed files are
+// copied by the storage to an object of the new name and the old object is removed afterwards;
+// deduplicated content keeps its object whatever the name. Files on legal hold can't be moved, nor
+// retained files to another reference.
+func (useCase *DefaultFilesUseCase) MoveFile(ctx context.Context, tenant string, command models.MoveFileCommand) (*models.Attachment, error) {
+	file, err := useCase.readFile(ctx, tenant, command.FileID)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - MoveFile: %w", err)
+	}
+	err = useCase.authorize(ctx, tenant, file, models.RoleWriter)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - MoveFile: %w", err)
+	}
+	if file.Status != models.FileStatusClean {
+		return nil, fmt.Errorf("DefaultFilesUseCase - MoveFile: %w", ErrFileNotClean)
+	}
+	movedFile := *file
+	movedFile.FileName, err = resolveFileName(command.FileName, file.FileName)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - MoveFile: %w", err)
+	}
+	if command.ReferenceID != "" {
+		movedFile.ReferenceID = command.ReferenceID
+	}
+	renamed := movedFile.FileName != file.FileName
+	if !renamed && movedFile.ReferenceID == file.ReferenceID {
+		return &models.Attachment{ID: file.ID, FileName: file.FileName, Status: file.Status}, nil
+	}
+	if movedFile.ReferenceID != file.ReferenceID {
+		err = validateReferenceID(movedFile.ReferenceID)
+		if err == nil {
+			err = useCase.authorizeReference(ctx, tenant, movedFile.ReferenceID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("DefaultFilesUseCase - MoveFile: %w", err)
+		}
+	}
+	if movedFile.ReferenceID != file.ReferenceID || file.LegalHold {
+		// held files keep their object, and retained ones their reference, which may retain them
+		// longer than the new one
+		err = useCase.checkRetention(ctx, tenant, file)
+		if err != nil {
+			return nil, fmt.Errorf("DefaultFilesUseCase - MoveFile: %w", err)
+		}
+	}
+	err = useCase.moveQuota(ctx, tenant, file.ReferenceID, movedFile.ReferenceID, file.Size, useCase.resolveQuotaLimits(tenant))
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - MoveFile: %w", err)
+	}
+	copyObject := renamed && file.ContentHash == ""
+	if copyObject {
+		movedFile.ObjectName = makeObjectName(file.ID, movedFile.FileName)
+		err = useCase.fileStorage.CopyFile(ctx, tenant, file.StorageName(), movedFile.ObjectName)
+		if err != nil {
+			_ = useCase.moveQuota(ctx, tenant, movedFile.ReferenceID, file.ReferenceID, file.Size, models.QuotaLimits{})
+			return nil, fmt.Errorf("DefaultFilesUseCase - MoveFile: can't copy file in file storage; %w", err)
+		}
+		movedFile.Thumbnails = useCase.copyThumbnails(ctx, tenant, file.Thumbnails, file.StorageName(), movedFile.ObjectName)
+	}
+	err = useCase.fileRepository.Update(ctx, tenant, &movedFile)
+	if err == nil && copyObject {
+		err = useCase.fileRepository.UpdateObject(ctx, tenant, movedFile.ID, movedFile.ObjectName, movedFile.Thumbnails)
+		if err != nil {
+			_ = useCase.fileRepository.Update(ctx, tenant, file)
+		}
+	}
+	if err != nil {
+		if copyObject {
+			useCase.removeObjects(ctx, tenant, &movedFile)
+		}
+		_ = useCase.moveQuota(ctx, tenant, movedFile.ReferenceID, file.ReferenceID, file.Size, models.QuotaLimits{})
+		return nil, fmt.Errorf("DefaultFilesUseCase - MoveFile: can't update file in repository; %w", err)
+	}
+	if copyObject {
+		// the file is already served from the new object, a leftover old one only takes space
+		useCase.removeObjects(ctx, tenant, file)
+	}
+	if renamed {
+		err = useCase.indexer.update(ctx, tenant, &movedFile)
+		if err != nil {
+			return nil, fmt.Errorf("DefaultFilesUseCase - MoveFile: can't index file; %w", err)
+		}
+	}
+	useCase.committed(ctx, events.FileMoved, audit.ActionMove, tenant, "", &movedFile)
+	return &models.Attachment{ID: movedFile.ID, FileName: movedFile.FileName, Status: movedFile.Status}, nil
+}
+
+// uploadContent stores the uploaded file under its own name, or in the shared object of its
+// content when deduplication is on.
+func (useCase *DefaultFilesUseCase) uploadContent(ctx context.Context, tenant string, file *models.File, content []byte) error {
+	if useCase.contents == nil {
+		return useCase.fileStorage.UploadFile(ctx, tenant, file.FileName, content)
+	}
+	file.ContentHash = hashContent(content)
+	file.ObjectName = makeContentName(file.ContentHash, file.FileName)
+	return useCase.contents.store(ctx, tenant, file.ObjectName, content)
+}
+
+// UpdateMetadata changes metadata and tags of the file in the repository and on its object.
+func (useCase *DefaultFilesUseCase) UpdateMetadata(ctx context.Context, tenant string, command models.UpdateMetadataCommand) (*models.Attachment, error) {
+	file, err := useCase.readFile(ctx, tenant, command.FileID)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - UpdateMetadata: %w", err)
+	}
+	err = useCase.authorize(ctx, tenant, file, models.RoleWriter)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - UpdateMetadata: %w", err)
+	}
+	updatedFile := *file
+	updatedFile.Metadata = mergeMetadata(file.Metadata, command.Metadata)
+	if command.Tags != nil {
+		updatedFile.Tags = uniqueTags(*command.Tags)
+	}
+	err = validateMetadata(updatedFile.Metadata)
+	if err == nil {
+		err = validateTags(updatedFile.Tags)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - UpdateMetadata: %w", err)
+	}
+	err = useCase.writeMetadata(ctx, tenant, &updatedFile)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - UpdateMetadata: can't write object metadata; %w", err)
+	}
+	err = useCase.fileRepository.Update(ctx, tenant, &updatedFile)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - UpdateMetadata: can't update file in repository; %w", err)
+	}
+	if command.Tags != nil {
+		err = useCase.indexer.update(ctx, tenant, &updatedFile)
+		if err != nil {
+			return nil, fmt.Errorf("DefaultFilesUseCase - UpdateMetadata: can't index file; %w", err)
+		}
+	}
+	useCase.committed(ctx, events.FileMetadataUpdated, audit.ActionUpdateMetadata, tenant, "", &updatedFile)
+	return &models.Attachment{
+		ID:       updatedFile.ID,
+		FileName: updatedFile.FileName,
+		Status:   updatedFile.Status,
+		Metadata: updatedFile.Metadata,
+		Tags:     updatedFile.Tags,
+	}, nil
+}
+
+// writeMetadata labels the file's object with its metadata and tags. Deduplicated content is
+// shared by files with different labels, so its object isn't labelled.
+func (useCase *DefaultFilesUseCase) writeMetadata(ctx context.Context, tenant string, file *models.File) error {
+	if file.ContentHash != "" {
+		return nil
+	}
+	storageName := file.StorageName()
+	if file.Status == models.FileStatusInfected {
+		storageName = quarantineName(storageName)
+	}
+	return useCase.fileStorage.SetMetadata(ctx, tenant, storageName, objectMetadata(file.Metadata, file.Tags))
+}
+
+// LinkFile attaches a clean file to one more reference without copying it. The file keeps counting
+// towards the quota of the reference that owns it only.
+func (useCase *DefaultFilesUseCase) LinkFile(ctx context.Context, tenant string, fileID, referenceID string) error {
+	file, err := useCase.readFile(ctx, tenant, fileID)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - LinkFile: %w", err)
+	}
+	err = useCase.authorize(ctx, tenant, file, models.RoleWriter)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - LinkFile: %w", err)
+	}
+	if file.Status != models.FileStatusClean {
+		return fmt.Errorf("DefaultFilesUseCase - LinkFile: %w", ErrFileNotClean)
+	}
+	err = validateReferenceID(referenceID)
+	if err == nil {
+		err = useCase.authorizeReference(ctx, tenant, referenceID)
+	}
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - LinkFile: %w", err)
+	}
+	links, err := useCase.fileRepository.ListLinks(ctx, tenant, fileID)
 	if err != nil {
-		return fmt.Errorf("DefaultFilesUseCase - DeleteFile: can't delete file from repository; %w", err)
+		return fmt.Errorf("DefaultFilesUseCase - LinkFile: can't read links from repository; %w", err)
+	}
+	for _, link := range links {
+		if link == referenceID {
+			return nil
+		}
 	}
-	err = useCase.fileStorage.DeleteFile(ctx, tenant, file.FileName)
+	err = useCase.fileRepository.Link(ctx, tenant, fileID, referenceID)
 	if err != nil {
-		return fmt.Errorf("DefaultFilesUseCase - DeleteFile: can't delete file from storage; %w", err)
+		return fmt.Errorf("DefaultFilesUseCase - LinkFile: can't link file in repository; %w", err)
 	}
+	linkedFile := *file
+	linkedFile.ReferenceID = referenceID
+	useCase.committed(ctx, events.FileLinked, audit.ActionLink, tenant, "", &linkedFile)
 	return nil
 }
+
+// UnlinkFile detaches the file from the reference. The file is deleted along with its objects once
+// its last link is gone. When the owning reference is unlinked, the next linked one takes its
+// place and its usage. No reference can be unlinked from a file it retains, and the owning one
+// can't be unlinked from files on legal hold or retained by any of their references.
+func (useCase *DefaultFilesUseCase) UnlinkFile(ctx context.Context, tenant string, fileID, referenceID string) error {
+	file, err := useCase.readFile(ctx, tenant, fileID)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - UnlinkFile: %w", err)
+	}
+	err = useCase.authorize(ctx, tenant, file, models.RoleWriter)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - UnlinkFile: %w", err)
+	}
+	if referenceID == file.ReferenceID {
+		// the owning reference stays linked until the last, so this covers deleting the file as
+		// well as handing it over to a reference that might not retain it
+		err = useCase.checkRetention(ctx, tenant, file)
+	} else {
+		err = useCase.checkReferenceRetention(ctx, tenant, file, referenceID)
+	}
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - UnlinkFile: %w", err)
+	}
+	remaining, err := useCase.fileRepository.Unlink(ctx, tenant, fileID, referenceID)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - UnlinkFile: can't unlink file in repository; %w", err)
+	}
+	unlinkedFile := *file
+	unlinkedFile.ReferenceID = referenceID
+	if len(remaining) == 0 {
+		err = useCase.deleteFile(ctx, tenant, file)
+		if err != nil {
+			return fmt.Errorf("DefaultFilesUseCase - UnlinkFile: %w", err)
+		}
+		useCase.committed(ctx, events.FileUnlinked, audit.ActionUnlink, tenant, "", &unlinkedFile)
+		useCase.committed(ctx, events.FileDeleted, audit.ActionDelete, tenant, "", file)
+		return nil
+	}
+	if referenceID == file.ReferenceID {
+		ownedFile := *file
+		ownedFile.ReferenceID = remaining[0]
+		err = useCase.moveQuota(ctx, tenant, file.ReferenceID, ownedFile.ReferenceID, file.Size, models.QuotaLimits{})
+		if err != nil {
+			return fmt.Errorf("DefaultFilesUseCase - UnlinkFile: %w", err)
+		}
+		err = useCase.fileRepository.Update(ctx, tenant, &ownedFile)
+		if err != nil {
+			return fmt.Errorf("DefaultFilesUseCase - UnlinkFile: can't update file in repository; %w", err)
+		}
+	}
+	useCase.committed(ctx, events.FileUnlinked, audit.ActionUnlink, tenant, "", &unlinkedFile)
+	return nil
+}
+
+// SetLegalHold places or releases the legal hold of the file. The storage holds the object as well
+// when object holds are on.
+func (useCase *DefaultFilesUseCase) SetLegalHold(ctx context.Context, tenant string, fileID string, hold bool) error {
+	file, err := useCase.readFile(ctx, tenant, fileID)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - SetLegalHold: %w", err)
+	}
+	err = useCase.authorize(ctx, tenant, file, models.RoleOwner)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - SetLegalHold: %w", err)
+	}
+	if file.LegalHold == hold {
+		return nil
+	}
+	err = useCase.holdObject(ctx, tenant, file, hold)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - SetLegalHold: can't hold object in file storage; %w", err)
+	}
+	heldFile := *file
+	heldFile.LegalHold = hold
+	err = useCase.fileRepository.Update(ctx, tenant, &heldFile)
+	if err != nil {
+		_ = useCase.holdObject(ctx, tenant, file, !hold)
+		return fmt.Errorf("DefaultFilesUseCase - SetLegalHold: can't update file in repository; %w", err)
+	}
+	action := audit.ActionLegalHold
+	if !hold {
+		action = audit.ActionReleaseHold
+	}
+	useCase.committed(ctx, "", action, tenant, "", &heldFile)
+	return nil
+}
+
+// holdObject holds the file's object in the storage when object holds are on. Deduplicated content
+// is shared with files that aren't held, so its object isn't.
+func (useCase *DefaultFilesUseCase) holdObject(ctx context.Context, tenant string, file *models.File, hold bool) error {
+	if useCase.objectHolder == nil || file.ContentHash != "" {
+		return nil
+	}
+	storageName := file.StorageName()
+	if file.Status == models.FileStatusInfected {
+		storageName = quarantineName(storageName)
+	}
+	return useCase.objectHolder.SetHold(ctx, tenant, storageName, hold)
+}
+
+// SetRetentionRule sets the rule of the tenant, or of the reference named by the rule. With access
+// control on, rules of references are set by their owners and the rule of the tenant by its admins.
+func (useCase *DefaultFilesUseCase) SetRetentionRule(ctx context.Context, tenant string, rule models.RetentionRule) error {
+	if useCase.retentionStore == nil {
+		return fmt.Errorf("DefaultFilesUseCase - SetRetentionRule: %w", ErrRetentionNotEnabled)
+	}
+	err := validateRetentionRule(rule)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - SetRetentionRule: %w", err)
+	}
+	err = useCase.authorizeRetention(ctx, tenant, rule.ReferenceID)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - SetRetentionRule: %w", err)
+	}
+	err = useCase.retentionStore.Set(ctx, tenant, rule)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - SetRetentionRule: can't store rule; %w", err)
+	}
+	useCase.committed(ctx, "", audit.ActionSetRetention, tenant, "", &models.File{ReferenceID: rule.ReferenceID})
+	return nil
+}
+
+// RemoveRetentionRule removes the rule of the reference, or of the tenant when referenceID is empty.
+func (useCase *DefaultFilesUseCase) RemoveRetentionRule(ctx context.Context, tenant string, referenceID string) error {
+	if useCase.retentionStore == nil {
+		return fmt.Errorf("DefaultFilesUseCase - RemoveRetentionRule: %w", ErrRetentionNotEnabled)
+	}
+	err := useCase.authorizeRetention(ctx, tenant, referenceID)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - RemoveRetentionRule: %w", err)
+	}
+	err = useCase.retentionStore.Remove(ctx, tenant, referenceID)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - RemoveRetentionRule: can't remove rule; %w", err)
+	}
+	useCase.committed(ctx, "", audit.ActionUnsetRetention, tenant, "", &models.File{ReferenceID: referenceID})
+	return nil
+}
+
+// authorizeRetention fails unless the caller administers the tenant or, for the rule of a reference,
+// owns the reference.
+func (useCase *DefaultFilesUseCase) authorizeRetention(ctx context.Context, tenant string, referenceID string) error {
+	if useCase.accessStore == nil {
+		return nil
+	}
+	caller, ok := access.CallerFrom(ctx)
+	if !ok || caller.InGroup(access.AdminsGroup) {
+		return nil
+	}
+	if referenceID == "" {
+		return ErrAccessDenied
+	}
+	_, err := useCase.referenceGrantsForOwner(ctx, tenant, referenceID)
+	return err
+}
+
+func (useCase *DefaultFilesUseCase) ListRetentionRules(ctx context.Context, tenant string) ([]models.RetentionRule, error) {
+	if useCase.retentionStore == nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - ListRetentionRules: %w", ErrRetentionNotEnabled)
+	}
+	rules, err := useCase.retentionStore.List(ctx, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - ListRetentionRules: can't list rules; %w", err)
+	}
+	return rules, nil
+}
+
+// DeleteExpiredFiles deletes files of every tenant past the expiration of the rules of all their
+// references, except those on legal hold, and reports how many were deleted. Failures don't stop
+// the rest from being deleted, they are returned together at the end.
+func (useCase *DefaultFilesUseCase) DeleteExpiredFiles(ctx context.Context) (int, error) {
+	if useCase.retentionStore == nil {
+		return 0, nil
+	}
+	tenants, err := useCase.retentionStore.Tenants(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("DefaultFilesUseCase - DeleteExpiredFiles: can't list tenants; %w", err)
+	}
+	now := time.Now()
+	deleted := 0
+	var errs []error
+	for _, tenant := range tenants {
+		rules, err := useCase.retentionStore.List(ctx, tenant)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("DefaultFilesUseCase - DeleteExpiredFiles: can't list rules of tenant %s; %w", tenant, err))
+			continue
+		}
+		tenantFiles, err := useCase.fileRepository.Search(ctx, tenant, models.FileFilter{})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("DefaultFilesUseCase - DeleteExpiredFiles: can't list files of tenant %s; %w", tenant, err))
+			continue
+		}
+		for i := range *tenantFiles {
+			file := (*tenantFiles)[i]
+			if file.LegalHold {
+				continue
+			}
+			fileRules, err := useCase.fileRetentionRules(ctx, tenant, &file, rules)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("DefaultFilesUseCase - DeleteExpiredFiles: %w", err))
+				continue
+			}
+			if !expired(&file, fileRules, now) {
+				continue
+			}
+			err = useCase.deleteFile(ctx, tenant, &file)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("DefaultFilesUseCase - DeleteExpiredFiles: can't delete file %s; %w", file.ID, err))
+				continue
+			}
+			useCase.committed(ctx, events.FileDeleted, audit.ActionDelete, tenant, "", &file)
+			deleted++
+		}
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// CreateShare shares a clean file by a link served by the app, which unlike signed urls can be
+// revoked, protected by a password and limited in downloads.
+func (useCase *DefaultFilesUseCase) CreateShare(ctx context.Context, tenant string, command models.CreateShareCommand) (*models.ShareLink, error) {
+	if useCase.shareRepository == nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - CreateShare: %w", ErrSharingNotEnabled)
+	}
+	if command.ExpiresIn <= 0 || command.ExpiresIn > useCase.maxShareExpiration {
+		return nil, fmt.Errorf("DefaultFilesUseCase - CreateShare: %w: expiration must be positive and at most %s", ErrInvalidShare, useCase.maxShareExpiration)
+	}
+	if command.MaxDownloads < 0 {
+		return nil, fmt.Errorf("DefaultFilesUseCase - CreateShare: %w: max downloads can't be negative", ErrInvalidShare)
+	}
+	file, err := useCase.readFile(ctx, tenant, command.FileID)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - CreateShare: %w", err)
+	}
+	err = useCase.authorize(ctx, tenant, file, models.RoleWriter)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - CreateShare: %w", err)
+	}
+	if file.Status != models.FileStatusClean {
+		return nil, fmt.Errorf("DefaultFilesUseCase - CreateShare: %w", ErrFileNotClean)
+	}
+	token, err := makeShareToken()
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - CreateShare: can't make token; %w", err)
+	}
+	passwordHash, err := hashSharePassword(command.Password)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - CreateShare: can't hash password; %w", err)
+	}
+	now := time.Now()
+	share := models.Share{
+		Token:        token,
+		Tenant:       tenant,
+		FileID:       file.ID,
+		CreatorId:    command.CreatorId,
+		CreatedAt:    now.Unix(),
+		ExpiresAt:    now.Add(command.ExpiresIn).Unix(),
+		MaxDownloads: command.MaxDownloads,
+		PasswordHash: passwordHash,
+	}
+	err = useCase.shareRepository.Add(ctx, &share)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - CreateShare: can't add share to repository; %w", err)
+	}
+	useCase.committed(ctx, "", audit.ActionShare, tenant, command.CreatorId, file)
+	link := makeShareLink(&share)
+	return &link, nil
+}
+
+// ListShares lists shares of the file that can still be opened.
+func (useCase *DefaultFilesUseCase) ListShares(ctx context.Context, tenant string, fileID string) ([]models.ShareLink, error) {
+	if useCase.shareRepository == nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - ListShares: %w", ErrSharingNotEnabled)
+	}
+	file, err := useCase.readFile(ctx, tenant, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - ListShares: %w", err)
+	}
+	err = useCase.authorize(ctx, tenant, file, models.RoleWriter)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - ListShares: %w", err)
+	}
+	shares, err := useCase.shareRepository.ListBy(ctx, tenant, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - ListShares: can't list shares; %w", err)
+	}
+	now := time.Now()
+	result := make([]models.ShareLink, 0, len(shares))
+	for i := range shares {
+		if shareActive(&shares[i], now) {
+			result = append(result, makeShareLink(&shares[i]))
+		}
+	}
+	return result, nil
+}
+
+// RevokeShare removes the share, its link stops working at once.
+func (useCase *DefaultFilesUseCase) RevokeShare(ctx context.Context, tenant string, token string) error {
+	if useCase.shareRepository == nil {
+		return fmt.Errorf("DefaultFilesUseCase - RevokeShare: %w", ErrSharingNotEnabled)
+	}
+	share, err := useCase.shareRepository.ReadBy(ctx, token)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - RevokeShare: can't read share from repository; %w", err)
+	}
+	if share == nil || share.Tenant != tenant {
+		return fmt.Errorf("DefaultFilesUseCase - RevokeShare: %w", ErrShareNotFound)
+	}
+	file, err := useCase.readFile(ctx, tenant, share.FileID)
+	if err != nil {
+		// shares are deleted along with their file
+		return fmt.Errorf("DefaultFilesUseCase - RevokeShare: %w", err)
+	}
+	err = useCase.authorize(ctx, tenant, file, models.RoleWriter)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - RevokeShare: %w", err)
+	}
+	err = useCase.shareRepository.Delete(ctx, tenant, token)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - RevokeShare: can't delete share from repository; %w", err)
+	}
+	useCase.committed(ctx, "", audit.ActionRevokeShare, tenant, "", file)
+	return nil
+}
+
+// OpenShare counts a download of the shared file and serves it by a signed url expiring shortly,
+// or by its content when the storage can't sign one. Protected shares lock after a few wrong passwords.
+func (useCase *DefaultFilesUseCase) OpenShare(ctx context.Context, token string, password string) (*models.SharedFile, error) {
+	if useCase.shareRepository == nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - OpenShare: %w", ErrSharingNotEnabled)
+	}
+	share, err := useCase.shareRepository.ReadBy(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - OpenShare: can't read share from repository; %w", err)
+	}
+	if share == nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - OpenShare: %w", ErrShareNotFound)
+	}
+	if time.Now().Unix() >= share.ExpiresAt {
+		return nil, fmt.Errorf("DefaultFilesUseCase - OpenShare: %w", ErrShareExpired)
+	}
+	if share.MaxDownloads > 0 && share.Downloads >= share.MaxDownloads {
+		return nil, fmt.Errorf("DefaultFilesUseCase - OpenShare: %w", ErrShareExhausted)
+	}
+	err = checkSharePassword(share, password)
+	if errors.Is(err, ErrSharePasswordInvalid) {
+		if countErr := useCase.shareRepository.CountFailedAttempt(ctx, token); countErr != nil {
+			return nil, fmt.Errorf("DefaultFilesUseCase - OpenShare: can't count failed attempt; %w", countErr)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - OpenShare: %w", err)
+	}
+	file, err := useCase.readFile(ctx, share.Tenant, share.FileID)
+	if errors.Is(err, ErrFileNotFound) {
+		return nil, fmt.Errorf("DefaultFilesUseCase - OpenShare: %w", ErrShareNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - OpenShare: %w", err)
+	}
+	if file.Status != models.FileStatusClean {
+		return nil, fmt.Errorf("DefaultFilesUseCase - OpenShare: %w", ErrFileNotClean)
+	}
+	// the download is counted once the file can be served, so storage failures don't use it up
+	sharedFile, err := useCase.serveSharedFile(ctx, share, file)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - OpenShare: %w", err)
+	}
+	_, err = useCase.shareRepository.CountDownload(ctx, token)
+	if err == nil {
+		err = useCase.audit(ctx, audit.ActionSharedDownload, share.Tenant, "", file)
+	}
+	if err != nil {
+		if sharedFile.Content != nil {
+			_ = sharedFile.Content.Content.Close()
+		}
+		return nil, fmt.Errorf("DefaultFilesUseCase - OpenShare: %w", err)
+	}
+	return sharedFile, nil
+}
+
+// serveSharedFile signs a url of the shared file, or opens its content when the storage can't sign one.
+func (useCase *DefaultFilesUseCase) serveSharedFile(ctx context.Context, share *models.Share, file *models.File) (*models.SharedFile, error) {
+	url, err := useCase.fileStorage.GetExpiringUrl(share.Tenant, file.StorageName(), models.SignedUrlOptions{
+		Expiry: useCase.shareUrlExpiration,
+		Method: http.MethodGet,
+	})
+	if err == nil {
+		return &models.SharedFile{Url: url}, nil
+	}
+	if !errors.Is(err, ports.ErrSignedUrlNotSupported) {
+		return nil, fmt.Errorf("can't get file url; %w", err)
+	}
+	content, err := useCase.fileStorage.ReadFile(ctx, share.Tenant, file.StorageName())
+	if err != nil {
+		return nil, fmt.Errorf("can't read file from storage; %w", err)
+	}
+	return &models.SharedFile{Content: &models.FileContent{FileName: file.FileName, Content: content}}, nil
+}
+
+// ListFileAccess lists grants on the file itself, without those of its references.
+func (useCase *DefaultFilesUseCase) ListFileAccess(ctx context.Context, tenant string, fileID string) ([]models.Grant, error) {
+	if useCase.accessStore == nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - ListFileAccess: %w", ErrAccessControlDisabled)
+	}
+	file, err := useCase.readFile(ctx, tenant, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - ListFileAccess: %w", err)
+	}
+	err = useCase.authorize(ctx, tenant, file, models.RoleReader)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - ListFileAccess: %w", err)
+	}
+	return file.Grants, nil
+}
+
+// GrantFileAccess gives the role on the file to the principal, replacing the one it had.
+func (useCase *DefaultFilesUseCase) GrantFileAccess(ctx context.Context, tenant string, fileID string, grant models.Grant) error {
+	if useCase.accessStore == nil {
+		return fmt.Errorf("DefaultFilesUseCase - GrantFileAccess: %w", ErrAccessControlDisabled)
+	}
+	err := validateGrant(grant)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - GrantFileAccess: %w", err)
+	}
+	file, err := useCase.readFile(ctx, tenant, fileID)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - GrantFileAccess: %w", err)
+	}
+	err = useCase.updateGrants(ctx, tenant, file, setGrant(file.Grants, grant), audit.ActionGrantAccess)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - GrantFileAccess: %w", err)
+	}
+	return nil
+}
+
+func (useCase *DefaultFilesUseCase) RevokeFileAccess(ctx context.Context, tenant string, fileID string, principalType models.PrincipalType, principalID string) error {
+	if useCase.accessStore == nil {
+		return fmt.Errorf("DefaultFilesUseCase - RevokeFileAccess: %w", ErrAccessControlDisabled)
+	}
+	file, err := useCase.readFile(ctx, tenant, fileID)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - RevokeFileAccess: %w", err)
+	}
+	grants, found := removeGrant(file.Grants, principalType, principalID)
+	if !found {
+		return fmt.Errorf("DefaultFilesUseCase - RevokeFileAccess: %w", ErrGrantNotFound)
+	}
+	err = useCase.updateGrants(ctx, tenant, file, grants, audit.ActionRevokeAccess)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - RevokeFileAccess: %w", err)
+	}
+	return nil
+}
+
+// updateGrants replaces grants on the file for its owner.
+func (useCase *DefaultFilesUseCase) updateGrants(ctx context.Context, tenant string, file *models.File, grants []models.Grant, action audit.Action) error {
+	err := useCase.authorize(ctx, tenant, file, models.RoleOwner)
+	if err != nil {
+		return err
+	}
+	err = checkOwnerKept(file.Grants, grants)
+	if err != nil {
+		return err
+	}
+	updatedFile := *file
+	updatedFile.Grants = grants
+	err = useCase.fileRepository.Update(ctx, tenant, &updatedFile)
+	if err != nil {
+		return fmt.Errorf("can't update file in repository; %w", err)
+	}
+	useCase.committed(ctx, "", action, tenant, "", &updatedFile)
+	return nil
+}
+
+// ListReferenceAccess lists grants on the reference to its owners, who are the ones to manage them.
+func (useCase *DefaultFilesUseCase) ListReferenceAccess(ctx context.Context, tenant string, referenceID string) ([]models.Grant, error) {
+	if useCase.accessStore == nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - ListReferenceAccess: %w", ErrAccessControlDisabled)
+	}
+	grants, err := useCase.referenceGrantsForOwner(ctx, tenant, referenceID)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - ListReferenceAccess: %w", err)
+	}
+	return grants, nil
+}
+
+// GrantReferenceAccess gives the role on the reference, and so on all its files, to the principal.
+// A reference nobody has access to yet is claimed by the caller as its owner first.
+func (useCase *DefaultFilesUseCase) GrantReferenceAccess(ctx context.Context, tenant string, referenceID string, grant models.Grant) error {
+	if useCase.accessStore == nil {
+		return fmt.Errorf("DefaultFilesUseCase - GrantReferenceAccess: %w", ErrAccessControlDisabled)
+	}
+	err := validateGrant(grant)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - GrantReferenceAccess: %w", err)
+	}
+	err = useCase.authorizeReference(ctx, tenant, referenceID)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - GrantReferenceAccess: %w", err)
+	}
+	grants, err := useCase.referenceGrantsForOwner(ctx, tenant, referenceID)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - GrantReferenceAccess: %w", err)
+	}
+	err = checkOwnerKept(grants, setGrant(grants, grant))
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - GrantReferenceAccess: %w", err)
+	}
+	err = useCase.accessStore.Grant(ctx, tenant, referenceID, grant)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - GrantReferenceAccess: can't store grant; %w", err)
+	}
+	useCase.committed(ctx, "", audit.ActionGrantAccess, tenant, "", &models.File{ReferenceID: referenceID})
+	return nil
+}
+
+func (useCase *DefaultFilesUseCase) RevokeReferenceAccess(ctx context.Context, tenant string, referenceID string, principalType models.PrincipalType, principalID string) error {
+	if useCase.accessStore == nil {
+		return fmt.Errorf("DefaultFilesUseCase - RevokeReferenceAccess: %w", ErrAccessControlDisabled)
+	}
+	grants, err := useCase.referenceGrantsForOwner(ctx, tenant, referenceID)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - RevokeReferenceAccess: %w", err)
+	}
+	remaining, found := removeGrant(grants, principalType, principalID)
+	if !found {
+		return fmt.Errorf("DefaultFilesUseCase - RevokeReferenceAccess: %w", ErrGrantNotFound)
+	}
+	err = checkOwnerKept(grants, remaining)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - RevokeReferenceAccess: %w", err)
+	}
+	err = useCase.accessStore.Revoke(ctx, tenant, referenceID, principalType, principalID)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - RevokeReferenceAccess: can't revoke grant; %w", err)
+	}
+	useCase.committed(ctx, "", audit.ActionRevokeAccess, tenant, "", &models.File{ReferenceID: referenceID})
+	return nil
+}
+
+// referenceGrantsForOwner lists grants on the reference, failing unless the caller owns it.
+func (useCase *DefaultFilesUseCase) referenceGrantsForOwner(ctx context.Context, tenant string, referenceID string) ([]models.Grant, error) {
+	grants, err := useCase.accessStore.List(ctx, tenant, referenceID)
+	if err != nil {
+		return nil, fmt.Errorf("can't list grants; %w", err)
+	}
+	caller, ok := access.CallerFrom(ctx)
+	if ok && !includesRole(callerRole(grants, caller), models.RoleOwner) {
+		return nil, ErrAccessDenied
+	}
+	return grants, nil
+}
+
+// authorize fails unless the caller has the role on the file, by grants on the file or on any
+// reference it's linked to. Calls outside of a request, e.g. from background jobs, aren't checked.
+func (useCase *DefaultFilesUseCase) authorize(ctx context.Context, tenant string, file *models.File, role models.Role) error {
+	if useCase.accessStore == nil {
+		return nil
+	}
+	caller, ok := access.CallerFrom(ctx)
+	if !ok || includesRole(callerRole(file.Grants, caller), role) {
+		return nil
+	}
+	links, err := useCase.fileRepository.ListLinks(ctx, tenant, file.ID)
+	if err != nil {
+		return fmt.Errorf("can't read links from repository; %w", err)
+	}
+	for _, referenceID := range links {
+		grants, err := useCase.accessStore.List(ctx, tenant, referenceID)
+		if err != nil {
+			return fmt.Errorf("can't list grants; %w", err)
+		}
+		if includesRole(callerRole(grants, caller), role) {
+			return nil
+		}
+	}
+	return ErrAccessDenied
+}
+
+// authorizeReference fails unless the caller can add files to the reference. A new reference,
+// with neither grants nor files, is claimed by the caller as its owner; references holding files
+// of others can't be taken over this way.
+func (useCase *DefaultFilesUseCase) authorizeReference(ctx context.Context, tenant string, referenceID string) error {
+	if useCase.accessStore == nil {
+		return nil
+	}
+	caller, ok := access.CallerFrom(ctx)
+	if !ok {
+		return nil
+	}
+	grants, err := useCase.accessStore.List(ctx, tenant, referenceID)
+	if err != nil {
+		return fmt.Errorf("can't list grants; %w", err)
+	}
+	if len(grants) == 0 {
+		referenceFiles, err := useCase.fileRepository.ListBy(ctx, tenant, referenceID)
+		if err != nil {
+			return fmt.Errorf("can't read files from repository; %w", err)
+		}
+		if len(*referenceFiles) > 0 {
+			return ErrAccessDenied
+		}
+		err = useCase.accessStore.Grant(ctx, tenant, referenceID, ownerGrant(caller))
+		if err != nil {
+			return fmt.Errorf("can't claim reference; %w", err)
+		}
+		return nil
+	}
+	if !includesRole(callerRole(grants, caller), models.RoleWriter) {
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+// readableFiles keeps the files the caller can read, all of them when it can read the reference
+// they are listed by.
+func (useCase *DefaultFilesUseCase) readableFiles(ctx context.Context, tenant string, referenceID string, files []models.File) ([]models.File, error) {
+	if useCase.accessStore == nil {
+		return files, nil
+	}
+	caller, ok := access.CallerFrom(ctx)
+	if !ok {
+		return files, nil
+	}
+	if referenceID != "" {
+		grants, err := useCase.accessStore.List(ctx, tenant, referenceID)
+		if err != nil {
+			return nil, fmt.Errorf("can't list grants; %w", err)
+		}
+		if includesRole(callerRole(grants, caller), models.RoleReader) {
+			return files, nil
+		}
+	}
+	var result []models.File
+	for i := range files {
+		err := useCase.authorize(ctx, tenant, &files[i], models.RoleReader)
+		if errors.Is(err, ErrAccessDenied) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, files[i])
+	}
+	return result, nil
+}
+
+// creatorGrants makes the caller the owner of the file it creates.
+func (useCase *DefaultFilesUseCase) creatorGrants(ctx context.Context) []models.Grant {
+	if useCase.accessStore == nil {
+		return nil
+	}
+	caller, ok := access.CallerFrom(ctx)
+	if !ok {
+		return nil
+	}
+	return []models.Grant{ownerGrant(caller)}
+}
+
+// checkRetention fails for files on legal hold and files still retained by the rule of any of
+// their references.
+func (useCase *DefaultFilesUseCase) checkRetention(ctx context.Context, tenant string, file *models.File) error {
+	if file.LegalHold {
+		return ErrFileOnLegalHold
+	}
+	if useCase.retentionStore == nil {
+		return nil
+	}
+	rules, err := useCase.retentionStore.List(ctx, tenant)
+	if err != nil {
+		return fmt.Errorf("can't list retention rules; %w", err)
+	}
+	fileRules, err := useCase.fileRetentionRules(ctx, tenant, file, rules)
+	if err != nil {
+		return err
+	}
+	return checkRetained(file, fileRules, time.Now())
+}
+
+// checkReferenceRetention fails while the rule of the reference retains the file.
+func (useCase *DefaultFilesUseCase) checkReferenceRetention(ctx context.Context, tenant string, file *models.File, referenceID string) error {
+	if useCase.retentionStore == nil {
+		return nil
+	}
+	rules, err := useCase.retentionStore.List(ctx, tenant)
+	if err != nil {
+		return fmt.Errorf("can't list retention rules; %w", err)
+	}
+	return checkRetained(file, resolveRetentionRules(rules, []string{referenceID}), time.Now())
+}
+
+// fileRetentionRules resolves the rules of the references the file is linked to.
+func (useCase *DefaultFilesUseCase) fileRetentionRules(ctx context.Context, tenant string, file *models.File, rules []models.RetentionRule) ([]models.RetentionRule, error) {
+	references, err := useCase.fileRepository.ListLinks(ctx, tenant, file.ID)
+	if err != nil {
+		return nil, fmt.Errorf("can't list references of file %s; %w", file.ID, err)
+	}
+	if len(references) == 0 {
+		references = []string{file.ReferenceID}
+	}
+	return resolveRetentionRules(rules, references), nil
+}
+
+// copyThumbnails copies thumbnails to the names of the target object. Thumbnails are best
+// effort, those that fail to copy are left out.
+func (useCase *DefaultFilesUseCase) copyThumbnails(ctx context.Context, tenant string, thumbnails []models.Thumbnail, sourceObject, targetObject string) []models.Thumbnail {
+	var result []models.Thumbnail
+	for _, thumbnail := range thumbnails {
+		extension := strings.TrimPrefix(thumbnail.FileName, makeThumbnailName(thumbnail.Size, sourceObject, ""))
+		thumbnailName := makeThumbnailName(thumbnail.Size, targetObject, extension)
+		if err := useCase.fileStorage.CopyFile(ctx, tenant, thumbnail.FileName, thumbnailName); err != nil {
+			continue
+		}
+		result = append(result, models.Thumbnail{Size: thumbnail.Size, FileName: thumbnailName})
+	}
+	return result
+}
+
+// removeObjects deletes the file's object with its thumbnails, ignoring failures. Deduplicated
+// content is only released, its object goes with the last file.
+func (useCase *DefaultFilesUseCase) removeObjects(ctx context.Context, tenant string, file *models.File) {
+	if file.ContentHash != "" {
+		_ = useCase.contents.release(ctx, tenant, file.ObjectName)
+	} else {
+		_ = useCase.fileStorage.DeleteFile(ctx, tenant, file.StorageName())
+	}
+	for _, thumbnail := range file.Thumbnails {
+		_ = useCase.fileStorage.DeleteFile(ctx, tenant, thumbnail.FileName)
+	}
+}
+
+func makeObjectName(fileID, fileName string) string {
+	return fmt.Sprintf("%s/%s/%s", _objectsPrefix, fileID, fileName)
+}
+
+// resolveFileName keeps the current name when none is requested.
+func resolveFileName(requested, current string) (string, error) {
+	if requested == "" {
+		return current, nil
+	}
+	if requested != filepath.Base(requested) || requested == "." || requested == ".." || strings.Contains(requested, "\\") {
+		return "", ErrInvalidFileName
+	}
+	return requested, nil
+}
+
+// RegisterStoredFile adds a record for an object that was put into the bucket directly.
+// Objects that are already registered are skipped, so notifications can be redelivered.
+// The object is already stored, so it counts towards the quota without being checked against it.
+func (useCase *DefaultFilesUseCase) RegisterStoredFile(ctx context.Context, object models.StoredObject) error {
+	existing, err := useCase.findStoredFile(ctx, object)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - RegisterStoredFile: %w", err)
+	}
+	if existing != nil {
+		return nil
+	}
+	var content []byte
+	if useCase.scanPipeline != nil || len(useCase.cleanPipelines) > 0 {
+		content, err = useCase.readStoredContent(ctx, object.Tenant, object.ObjectName)
+		if err != nil {
+			return fmt.Errorf("DefaultFilesUseCase - RegisterStoredFile: %w", err)
+		}
+	}
+	createdFile := models.File{
+		ID:          useCase.idGen.MakeId(),
+		FileName:    object.FileName,
+		ObjectName:  object.ObjectName,
+		ReferenceID: object.ReferenceID,
+		CreatedAt:   time.Now().Unix(),
+		Status:      models.FileStatusClean,
+		Size:        object.Size,
+	}
+	if content != nil {
+		createdFile.Size = int64(len(content))
+	}
+	if useCase.scanPipeline != nil {
+		createdFile.Status = models.FileStatusPending
+	}
+	err = useCase.fileRepository.Add(ctx, object.Tenant, &createdFile)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - RegisterStoredFile: can't add file to repository; %w", err)
+	}
+	err = useCase.enqueueProcessing(object.Tenant, createdFile.ID, content)
+	if err != nil {
+		_ = useCase.fileRepository.Delete(ctx, object.Tenant, createdFile.ID)
+		return fmt.Errorf("DefaultFilesUseCase - RegisterStoredFile: %w", err)
+	}
+	if useCase.quotaStore != nil {
+		err = useCase.quotaStore.Reserve(ctx, object.Tenant, object.ReferenceID, createdFile.Size, models.QuotaLimits{})
+		if err != nil {
+			return fmt.Errorf("DefaultFilesUseCase - RegisterStoredFile: can't count file in usage; %w", err)
+		}
+	}
+	useCase.committed(ctx, events.FileUploaded, audit.ActionRegister, object.Tenant, _storageNotificationActor, &createdFile)
+	return nil
+}
+
+// UnregisterStoredFile removes the record of an object deleted from the bucket directly, along with
+// its thumbnails. Unknown objects, including ones already removed through DeleteFile, are skipped.
+func (useCase *DefaultFilesUseCase) UnregisterStoredFile(ctx context.Context, object models.StoredObject) error {
+	file, err := useCase.findStoredFile(ctx, object)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - UnregisterStoredFile: %w", err)
+	}
+	if file == nil || file.Status == models.FileStatusInfected {
+		// infected files were moved to quarantine by the scanner, which also deletes the original
+		return nil
+	}
+	if file.LegalHold {
+		// a held record has to outlive its object, it is removed once the hold is released
+		return nil
+	}
+	err = useCase.fileRepository.Delete(ctx, object.Tenant, file.ID)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - UnregisterStoredFile: can't delete file from repository; %w", err)
+	}
+	for _, thumbnail := range file.Thumbnails {
+		err = useCase.fileStorage.DeleteFile(ctx, object.Tenant, thumbnail.FileName)
+		if err != nil {
+			return fmt.Errorf("DefaultFilesUseCase - UnregisterStoredFile: can't delete thumbnail from storage; %w", err)
+		}
+	}
+	err = useCase.releaseQuota(ctx, object.Tenant, file.ReferenceID, file.Size)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - UnregisterStoredFile: %w", err)
+	}
+	err = useCase.indexer.remove(ctx, object.Tenant, file.ID)
+	if err != nil {
+		return fmt.Errorf("DefaultFilesUseCase - UnregisterStoredFile: can't remove file from search index; %w", err)
+	}
+	useCase.committed(ctx, events.FileDeleted, audit.ActionUnregister, object.Tenant, _storageNotificationActor, file)
+	return nil
+}
+
+// Usage reports stored bytes and file count of the tenant with its limits, and of the reference
+// when referenceID isn't empty. Thumbnails don't count.
+func (useCase *DefaultFilesUseCase) Usage(ctx context.Context, tenant string, referenceID string) (*models.Usage, error) {
+	if useCase.quotaStore == nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - Usage: %w", ErrUsageNotTracked)
+	}
+	limits := useCase.resolveQuotaLimits(tenant)
+	tenantUsage, err := useCase.quotaStore.Usage(ctx, tenant, "")
+	if err != nil {
+		return nil, fmt.Errorf("DefaultFilesUseCase - Usage: can't read tenant usage; %w", err)
+	}
+	usage := models.Usage{
+		Tenant:   tenant,
+		Bytes:    tenantUsage.Bytes,
+		Files:    tenantUsage.Files,
+		MaxBytes: limits.MaxBytes,
+		MaxFiles: limits.MaxFiles,
+	}
+	if referenceID != "" {
+		referenceUsage, err := useCase.quotaStore.Usage(ctx, tenant, referenceID)
+		if err != nil {
+			return nil, fmt.Errorf("DefaultFilesUseCase - Usage: can't read reference usage; %w", err)
+		}
+		usage.Reference = &models.ReferenceUsage{
+			ReferenceID: referenceID,
+			Bytes:       referenceUsage.Bytes,
+			Files:       referenceUsage.Files,
+			MaxBytes:    limits.MaxReferenceBytes,
+			MaxFiles:    limits.MaxReferenceFiles,
+		}
+	}
+	return &usage, nil
+}
+
+func (useCase *DefaultFilesUseCase) findStoredFile(ctx context.Context, object models.StoredObject) (*models.File, error) {
+	referenceFiles, err := useCase.fileRepository.ListBy(ctx, object.Tenant, object.ReferenceID)
+	if err != nil {
+		return nil, fmt.Errorf("can't list files from repository; %w", err)
+	}
+	for _, file := range *referenceFiles {
+		if file.StorageName() == object.ObjectName {
+			return &file, nil
+		}
+	}
+	return nil, nil
+}
+
+func (useCase *DefaultFilesUseCase) readStoredContent(ctx context.Context, tenant, fileName string) ([]byte, error) {
+	reader, err := useCase.fileStorage.ReadFile(ctx, tenant, fileName)
+	if err != nil {
+		return nil, fmt.Errorf("can't read file from storage; %w", err)
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("can't read file content; %w", err)
+	}
+	return content, nil
+}
+
+// enqueueProcessing schedules the antivirus scan, which hands clean files over to thumbnails and
+// indexing, or these alone when scanning is off.
+func (useCase *DefaultFilesUseCase) enqueueProcessing(tenant, fileID string, content []byte) error {
+	if useCase.scanPipeline != nil {
+		err := useCase.scanPipeline.Enqueue(tenant, fileID, content)
+		if err != nil {
+			return fmt.Errorf("can't schedule antivirus scan; %w", err)
+		}
+		return nil
+	}
+	for _, pipeline := range useCase.cleanPipelines {
+		// thumbnails and indexing are best effort, the file is usable without them
+		_ = pipeline.Enqueue(tenant, fileID, content)
+	}
+	return nil
+}
+
+func (useCase *DefaultFilesUseCase) reserveQuota(ctx context.Context, tenant, referenceID string, size int64) error {
+	if useCase.quotaStore == nil {
+		return nil
+	}
+	err := useCase.quotaStore.Reserve(ctx, tenant, referenceID, size, useCase.resolveQuotaLimits(tenant))
+	if err != nil {
+		return fmt.Errorf("can't reserve storage quota; %w", err)
+	}
+	return nil
+}
+
+func (useCase *DefaultFilesUseCase) releaseQuota(ctx context.Context, tenant, referenceID string, size int64) error {
+	if useCase.quotaStore == nil {
+		return nil
+	}
+	err := useCase.quotaStore.Release(ctx, tenant, referenceID, size)
+	if err != nil {
+		return fmt.Errorf("can't release storage quota; %w", err)
+	}
+	return nil
+}
+
+// moveQuota shifts the file's usage between references of the tenant, checking the target against limits.
+func (useCase *DefaultFilesUseCase) moveQuota(ctx context.Context, tenant, fromReferenceID, toReferenceID string, size int64, limits models.QuotaLimits) error {
+	if useCase.quotaStore == nil || fromReferenceID == toReferenceID {
+		return nil
+	}
+	err := useCase.quotaStore.Release(ctx, tenant, fromReferenceID, size)
+	if err != nil {
+		return fmt.Errorf("can't release storage quota; %w", err)
+	}
+	err = useCase.quotaStore.Reserve(ctx, tenant, toReferenceID, size, limits)
+	if err != nil {
+		_ = useCase.quotaStore.Reserve(ctx, tenant, fromReferenceID, size, models.QuotaLimits{})
+		return fmt.Errorf("can't reserve storage quota; %w", err)
+	}
+	return nil
+}
+
+// resolveQuotaLimits applies the tenant overrides on top of the default limits.
+func (useCase *DefaultFilesUseCase) resolveQuotaLimits(tenant string) models.QuotaLimits {
+	limits := useCase.quotaLimits
+	override := useCase.tenantsQuota[tenant]
+	if override.MaxBytes > 0 {
+		limits.MaxBytes = override.MaxBytes
+	}
+	if override.MaxFiles > 0 {
+		limits.MaxFiles = override.MaxFiles
+	}
+	if override.MaxReferenceBytes > 0 {
+		limits.MaxReferenceBytes = override.MaxReferenceBytes
+	}
+	if override.MaxReferenceFiles > 0 {
+		limits.MaxReferenceFiles = override.MaxReferenceFiles
+	}
+	return limits
+}
+
+// audit records the operation; an empty actorID is resolved by the recorder from the request.
+func (useCase *DefaultFilesUseCase) audit(ctx context.Context, action audit.Action, tenant, actorID string, file *models.File) error {
+	if useCase.auditRecorder == nil {
+		return nil
+	}
+	err := useCase.auditRecorder.Record(ctx, audit.Entry{
+		Tenant:      tenant,
+		ActorID:     actorID,
+		Action:      action,
+		FileID:      file.ID,
+		ReferenceID: file.ReferenceID,
+	})
+	if err != nil {
+		return fmt.Errorf("can't record audit entry; %w", err)
+	}
+	return nil
+}
+
+// committed publishes the event, unless eventType is empty, and records the audit entry of an
+// operation that has already been committed. Failures are only logged: failing the operation
+// would make clients retry what has already happened.
+func (useCase *DefaultFilesUseCase) committed(ctx context.Context, eventType events.Type, action audit.Action, tenant, actorID string, file *models.File) {
+	if eventType != "" {
+		err := useCase.publish(ctx, eventType, tenant, actorID, file)
+		if err != nil {
+			useCase.logger.Ctx(ctx).Error(fmt.Errorf("DefaultFilesUseCase - %s: can't publish event of file %s; %w", action, file.ID, err), "files - DefaultFilesUseCase")
+		}
+	}
+	err := useCase.audit(ctx, action, tenant, actorID, file)
+	if err != nil {
+		useCase.logger.Ctx(ctx).Error(fmt.Errorf("DefaultFilesUseCase - %s: %w", action, err), "files - DefaultFilesUseCase")
+	}
+}
+
+func (useCase *DefaultFilesUseCase) publish(ctx context.Context, eventType events.Type, tenant, actorID string, file *models.File) error {
+	if useCase.eventPublisher == nil {
+		return nil
+	}
+	return useCase.eventPublisher.Publish(ctx, events.Event{
+		ID:          useCase.idGen.MakeId(),
+		Type:        eventType,
+		Tenant:      tenant,
+		FileID:      file.ID,
+		FileName:    file.FileName,
+		ReferenceID: file.ReferenceID,
+		ActorID:     actorID,
+		OccurredAt:  time.Now().UTC(),
+	})
+}
+
+// thumbnailUrls signs thumbnail urls; thumbnails that can't be signed are left out.
+func (useCase *DefaultFilesUseCase) thumbnailUrls(tenant string, thumbnails []models.Thumbnail, expiry time.Duration) ([]models.AttachmentThumbnail, error) {
+	var result []models.AttachmentThumbnail
+	for _, thumbnail := range thumbnails {
+		url, err := useCase.fileStorage.GetExpiringUrl(tenant, thumbnail.FileName, models.SignedUrlOptions{
+			Expiry: expiry,
+			Method: http.MethodGet,
+		})
+		if errors.Is(err, ports.ErrSignedUrlNotSupported) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, models.AttachmentThumbnail{Size: thumbnail.Size, Url: url})
+	}
+	return result, nil
+}
+
+func (useCase *DefaultFilesUseCase) readFile(ctx context.Context, tenant string, fileID string) (*models.File, error) {
+	file, err := useCase.fileRepository.ReadBy(ctx, tenant, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("can't read file from repository; %w", err)
+	}
+	if file == nil || file.ID == "" {
+		return nil, ErrFileNotFound
+	}
+	return file, nil
+}
+
+// resolveUrlExpiration picks the tenant default when nothing was requested and
+// rejects requests above the tenant maximum.
+func (useCase *DefaultFilesUseCase) resolveUrlExpiration(tenant string, requested time.Duration) (time.Duration, error) {
+	expiration, ok := useCase.tenantsUrlExpiration[tenant]
+	if !ok {
+		expiration = useCase.urlExpiration
+	}
+	if requested <= 0 {
+		return expiration.defaultTime, nil
+	}
+	if requested > expiration.maxTime {
+		return 0, ErrUrlExpirationTooLong
+	}
+	return requested, nil
+}
+
+func makeUrlExpiration(defaultMinutes, maxMinutes int, fallback urlExpiration) urlExpiration {
+	expiration := fallback
+	if defaultMinutes > 0 {
+		expiration.defaultTime = time.Duration(defaultMinutes) * time.Minute
+	}
+	if maxMinutes > 0 {
+		expiration.maxTime = time.Duration(maxMinutes) * time.Minute
+	}
+	if expiration.maxTime < expiration.defaultTime {
+		expiration.maxTime = expiration.defaultTime
+	}
+	return expiration
+}
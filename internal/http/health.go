@@ -0,0 +1,27 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/health"
+)
+
+// AppendHealthRoutes registers probes outside of the API. /healthz reports dependencies but
+// answers 200 as long as the process serves requests, so an outage doesn't restart it;
+// /readyz answers 503 when a dependency is down or the server is shutting down.
+func AppendHealthRoutes(handler *gin.Engine, checker *health.Checker) {
+	handler.GET("/healthz", func(ginCtx *gin.Context) {
+		report := checker.Check(ginCtx.Request.Context())
+		ginCtx.JSON(http.StatusOK, report)
+	})
+	handler.GET("/readyz", func(ginCtx *gin.Context) {
+		report := checker.Check(ginCtx.Request.Context())
+		status := http.StatusOK
+		if !report.Ready || report.Status != health.StatusUp {
+			status = http.StatusServiceUnavailable
+		}
+		ginCtx.JSON(status, report)
+	})
+}
@@ -0,0 +1,136 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/access"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/audit"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/logger"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/metrics"
+)
+
+const HeaderRequestID = "X-Request-ID"
+
+// RequestID reuses the caller's request id or makes a new one, returns it in the response
+// and attaches it to entries logged with the request context.
+func RequestID() gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		requestID := ginCtx.GetHeader(HeaderRequestID)
+		if requestID == "" || len(requestID) > 128 {
+			requestID = uuid.NewString()
+		}
+		ginCtx.Header(HeaderRequestID, requestID)
+		ctx := logger.ContextWithFields(ginCtx.Request.Context(), logger.String("request_id", requestID))
+		ginCtx.Request = ginCtx.Request.WithContext(ctx)
+		ginCtx.Next()
+	}
+}
+
+// AccessLog logs every request once it is handled: server errors at error level, client errors
+// at warn level and the rest at info level.
+func AccessLog(log logger.Logger) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		start := time.Now()
+		ginCtx.Next()
+		status := ginCtx.Writer.Status()
+		size := ginCtx.Writer.Size()
+		if size < 0 {
+			size = 0
+		}
+		requestLogger := log.Ctx(ginCtx.Request.Context())
+		fields := []interface{}{
+			"http - AccessLog",
+			logger.String("method", ginCtx.Request.Method),
+			logger.String("path", ginCtx.Request.URL.Path),
+			logger.String("route", ginCtx.FullPath()),
+			logger.Int("status", status),
+			logger.Duration("latency", time.Since(start)),
+			logger.Int("bytes", size),
+			logger.String("ip", ginCtx.ClientIP()),
+		}
+		message := fmt.Sprintf("%s %s %d", ginCtx.Request.Method, ginCtx.Request.URL.Path, status)
+		switch {
+		case status >= http.StatusInternalServerError:
+			requestLogger.Error(message, fields...)
+		case status >= http.StatusBadRequest:
+			requestLogger.Warn(message, fields...)
+		default:
+			requestLogger.Info(message, fields...)
+		}
+	}
+}
+
+// Recovery turns panics into 500 responses and logs them with the request context.
+// It goes after AccessLog, so recovered requests are logged too.
+func Recovery(log logger.Logger) gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(ginCtx *gin.Context, recovered interface{}) {
+		log.Ctx(ginCtx.Request.Context()).Error(fmt.Sprintf("panic: %v", recovered), "http - Recovery")
+		ginCtx.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
+
+// Actor stores who issued the request in the request context for the audit trail, access control
+// and logs. Handlers pass gin contexts down, so the engine has to fall back to the request context.
+// Given callers by API key, it authenticates requests by X-API-Key and rejects the rest with 401;
+// public routes carry tokens of their own and pass without a caller. Without callers every request
+// acts as the same placeholder user, which is fine only as long as access control is off.
+func Actor(callers map[string]access.Caller, public ...string) gin.HandlerFunc {
+	var issued map[string]access.Caller
+	if callers != nil {
+		issued = make(map[string]access.Caller, len(callers))
+		for apiKey, caller := range callers {
+			issued[hashApiKey(apiKey)] = caller
+		}
+	}
+	publicRoutes := make(map[string]bool, len(public))
+	for _, route := range public {
+		publicRoutes[route] = true
+	}
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Request.Context()
+		caller, authenticated := access.Caller{ID: "UserId"}, true
+		if issued != nil {
+			caller, authenticated = issued[hashApiKey(ginCtx.GetHeader(HeaderApiKey))]
+		}
+		if !authenticated && !publicRoutes[ginCtx.FullPath()] {
+			ginCtx.String(http.StatusUnauthorized, "missing or unknown api key")
+			ginCtx.Abort()
+			return
+		}
+		ctx = audit.WithActor(ctx, audit.Actor{
+			ID: caller.ID,
+			IP: ginCtx.ClientIP(),
+		})
+		if authenticated {
+			ctx = access.WithCaller(ctx, caller)
+		}
+		ctx = logger.ContextWithFields(ctx, logger.String("tenant", tenantOf(ginCtx)), logger.String("user", caller.ID))
+		ginCtx.Request = ginCtx.Request.WithContext(ctx)
+		ginCtx.Next()
+	}
+}
+
+// tenantOf resolves the tenant of the request; routes serve a single tenant until callers are authenticated.
+func tenantOf(_ *gin.Context) string {
+	return "tenant1"
+}
+
+// Metrics observes request durations labelled by the route template, so ids in paths don't
+// create new series. Requests that match no route are reported as "unmatched".
+func Metrics(m *metrics.Metrics) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		start := time.Now()
+		ginCtx.Next()
+		route := ginCtx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		m.ObserveRequest(ginCtx.Request.Method, route, ginCtx.Writer.Status(), time.Since(start))
+	}
+}
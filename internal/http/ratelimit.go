@@ -0,0 +1,89 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/logger"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/ratelimit"
+)
+
+const HeaderApiKey = "X-API-Key"
+
+// KeyFunc names the bucket a request is counted in.
+type KeyFunc func(ginCtx *gin.Context) string
+
+func TenantKey(ginCtx *gin.Context) string {
+	return "tenant:" + tenantOf(ginCtx)
+}
+
+// ClientKey identifies the caller by one of the issued API keys, or by IP address otherwise.
+// Unknown keys count against the IP address, so a client can't escape its limit by sending a
+// new key with every request. Keys are hashed, so they don't end up in a shared store.
+func ClientKey(apiKeys []string) KeyFunc {
+	issued := make(map[string]bool, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		issued[hashApiKey(apiKey)] = true
+	}
+	return func(ginCtx *gin.Context) string {
+		if apiKey := ginCtx.GetHeader(HeaderApiKey); apiKey != "" {
+			if hashed := hashApiKey(apiKey); issued[hashed] {
+				return "api_key:" + hashed
+			}
+		}
+		return "ip:" + ginCtx.ClientIP()
+	}
+}
+
+func hashApiKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:16])
+}
+
+// RateLimit rejects requests over the limit with 429 and the time to wait in Retry-After.
+// Requests are let through when the store fails, the limit protects the service but isn't
+// worth an outage of its own.
+func RateLimit(log logger.Logger, store ratelimit.Store, limit ratelimit.Limit, key KeyFunc) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		result, err := store.Take(ginCtx.Request.Context(), key(ginCtx), limit)
+		if err != nil {
+			log.Ctx(ginCtx.Request.Context()).Error(err, "http - RateLimit")
+			ginCtx.Next()
+			return
+		}
+		if !result.Allowed {
+			tooManyRequests(ginCtx, result.RetryAfter, "rate limit exceeded")
+			return
+		}
+		ginCtx.Next()
+	}
+}
+
+// ConcurrentUploads rejects requests with 429 while the key has the maximum of uploads in flight.
+func ConcurrentUploads(limiter *ratelimit.ConcurrencyLimiter, key KeyFunc) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		uploadKey := key(ginCtx)
+		if !limiter.Acquire(uploadKey) {
+			tooManyRequests(ginCtx, time.Second, "too many uploads in progress")
+			return
+		}
+		defer limiter.Release(uploadKey)
+		ginCtx.Next()
+	}
+}
+
+func tooManyRequests(ginCtx *gin.Context, retryAfter time.Duration, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	ginCtx.Header("Retry-After", strconv.Itoa(seconds))
+	ginCtx.String(http.StatusTooManyRequests, message)
+	ginCtx.Abort()
+}
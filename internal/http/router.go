@@ -4,10 +4,25 @@ import (
 	"github.com/gin-gonic/gin"
 
 	_ "github.com/marcinlovescode/go-gcloudstorage-fileupload/docs"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/auditlog"
 	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/notifications"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/access"
 	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/logger"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/webhooks"
 )
 
+// Middleware is added to the api routes: Api runs on all of them after Actor, Upload only on file uploads.
+// Callers by API key make Actor authenticate requests, see Actor.
+type Middleware struct {
+	Callers map[string]access.Caller
+	Api     []gin.HandlerFunc
+	Upload  []gin.HandlerFunc
+}
+
+// publicRoutes are authenticated by tokens of their own: share tokens and the notifications token.
+var publicRoutes = []string{"/api/shares/:token", "/api/notifications/storage"}
+
 // NewGinHttpRouter -.
 // Swagger spec:
 // @title       FileRequest Upload Service
@@ -15,12 +30,18 @@ import (
 // @version     1.0
 // @host        localhost:8080
 // @BasePath    /api
-func NewGinHttpRouter(logger logger.Logger, useCase files.UseCase, handler *gin.Engine) error {
-	appendApiRoutes(handler, logger, useCase)
+func NewGinHttpRouter(logger logger.Logger, useCase files.UseCase, webhooksUseCase webhooks.UseCase, notificationsUseCase notifications.UseCase, notificationsToken string, auditUseCase auditlog.UseCase, middleware Middleware, handler *gin.Engine) error {
+	handler.ContextWithFallback = true
+	appendApiRoutes(handler, logger, useCase, webhooksUseCase, notificationsUseCase, notificationsToken, auditUseCase, middleware)
 	return nil
 }
 
-func appendApiRoutes(handler *gin.Engine, logger logger.Logger, filesUseCase files.UseCase) {
+func appendApiRoutes(handler *gin.Engine, logger logger.Logger, filesUseCase files.UseCase, webhooksUseCase webhooks.UseCase, notificationsUseCase notifications.UseCase, notificationsToken string, auditUseCase auditlog.UseCase, middleware Middleware) {
 	routerGroup := handler.Group("/api")
-	files.AppendFileRoutes(routerGroup, logger, filesUseCase)
+	routerGroup.Use(Actor(middleware.Callers, publicRoutes...))
+	routerGroup.Use(middleware.Api...)
+	files.AppendFileRoutes(routerGroup, logger, filesUseCase, middleware.Upload...)
+	webhooks.AppendWebhookRoutes(routerGroup, logger, webhooksUseCase)
+	notifications.AppendNotificationRoutes(routerGroup, logger, notificationsUseCase, notificationsToken)
+	auditlog.AppendAuditRoutes(routerGroup, logger, auditUseCase)
 }
@@ -0,0 +1,33 @@
+package models
+
+const (
+	EventObjectFinalize = "OBJECT_FINALIZE"
+	EventObjectDelete   = "OBJECT_DELETE"
+)
+
+// PushRequest is the body Pub/Sub posts to push endpoints.
+type PushRequest struct {
+	Message      PushMessage `json:"message" binding:"required"`
+	Subscription string      `json:"subscription"`
+}
+
+// PushMessage carries a Cloud Storage notification; the object is described by its attributes.
+type PushMessage struct {
+	Attributes map[string]string `json:"attributes"`
+	Data       []byte            `json:"data"`
+	MessageID  string            `json:"messageId"`
+}
+
+type ObjectNotification struct {
+	EventType               string
+	BucketID                string
+	ObjectID                string
+	OverwrittenByGeneration string
+	Size                    int64
+}
+
+// ObjectResource is the part of the object metadata sent as the message data that is used.
+// Cloud Storage encodes 64-bit numbers as strings.
+type ObjectResource struct {
+	Size int64 `json:"size,string"`
+}
@@ -0,0 +1,79 @@
+package notifications
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/notifications/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/logger"
+)
+
+// AppendNotificationRoutes registers the push endpoint. The push subscription has to pass the
+// token in the "token" query parameter; without a token the endpoint isn't registered at all.
+func AppendNotificationRoutes(handler *gin.RouterGroup, logger logger.Logger, useCase UseCase, token string) {
+	if token == "" {
+		logger.Warn("notifications - AppendNotificationRoutes: no token is configured, storage notifications are disabled")
+		return
+	}
+	routerGroup := handler.Group("/notifications")
+	routerGroup.POST("/storage", receiveStorageNotification(logger, useCase, token))
+}
+
+// receiveStorageNotification godoc
+//
+// @Summary     Receive Cloud Storage notification
+// @Description Pub/Sub push endpoint for bucket notifications; registers files put into the bucket as tenant/reference/name and removes records of deleted ones
+// @ID          receive-storage-notification
+// @Tags  	    notifications
+// @Accept      json
+// @Param		token	query	string	true "Push subscription token"
+// @Param		message	body models.PushRequest	true "Pub/Sub push message"
+// @Success     204
+// @Failure     400 {string} Error
+// @Failure     401 {string} Error
+// @Failure     500 {string} Error
+// @Router      /notifications/storage [post]
+func receiveStorageNotification(logger logger.Logger, useCase UseCase, token string) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		if subtle.ConstantTimeCompare([]byte(ginCtx.Query("token")), []byte(token)) != 1 {
+			ginCtx.String(http.StatusUnauthorized, "invalid token")
+			return
+		}
+		var request models.PushRequest
+		if err := ginCtx.ShouldBindJSON(&request); err != nil {
+			logger.Ctx(ctx).Debug(err, "notifications - receiveStorageNotification")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		attributes := request.Message.Attributes
+		var object models.ObjectResource
+		if len(request.Message.Data) > 0 {
+			// the data is only set for the JSON_API_V1 payload format; without it the size stays unknown
+			_ = json.Unmarshal(request.Message.Data, &object)
+		}
+		err := useCase.HandleObjectNotification(ctx, models.ObjectNotification{
+			EventType:               attributes["eventType"],
+			BucketID:                attributes["bucketId"],
+			ObjectID:                attributes["objectId"],
+			OverwrittenByGeneration: attributes["overwrittenByGeneration"],
+			Size:                    object.Size,
+		})
+		if errors.Is(err, ErrInvalidNotification) {
+			logger.Ctx(ctx).Debug(err, "notifications - receiveStorageNotification")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			// Pub/Sub redelivers the message on any non-success response
+			logger.Ctx(ctx).Error(err, "notifications - receiveStorageNotification")
+			ginCtx.String(http.StatusInternalServerError, "can't handle notification")
+			return
+		}
+		ginCtx.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,62 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/notifications/models"
+)
+
+var ErrInvalidNotification = errors.New("invalid storage notification")
+
+type UseCase interface {
+	HandleObjectNotification(ctx context.Context, notification models.ObjectNotification) error
+}
+
+// DefaultNotificationsUseCase keeps file records in sync with objects written to the bucket
+// by other producers. Notifications of other buckets, other event types and objects owned by
+// the service are ignored.
+type DefaultNotificationsUseCase struct {
+	filesUseCase files.UseCase
+	bucketName   string
+}
+
+func NewDefaultNotificationsUseCase(filesUseCase files.UseCase, bucketName string) (*DefaultNotificationsUseCase, error) {
+	return &DefaultNotificationsUseCase{
+		filesUseCase: filesUseCase,
+		bucketName:   bucketName,
+	}, nil
+}
+
+func (useCase *DefaultNotificationsUseCase) HandleObjectNotification(ctx context.Context, notification models.ObjectNotification) error {
+	if notification.EventType == "" || notification.ObjectID == "" {
+		return fmt.Errorf("DefaultNotificationsUseCase - HandleObjectNotification: %w", ErrInvalidNotification)
+	}
+	if notification.BucketID != useCase.bucketName {
+		return nil
+	}
+	object, ok := files.ParseObjectName(notification.ObjectID)
+	if !ok {
+		return nil
+	}
+	object.Size = notification.Size
+	switch notification.EventType {
+	case models.EventObjectFinalize:
+		err := useCase.filesUseCase.RegisterStoredFile(ctx, object)
+		if err != nil {
+			return fmt.Errorf("DefaultNotificationsUseCase - HandleObjectNotification: can't register file; %w", err)
+		}
+	case models.EventObjectDelete:
+		if notification.OverwrittenByGeneration != "" {
+			// a new version replaced the object, the file still exists
+			return nil
+		}
+		err := useCase.filesUseCase.UnregisterStoredFile(ctx, object)
+		if err != nil {
+			return fmt.Errorf("DefaultNotificationsUseCase - HandleObjectNotification: can't unregister file; %w", err)
+		}
+	}
+	return nil
+}
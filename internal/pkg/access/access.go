@@ -0,0 +1,35 @@
+package access
+
+import "context"
+
+// AdminsGroup is the group of callers administering the tenant, e.g. its retention rules.
+const AdminsGroup = "admins"
+
+// Caller is who issued the request, checked against grants on files and references.
+type Caller struct {
+	ID     string
+	Groups []string
+}
+
+type callerKey struct{}
+
+func WithCaller(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFrom returns the caller stored by WithCaller; ok is false outside of a request, e.g. in
+// background jobs.
+func CallerFrom(ctx context.Context) (Caller, bool) {
+	caller, ok := ctx.Value(callerKey{}).(Caller)
+	return caller, ok
+}
+
+// InGroup tells whether the caller is a member of the group.
+func (caller Caller) InGroup(group string) bool {
+	for _, member := range caller.Groups {
+		if member == group {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package audit
+
+import (
+	"context"
+	"time"
+)
+
+type Action string
+
+const (
+	ActionUpload         Action = "upload"
+	ActionUrlIssued      Action = "url_issued"
+	ActionDownload       Action = "download"
+	ActionDelete         Action = "delete"
+	ActionRotateKey      Action = "rotate_key"
+	ActionRegister       Action = "register"
+	ActionUnregister     Action = "unregister"
+	ActionCopy           Action = "copy"
+	ActionMove           Action = "move"
+	ActionLink           Action = "link"
+	ActionUnlink         Action = "unlink"
+	ActionUpdateMetadata Action = "update_metadata"
+	ActionLegalHold      Action = "legal_hold"
+	ActionReleaseHold    Action = "release_legal_hold"
+	ActionShare          Action = "share"
+	ActionRevokeShare    Action = "revoke_share"
+	ActionSharedDownload Action = "shared_download"
+	ActionGrantAccess    Action = "grant_access"
+	ActionRevokeAccess   Action = "revoke_access"
+	ActionSetRetention   Action = "set_retention_rule"
+	ActionUnsetRetention Action = "unset_retention_rule"
+)
+
+var _actions = map[Action]bool{
+	ActionUpload:         true,
+	ActionUrlIssued:      true,
+	ActionDownload:       true,
+	ActionDelete:         true,
+	ActionRotateKey:      true,
+	ActionRegister:       true,
+	ActionUnregister:     true,
+	ActionCopy:           true,
+	ActionMove:           true,
+	ActionLink:           true,
+	ActionUnlink:         true,
+	ActionUpdateMetadata: true,
+	ActionLegalHold:      true,
+	ActionReleaseHold:    true,
+	ActionShare:          true,
+	ActionRevokeShare:    true,
+	ActionSharedDownload: true,
+	ActionGrantAccess:    true,
+	ActionRevokeAccess:   true,
+	ActionSetRetention:   true,
+	ActionUnsetRetention: true,
+}
+
+// Known tells whether entries are recorded with the action.
+func (action Action) Known() bool {
+	return _actions[action]
+}
+
+// Entry is a single record of the audit trail. Entries are never changed once recorded.
+type Entry struct {
+	ID          string    `json:"id"`
+	Tenant      string    `json:"tenant"`
+	ActorID     string    `json:"actorId"`
+	IP          string    `json:"ip"`
+	Action      Action    `json:"action"`
+	FileID      string    `json:"fileId"`
+	ReferenceID string    `json:"referenceId,omitempty"`
+	OccurredAt  time.Time `json:"occurredAt"`
+}
+
+// Actor identifies who issued the request being handled.
+type Actor struct {
+	ID string
+	IP string
+}
+
+type actorKey struct{}
+
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor stored by WithActor, or an empty one outside of a request.
+func ActorFrom(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	return actor
+}
@@ -0,0 +1,128 @@
+package clamav
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+)
+
+const (
+	_defaultTimeout   = 30 * time.Second
+	_defaultChunkSize = 64 * 1024
+)
+
+// Client talks to clamd over TCP using the INSTREAM command.
+type Client struct {
+	address   string
+	timeout   time.Duration
+	chunkSize int
+}
+
+func NewClient(address string, timeout time.Duration) *Client {
+	if timeout <= 0 {
+		timeout = _defaultTimeout
+	}
+	return &Client{
+		address:   address,
+		timeout:   timeout,
+		chunkSize: _defaultChunkSize,
+	}
+}
+
+func (client *Client) Ping(ctx context.Context) error {
+	response, err := client.command(ctx, "zPING\x00", nil)
+	if err != nil {
+		return fmt.Errorf("clamav - Ping: %w", err)
+	}
+	if response != "PONG" {
+		return fmt.Errorf("clamav - Ping: unexpected response %q", response)
+	}
+	return nil
+}
+
+func (client *Client) Scan(ctx context.Context, content io.Reader) (models.ScanResult, error) {
+	response, err := client.command(ctx, "zINSTREAM\x00", content)
+	if err != nil {
+		return models.ScanResult{}, fmt.Errorf("clamav - Scan: %w", err)
+	}
+	return parseScanResponse(response)
+}
+
+func (client *Client) command(ctx context.Context, command string, content io.Reader) (string, error) {
+	dialer := net.Dialer{Timeout: client.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", client.address)
+	if err != nil {
+		return "", fmt.Errorf("can't connect to clamd; %w", err)
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(client.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return "", fmt.Errorf("can't set connection deadline; %w", err)
+	}
+	if _, err := conn.Write([]byte(command)); err != nil {
+		return "", fmt.Errorf("can't send command; %w", err)
+	}
+	if content != nil {
+		if err := client.stream(conn, content); err != nil {
+			return "", err
+		}
+	}
+	response, err := bufio.NewReader(conn).ReadString('\x00')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("can't read response; %w", err)
+	}
+	return strings.TrimRight(response, "\x00\n"), nil
+}
+
+// stream sends content as length-prefixed chunks terminated by a zero-length chunk.
+func (client *Client) stream(conn net.Conn, content io.Reader) error {
+	chunk := make([]byte, client.chunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := content.Read(chunk)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return fmt.Errorf("can't stream content; %w", err)
+			}
+			if _, err := conn.Write(chunk[:n]); err != nil {
+				return fmt.Errorf("can't stream content; %w", err)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("can't read content; %w", err)
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return fmt.Errorf("can't finish stream; %w", err)
+	}
+	return nil
+}
+
+// parseScanResponse understands "stream: OK" and "stream: <signature> FOUND".
+func parseScanResponse(response string) (models.ScanResult, error) {
+	result := strings.TrimPrefix(response, "stream: ")
+	switch {
+	case result == "OK":
+		return models.ScanResult{}, nil
+	case strings.HasSuffix(result, " FOUND"):
+		return models.ScanResult{Infected: true, Signature: strings.TrimSuffix(result, " FOUND")}, nil
+	case strings.HasSuffix(result, " ERROR"):
+		return models.ScanResult{}, fmt.Errorf("clamav - Scan: clamd error %q", result)
+	default:
+		return models.ScanResult{}, fmt.Errorf("clamav - Scan: unexpected response %q", response)
+	}
+}
@@ -0,0 +1,148 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Envelope layout:
+//
+//	magic (4) | key id length (1) | key id | wrapped data key length (2) | wrapped data key | sealed payload
+//
+// The payload is sealed with a random AES-256-GCM data key, which in turn is sealed with
+// the tenant key identified by key id.
+var _envelopeMagic = []byte("ENV1")
+
+var ErrNotAnEnvelope = errors.New("data is not an encryption envelope")
+
+func Seal(keyring *Keyring, plaintext []byte) ([]byte, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, fmt.Errorf("encryption - Seal: can't generate data key; %w", err)
+	}
+	wrappedKey, err := seal(keyring.Primary(), dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("encryption - Seal: can't wrap data key; %w", err)
+	}
+	payload, err := seal(dataKey, plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("encryption - Seal: can't seal payload; %w", err)
+	}
+	return writeEnvelope(keyring.PrimaryID(), wrappedKey, payload), nil
+}
+
+func Open(keyring *Keyring, envelope []byte) ([]byte, error) {
+	keyID, wrappedKey, payload, err := readEnvelope(envelope)
+	if err != nil {
+		return nil, fmt.Errorf("encryption - Open: %w", err)
+	}
+	dataKey, err := unwrap(keyring, keyID, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("encryption - Open: %w", err)
+	}
+	plaintext, err := open(dataKey, payload)
+	if err != nil {
+		return nil, fmt.Errorf("encryption - Open: can't open payload; %w", err)
+	}
+	return plaintext, nil
+}
+
+// Rewrap re-seals the data key with the primary key, leaving the payload untouched.
+// It reports false when the envelope already uses the primary key.
+func Rewrap(keyring *Keyring, envelope []byte) ([]byte, bool, error) {
+	keyID, wrappedKey, payload, err := readEnvelope(envelope)
+	if err != nil {
+		return nil, false, fmt.Errorf("encryption - Rewrap: %w", err)
+	}
+	if keyID == keyring.PrimaryID() {
+		return envelope, false, nil
+	}
+	dataKey, err := unwrap(keyring, keyID, wrappedKey)
+	if err != nil {
+		return nil, false, fmt.Errorf("encryption - Rewrap: %w", err)
+	}
+	rewrappedKey, err := seal(keyring.Primary(), dataKey)
+	if err != nil {
+		return nil, false, fmt.Errorf("encryption - Rewrap: can't wrap data key; %w", err)
+	}
+	return writeEnvelope(keyring.PrimaryID(), rewrappedKey, payload), true, nil
+}
+
+func unwrap(keyring *Keyring, keyID string, wrappedKey []byte) ([]byte, error) {
+	key, err := keyring.Key(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("can't find key %q; %w", keyID, err)
+	}
+	dataKey, err := open(key, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("can't unwrap data key; %w", err)
+	}
+	return dataKey, nil
+}
+
+func writeEnvelope(keyID string, wrappedKey, payload []byte) []byte {
+	envelope := bytes.NewBuffer(make([]byte, 0, len(_envelopeMagic)+1+len(keyID)+2+len(wrappedKey)+len(payload)))
+	envelope.Write(_envelopeMagic)
+	envelope.WriteByte(byte(len(keyID)))
+	envelope.WriteString(keyID)
+	_ = binary.Write(envelope, binary.BigEndian, uint16(len(wrappedKey)))
+	envelope.Write(wrappedKey)
+	envelope.Write(payload)
+	return envelope.Bytes()
+}
+
+func readEnvelope(envelope []byte) (string, []byte, []byte, error) {
+	if !bytes.HasPrefix(envelope, _envelopeMagic) {
+		return "", nil, nil, ErrNotAnEnvelope
+	}
+	rest := envelope[len(_envelopeMagic):]
+	if len(rest) < 1 || len(rest) < 1+int(rest[0])+2 {
+		return "", nil, nil, ErrNotAnEnvelope
+	}
+	keyID := string(rest[1 : 1+int(rest[0])])
+	rest = rest[1+int(rest[0]):]
+	wrappedKeyLength := int(binary.BigEndian.Uint16(rest))
+	rest = rest[2:]
+	if len(rest) < wrappedKeyLength {
+		return "", nil, nil, ErrNotAnEnvelope
+	}
+	return keyID, rest[:wrappedKeyLength], rest[wrappedKeyLength:], nil
+}
+
+func seal(key, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key, sealed []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrNotAnEnvelope
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
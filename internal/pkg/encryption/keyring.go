@@ -0,0 +1,53 @@
+package encryption
+
+import (
+	"errors"
+	"fmt"
+)
+
+const KeySize = 32
+
+var ErrUnknownKey = errors.New("encryption key is not in the keyring")
+
+// Keyring holds the versions of a tenant key. New data is always protected with the
+// primary key, older versions are kept so existing data can still be read and rotated.
+type Keyring struct {
+	primaryID string
+	keys      map[string][]byte
+}
+
+func NewKeyring(primaryID string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[primaryID]; !ok {
+		return nil, fmt.Errorf("encryption - NewKeyring: primary key %q is missing", primaryID)
+	}
+	for id, key := range keys {
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("encryption - NewKeyring: key %q must be %d bytes long", id, KeySize)
+		}
+		if len(id) > 255 {
+			return nil, fmt.Errorf("encryption - NewKeyring: key id %q is too long", id)
+		}
+	}
+	return &Keyring{primaryID: primaryID, keys: keys}, nil
+}
+
+func (keyring *Keyring) PrimaryID() string {
+	return keyring.primaryID
+}
+
+func (keyring *Keyring) Primary() []byte {
+	return keyring.keys[keyring.primaryID]
+}
+
+func (keyring *Keyring) Key(id string) ([]byte, error) {
+	key, ok := keyring.keys[id]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// Keys returns every key version, used to match keys by fingerprint.
+func (keyring *Keyring) Keys() map[string][]byte {
+	return keyring.keys
+}
@@ -0,0 +1,40 @@
+package events
+
+import (
+	"context"
+	"sync"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/logger"
+)
+
+type Handler func(ctx context.Context, event Event) error
+
+// Bus delivers events to in-process handlers synchronously. A failing handler is logged and
+// doesn't stop the others, so handlers doing slow or unreliable work should queue it.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+	logger   logger.Logger
+}
+
+func NewBus(logger logger.Logger) *Bus {
+	return &Bus{logger: logger}
+}
+
+func (bus *Bus) Subscribe(handler Handler) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	bus.handlers = append(bus.handlers, handler)
+}
+
+func (bus *Bus) Publish(ctx context.Context, event Event) error {
+	bus.mu.RLock()
+	handlers := bus.handlers
+	bus.mu.RUnlock()
+	for _, handler := range handlers {
+		if err := handler(ctx, event); err != nil {
+			bus.logger.Error(err, "events - Bus - Publish")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package events
+
+import "time"
+
+type Type string
+
+const (
+	FileUploaded        Type = "FileUploaded"
+	FileDeleted         Type = "FileDeleted"
+	FileCopied          Type = "FileCopied"
+	FileMoved           Type = "FileMoved"
+	FileLinked          Type = "FileLinked"
+	FileUnlinked        Type = "FileUnlinked"
+	FileMetadataUpdated Type = "FileMetadataUpdated"
+)
+
+// Event describes a change in the file lifecycle. It is serialized as is to subscribers.
+type Event struct {
+	ID          string    `json:"id"`
+	Type        Type      `json:"type"`
+	Tenant      string    `json:"tenant"`
+	FileID      string    `json:"fileId"`
+	FileName    string    `json:"fileName"`
+	ReferenceID string    `json:"referenceId"`
+	ActorID     string    `json:"actorId,omitempty"`
+	OccurredAt  time.Time `json:"occurredAt"`
+}
@@ -0,0 +1,269 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/logger"
+)
+
+// OutboxStore keeps events until the broker has acknowledged them.
+type OutboxStore interface {
+	// Append stores the event; appending an event id that is already known is a no-op.
+	Append(ctx context.Context, event Event) error
+	// Pending returns up to limit unpublished events, oldest first.
+	Pending(ctx context.Context, limit int) ([]Event, error)
+	MarkPublished(ctx context.Context, eventID string) error
+	// MarkFailed records a failed publish of the event and returns how many times it failed.
+	MarkFailed(ctx context.Context, eventID string) (int, error)
+	// MarkDead removes the event from the pending ones and keeps it aside with the reason.
+	MarkDead(ctx context.Context, eventID, reason string) error
+}
+
+// Outbox decouples event producers from the broker. Handle only records the event, a single
+// relay goroutine publishes pending events oldest first and marks them once the broker
+// acknowledged them. While the broker is down events stay in the store and are retried on the
+// next tick. Delivery is at-least-once: a crash between the acknowledgement and marking resends
+// the event with the same id.
+//
+// The outbox is only as durable as its store. Events are handed to it after the file operation
+// has been committed, and InMemoryOutboxStore lives in the process, so a crash or restart loses
+// events that were not published yet.
+//
+// An event that keeps failing while the events after it are published is considered poison:
+// after maxAttempts such failures it is moved aside with MarkDead, so it doesn't block the
+// outbox. If nothing can be published the broker is considered down and no attempt is counted.
+type Outbox struct {
+	store       OutboxStore
+	publish     Handler
+	logger      logger.Logger
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+	trigger     chan struct{}
+	wg          sync.WaitGroup
+}
+
+func NewOutbox(store OutboxStore, publish Handler, logger logger.Logger, interval time.Duration, batchSize, maxAttempts int) *Outbox {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	return &Outbox{
+		store:       store,
+		publish:     publish,
+		logger:      logger,
+		interval:    interval,
+		batchSize:   batchSize,
+		maxAttempts: maxAttempts,
+		trigger:     make(chan struct{}, 1),
+	}
+}
+
+func (outbox *Outbox) Handle(ctx context.Context, event Event) error {
+	err := outbox.store.Append(ctx, event)
+	if err != nil {
+		return fmt.Errorf("Outbox - Handle: can't store event %s; %w", event.ID, err)
+	}
+	select {
+	case outbox.trigger <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (outbox *Outbox) Start(ctx context.Context) {
+	outbox.wg.Add(1)
+	go func() {
+		defer outbox.wg.Done()
+		ticker := time.NewTicker(outbox.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-outbox.trigger:
+			}
+			if _, err := outbox.Flush(ctx); err != nil {
+				outbox.logger.Error(err, "events - Outbox")
+			}
+		}
+	}()
+}
+
+// Flush publishes pending events until the store is drained or the broker fails. It returns
+// the number of published events. A failing event doesn't hold back the events after it; it is
+// retried on the next flush. Flush must not run concurrently with the relay started by Start.
+func (outbox *Outbox) Flush(ctx context.Context) (int, error) {
+	published := 0
+	for {
+		pending, err := outbox.store.Pending(ctx, outbox.batchSize)
+		if err != nil {
+			return published, fmt.Errorf("Outbox - Flush: can't read pending events; %w", err)
+		}
+		if len(pending) == 0 {
+			return published, nil
+		}
+		var failed []Event
+		var publishErr error
+		progressed := false
+		for _, event := range pending {
+			err = outbox.publish(ctx, event)
+			if err != nil {
+				failed = append(failed, event)
+				publishErr = fmt.Errorf("Outbox - Flush: can't publish event %s; %w", event.ID, err)
+				if !progressed && len(failed) > 1 {
+					return published, publishErr
+				}
+				continue
+			}
+			err = outbox.store.MarkPublished(ctx, event.ID)
+			if err != nil {
+				return published, fmt.Errorf("Outbox - Flush: can't mark event %s as published; %w", event.ID, err)
+			}
+			published++
+			progressed = true
+		}
+		if len(failed) == 0 {
+			continue
+		}
+		if !progressed {
+			return published, publishErr
+		}
+		for _, event := range failed {
+			err = outbox.giveUpIfPoison(ctx, event, publishErr)
+			if err != nil {
+				return published, err
+			}
+		}
+		return published, publishErr
+	}
+}
+
+func (outbox *Outbox) giveUpIfPoison(ctx context.Context, event Event, publishErr error) error {
+	attempts, err := outbox.store.MarkFailed(ctx, event.ID)
+	if err != nil {
+		return fmt.Errorf("Outbox - Flush: can't mark event %s as failed; %w", event.ID, err)
+	}
+	if attempts < outbox.maxAttempts {
+		return nil
+	}
+	err = outbox.store.MarkDead(ctx, event.ID, publishErr.Error())
+	if err != nil {
+		return fmt.Errorf("Outbox - Flush: can't set aside event %s; %w", event.ID, err)
+	}
+	outbox.logger.Warn(fmt.Sprintf("events - Outbox: gave up publishing event %s after %d attempts", event.ID, attempts))
+	return nil
+}
+
+func (outbox *Outbox) Wait() {
+	outbox.wg.Wait()
+}
+
+// DeadEvent is an event the outbox gave up publishing.
+type DeadEvent struct {
+	Event    Event
+	Attempts int
+	Reason   string
+}
+
+// InMemoryOutboxStore keeps the events in the process memory. It remembers the ids of the most
+// recent published or dead events, up to remembered of them, so a late duplicate append is ignored.
+type InMemoryOutboxStore struct {
+	mu         sync.Mutex
+	pending    []Event
+	attempts   map[string]int
+	known      map[string]bool
+	finished   []string
+	remembered int
+	dead       []DeadEvent
+}
+
+func NewInMemoryOutboxStore(remembered int) *InMemoryOutboxStore {
+	if remembered <= 0 {
+		remembered = 10000
+	}
+	return &InMemoryOutboxStore{attempts: make(map[string]int), known: make(map[string]bool), remembered: remembered}
+}
+
+func (store *InMemoryOutboxStore) Append(_ context.Context, event Event) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.known[event.ID] {
+		return nil
+	}
+	store.known[event.ID] = true
+	store.pending = append(store.pending, event)
+	return nil
+}
+
+func (store *InMemoryOutboxStore) Pending(_ context.Context, limit int) ([]Event, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if limit > len(store.pending) {
+		limit = len(store.pending)
+	}
+	pending := make([]Event, limit)
+	copy(pending, store.pending[:limit])
+	return pending, nil
+}
+
+func (store *InMemoryOutboxStore) MarkPublished(_ context.Context, eventID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.finish(eventID)
+	return nil
+}
+
+func (store *InMemoryOutboxStore) MarkFailed(_ context.Context, eventID string) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.attempts[eventID]++
+	return store.attempts[eventID], nil
+}
+
+func (store *InMemoryOutboxStore) MarkDead(_ context.Context, eventID, reason string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	attempts := store.attempts[eventID]
+	event, found := store.finish(eventID)
+	if found {
+		store.dead = append(store.dead, DeadEvent{Event: event, Attempts: attempts, Reason: reason})
+	}
+	return nil
+}
+
+// Dead returns the events the outbox gave up publishing.
+func (store *InMemoryOutboxStore) Dead() []DeadEvent {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	dead := make([]DeadEvent, len(store.dead))
+	copy(dead, store.dead)
+	return dead
+}
+
+// finish removes the event from the pending ones and forgets the oldest finished id once
+// more than remembered ids are kept.
+func (store *InMemoryOutboxStore) finish(eventID string) (Event, bool) {
+	delete(store.attempts, eventID)
+	for i, event := range store.pending {
+		if event.ID == eventID {
+			store.pending = append(store.pending[:i], store.pending[i+1:]...)
+			store.finished = append(store.finished, eventID)
+			if len(store.finished) > store.remembered {
+				delete(store.known, store.finished[0])
+				store.finished = store.finished[1:]
+			}
+			return event, true
+		}
+	}
+	return Event{}, false
+}
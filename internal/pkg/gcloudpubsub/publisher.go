@@ -0,0 +1,63 @@
+package gcloudpubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"cloud.google.com/go/pubsub"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/events"
+)
+
+// Publisher sends file events to a Pub/Sub topic as JSON. Every message carries the event id
+// in the "eventId" attribute, so consumers can drop the rare duplicate left by a redelivery.
+type Publisher struct {
+	topic *pubsub.Topic
+}
+
+func NewPublisher(client *pubsub.Client, topicID string) *Publisher {
+	return &Publisher{topic: client.Topic(topicID)}
+}
+
+// EnsureTopic creates the topic when it doesn't exist yet; meant for the emulator and local setups.
+func (publisher *Publisher) EnsureTopic(ctx context.Context, client *pubsub.Client) error {
+	exists, err := publisher.topic.Exists(ctx)
+	if err != nil {
+		return fmt.Errorf("Publisher - EnsureTopic: can't check topic; %w", err)
+	}
+	if exists {
+		return nil
+	}
+	_, err = client.CreateTopic(ctx, publisher.topic.ID())
+	if err != nil {
+		return fmt.Errorf("Publisher - EnsureTopic: can't create topic; %w", err)
+	}
+	return nil
+}
+
+// Publish blocks until the broker acknowledges the message.
+func (publisher *Publisher) Publish(ctx context.Context, event events.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("Publisher - Publish: can't serialize event; %w", err)
+	}
+	result := publisher.topic.Publish(ctx, &pubsub.Message{
+		Data: payload,
+		Attributes: map[string]string{
+			"eventId":   event.ID,
+			"eventType": string(event.Type),
+			"tenant":    event.Tenant,
+		},
+	})
+	_, err = result.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("Publisher - Publish: can't publish event %s; %w", event.ID, err)
+	}
+	return nil
+}
+
+// Stop flushes messages still buffered by the client.
+func (publisher *Publisher) Stop() {
+	publisher.topic.Stop()
+}
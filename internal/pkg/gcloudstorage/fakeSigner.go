@@ -0,0 +1,26 @@
+package gcloudstorage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+)
+
+// fakeSigner produces deterministic, unverifiable signatures. It is meant for tests and
+// the storage emulator, which does not check signatures.
+type fakeSigner struct {
+	accessID string
+}
+
+func NewFakeSigner(accessID string) *fakeSigner {
+	return &fakeSigner{accessID: accessID}
+}
+
+func (signer *fakeSigner) AccessID() string {
+	return signer.accessID
+}
+
+func (signer *fakeSigner) SignBytes(payload []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, []byte(signer.accessID))
+	mac.Write(payload)
+	return mac.Sum(nil), nil
+}
@@ -0,0 +1,54 @@
+package gcloudstorage
+
+import (
+	"context"
+	b64 "encoding/base64"
+	"fmt"
+	"time"
+
+	"google.golang.org/api/iamcredentials/v1"
+)
+
+const _defaultSignBlobTimeout = 5 * time.Second
+
+// iamSigner signs payloads with the IAM Credentials SignBlob API, so no private key
+// has to be shipped with the service. The caller needs roles/iam.serviceAccountTokenCreator
+// on the signing service account.
+type iamSigner struct {
+	service        *iamcredentials.Service
+	serviceAccount string
+	timeout        time.Duration
+}
+
+func NewIAMSigner(ctx context.Context, serviceAccount string) (*iamSigner, error) {
+	service, err := iamcredentials.NewService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("gcloudstorage - NewIAMSigner: can't create IAM Credentials client; %w", err)
+	}
+	return &iamSigner{
+		service:        service,
+		serviceAccount: serviceAccount,
+		timeout:        _defaultSignBlobTimeout,
+	}, nil
+}
+
+func (signer *iamSigner) AccessID() string {
+	return signer.serviceAccount
+}
+
+func (signer *iamSigner) SignBytes(payload []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), signer.timeout)
+	defer cancel()
+	name := fmt.Sprintf("projects/-/serviceAccounts/%s", signer.serviceAccount)
+	response, err := signer.service.Projects.ServiceAccounts.SignBlob(name, &iamcredentials.SignBlobRequest{
+		Payload: b64.StdEncoding.EncodeToString(payload),
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("gcloudstorage - iamSigner - SignBytes: can't sign blob; %w", err)
+	}
+	signature, err := b64.StdEncoding.DecodeString(response.SignedBlob)
+	if err != nil {
+		return nil, fmt.Errorf("gcloudstorage - iamSigner - SignBytes: can't decode signed blob; %w", err)
+	}
+	return signature, nil
+}
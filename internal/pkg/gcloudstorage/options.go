@@ -0,0 +1,19 @@
+package gcloudstorage
+
+import "github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/encryption"
+
+type Option func(*gCloudStorageService)
+
+func Insecure(insecure bool) Option {
+	return func(s *gCloudStorageService) {
+		s.insecure = insecure
+	}
+}
+
+// CustomerSuppliedKeys encrypts objects of the given tenants with customer-supplied
+// encryption keys (CSEK). The primary key of the keyring is used for new objects.
+func CustomerSuppliedKeys(keyrings map[string]*encryption.Keyring) Option {
+	return func(s *gCloudStorageService) {
+		s.keyrings = keyrings
+	}
+}
@@ -0,0 +1,24 @@
+package gcloudstorage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+// IsRetryable tells transient failures worth another attempt, such as 429, 5xx responses
+// and reset connections, from permanent ones like missing objects or denied access.
+// Attempts that ran out of time are retried too.
+func IsRetryable(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || storage.ShouldRetry(err)
+}
+
+// isPreconditionFailed tells the object didn't match the conditions of the request, e.g. it
+// already existed when it was written with DoesNotExist.
+func isPreconditionFailed(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed
+}
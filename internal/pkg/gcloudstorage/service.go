@@ -1,40 +1,70 @@
 package gcloudstorage
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	b64 "encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"mime"
+	"net/http"
 	"path/filepath"
 	"time"
 
 	"cloud.google.com/go/storage"
 	"google.golang.org/api/iterator"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/encryption"
 )
 
-type GCloudAuthCredentials struct {
-	AccessID   string
-	PrivateKey []byte
+// ErrObjectExists is returned by UploadFile when the object is already stored.
+var ErrObjectExists = errors.New("object already exists")
+
+// ErrObjectNotExist is returned by DeleteFile when there is no such object.
+var ErrObjectNotExist = errors.New("object doesn't exist")
+
+// ErrSignedUrlNotSupported is returned by MakeSignedUrl for objects encrypted with a
+// customer-supplied key, which can't be served by signed urls.
+var ErrSignedUrlNotSupported = errors.New("signed urls are not supported for this object")
+
+// SignedUrlOptions shape the request a signed url allows; an empty method is GET.
+type SignedUrlOptions struct {
+	Expiry      time.Duration
+	Method      string
+	Headers     []string
+	ContentType string
 }
 
 type gCloudStorageService struct {
 	client      *storage.Client
 	projectName string
 	bucketName  string
-	credentials *GCloudAuthCredentials
+	signer      Signer
+	insecure    bool
+	keyrings    map[string]*encryption.Keyring
 }
 
-func NewGCloudStorageService(client *storage.Client, projectName, bucketName string, credentials *GCloudAuthCredentials) *gCloudStorageService {
-	return &gCloudStorageService{
+func NewGCloudStorageService(client *storage.Client, projectName, bucketName string, signer Signer, opts ...Option) *gCloudStorageService {
+	storageService := &gCloudStorageService{
 		client:      client,
 		projectName: projectName,
 		bucketName:  bucketName,
-		credentials: credentials,
+		signer:      signer,
+	}
+	for _, opt := range opts {
+		opt(storageService)
 	}
+	return storageService
 }
 
 func (storageService *gCloudStorageService) UploadFile(context context.Context, tenant, fileName string, file []byte) error {
 	storageObject := storageService.client.Bucket(storageService.bucketName).Object(fmt.Sprintf("%s/%s", tenant, fileName))
 	storageObject = storageObject.If(storage.Conditions{DoesNotExist: true})
+	if keyring, ok := storageService.keyrings[tenant]; ok {
+		storageObject = storageObject.Key(keyring.Primary())
+	}
 	writer := storageObject.NewWriter(context)
 	fileExtension := filepath.Ext(fileName)
 	writer.ContentType = mime.TypeByExtension(fileExtension)
@@ -43,20 +73,168 @@ func (storageService *gCloudStorageService) UploadFile(context context.Context,
 		return fmt.Errorf("gcloudstorage - UploadFile: can't upload file; %w", err)
 	}
 	if err := writer.Close(); err != nil {
+		if isPreconditionFailed(err) {
+			return fmt.Errorf("gcloudstorage - UploadFile: %v; %w", err, ErrObjectExists)
+		}
 		return fmt.Errorf("gcloudstorage - UploadFile: can't close writer; %w", err)
 	}
 	return nil
 }
 
+// ReplaceFile overwrites the object with a new generation, keeping its custom metadata. The write
+// only succeeds while the object is still at the generation read, so concurrent changes aren't lost.
+func (storageService *gCloudStorageService) ReplaceFile(context context.Context, tenant, fileName string, file []byte) error {
+	storageObject := storageService.client.Bucket(storageService.bucketName).Object(fmt.Sprintf("%s/%s", tenant, fileName))
+	attrs, err := storageObject.Attrs(context)
+	if err != nil {
+		return fmt.Errorf("gcloudstorage - ReplaceFile: can't read object; %w", err)
+	}
+	storageObject = storageObject.If(storage.Conditions{GenerationMatch: attrs.Generation})
+	if keyring, ok := storageService.keyrings[tenant]; ok {
+		storageObject = storageObject.Key(keyring.Primary())
+	}
+	writer := storageObject.NewWriter(context)
+	writer.ContentType = attrs.ContentType
+	writer.ContentDisposition = attrs.ContentDisposition
+	writer.Metadata = attrs.Metadata
+	if _, err := writer.Write(file); err != nil {
+		return fmt.Errorf("gcloudstorage - ReplaceFile: can't upload file; %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("gcloudstorage - ReplaceFile: can't close writer; %w", err)
+	}
+	return nil
+}
+
+func (storageService *gCloudStorageService) ReadFile(context context.Context, tenant, fileName string) (io.ReadCloser, error) {
+	storageObject := storageService.client.Bucket(storageService.bucketName).Object(fmt.Sprintf("%s/%s", tenant, fileName))
+	if keyring, ok := storageService.keyrings[tenant]; ok {
+		key, err := storageService.objectKey(context, storageObject, keyring)
+		if err != nil {
+			return nil, fmt.Errorf("gcloudstorage - ReadFile: can't find object key; %w", err)
+		}
+		storageObject = storageObject.Key(key)
+	}
+	reader, err := storageObject.NewReader(context)
+	if err != nil {
+		return nil, fmt.Errorf("gcloudstorage - ReadFile: can't open file; %w", err)
+	}
+	return reader, nil
+}
+
+// RotateEncryptionKey rewrites a CSEK-encrypted object with the tenant's primary key.
+// The rewrite happens server side. It reports false when the object already uses the primary key.
+func (storageService *gCloudStorageService) RotateEncryptionKey(context context.Context, tenant, fileName string) (bool, error) {
+	keyring, ok := storageService.keyrings[tenant]
+	if !ok {
+		return false, nil
+	}
+	storageObject := storageService.client.Bucket(storageService.bucketName).Object(fmt.Sprintf("%s/%s", tenant, fileName))
+	currentKey, err := storageService.objectKey(context, storageObject, keyring)
+	if err != nil {
+		return false, fmt.Errorf("gcloudstorage - RotateEncryptionKey: can't find object key; %w", err)
+	}
+	if bytes.Equal(currentKey, keyring.Primary()) {
+		return false, nil
+	}
+	copier := storageObject.Key(keyring.Primary()).CopierFrom(storageObject.Key(currentKey))
+	if _, err := copier.Run(context); err != nil {
+		return false, fmt.Errorf("gcloudstorage - RotateEncryptionKey: can't rewrite object; %w", err)
+	}
+	return true, nil
+}
+
+// objectKey finds the keyring version the object was encrypted with by comparing key fingerprints.
+func (storageService *gCloudStorageService) objectKey(context context.Context, storageObject *storage.ObjectHandle, keyring *encryption.Keyring) ([]byte, error) {
+	attrs, err := storageObject.Attrs(context)
+	if err != nil {
+		return nil, err
+	}
+	return matchKey(attrs, keyring)
+}
+
+func matchKey(attrs *storage.ObjectAttrs, keyring *encryption.Keyring) ([]byte, error) {
+	for _, key := range keyring.Keys() {
+		fingerprint := sha256.Sum256(key)
+		if b64.StdEncoding.EncodeToString(fingerprint[:]) == attrs.CustomerKeySHA256 {
+			return key, nil
+		}
+	}
+	return nil, encryption.ErrUnknownKey
+}
+
 func (storageService *gCloudStorageService) DeleteFile(context context.Context, tenant, fileName string) error {
 	storageObject := storageService.client.Bucket(storageService.bucketName).Object(fmt.Sprintf("%s/%s", tenant, fileName))
 	err := storageObject.Delete(context)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("gcloudstorage - DeleteFile: %v; %w", err, ErrObjectNotExist)
+	}
 	if err != nil {
 		return fmt.Errorf("gcloudstorage - DeleteFile: can't remove file; %w", err)
 	}
 	return nil
 }
 
+// CopyFile rewrites the object server side, keeping its custom metadata. Objects encrypted with
+// a customer-supplied key are copied with the tenant's primary key.
+func (storageService *gCloudStorageService) CopyFile(context context.Context, tenant, sourceName, targetName string) error {
+	bucket := storageService.client.Bucket(storageService.bucketName)
+	source := bucket.Object(fmt.Sprintf("%s/%s", tenant, sourceName))
+	target := bucket.Object(fmt.Sprintf("%s/%s", tenant, targetName)).If(storage.Conditions{DoesNotExist: true})
+	attrs, err := source.Attrs(context)
+	if err != nil {
+		return fmt.Errorf("gcloudstorage - CopyFile: can't read source object; %w", err)
+	}
+	if keyring, ok := storageService.keyrings[tenant]; ok {
+		key, err := matchKey(attrs, keyring)
+		if err != nil {
+			return fmt.Errorf("gcloudstorage - CopyFile: can't find object key; %w", err)
+		}
+		source = source.Key(key)
+		target = target.Key(keyring.Primary())
+	}
+	copier := target.CopierFrom(source)
+	copier.ContentType = mime.TypeByExtension(filepath.Ext(targetName))
+	copier.ContentDisposition = fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(targetName))
+	copier.Metadata = attrs.Metadata
+	if _, err := copier.Run(context); err != nil {
+		return fmt.Errorf("gcloudstorage - CopyFile: can't copy object; %w", err)
+	}
+	return nil
+}
+
+// SetMetadata replaces the custom metadata of the object; keys it no longer has are removed.
+// The update fails when the metadata changed since it was read.
+func (storageService *gCloudStorageService) SetMetadata(context context.Context, tenant, fileName string, metadata map[string]string) error {
+	storageObject := storageService.client.Bucket(storageService.bucketName).Object(fmt.Sprintf("%s/%s", tenant, fileName))
+	attrs, err := storageObject.Attrs(context)
+	if err != nil {
+		return fmt.Errorf("gcloudstorage - SetMetadata: can't read object; %w", err)
+	}
+	update := make(map[string]string, len(attrs.Metadata)+len(metadata))
+	for key := range attrs.Metadata {
+		update[key] = ""
+	}
+	for key, value := range metadata {
+		update[key] = value
+	}
+	storageObject = storageObject.If(storage.Conditions{MetagenerationMatch: attrs.Metageneration})
+	if _, err := storageObject.Update(context, storage.ObjectAttrsToUpdate{Metadata: update}); err != nil {
+		return fmt.Errorf("gcloudstorage - SetMetadata: can't update object; %w", err)
+	}
+	return nil
+}
+
+// SetHold places or releases a temporary hold on the object. The bucket refuses to delete or
+// replace held objects, whatever the service does.
+func (storageService *gCloudStorageService) SetHold(context context.Context, tenant, fileName string, hold bool) error {
+	storageObject := storageService.client.Bucket(storageService.bucketName).Object(fmt.Sprintf("%s/%s", tenant, fileName))
+	if _, err := storageObject.Update(context, storage.ObjectAttrsToUpdate{TemporaryHold: hold}); err != nil {
+		return fmt.Errorf("gcloudstorage - SetHold: can't update object; %w", err)
+	}
+	return nil
+}
+
 func (storageService *gCloudStorageService) FileExists(context context.Context, tenant, fileName string) (bool, error) {
 	query := &storage.Query{
 		Prefix: fmt.Sprintf("%s/%s", tenant, fileName),
@@ -71,6 +249,17 @@ func (storageService *gCloudStorageService) FileExists(context context.Context,
 	return true, nil
 }
 
+// Ping checks that objects of the bucket can be listed.
+func (storageService *gCloudStorageService) Ping(context context.Context) error {
+	storageObjects := storageService.client.Bucket(storageService.bucketName).Objects(context, &storage.Query{})
+	storageObjects.PageInfo().MaxSize = 1
+	_, err := storageObjects.Next()
+	if err != nil && err != iterator.Done {
+		return fmt.Errorf("gcloudstorage - Ping: can't list bucket objects; %w", err)
+	}
+	return nil
+}
+
 func (storageService *gCloudStorageService) CreateBucket(context context.Context) error {
 	bucket := storageService.client.Bucket(storageService.bucketName)
 	if err := bucket.Create(context, storageService.projectName, nil); err != nil {
@@ -79,30 +268,46 @@ func (storageService *gCloudStorageService) CreateBucket(context context.Context
 	return nil
 }
 
-func (storageService *gCloudStorageService) makeSignedUrlOptions(expiresInNumberOfMinutes int, insecure bool) *storage.SignedURLOptions {
+func (storageService *gCloudStorageService) makeSignedUrlOptions(options SignedUrlOptions) *storage.SignedURLOptions {
+	method := options.Method
+	if method == "" {
+		method = http.MethodGet
+	}
 	opts := &storage.SignedURLOptions{
-		Method:   "GET",
-		Expires:  time.Now().Add(time.Duration(expiresInNumberOfMinutes) * time.Minute),
+		Method:   method,
+		Expires:  time.Now().Add(options.Expiry),
 		Scheme:   storage.SigningSchemeV4,
-		Insecure: insecure,
+		Insecure: storageService.insecure,
+		Headers:  options.Headers,
 	}
-	if storageService.credentials != nil {
-		opts.PrivateKey = storageService.credentials.PrivateKey
-		opts.GoogleAccessID = storageService.credentials.AccessID
+	if storageService.signer != nil {
+		opts.GoogleAccessID = storageService.signer.AccessID()
+		opts.SignBytes = storageService.signer.SignBytes
 	}
 	return opts
 }
-func (storageService *gCloudStorageService) GetExpiringUrl(tenant, fileName string, expiresInNumberOfMinutes int, insecure bool) (string, error) {
-	return storageService.MakeSignedUrl(tenant, fileName, expiresInNumberOfMinutes, insecure)
+
+func (storageService *gCloudStorageService) GetExpiringUrl(tenant, fileName string, options SignedUrlOptions) (string, error) {
+	return storageService.MakeSignedUrl(tenant, fileName, options)
 }
 
-func (storageService *gCloudStorageService) MakeSignedUrl(tenant, fileName string, expiresInNumberOfMinutes int, insecure bool) (string, error) {
-	opts := storageService.makeSignedUrlOptions(expiresInNumberOfMinutes, insecure)
-	queryParams := make(map[string][]string)
-	fileExtension := filepath.Ext(fileName)
-	queryParams["response-content-disposition"] = append(queryParams["response-content-disposition"], "attachment")
-	queryParams["response-content-type"] = append(queryParams["response-content-disposition"], mime.TypeByExtension(fileExtension))
-	opts.QueryParameters = queryParams
+func (storageService *gCloudStorageService) MakeSignedUrl(tenant, fileName string, options SignedUrlOptions) (string, error) {
+	if _, ok := storageService.keyrings[tenant]; ok {
+		return "", fmt.Errorf("gcloudstorage - MakeSignedUrl: object is encrypted with a customer-supplied key; %w", ErrSignedUrlNotSupported)
+	}
+	opts := storageService.makeSignedUrlOptions(options)
+	if opts.Method == http.MethodGet {
+		contentType := options.ContentType
+		if contentType == "" {
+			contentType = mime.TypeByExtension(filepath.Ext(fileName))
+		}
+		queryParams := make(map[string][]string)
+		queryParams["response-content-disposition"] = append(queryParams["response-content-disposition"], "attachment")
+		queryParams["response-content-type"] = append(queryParams["response-content-type"], contentType)
+		opts.QueryParameters = queryParams
+	} else if options.ContentType != "" {
+		opts.ContentType = options.ContentType
+	}
 	signedUrl, err := storageService.client.Bucket(storageService.bucketName).SignedURL(fmt.Sprintf("%s/%s", tenant, fileName), opts)
 	if err != nil {
 		return "", fmt.Errorf("gcloudstorage - MakeSignedUrl: can't make signed url; %w", err)
@@ -0,0 +1,66 @@
+package gcloudstorage
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// Signer signs V4 signed url payloads on behalf of a service account.
+type Signer interface {
+	AccessID() string
+	SignBytes(payload []byte) ([]byte, error)
+}
+
+type privateKeySigner struct {
+	accessID   string
+	privateKey *rsa.PrivateKey
+}
+
+func NewPrivateKeySigner(accessID string, privateKeyPEM []byte) (*privateKeySigner, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, errors.New("gcloudstorage - NewPrivateKeySigner: private key is not PEM encoded")
+	}
+	privateKey, err := parseRSAPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("gcloudstorage - NewPrivateKeySigner: can't parse private key; %w", err)
+	}
+	return &privateKeySigner{
+		accessID:   accessID,
+		privateKey: privateKey,
+	}, nil
+}
+
+func (signer *privateKeySigner) AccessID() string {
+	return signer.accessID
+}
+
+func (signer *privateKeySigner) SignBytes(payload []byte) ([]byte, error) {
+	digest := sha256.Sum256(payload)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, signer.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("gcloudstorage - privateKeySigner - SignBytes: can't sign payload; %w", err)
+	}
+	return signature, nil
+}
+
+func parseRSAPrivateKey(der []byte) (*rsa.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,130 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusUp   Status = "up"
+	StatusDown Status = "down"
+)
+
+// Pinger is a dependency that can tell whether it is reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type CheckResult struct {
+	Status     Status `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+type Report struct {
+	Status Status                 `json:"status"`
+	Ready  bool                   `json:"ready"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Readiness tells whether the service should receive traffic. It starts as not ready.
+type Readiness struct {
+	ready atomic.Bool
+}
+
+func NewReadiness() *Readiness {
+	return &Readiness{}
+}
+
+func (readiness *Readiness) SetReady(ready bool) {
+	readiness.ready.Store(ready)
+}
+
+func (readiness *Readiness) Ready() bool {
+	return readiness.ready.Load()
+}
+
+type namedPinger struct {
+	name   string
+	pinger Pinger
+}
+
+// Checker pings registered dependencies concurrently, each bounded by the timeout.
+type Checker struct {
+	mu        sync.RWMutex
+	pingers   []namedPinger
+	timeout   time.Duration
+	readiness *Readiness
+}
+
+// NewChecker reports readiness of the given state; a nil readiness is always ready.
+func NewChecker(timeout time.Duration, readiness *Readiness) *Checker {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return &Checker{timeout: timeout, readiness: readiness}
+}
+
+func (checker *Checker) Register(name string, pinger Pinger) {
+	checker.mu.Lock()
+	defer checker.mu.Unlock()
+	checker.pingers = append(checker.pingers, namedPinger{name: name, pinger: pinger})
+}
+
+// Check is up when every dependency answered within the timeout.
+func (checker *Checker) Check(ctx context.Context) Report {
+	checker.mu.RLock()
+	pingers := checker.pingers
+	checker.mu.RUnlock()
+
+	results := make([]CheckResult, len(pingers))
+	var wg sync.WaitGroup
+	for i := range pingers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = checker.ping(ctx, pingers[i].pinger)
+		}(i)
+	}
+	wg.Wait()
+
+	report := Report{
+		Status: StatusUp,
+		Ready:  checker.readiness == nil || checker.readiness.Ready(),
+		Checks: make(map[string]CheckResult, len(pingers)),
+	}
+	for i, result := range results {
+		report.Checks[pingers[i].name] = result
+		if result.Status == StatusDown {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+func (checker *Checker) ping(ctx context.Context, pinger Pinger) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, checker.timeout)
+	defer cancel()
+	start := time.Now()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- pinger.Ping(ctx)
+	}()
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		// the dependency ignores the context, don't wait for it
+		err = ctx.Err()
+	}
+	result := CheckResult{Status: StatusUp, DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
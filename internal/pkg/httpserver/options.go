@@ -25,8 +25,30 @@ func WriteTimeout(timeout time.Duration) Option {
 	}
 }
 
+// StreamWriteTimeout is the write timeout of responses streamed by handlers that call
+// ExtendWriteDeadline, e.g. archives and downloads, which take longer than regular responses.
+func StreamWriteTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.streamTimeout = timeout
+	}
+}
+
 func ShutdownTimeout(timeout time.Duration) Option {
 	return func(s *Server) {
 		s.shutdownTimeout = timeout
 	}
 }
+
+// Readiness is flipped to ready once the server starts and back before it shuts down.
+func Readiness(readiness ReadinessSetter) Option {
+	return func(s *Server) {
+		s.readiness = readiness
+	}
+}
+
+// ShutdownDelay keeps serving after readiness is lost, so load balancers stop routing first.
+func ShutdownDelay(delay time.Duration) Option {
+	return func(s *Server) {
+		s.shutdownDelay = delay
+	}
+}
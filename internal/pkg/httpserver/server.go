@@ -13,10 +13,17 @@ const (
 	_defaultShutdownTimeout = 10 * time.Second
 )
 
+type ReadinessSetter interface {
+	SetReady(ready bool)
+}
+
 type Server struct {
 	server          *http.Server
 	notify          chan error
 	shutdownTimeout time.Duration
+	shutdownDelay   time.Duration
+	readiness       ReadinessSetter
+	streamTimeout   time.Duration
 }
 
 func New(handler http.Handler, opts ...Option) *Server {
@@ -36,6 +43,9 @@ func New(handler http.Handler, opts ...Option) *Server {
 	for _, opt := range opts {
 		opt(s)
 	}
+	if s.streamTimeout > 0 {
+		httpServer.Handler = withStreamDeadline(handler, s.streamTimeout)
+	}
 
 	s.start()
 
@@ -43,6 +53,9 @@ func New(handler http.Handler, opts ...Option) *Server {
 }
 
 func (s *Server) start() {
+	if s.readiness != nil {
+		s.readiness.SetReady(true)
+	}
 	go func() {
 		s.notify <- s.server.ListenAndServe()
 		close(s.notify)
@@ -53,7 +66,14 @@ func (s *Server) Notify() <-chan error {
 	return s.notify
 }
 
+// Shutdown reports the server as not ready, waits for the shutdown delay and then stops accepting
+// connections, letting requests in progress finish within the shutdown timeout.
 func (s *Server) Shutdown() error {
+	if s.readiness != nil {
+		s.readiness.SetReady(false)
+	}
+	time.Sleep(s.shutdownDelay)
+
 	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
 	defer cancel()
 
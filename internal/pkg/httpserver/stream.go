@@ -0,0 +1,32 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type streamKey struct{}
+
+// streamDeadline lets handlers reach the connection's writer, which routers hide behind their own.
+type streamDeadline struct {
+	writer  http.ResponseWriter
+	timeout time.Duration
+}
+
+func withStreamDeadline(handler http.Handler, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), streamKey{}, streamDeadline{writer: w, timeout: timeout})
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ExtendWriteDeadline gives a handler streaming a long response the stream write timeout instead
+// of the write timeout of the server. It does nothing when the server has no stream write timeout.
+func ExtendWriteDeadline(r *http.Request) error {
+	deadline, ok := r.Context().Value(streamKey{}).(streamDeadline)
+	if !ok {
+		return nil
+	}
+	return http.NewResponseController(deadline.writer).SetWriteDeadline(time.Now().Add(deadline.timeout))
+}
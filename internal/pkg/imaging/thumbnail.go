@@ -0,0 +1,94 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	_maxSourcePixels = 50_000_000
+	_jpegQuality     = 85
+)
+
+var ErrUnsupportedImage = errors.New("unsupported image format")
+
+// Supported reports whether a thumbnail can be made for the given content type.
+func Supported(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+type Thumbnail struct {
+	Content     []byte
+	ContentType string
+	Extension   string
+}
+
+// MakeThumbnail scales the image down to fit in a size x size box, keeping the aspect ratio.
+// JPEG sources stay JPEG, the other formats become PNG to keep transparency. Images that already
+// fit are re-encoded without scaling.
+func MakeThumbnail(content []byte, size int) (*Thumbnail, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("imaging - MakeThumbnail: %w; %v", ErrUnsupportedImage, err)
+	}
+	if config.Width*config.Height > _maxSourcePixels {
+		return nil, fmt.Errorf("imaging - MakeThumbnail: image of %dx%d is too large", config.Width, config.Height)
+	}
+	source, err := decode(content, format)
+	if err != nil {
+		return nil, fmt.Errorf("imaging - MakeThumbnail: can't decode image; %w", err)
+	}
+	width, height := fit(source.Bounds().Dx(), source.Bounds().Dy(), size)
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), source, source.Bounds(), draw.Over, nil)
+
+	encoded := new(bytes.Buffer)
+	if format == "jpeg" {
+		if err := jpeg.Encode(encoded, scaled, &jpeg.Options{Quality: _jpegQuality}); err != nil {
+			return nil, fmt.Errorf("imaging - MakeThumbnail: can't encode thumbnail; %w", err)
+		}
+		return &Thumbnail{Content: encoded.Bytes(), ContentType: "image/jpeg", Extension: ".jpg"}, nil
+	}
+	if err := png.Encode(encoded, scaled); err != nil {
+		return nil, fmt.Errorf("imaging - MakeThumbnail: can't encode thumbnail; %w", err)
+	}
+	return &Thumbnail{Content: encoded.Bytes(), ContentType: "image/png", Extension: ".png"}, nil
+}
+
+func decode(content []byte, format string) (image.Image, error) {
+	if format == "gif" {
+		// only the first frame is used for animated gifs
+		return gif.Decode(bytes.NewReader(content))
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(content))
+	return decoded, err
+}
+
+func fit(width, height, size int) (int, int) {
+	if width <= size && height <= size {
+		return width, height
+	}
+	if width >= height {
+		return size, max(1, height*size/width)
+	}
+	return max(1, width*size/height), size
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,60 @@
+package logger
+
+import (
+	"context"
+	"time"
+)
+
+// Field is a typed key-value pair attached to a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Bool(key string, value bool) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Time(key string, value time.Time) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Err(err error) Field {
+	return Field{Key: "error", Value: err}
+}
+
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+type fieldsKey struct{}
+
+// ContextWithFields adds fields attached to every entry logged through Logger.Ctx with the returned context.
+func ContextWithFields(ctx context.Context, fields ...Field) context.Context {
+	existing := FieldsFromContext(ctx)
+	merged := make([]Field, 0, len(existing)+len(fields))
+	merged = append(merged, existing...)
+	merged = append(merged, fields...)
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+func FieldsFromContext(ctx context.Context) []Field {
+	fields, _ := ctx.Value(fieldsKey{}).([]Field)
+	return fields
+}
@@ -1,28 +1,54 @@
 package logger
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 )
 
+// Logger writes structured entries. The message is a string or an error; args are Fields,
+// while a plain string arg names the source of the entry, e.g. logger.Error(err, "files - uploadFile").
 type Logger interface {
 	Debug(message interface{}, args ...interface{})
-	Info(message string, args ...interface{})
-	Warn(message string, args ...interface{})
+	Info(message interface{}, args ...interface{})
+	Warn(message interface{}, args ...interface{})
 	Error(message interface{}, args ...interface{})
 	Fatal(message interface{}, args ...interface{})
+	// With returns a logger attaching the fields to every entry.
+	With(fields ...Field) Logger
+	// Ctx returns a logger attaching the fields stored in the context, like the request id.
+	Ctx(ctx context.Context) Logger
 }
 
 type ZerologLogger struct {
-	logger *zerolog.Logger
+	logger zerolog.Logger
 }
 
-func NewZerologLogger(level string) *ZerologLogger {
-	var logLevel zerolog.Level
+type Option func(*zerologOptions)
+
+type zerologOptions struct {
+	output io.Writer
+}
+
+// Output redirects entries from the standard output.
+func Output(writer io.Writer) Option {
+	return func(options *zerologOptions) {
+		options.output = writer
+	}
+}
+
+func NewZerologLogger(level string, opts ...Option) *ZerologLogger {
+	options := &zerologOptions{output: os.Stdout}
+	for _, opt := range opts {
+		opt(options)
+	}
 
+	var logLevel zerolog.Level
 	switch strings.ToLower(level) {
 	case "error":
 		logLevel = zerolog.ErrorLevel
@@ -36,57 +62,109 @@ func NewZerologLogger(level string) *ZerologLogger {
 		logLevel = zerolog.InfoLevel
 	}
 
-	zerolog.SetGlobalLevel(logLevel)
-
-	skipFrameCount := 3
-	logger := zerolog.New(os.Stdout).With().Timestamp().CallerWithSkipFrameCount(zerolog.CallerSkipFrameCount + skipFrameCount).Logger()
+	skipFrameCount := 2
+	logger := zerolog.New(options.output).Level(logLevel).With().Timestamp().
+		CallerWithSkipFrameCount(zerolog.CallerSkipFrameCount + skipFrameCount).Logger()
 
 	return &ZerologLogger{
-		logger: &logger,
+		logger: logger,
 	}
 }
 
+// NewNopLogger discards every entry, Fatal still exits the process.
+func NewNopLogger() *ZerologLogger {
+	return &ZerologLogger{logger: zerolog.Nop()}
+}
+
 func (logger *ZerologLogger) Debug(message interface{}, args ...interface{}) {
-	logger.msg("debug", message, args...)
+	logger.write(logger.logger.Debug(), message, args)
 }
 
-func (logger *ZerologLogger) Info(message string, args ...interface{}) {
-	logger.log(message, args...)
+func (logger *ZerologLogger) Info(message interface{}, args ...interface{}) {
+	logger.write(logger.logger.Info(), message, args)
 }
 
-func (logger *ZerologLogger) Warn(message string, args ...interface{}) {
-	logger.log(message, args...)
+func (logger *ZerologLogger) Warn(message interface{}, args ...interface{}) {
+	logger.write(logger.logger.Warn(), message, args)
 }
 
 func (logger *ZerologLogger) Error(message interface{}, args ...interface{}) {
-	if logger.logger.GetLevel() == zerolog.DebugLevel {
-		logger.Debug(message, args...)
-	}
-
-	logger.msg("error", message, args...)
+	logger.write(logger.logger.Error(), message, args)
 }
 
+// Fatal logs the entry and exits the process.
 func (logger *ZerologLogger) Fatal(message interface{}, args ...interface{}) {
-	logger.msg("fatal", message, args...)
-
+	logger.write(logger.logger.WithLevel(zerolog.FatalLevel), message, args)
 	os.Exit(1)
 }
 
-func (logger *ZerologLogger) log(message string, args ...interface{}) {
-	if len(args) == 0 {
-		logger.logger.Info().Msg(message)
-	} else {
-		logger.logger.Info().Msgf(message, args...)
+func (logger *ZerologLogger) With(fields ...Field) Logger {
+	if len(fields) == 0 {
+		return logger
 	}
+	context := logger.logger.With()
+	for _, field := range fields {
+		context = context.Interface(field.Key, fieldValue(field.Value))
+	}
+	return &ZerologLogger{logger: context.Logger()}
+}
+
+func (logger *ZerologLogger) Ctx(ctx context.Context) Logger {
+	return logger.With(FieldsFromContext(ctx)...)
 }
 
-func (logger *ZerologLogger) msg(level string, message interface{}, args ...interface{}) {
+func (logger *ZerologLogger) write(event *zerolog.Event, message interface{}, args []interface{}) {
+	if event == nil {
+		// the level is disabled
+		return
+	}
+	for _, arg := range args {
+		switch value := arg.(type) {
+		case Field:
+			event = addField(event, value)
+		case string:
+			event = event.Str("source", value)
+		case error:
+			event = event.AnErr("error", value)
+		default:
+			event = event.Interface("arg", value)
+		}
+	}
 	switch msg := message.(type) {
 	case error:
-		logger.log(msg.Error(), args...)
+		event.Msg(msg.Error())
+	case string:
+		event.Msg(msg)
+	default:
+		event.Msg(fmt.Sprintf("%v", msg))
+	}
+}
+
+func addField(event *zerolog.Event, field Field) *zerolog.Event {
+	switch value := field.Value.(type) {
 	case string:
-		logger.log(msg, args...)
+		return event.Str(field.Key, value)
+	case int:
+		return event.Int(field.Key, value)
+	case int64:
+		return event.Int64(field.Key, value)
+	case bool:
+		return event.Bool(field.Key, value)
+	case time.Duration:
+		return event.Dur(field.Key, value)
+	case time.Time:
+		return event.Time(field.Key, value)
+	case error:
+		return event.AnErr(field.Key, value)
 	default:
-		logger.log(fmt.Sprintf("%s message %v has unknown type %v", level, message, msg), args...)
+		return event.Interface(field.Key, value)
+	}
+}
+
+// fieldValue makes values without a JSON form, like errors, readable in context fields.
+func fieldValue(value interface{}) interface{} {
+	if err, ok := value.(error); ok {
+		return err.Error()
 	}
+	return value
 }
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	PortFileStorage    = "file_storage"
+	PortFileRepository = "file_repository"
+)
+
+// Metrics owns the collectors of the service. Each instance has its own registry, so several
+// handlers, e.g. in tests, don't clash on registration.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requestDuration *prometheus.HistogramVec
+	callDuration    *prometheus.HistogramVec
+	callErrors      *prometheus.CounterVec
+	uploadBytes     prometheus.Histogram
+	uploadDuration  prometheus.Histogram
+	uploadsInFlight prometheus.Gauge
+	downloadBytes   prometheus.Histogram
+}
+
+func New() *Metrics {
+	sizeBuckets := prometheus.ExponentialBuckets(1024, 4, 10)
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Duration of HTTP requests by route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		callDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "port_call_duration_seconds",
+			Help:    "Duration of file storage and repository calls by operation.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"port", "operation"}),
+		callErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "port_call_errors_total",
+			Help: "Failed file storage and repository calls by operation.",
+		}, []string{"port", "operation"}),
+		uploadBytes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "file_upload_bytes",
+			Help:    "Size of files uploaded to the storage.",
+			Buckets: sizeBuckets,
+		}),
+		uploadDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "file_upload_duration_seconds",
+			Help:    "Duration of file uploads to the storage.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		uploadsInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "file_uploads_in_flight",
+			Help: "Uploads to the storage in progress.",
+		}),
+		downloadBytes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "file_download_bytes",
+			Help:    "Bytes read from the storage per download.",
+			Buckets: sizeBuckets,
+		}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requestDuration,
+		m.callDuration,
+		m.callErrors,
+		m.uploadBytes,
+		m.uploadDuration,
+		m.uploadsInFlight,
+		m.downloadBytes,
+	)
+	return m
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func (m *Metrics) ObserveRequest(method, route string, status int, duration time.Duration) {
+	m.requestDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(duration.Seconds())
+}
+
+func (m *Metrics) ObserveCall(port, operation string, duration time.Duration, err error) {
+	m.callDuration.WithLabelValues(port, operation).Observe(duration.Seconds())
+	if err != nil {
+		m.callErrors.WithLabelValues(port, operation).Inc()
+	}
+}
+
+// UploadStarted marks an upload as in flight; the returned func records its outcome.
+func (m *Metrics) UploadStarted(size int) func(err error) {
+	start := time.Now()
+	m.uploadsInFlight.Inc()
+	return func(err error) {
+		m.uploadsInFlight.Dec()
+		if err == nil {
+			m.uploadBytes.Observe(float64(size))
+			m.uploadDuration.Observe(time.Since(start).Seconds())
+		}
+	}
+}
+
+func (m *Metrics) ObserveDownload(size int64) {
+	m.downloadBytes.Observe(float64(size))
+}
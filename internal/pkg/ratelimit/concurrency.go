@@ -0,0 +1,38 @@
+package ratelimit
+
+import "sync"
+
+// ConcurrencyLimiter caps how many operations run at once per key. The count lives in the
+// process, since in-flight operations hold its memory.
+type ConcurrencyLimiter struct {
+	mu       sync.Mutex
+	max      int
+	inFlight map[string]int
+}
+
+func NewConcurrencyLimiter(max int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		max:      max,
+		inFlight: make(map[string]int),
+	}
+}
+
+// Acquire reports false when the key is at the cap; otherwise the caller has to Release.
+func (limiter *ConcurrencyLimiter) Acquire(key string) bool {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	if limiter.inFlight[key] >= limiter.max {
+		return false
+	}
+	limiter.inFlight[key]++
+	return true
+}
+
+func (limiter *ConcurrencyLimiter) Release(key string) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	limiter.inFlight[key]--
+	if limiter.inFlight[key] <= 0 {
+		delete(limiter.inFlight, key)
+	}
+}
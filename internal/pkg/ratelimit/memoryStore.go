@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// _sweepInterval is how often buckets that refilled completely are dropped.
+const _sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// InMemoryStore keeps buckets in the process, so every instance of the service limits on its own.
+type InMemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (store *InMemoryStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	now := store.now()
+	store.sweep(now)
+	burst := math.Max(float64(limit.Burst), 1)
+	current, ok := store.buckets[key]
+	if !ok {
+		current = &bucket{tokens: burst, updated: now}
+		store.buckets[key] = current
+	}
+	current.tokens = math.Min(burst, current.tokens+now.Sub(current.updated).Seconds()*limit.Rate)
+	current.updated = now
+	current.limit = limit
+	if current.tokens >= 1 {
+		current.tokens--
+		return Result{Allowed: true}, nil
+	}
+	missing := (1 - current.tokens) / limit.Rate
+	return Result{RetryAfter: time.Duration(missing * float64(time.Second))}, nil
+}
+
+// sweep drops buckets that are full again, they behave the same as missing ones.
+func (store *InMemoryStore) sweep(now time.Time) {
+	if now.Sub(store.lastSweep) < _sweepInterval {
+		return
+	}
+	store.lastSweep = now
+	for key, current := range store.buckets {
+		refilled := current.tokens + now.Sub(current.updated).Seconds()*current.limit.Rate
+		if refilled >= math.Max(float64(current.limit.Burst), 1) {
+			delete(store.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limit is a token bucket refilled with Rate tokens per second up to Burst tokens.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Enabled tells whether the limit applies; a zero rate disables it.
+func (limit Limit) Enabled() bool {
+	return limit.Rate > 0
+}
+
+type Result struct {
+	Allowed    bool
+	RetryAfter time.Duration
+}
+
+// Store keeps token buckets by key. Instances of the service share limits through a shared store.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
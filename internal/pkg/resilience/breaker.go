@@ -0,0 +1,73 @@
+package resilience
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type State string
+
+const (
+	StateClosed   State = "closed"
+	StateOpen     State = "open"
+	StateHalfOpen State = "half_open"
+)
+
+// CircuitBreaker stops calls to a dependency for OpenFor after Threshold consecutive failures.
+// Once that passes calls go through again as probes: the first result closes the breaker
+// or opens it for another period.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	openFor   time.Duration
+	state     State
+	failures  int
+	openedAt  time.Time
+	now       func() time.Time
+}
+
+func NewCircuitBreaker(threshold int, openFor time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		openFor:   openFor,
+		state:     StateClosed,
+		now:       time.Now,
+	}
+}
+
+// Allow returns ErrCircuitOpen while calls are stopped.
+func (breaker *CircuitBreaker) Allow() error {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	if breaker.state == StateOpen {
+		if breaker.now().Sub(breaker.openedAt) < breaker.openFor {
+			return ErrCircuitOpen
+		}
+		breaker.state = StateHalfOpen
+	}
+	return nil
+}
+
+func (breaker *CircuitBreaker) Record(success bool) {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	if success {
+		breaker.state = StateClosed
+		breaker.failures = 0
+		return
+	}
+	breaker.failures++
+	if breaker.state == StateHalfOpen || (breaker.state == StateClosed && breaker.failures >= breaker.threshold) {
+		breaker.state = StateOpen
+		breaker.openedAt = breaker.now()
+	}
+}
+
+func (breaker *CircuitBreaker) State() State {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	return breaker.state
+}
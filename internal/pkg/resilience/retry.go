@@ -0,0 +1,89 @@
+package resilience
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff grows the delay between retries exponentially from Initial up to Max.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+}
+
+// Delay before the given retry, counted from 1. Half of the delay is random, so callers that
+// failed together don't retry together.
+func (backoff Backoff) Delay(retry int) time.Duration {
+	multiplier := backoff.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	delay := float64(backoff.Initial) * math.Pow(multiplier, float64(retry-1))
+	if backoff.Max > 0 && delay > float64(backoff.Max) {
+		delay = float64(backoff.Max)
+	}
+	return time.Duration(delay/2 + rand.Float64()*delay/2)
+}
+
+// Retry repeats operations failing with errors Retryable accepts, up to MaxAttempts calls.
+type Retry struct {
+	MaxAttempts int
+	Backoff     Backoff
+	Retryable   func(err error) bool
+}
+
+// Do calls op until it succeeds, fails permanently, runs out of attempts or ctx is done, and
+// returns the last error. Retryable failures count against the breaker, which may be nil;
+// permanent ones show the dependency is answering, so they count as successes.
+func (retry Retry) Do(ctx context.Context, breaker *CircuitBreaker, op func(ctx context.Context) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if breaker != nil {
+			if openErr := breaker.Allow(); openErr != nil {
+				if err != nil {
+					return &openError{last: err}
+				}
+				return openErr
+			}
+		}
+		err = op(ctx)
+		if ctx.Err() != nil {
+			// the caller gave up, that says nothing about the dependency
+			return err
+		}
+		transient := err != nil && retry.Retryable != nil && retry.Retryable(err)
+		if breaker != nil {
+			breaker.Record(!transient)
+		}
+		if !transient || attempt >= retry.MaxAttempts {
+			return err
+		}
+		timer := time.NewTimer(retry.Backoff.Delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// openError reports the breaker opening between attempts together with the last failure.
+type openError struct {
+	last error
+}
+
+func (err *openError) Error() string {
+	return ErrCircuitOpen.Error() + "; last error: " + err.last.Error()
+}
+
+func (err *openError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+func (err *openError) Unwrap() error {
+	return err.last
+}
@@ -0,0 +1,80 @@
+package textextract
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// _maxTextBytes bounds the text taken from a single document, the rest is left out.
+const _maxTextBytes = 1 << 20
+
+var ErrUnsupportedDocument = errors.New("unsupported document format")
+
+// Supported reports whether text can be extracted from the given content type.
+func Supported(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "text/plain", "application/pdf":
+		return true
+	}
+	return false
+}
+
+// Extract returns the text of a plain text or PDF document, cut to the first MiB.
+func Extract(content []byte, contentType string) (string, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/plain":
+		if !utf8.Valid(content) {
+			return "", fmt.Errorf("textextract - Extract: %w; text isn't valid UTF-8", ErrUnsupportedDocument)
+		}
+		return truncate(string(content)), nil
+	case "application/pdf":
+		text, err := extractPdf(content)
+		if err != nil {
+			return "", fmt.Errorf("textextract - Extract: %w; %v", ErrUnsupportedDocument, err)
+		}
+		return truncate(text), nil
+	}
+	return "", fmt.Errorf("textextract - Extract: %w; %s", ErrUnsupportedDocument, contentType)
+}
+
+func extractPdf(content []byte) (text string, err error) {
+	// the parser panics on some malformed documents
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("malformed pdf: %v", recovered)
+		}
+	}()
+	reader, err := pdf.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "", err
+	}
+	plainText, err := reader.GetPlainText()
+	if err != nil {
+		return "", err
+	}
+	extracted, err := io.ReadAll(io.LimitReader(plainText, _maxTextBytes))
+	if err != nil {
+		return "", err
+	}
+	return string(extracted), nil
+}
+
+// truncate cuts the text to _maxTextBytes without splitting a character.
+func truncate(text string) string {
+	if len(text) <= _maxTextBytes {
+		return text
+	}
+	return strings.ToValidUTF8(text[:_maxTextBytes], "")
+}
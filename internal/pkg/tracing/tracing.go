@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	AttributeTenant      = attribute.Key("file.tenant")
+	AttributeFileID      = attribute.Key("file.id")
+	AttributeFileName    = attribute.Key("file.name")
+	AttributeReferenceID = attribute.Key("file.reference_id")
+	AttributeFileSize    = attribute.Key("file.size")
+)
+
+type Exporter string
+
+const (
+	ExporterNone   Exporter = "none"
+	ExporterStdout Exporter = "stdout"
+	ExporterOTLP   Exporter = "otlp"
+)
+
+type Options struct {
+	ServiceName    string
+	ServiceVersion string
+	Exporter       Exporter
+	Endpoint       string
+	Insecure       bool
+	SampleRatio    float64
+	Writer         io.Writer
+}
+
+// NewTracerProvider creates the provider for the selected exporter and installs it, along with
+// W3C trace context propagation, as the global one. ExporterNone records spans for
+// propagation only and exports nothing.
+func NewTracerProvider(ctx context.Context, options Options) (*sdktrace.TracerProvider, error) {
+	providerOptions := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(options.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(options.ServiceName),
+			semconv.ServiceVersion(options.ServiceVersion))),
+	}
+	switch options.Exporter {
+	case ExporterOTLP:
+		clientOptions := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(options.Endpoint)}
+		if options.Insecure {
+			clientOptions = append(clientOptions, otlptracegrpc.WithInsecure())
+		}
+		exporter, err := otlptracegrpc.New(ctx, clientOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("tracing - NewTracerProvider: can't create OTLP exporter; %w", err)
+		}
+		providerOptions = append(providerOptions, sdktrace.WithBatcher(exporter))
+	case ExporterStdout:
+		exporterOptions := []stdouttrace.Option{stdouttrace.WithPrettyPrint()}
+		if options.Writer != nil {
+			exporterOptions = append(exporterOptions, stdouttrace.WithWriter(options.Writer))
+		}
+		exporter, err := stdouttrace.New(exporterOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("tracing - NewTracerProvider: can't create stdout exporter; %w", err)
+		}
+		providerOptions = append(providerOptions, sdktrace.WithSyncer(exporter))
+	case ExporterNone, "":
+	default:
+		return nil, fmt.Errorf("tracing - NewTracerProvider: unknown exporter %q", options.Exporter)
+	}
+	provider := sdktrace.NewTracerProvider(providerOptions...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider, nil
+}
+
+// End finishes the span, marking it as failed when err isn't nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
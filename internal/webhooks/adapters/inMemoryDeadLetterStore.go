@@ -0,0 +1,34 @@
+package adapters
+
+import (
+	"context"
+	"sync"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/webhooks/models"
+)
+
+type InMemoryDeadLetterStore struct {
+	mu          sync.RWMutex
+	deadLetters map[string][]models.DeadLetter
+}
+
+func NewInMemoryDeadLetterStore(_ context.Context) (*InMemoryDeadLetterStore, error) {
+	return &InMemoryDeadLetterStore{
+		deadLetters: make(map[string][]models.DeadLetter),
+	}, nil
+}
+
+func (store *InMemoryDeadLetterStore) Add(_ context.Context, deadLetter *models.DeadLetter) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	tenant := deadLetter.Delivery.Tenant
+	store.deadLetters[tenant] = append(store.deadLetters[tenant], *deadLetter)
+	return nil
+}
+
+func (store *InMemoryDeadLetterStore) ListBy(_ context.Context, tenant string) (*[]models.DeadLetter, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	result := append([]models.DeadLetter{}, store.deadLetters[tenant]...)
+	return &result, nil
+}
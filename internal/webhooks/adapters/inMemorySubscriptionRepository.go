@@ -0,0 +1,46 @@
+package adapters
+
+import (
+	"context"
+	"sync"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/webhooks/models"
+)
+
+type InMemorySubscriptionRepository struct {
+	mu            sync.RWMutex
+	subscriptions map[string][]models.Subscription
+}
+
+func NewInMemorySubscriptionRepository(_ context.Context) (*InMemorySubscriptionRepository, error) {
+	return &InMemorySubscriptionRepository{
+		subscriptions: make(map[string][]models.Subscription),
+	}, nil
+}
+
+func (repository *InMemorySubscriptionRepository) ListBy(_ context.Context, tenant string) (*[]models.Subscription, error) {
+	repository.mu.RLock()
+	defer repository.mu.RUnlock()
+	result := append([]models.Subscription{}, repository.subscriptions[tenant]...)
+	return &result, nil
+}
+
+func (repository *InMemorySubscriptionRepository) Add(_ context.Context, tenant string, subscription *models.Subscription) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	repository.subscriptions[tenant] = append(repository.subscriptions[tenant], *subscription)
+	return nil
+}
+
+func (repository *InMemorySubscriptionRepository) Delete(_ context.Context, tenant, subscriptionID string) (bool, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	data := repository.subscriptions[tenant]
+	for i := range data {
+		if data[i].ID == subscriptionID {
+			repository.subscriptions[tenant] = append(data[:i], data[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
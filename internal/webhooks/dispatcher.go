@@ -0,0 +1,223 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/events"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/logger"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/webhooks/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/webhooks/ports"
+)
+
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+type DeliveryPolicy struct {
+	Workers        int
+	QueueSize      int
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration
+	// AllowPrivateTargets lets deliveries connect to loopback, private and link-local addresses.
+	AllowPrivateTargets bool
+}
+
+// Dispatcher delivers events to the tenant's webhook subscriptions in the background. Failed
+// deliveries are retried with exponential backoff and end up in the dead-letter store once
+// attempts run out or the receiver rejects them permanently.
+type Dispatcher struct {
+	subscriptions ports.SubscriptionRepository
+	deadLetters   ports.DeadLetterStore
+	idGen         ports.IdGenerator
+	logger        logger.Logger
+	client        *http.Client
+	policy        DeliveryPolicy
+	deliveries    chan models.Delivery
+	wg            sync.WaitGroup
+}
+
+func NewDispatcher(subscriptions ports.SubscriptionRepository, deadLetters ports.DeadLetterStore, idGen ports.IdGenerator, logger logger.Logger, policy DeliveryPolicy) *Dispatcher {
+	if policy.Workers <= 0 {
+		policy.Workers = 1
+	}
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 1
+	}
+	dialer := &net.Dialer{Timeout: policy.Timeout}
+	if !policy.AllowPrivateTargets {
+		dialer.Control = publicOnly
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &Dispatcher{
+		subscriptions: subscriptions,
+		deadLetters:   deadLetters,
+		idGen:         idGen,
+		logger:        logger,
+		client:        &http.Client{Timeout: policy.Timeout, Transport: transport},
+		policy:        policy,
+		deliveries:    make(chan models.Delivery, policy.QueueSize),
+	}
+}
+
+// Start runs the workers until ctx is cancelled.
+func (dispatcher *Dispatcher) Start(ctx context.Context) {
+	for i := 0; i < dispatcher.policy.Workers; i++ {
+		dispatcher.wg.Add(1)
+		go func() {
+			defer dispatcher.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case delivery := <-dispatcher.deliveries:
+					dispatcher.deliver(ctx, delivery)
+				}
+			}
+		}()
+	}
+}
+
+// Wait blocks until all workers have stopped.
+func (dispatcher *Dispatcher) Wait() {
+	dispatcher.wg.Wait()
+}
+
+// Handle queues a delivery of the event for every matching subscription of its tenant.
+func (dispatcher *Dispatcher) Handle(ctx context.Context, event events.Event) error {
+	subscriptions, err := dispatcher.subscriptions.ListBy(ctx, event.Tenant)
+	if err != nil {
+		return fmt.Errorf("webhooks - Dispatcher - Handle: can't list subscriptions; %w", err)
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("webhooks - Dispatcher - Handle: can't serialize event; %w", err)
+	}
+	for _, subscription := range *subscriptions {
+		if !subscribed(subscription, event.Type) {
+			continue
+		}
+		delivery := models.Delivery{
+			ID:             dispatcher.idGen.MakeId(),
+			SubscriptionID: subscription.ID,
+			Tenant:         event.Tenant,
+			Url:            subscription.Url,
+			Secret:         subscription.Secret,
+			EventType:      string(event.Type),
+			Payload:        payload,
+		}
+		select {
+		case dispatcher.deliveries <- delivery:
+		default:
+			dispatcher.deadLetter(ctx, delivery, "delivery queue is full")
+		}
+	}
+	return nil
+}
+
+func (dispatcher *Dispatcher) deliver(ctx context.Context, delivery models.Delivery) {
+	backoff := dispatcher.policy.InitialBackoff
+	for {
+		delivery.Attempts++
+		retryable, err := dispatcher.send(ctx, delivery)
+		if err == nil {
+			return
+		}
+		if !retryable || delivery.Attempts >= dispatcher.policy.MaxAttempts {
+			dispatcher.deadLetter(ctx, delivery, err.Error())
+			return
+		}
+		select {
+		case <-ctx.Done():
+			dispatcher.deadLetter(context.Background(), delivery, "dispatcher stopped: "+err.Error())
+			return
+		case <-time.After(jitter(backoff)):
+		}
+		backoff *= 2
+		if dispatcher.policy.MaxBackoff > 0 && backoff > dispatcher.policy.MaxBackoff {
+			backoff = dispatcher.policy.MaxBackoff
+		}
+	}
+}
+
+func (dispatcher *Dispatcher) send(ctx context.Context, delivery models.Delivery) (bool, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return false, fmt.Errorf("can't create request; %w", err)
+	}
+	timestamp := time.Now().Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(HeaderEvent, delivery.EventType)
+	request.Header.Set(HeaderDelivery, delivery.ID)
+	request.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+	response, err := dispatcher.client.Do(request)
+	if err != nil {
+		return !errors.Is(err, errPrivateTarget), fmt.Errorf("can't send request; %w", err)
+	}
+	_ = response.Body.Close()
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return false, nil
+	}
+	retryable := response.StatusCode >= 500 || response.StatusCode == http.StatusRequestTimeout || response.StatusCode == http.StatusTooManyRequests
+	return retryable, fmt.Errorf("receiver responded with %d", response.StatusCode)
+}
+
+func (dispatcher *Dispatcher) deadLetter(ctx context.Context, delivery models.Delivery, reason string) {
+	err := dispatcher.deadLetters.Add(ctx, &models.DeadLetter{
+		Delivery:  delivery,
+		LastError: reason,
+		FailedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		dispatcher.logger.Error(fmt.Errorf("webhooks - Dispatcher: can't store dead letter of delivery %s; %w", delivery.ID, err))
+	}
+}
+
+// Sign computes the signature receivers use to verify a delivery:
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + payload)).
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func subscribed(subscription models.Subscription, eventType events.Type) bool {
+	if len(subscription.EventTypes) == 0 {
+		return true
+	}
+	for _, subscribedType := range subscription.EventTypes {
+		if subscribedType == string(eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+func jitter(backoff time.Duration) time.Duration {
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
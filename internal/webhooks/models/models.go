@@ -0,0 +1,38 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type CreateSubscriptionCommand struct {
+	Url        string
+	Secret     string
+	EventTypes []string
+}
+
+type Subscription struct {
+	ID         string
+	Tenant     string
+	Url        string
+	Secret     string `json:"-"`
+	EventTypes []string
+	CreatedAt  int64
+}
+
+type Delivery struct {
+	ID             string
+	SubscriptionID string
+	Tenant         string
+	Url            string
+	Secret         string `json:"-"`
+	EventType      string
+	Payload        json.RawMessage `swaggertype:"object"`
+	Attempts       int
+}
+
+type DeadLetter struct {
+	Delivery  Delivery
+	LastError string
+	FailedAt  time.Time
+}
@@ -0,0 +1,12 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/webhooks/models"
+)
+
+type DeadLetterStore interface {
+	Add(ctx context.Context, deadLetter *models.DeadLetter) error
+	ListBy(ctx context.Context, tenant string) (*[]models.DeadLetter, error)
+}
@@ -0,0 +1,13 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/webhooks/models"
+)
+
+type SubscriptionRepository interface {
+	ListBy(ctx context.Context, tenant string) (*[]models.Subscription, error)
+	Add(ctx context.Context, tenant string, subscription *models.Subscription) error
+	Delete(ctx context.Context, tenant, subscriptionID string) (bool, error)
+}
@@ -0,0 +1,159 @@
+package webhooks
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/logger"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/webhooks/models"
+)
+
+type SubscriptionRequest struct {
+	ID string `uri:"id" binding:"required"`
+}
+
+type CreateSubscriptionRequest struct {
+	Url        string   `json:"url" binding:"required"`
+	Secret     string   `json:"secret" binding:"required"`
+	EventTypes []string `json:"eventTypes"`
+}
+
+type Subscriptions []models.Subscription
+
+type DeadLetters []models.DeadLetter
+
+func AppendWebhookRoutes(handler *gin.RouterGroup, logger logger.Logger, useCase UseCase) {
+	routerGroup := handler.Group("/webhooks")
+	routerGroup.POST("/subscriptions", createSubscription(logger, useCase))
+	routerGroup.GET("/subscriptions", showSubscriptions(logger, useCase))
+	routerGroup.DELETE("/subscriptions/:id", deleteSubscription(logger, useCase))
+	routerGroup.GET("/dead-letters", showDeadLetters(logger, useCase))
+}
+
+// createSubscription godoc
+//
+// @Summary     Subscribe to file events
+// @Description Register a webhook receiving file lifecycle events of the tenant, signed with the given secret
+// @ID          create-webhook-subscription
+// @Tags  	    webhooks
+// @Accept      json
+// @Produce     json
+// @Param		subscription	body CreateSubscriptionRequest	true "Subscription"
+// @Success     201 {object} models.Subscription
+// @Failure     400 {string} Error
+// @Failure     500 {string} Error
+// @Router      /webhooks/subscriptions [post]
+func createSubscription(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var request CreateSubscriptionRequest
+		if err := ginCtx.ShouldBindJSON(&request); err != nil {
+			logger.Ctx(ctx).Debug(err, "webhooks - createSubscription")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		subscription, err := useCase.CreateSubscription(ctx, "tenant1", models.CreateSubscriptionCommand{
+			Url:        request.Url,
+			Secret:     request.Secret,
+			EventTypes: request.EventTypes,
+		})
+		if errors.Is(err, ErrInvalidSubscription) {
+			logger.Ctx(ctx).Debug(err, "webhooks - createSubscription")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			logger.Ctx(ctx).Error(err, "webhooks - createSubscription")
+			ginCtx.String(http.StatusInternalServerError, "can't create subscription")
+			return
+		}
+		ginCtx.JSON(http.StatusCreated, subscription)
+	}
+}
+
+// showSubscriptions godoc
+//
+// @Summary     Show webhook subscriptions
+// @Description Get webhook subscriptions of the tenant
+// @ID          get-webhook-subscriptions
+// @Tags  	    webhooks
+// @Accept      json
+// @Produce     json
+// @Success     200 {object} Subscriptions
+// @Failure     500 {string} Error
+// @Router      /webhooks/subscriptions [get]
+func showSubscriptions(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		result, err := useCase.ListSubscriptions(ctx, "tenant1")
+		if err != nil {
+			logger.Ctx(ctx).Error(err, "webhooks - showSubscriptions")
+			ginCtx.String(http.StatusInternalServerError, "can't get subscriptions")
+			return
+		}
+		ginCtx.JSON(http.StatusOK, *result)
+	}
+}
+
+// deleteSubscription godoc
+//
+// @Summary     Remove webhook subscription
+// @Description Remove webhook subscription by id
+// @ID          remove-webhook-subscription
+// @Tags  	    webhooks
+// @Accept      json
+// @Produce     json
+// @Param		id	path string	true "Subscription ID"
+// @Success     204
+// @Failure     400 {string} Error
+// @Failure     404 {string} Error
+// @Failure     500 {string} Error
+// @Router      /webhooks/subscriptions/{id} [delete]
+func deleteSubscription(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		var subscription SubscriptionRequest
+		if err := ginCtx.ShouldBindUri(&subscription); err != nil {
+			logger.Ctx(ctx).Debug(err, "webhooks - deleteSubscription")
+			ginCtx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		err := useCase.DeleteSubscription(ctx, "tenant1", subscription.ID)
+		if errors.Is(err, ErrSubscriptionNotFound) {
+			ginCtx.String(http.StatusNotFound, ErrSubscriptionNotFound.Error())
+			return
+		}
+		if err != nil {
+			logger.Ctx(ctx).Error(err, "webhooks - deleteSubscription")
+			ginCtx.String(http.StatusInternalServerError, "can't remove subscription")
+			return
+		}
+		ginCtx.Status(http.StatusNoContent)
+	}
+}
+
+// showDeadLetters godoc
+//
+// @Summary     Show failed webhook deliveries
+// @Description Get deliveries that ran out of retries or were rejected by the receiver
+// @ID          get-webhook-dead-letters
+// @Tags  	    webhooks
+// @Accept      json
+// @Produce     json
+// @Success     200 {object} DeadLetters
+// @Failure     500 {string} Error
+// @Router      /webhooks/dead-letters [get]
+func showDeadLetters(logger logger.Logger, useCase UseCase) gin.HandlerFunc {
+	return func(ginCtx *gin.Context) {
+		ctx := ginCtx.Copy()
+		result, err := useCase.ListDeadLetters(ctx, "tenant1")
+		if err != nil {
+			logger.Ctx(ctx).Error(err, "webhooks - showDeadLetters")
+			ginCtx.String(http.StatusInternalServerError, "can't get dead letters")
+			return
+		}
+		ginCtx.JSON(http.StatusOK, *result)
+	}
+}
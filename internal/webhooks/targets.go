@@ -0,0 +1,40 @@
+package webhooks
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+)
+
+var errPrivateTarget = errors.New("webhook target is not a public address")
+
+// checkHost rejects hosts that name the service itself or its private network. Names are
+// checked again at dial time, since they may resolve to a private address later.
+func checkHost(host string) error {
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return errPrivateTarget
+	}
+	if ip := net.ParseIP(host); ip != nil && !isPublic(ip) {
+		return errPrivateTarget
+	}
+	return nil
+}
+
+// publicOnly is a net.Dialer Control function refusing connections to non-public addresses.
+func publicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errPrivateTarget, address)
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+		return fmt.Errorf("%w: %s", errPrivateTarget, address)
+	}
+	return nil
+}
+
+func isPublic(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
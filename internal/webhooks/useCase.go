@@ -0,0 +1,115 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/events"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/webhooks/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/webhooks/ports"
+)
+
+const _minimumSecretLength = 16
+
+var (
+	ErrInvalidSubscription  = errors.New("invalid subscription")
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+)
+
+var _supportedEventTypes = map[string]bool{
+	string(events.FileUploaded):        true,
+	string(events.FileDeleted):         true,
+	string(events.FileCopied):          true,
+	string(events.FileMoved):           true,
+	string(events.FileLinked):          true,
+	string(events.FileUnlinked):        true,
+	string(events.FileMetadataUpdated): true,
+}
+
+type UseCase interface {
+	CreateSubscription(ctx context.Context, tenant string, command models.CreateSubscriptionCommand) (*models.Subscription, error)
+	ListSubscriptions(ctx context.Context, tenant string) (*[]models.Subscription, error)
+	DeleteSubscription(ctx context.Context, tenant, subscriptionID string) error
+	ListDeadLetters(ctx context.Context, tenant string) (*[]models.DeadLetter, error)
+}
+
+type DefaultWebhooksUseCase struct {
+	subscriptions       ports.SubscriptionRepository
+	deadLetters         ports.DeadLetterStore
+	idGen               ports.IdGenerator
+	allowPrivateTargets bool
+}
+
+// NewDefaultWebhooksUseCase creates the use case. Subscriptions to loopback, private and
+// link-local addresses are rejected unless allowPrivateTargets is set.
+func NewDefaultWebhooksUseCase(subscriptions ports.SubscriptionRepository, deadLetters ports.DeadLetterStore, idGen ports.IdGenerator, allowPrivateTargets bool) (*DefaultWebhooksUseCase, error) {
+	return &DefaultWebhooksUseCase{subscriptions: subscriptions, deadLetters: deadLetters, idGen: idGen, allowPrivateTargets: allowPrivateTargets}, nil
+}
+
+func (useCase *DefaultWebhooksUseCase) CreateSubscription(ctx context.Context, tenant string, command models.CreateSubscriptionCommand) (*models.Subscription, error) {
+	if err := validate(command, useCase.allowPrivateTargets); err != nil {
+		return nil, fmt.Errorf("DefaultWebhooksUseCase - CreateSubscription: %w", err)
+	}
+	subscription := models.Subscription{
+		ID:         useCase.idGen.MakeId(),
+		Tenant:     tenant,
+		Url:        command.Url,
+		Secret:     command.Secret,
+		EventTypes: command.EventTypes,
+		CreatedAt:  time.Now().Unix(),
+	}
+	err := useCase.subscriptions.Add(ctx, tenant, &subscription)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultWebhooksUseCase - CreateSubscription: can't add subscription to repository; %w", err)
+	}
+	return &subscription, nil
+}
+
+func (useCase *DefaultWebhooksUseCase) ListSubscriptions(ctx context.Context, tenant string) (*[]models.Subscription, error) {
+	subscriptions, err := useCase.subscriptions.ListBy(ctx, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultWebhooksUseCase - ListSubscriptions: can't list subscriptions; %w", err)
+	}
+	return subscriptions, nil
+}
+
+func (useCase *DefaultWebhooksUseCase) DeleteSubscription(ctx context.Context, tenant, subscriptionID string) error {
+	deleted, err := useCase.subscriptions.Delete(ctx, tenant, subscriptionID)
+	if err != nil {
+		return fmt.Errorf("DefaultWebhooksUseCase - DeleteSubscription: can't delete subscription from repository; %w", err)
+	}
+	if !deleted {
+		return fmt.Errorf("DefaultWebhooksUseCase - DeleteSubscription: %w", ErrSubscriptionNotFound)
+	}
+	return nil
+}
+
+func (useCase *DefaultWebhooksUseCase) ListDeadLetters(ctx context.Context, tenant string) (*[]models.DeadLetter, error) {
+	deadLetters, err := useCase.deadLetters.ListBy(ctx, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("DefaultWebhooksUseCase - ListDeadLetters: can't list dead letters; %w", err)
+	}
+	return deadLetters, nil
+}
+
+func validate(command models.CreateSubscriptionCommand, allowPrivateTargets bool) error {
+	target, err := url.Parse(command.Url)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return fmt.Errorf("%w: url must be an absolute http(s) url", ErrInvalidSubscription)
+	}
+	if !allowPrivateTargets && checkHost(target.Hostname()) != nil {
+		return fmt.Errorf("%w: url must point to a public address", ErrInvalidSubscription)
+	}
+	if len(command.Secret) < _minimumSecretLength {
+		return fmt.Errorf("%w: secret must be at least %d characters long", ErrInvalidSubscription, _minimumSecretLength)
+	}
+	for _, eventType := range command.EventTypes {
+		if !_supportedEventTypes[eventType] {
+			return fmt.Errorf("%w: unknown event type %q", ErrInvalidSubscription, eventType)
+		}
+	}
+	return nil
+}
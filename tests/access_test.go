@@ -0,0 +1,232 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/adapters"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	httpRouter "github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/http"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/access"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/tests/doubles"
+)
+
+func TestFilesAreAccessibleToTheirOwnersAndGranteesOnly(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	useCase := createUseCase(t, ctx, doubles.NewInMemoryFileStorage(), files.AccessControl(adapters.NewInMemoryReferenceAccessStore()))
+	alice := access.WithCaller(ctx, access.Caller{ID: "alice"})
+	bob := access.WithCaller(ctx, access.Caller{ID: "bob"})
+	requireNotError(t, uploadText(alice, useCase, "tenant1", "order", "invoice.txt", "Paid"))
+	file := listAttachments(t, alice, useCase, "order")[0]
+
+	// Act
+	_, downloadErr := useCase.DownloadFile(bob, "tenant1", file.ID)
+	deleteErr := useCase.DeleteFile(bob, "tenant1", file.ID)
+	uploadErr := uploadText(bob, useCase, "tenant1", "order", "fake.txt", "Unpaid")
+	listedByBob := listAttachments(t, bob, useCase, "order")
+	requireNotError(t, useCase.GrantFileAccess(alice, "tenant1", file.ID, models.Grant{
+		PrincipalType: models.PrincipalUser,
+		PrincipalID:   "bob",
+		Role:          models.RoleReader,
+	}))
+	readByBob := downloadText(t, bob, useCase, file.ID)
+	deleteAsReaderErr := useCase.DeleteFile(bob, "tenant1", file.ID)
+	grants, err := useCase.ListFileAccess(alice, "tenant1", file.ID)
+	requireNotError(t, err)
+
+	// Assert
+	require.ErrorIs(t, downloadErr, files.ErrAccessDenied)
+	require.ErrorIs(t, deleteErr, files.ErrAccessDenied)
+	require.ErrorIs(t, uploadErr, files.ErrAccessDenied)
+	require.ErrorIs(t, deleteAsReaderErr, files.ErrAccessDenied)
+	require.Empty(t, listedByBob)
+	require.Equal(t, "Paid", readByBob)
+	require.Equal(t, []models.Grant{
+		{PrincipalType: models.PrincipalUser, PrincipalID: "alice", Role: models.RoleOwner},
+		{PrincipalType: models.PrincipalUser, PrincipalID: "bob", Role: models.RoleReader},
+	}, grants)
+	require.Len(t, listAttachments(t, ctx, useCase, "order"), 1)
+}
+
+func TestReferenceGrantsApplyToAllItsFilesAndGroupMembers(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	useCase := createUseCase(t, ctx, doubles.NewInMemoryFileStorage(), files.AccessControl(adapters.NewInMemoryReferenceAccessStore()))
+	alice := access.WithCaller(ctx, access.Caller{ID: "alice"})
+	carol := access.WithCaller(ctx, access.Caller{ID: "carol", Groups: []string{"accounting"}})
+	dave := access.WithCaller(ctx, access.Caller{ID: "dave", Groups: []string{"sales"}})
+	requireNotError(t, uploadText(alice, useCase, "tenant1", "order", "invoice.txt", "Paid"))
+	requireNotError(t, uploadText(alice, useCase, "tenant1", "order", "receipt.txt", "Paid too"))
+	requireNotError(t, useCase.GrantReferenceAccess(alice, "tenant1", "order", models.Grant{
+		PrincipalType: models.PrincipalGroup,
+		PrincipalID:   "accounting",
+		Role:          models.RoleWriter,
+	}))
+
+	// Act
+	listedByCarol := listAttachments(t, carol, useCase, "order")
+	uploadErr := uploadText(carol, useCase, "tenant1", "order", "correction.txt", "Refunded")
+	deleteErr := useCase.DeleteFile(carol, "tenant1", listedByCarol[0].ID)
+	listedByDave := listAttachments(t, dave, useCase, "order")
+	grantErr := useCase.GrantReferenceAccess(carol, "tenant1", "order", models.Grant{
+		PrincipalType: models.PrincipalUser,
+		PrincipalID:   "carol",
+		Role:          models.RoleOwner,
+	})
+	_, listGrantsErr := useCase.ListReferenceAccess(dave, "tenant1", "order")
+	_, listGrantsAsWriterErr := useCase.ListReferenceAccess(carol, "tenant1", "order")
+
+	// Assert
+	require.Len(t, listedByCarol, 2)
+	requireNotError(t, uploadErr)
+	requireNotError(t, deleteErr)
+	require.Empty(t, listedByDave)
+	require.ErrorIs(t, grantErr, files.ErrAccessDenied)
+	require.ErrorIs(t, listGrantsErr, files.ErrAccessDenied)
+	require.ErrorIs(t, listGrantsAsWriterErr, files.ErrAccessDenied)
+	require.Len(t, listAttachments(t, alice, useCase, "order"), 2)
+}
+
+func TestAccessIsManagedByOwnersAndKeepsOneOfThem(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	useCase := createUseCase(t, ctx, doubles.NewInMemoryFileStorage(), files.AccessControl(adapters.NewInMemoryReferenceAccessStore()))
+	requireNotError(t, uploadText(access.WithCaller(ctx, access.Caller{ID: "alice"}), useCase, "tenant1", "order", "invoice.txt", "Paid"))
+	file := listAttachments(t, ctx, useCase, "order")[0]
+	router := createCallerRouter(useCase)
+	serve := func(caller string, req *http.Request) int {
+		req.Header.Set(httpRouter.HeaderApiKey, caller+"-key")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+	grantsPath := "/api/files/" + file.ID + "/access"
+
+	// Act
+	grantedBob := serve("alice", makeJsonRequest(t, http.MethodPut, grantsPath,
+		map[string]interface{}{"principalType": "user", "principalId": "bob", "role": "owner"}))
+	invalidRole := serve("alice", makeJsonRequest(t, http.MethodPut, grantsPath,
+		map[string]interface{}{"principalType": "user", "principalId": "carol", "role": "admin"}))
+	grantedByStranger := serve("carol", makeJsonRequest(t, http.MethodPut, grantsPath,
+		map[string]interface{}{"principalType": "user", "principalId": "carol", "role": "owner"}))
+	downloadedByStranger := serve("carol", httptest.NewRequest(http.MethodGet, "/api/files/"+file.ID+"/content", nil))
+	revokedAlice := serve("bob", httptest.NewRequest(http.MethodDelete, grantsPath+"/user/alice", nil))
+	revokedUnknown := serve("bob", httptest.NewRequest(http.MethodDelete, grantsPath+"/group/sales", nil))
+	revokedLastOwner := serve("bob", httptest.NewRequest(http.MethodDelete, grantsPath+"/user/bob", nil))
+	listed := httptest.NewRecorder()
+	listRequest := httptest.NewRequest(http.MethodGet, grantsPath, nil)
+	listRequest.Header.Set(httpRouter.HeaderApiKey, "bob-key")
+	router.ServeHTTP(listed, listRequest)
+	var grants []models.Grant
+	requireNotError(t, json.Unmarshal(listed.Body.Bytes(), &grants))
+
+	// Assert
+	require.Equal(t, http.StatusNoContent, grantedBob)
+	require.Equal(t, http.StatusBadRequest, invalidRole)
+	require.Equal(t, http.StatusForbidden, grantedByStranger)
+	require.Equal(t, http.StatusForbidden, downloadedByStranger)
+	require.Equal(t, http.StatusNoContent, revokedAlice)
+	require.Equal(t, http.StatusNotFound, revokedUnknown)
+	require.Equal(t, http.StatusConflict, revokedLastOwner)
+	require.Equal(t, []models.Grant{{PrincipalType: models.PrincipalUser, PrincipalID: "bob", Role: models.RoleOwner}}, grants)
+}
+
+func TestReferencesHoldingFilesCantBeClaimed(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	useCase := createUseCase(t, ctx, doubles.NewInMemoryFileStorage(), files.AccessControl(adapters.NewInMemoryReferenceAccessStore()))
+	mallory := access.WithCaller(ctx, access.Caller{ID: "mallory"})
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "invoice.txt", "Paid"))
+
+	// Act
+	claimErr := uploadText(mallory, useCase, "tenant1", "order", "fake.txt", "Unpaid")
+	newReferenceErr := uploadText(mallory, useCase, "tenant1", "notes", "note.txt", "Mine")
+	listedByMallory := listAttachments(t, mallory, useCase, "order")
+	_, listGrantsErr := useCase.ListReferenceAccess(mallory, "tenant1", "order")
+
+	// Assert
+	require.ErrorIs(t, claimErr, files.ErrAccessDenied)
+	require.ErrorIs(t, listGrantsErr, files.ErrAccessDenied)
+	requireNotError(t, newReferenceErr)
+	require.Empty(t, listedByMallory)
+}
+
+func TestActorAuthenticatesCallersByApiKey(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	var callers []access.Caller
+	router.Use(httpRouter.Actor(map[string]access.Caller{
+		"alice-key": {ID: "alice", Groups: []string{access.AdminsGroup}},
+	}, "/public"))
+	recordCaller := func(ginCtx *gin.Context) {
+		caller, ok := access.CallerFrom(ginCtx.Request.Context())
+		if ok {
+			callers = append(callers, caller)
+		}
+	}
+	router.GET("/caller", recordCaller)
+	router.GET("/public", recordCaller)
+	serve := func(path string, apiKey string) int {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		if apiKey != "" {
+			request.Header.Set(httpRouter.HeaderApiKey, apiKey)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	// Act
+	authenticated := serve("/caller", "alice-key")
+	withoutKey := serve("/caller", "")
+	withUnknownKey := serve("/caller", "mallory-key")
+	public := serve("/public", "")
+
+	// Assert
+	require.Equal(t, http.StatusOK, authenticated)
+	require.Equal(t, http.StatusUnauthorized, withoutKey)
+	require.Equal(t, http.StatusUnauthorized, withUnknownKey)
+	require.Equal(t, http.StatusOK, public)
+	require.Equal(t, []access.Caller{{ID: "alice", Groups: []string{access.AdminsGroup}}}, callers)
+}
+
+func TestAccessWithoutAccessControlIsNotImplemented(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	useCase := createUseCase(t, ctx, doubles.NewInMemoryFileStorage(), quotas(models.QuotaLimits{}))
+	router := createFilesRouter(useCase)
+	requireNotError(t, uploadText(access.WithCaller(ctx, access.Caller{ID: "alice"}), useCase, "tenant1", "order", "invoice.txt", "Paid"))
+	file := listAttachments(t, ctx, useCase, "order")[0]
+
+	// Act
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/files/reference/order/access", nil))
+	_, err := useCase.DownloadFile(access.WithCaller(ctx, access.Caller{ID: "bob"}), "tenant1", file.ID)
+
+	// Assert
+	require.Equal(t, http.StatusNotImplemented, recorder.Code)
+	requireNotError(t, err)
+}
+
+// createCallerRouter serves file routes to alice, bob and carol, each authenticated by "<name>-key".
+func createCallerRouter(useCase files.UseCase) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(httpRouter.Actor(map[string]access.Caller{
+		"alice-key": {ID: "alice"},
+		"bob-key":   {ID: "bob"},
+		"carol-key": {ID: "carol"},
+	}))
+	files.AppendFileRoutes(router.Group("/api"), createStubLogger(), useCase)
+	return router
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/httpserver"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/tests/doubles"
+)
+
+func TestCanDownloadReferenceFilesAsArchive(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	useCase := createUseCase(t, ctx, doubles.NewInMemoryFileStorage())
+	for _, upload := range []struct{ name, content string }{{"a.txt", "first"}, {"a.txt", "second"}, {"b.txt", "third"}} {
+		err := useCase.UploadFile(ctx, "tenant1", models.UploadFileCommand{FileName: upload.name, ReferenceID: "reference", File: bytes.NewReader([]byte(upload.content))})
+		requireNotError(t, err)
+	}
+	router := gin.New()
+	files.AppendFileRoutes(router.Group("/api"), createStubLogger(), useCase)
+	archiveRecorder := httptest.NewRecorder()
+	missingFileRecorder := httptest.NewRecorder()
+
+	// Act
+	router.ServeHTTP(archiveRecorder, httptest.NewRequest(http.MethodGet, "/api/files/reference/reference/archive", nil))
+	router.ServeHTTP(missingFileRecorder, httptest.NewRequest(http.MethodGet, "/api/files/reference/reference/archive?fileId=missing", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, archiveRecorder.Code)
+	require.Equal(t, "application/zip", archiveRecorder.Header().Get("Content-Type"))
+	archive, err := zip.NewReader(bytes.NewReader(archiveRecorder.Body.Bytes()), int64(archiveRecorder.Body.Len()))
+	requireNotError(t, err)
+	entries := make(map[string]string)
+	for _, entry := range archive.File {
+		reader, err := entry.Open()
+		requireNotError(t, err)
+		content, err := io.ReadAll(reader)
+		requireNotError(t, err)
+		entries[entry.Name] = string(content)
+	}
+	require.Len(t, entries, 3)
+	require.Contains(t, entries, "a.txt")
+	require.Contains(t, entries, "a (1).txt")
+	require.Equal(t, "third", entries["b.txt"])
+	require.Equal(t, http.StatusNotFound, missingFileRecorder.Code)
+}
+
+func TestArchiveIsStreamedPastTheWriteTimeout(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewFaultyFileStorage(doubles.NewInMemoryFileStorage())
+	useCase := createUseCase(t, ctx, storage)
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "reference", "a.txt", "first"))
+	storage.SetDelay(300 * time.Millisecond)
+	port := freePort(t)
+	server := httpserver.New(createFilesRouter(useCase), httpserver.Port(port),
+		httpserver.WriteTimeout(100*time.Millisecond),
+		httpserver.StreamWriteTimeout(5*time.Second))
+	defer server.Shutdown()
+	url := fmt.Sprintf("http://127.0.0.1:%s/api/files/reference/reference/archive", port)
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", "127.0.0.1:"+port)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	// Act
+	response, err := http.Get(url)
+	requireNotError(t, err)
+	defer response.Body.Close()
+	content, err := io.ReadAll(response.Body)
+
+	// Assert
+	requireNotError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	requireNotError(t, err)
+	require.Len(t, archive.File, 1)
+}
+
+func freePort(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	requireNotError(t, err)
+	defer listener.Close()
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+}
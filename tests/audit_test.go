@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/config"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/auditlog"
+	auditAdapters "github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/auditlog/adapters"
+	auditModels "github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/auditlog/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/adapters"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	httpRouter "github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/http"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/audit"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/events"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/tests/doubles"
+)
+
+func TestFileOperationsAreRecordedInAuditTrail(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	auditUseCase := createAuditUseCase(t, ctx, 0)
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	useCase, err := files.NewDefaultFilesUseCase(doubles.NewInMemoryFileStorage(), repository, adapters.NewGuidBasedIdGenerator(),
+		config.GCloudStorage{UrlExpirationTime: 15}, nil, files.Audit(auditUseCase))
+	requireNotError(t, err)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.ContextWithFallback = true
+	routerGroup := router.Group("/api")
+	routerGroup.Use(httpRouter.Actor(nil))
+	files.AppendFileRoutes(routerGroup, createStubLogger(), useCase)
+	auditlog.AppendAuditRoutes(routerGroup, createStubLogger(), auditUseCase)
+	uploaderCtx := audit.WithActor(ctx, audit.Actor{ID: "uploader", IP: "10.0.0.1"})
+	err = useCase.UploadFile(uploaderCtx, "tenant1", models.UploadFileCommand{CreatorId: "uploader", FileName: "file.txt", ReferenceID: "reference", File: bytes.NewReader([]byte("Hello!"))})
+	requireNotError(t, err)
+
+	// Act
+	listRecorder := httptest.NewRecorder()
+	router.ServeHTTP(listRecorder, httptest.NewRequest(http.MethodGet, "/api/files/reference/reference", nil))
+	auditRecorder := httptest.NewRecorder()
+	router.ServeHTTP(auditRecorder, httptest.NewRequest(http.MethodGet, "/api/audit", nil))
+	invalidRecorder := httptest.NewRecorder()
+	router.ServeHTTP(invalidRecorder, httptest.NewRequest(http.MethodGet, "/api/audit?limit=5000", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, listRecorder.Code)
+	require.Equal(t, http.StatusOK, auditRecorder.Code)
+	var entries []audit.Entry
+	requireNotError(t, json.Unmarshal(auditRecorder.Body.Bytes(), &entries))
+	require.Len(t, entries, 2)
+	require.Equal(t, audit.ActionUrlIssued, entries[0].Action)
+	require.Equal(t, "UserId", entries[0].ActorID)
+	require.Equal(t, "192.0.2.1", entries[0].IP)
+	require.Equal(t, audit.ActionUpload, entries[1].Action)
+	require.Equal(t, "uploader", entries[1].ActorID)
+	require.Equal(t, "10.0.0.1", entries[1].IP)
+	require.Equal(t, entries[0].FileID, entries[1].FileID)
+	require.NotEmpty(t, entries[1].FileID)
+	require.Equal(t, http.StatusBadRequest, invalidRecorder.Code)
+}
+
+func TestAuditTrailIsFilteredByAnyRecordedAction(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	auditUseCase := createAuditUseCase(t, ctx, 0)
+	requireNotError(t, auditUseCase.Record(ctx, audit.Entry{Tenant: "tenant1", Action: audit.ActionShare, FileID: "file"}))
+	requireNotError(t, auditUseCase.Record(ctx, audit.Entry{Tenant: "tenant1", Action: audit.ActionUpload, FileID: "file"}))
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	auditlog.AppendAuditRoutes(router.Group("/api"), createStubLogger(), auditUseCase)
+
+	// Act
+	sharedRecorder := httptest.NewRecorder()
+	router.ServeHTTP(sharedRecorder, httptest.NewRequest(http.MethodGet, "/api/audit?action=share", nil))
+	unknownRecorder := httptest.NewRecorder()
+	router.ServeHTTP(unknownRecorder, httptest.NewRequest(http.MethodGet, "/api/audit?action=shared", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, sharedRecorder.Code)
+	var entries []audit.Entry
+	requireNotError(t, json.Unmarshal(sharedRecorder.Body.Bytes(), &entries))
+	require.Len(t, entries, 1)
+	require.Equal(t, audit.ActionShare, entries[0].Action)
+	require.Equal(t, http.StatusBadRequest, unknownRecorder.Code)
+}
+
+func TestExpiredAuditEntriesArePurged(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	auditUseCase := createAuditUseCase(t, ctx, time.Millisecond)
+	requireNotError(t, auditUseCase.Record(ctx, audit.Entry{Tenant: "tenant1", Action: audit.ActionDownload, FileID: "file"}))
+	time.Sleep(5 * time.Millisecond)
+
+	// Act
+	deleted, err := auditUseCase.PurgeExpired(ctx)
+
+	// Assert
+	requireNotError(t, err)
+	require.Equal(t, 1, deleted)
+	entries, err := auditUseCase.ListBy(ctx, "tenant1", auditModels.ListEntriesQuery{})
+	requireNotError(t, err)
+	require.Empty(t, *entries)
+}
+
+func createAuditUseCase(t *testing.T, ctx context.Context, retention time.Duration) *auditlog.DefaultAuditLogUseCase {
+	store, err := auditAdapters.NewInMemoryAuditStore(ctx)
+	requireNotError(t, err)
+	useCase, err := auditlog.NewDefaultAuditLogUseCase(store, adapters.NewGuidBasedIdGenerator(), retention)
+	requireNotError(t, err)
+	return useCase
+}
+
+func TestCommittedOperationsSucceedWhenAuditAndEventsFail(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	unavailable := &unavailableTrail{}
+	useCase, err := files.NewDefaultFilesUseCase(doubles.NewInMemoryFileStorage(), repository, adapters.NewGuidBasedIdGenerator(),
+		config.GCloudStorage{UrlExpirationTime: 15}, nil, files.Audit(unavailable), files.Events(unavailable), files.Logger(createStubLogger()))
+	requireNotError(t, err)
+
+	// Act
+	uploadErr := uploadText(ctx, useCase, "tenant1", "reference", "file.txt", "Hello!")
+	uploaded, err := repository.ListBy(ctx, "tenant1", "reference")
+	requireNotError(t, err)
+	deleteErr := useCase.DeleteFile(ctx, "tenant1", (*uploaded)[0].ID)
+	remaining, err := repository.ListBy(ctx, "tenant1", "reference")
+	requireNotError(t, err)
+
+	// Assert
+	requireNotError(t, uploadErr)
+	requireNotError(t, deleteErr)
+	require.Len(t, *uploaded, 1)
+	require.Empty(t, *remaining)
+	require.Equal(t, 4, unavailable.calls)
+}
+
+// unavailableTrail fails every audit entry and event, like a trail whose backend is down.
+type unavailableTrail struct {
+	calls int
+}
+
+func (trail *unavailableTrail) Record(context.Context, audit.Entry) error {
+	trail.calls++
+	return errors.New("audit trail unavailable")
+}
+
+func (trail *unavailableTrail) Publish(context.Context, events.Event) error {
+	trail.calls++
+	return errors.New("event bus unavailable")
+}
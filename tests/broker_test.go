@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/config"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/adapters"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/events"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/gcloudpubsub"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/tests/doubles"
+)
+
+func TestOutboxPublishesEventsOnceBrokerIsBack(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	server := pstest.NewServer()
+	defer server.Close()
+	conn, err := grpc.Dial(server.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	requireNotError(t, err)
+	defer conn.Close()
+	client, err := pubsub.NewClient(ctx, "project", option.WithGRPCConn(conn))
+	requireNotError(t, err)
+	publisher := gcloudpubsub.NewPublisher(client, "file-events")
+	defer publisher.Stop()
+	requireNotError(t, publisher.EnsureTopic(ctx, client))
+
+	var brokerDown atomic.Bool
+	brokerDown.Store(true)
+	outbox := events.NewOutbox(events.NewInMemoryOutboxStore(0), func(ctx context.Context, event events.Event) error {
+		if brokerDown.Load() {
+			return errors.New("broker unavailable")
+		}
+		return publisher.Publish(ctx, event)
+	}, createStubLogger(), 0, 1, 3)
+	bus := events.NewBus(createStubLogger())
+	bus.Subscribe(outbox.Handle)
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	useCase, err := files.NewDefaultFilesUseCase(doubles.NewInMemoryFileStorage(), repository, adapters.NewGuidBasedIdGenerator(),
+		config.GCloudStorage{UrlExpirationTime: 15}, nil, files.Events(bus))
+	requireNotError(t, err)
+	err = useCase.UploadFile(ctx, "tenant", models.UploadFileCommand{FileName: "file.txt", ReferenceID: "reference", File: bytes.NewReader([]byte("Hello!"))})
+	requireNotError(t, err)
+	attachments, err := useCase.ListBy(ctx, "tenant", models.ListFilesQuery{ReferenceID: "reference"})
+	requireNotError(t, err)
+	requireNotError(t, useCase.DeleteFile(ctx, "tenant", (*attachments)[0].ID))
+	_, err = outbox.Flush(ctx)
+	require.Error(t, err)
+
+	// Act
+	brokerDown.Store(false)
+	published, err := outbox.Flush(ctx)
+	requireNotError(t, err)
+	republished, err := outbox.Flush(ctx)
+	requireNotError(t, err)
+
+	// Assert
+	require.Equal(t, 2, published)
+	require.Equal(t, 0, republished)
+	messages := server.Messages()
+	require.Len(t, messages, 2)
+	var event events.Event
+	requireNotError(t, json.Unmarshal(messages[0].Data, &event))
+	require.Equal(t, events.FileUploaded, event.Type)
+	require.Equal(t, event.ID, messages[0].Attributes["eventId"])
+	require.Equal(t, string(events.FileDeleted), messages[1].Attributes["eventType"])
+}
+
+func TestOutboxSetsAsidePoisonEventsAndKeepsPublishing(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	store := events.NewInMemoryOutboxStore(2)
+	var published []string
+	outbox := events.NewOutbox(store, func(ctx context.Context, event events.Event) error {
+		if event.ID == "poison" {
+			return errors.New("message too large")
+		}
+		published = append(published, event.ID)
+		return nil
+	}, createStubLogger(), 0, 10, 2)
+	requireNotError(t, outbox.Handle(ctx, events.Event{ID: "poison"}))
+	requireNotError(t, outbox.Handle(ctx, events.Event{ID: "first"}))
+
+	// Act
+	_, firstErr := outbox.Flush(ctx)
+	requireNotError(t, outbox.Handle(ctx, events.Event{ID: "second"}))
+	_, secondErr := outbox.Flush(ctx)
+	requireNotError(t, outbox.Handle(ctx, events.Event{ID: "second"}))
+	requireNotError(t, outbox.Handle(ctx, events.Event{ID: "first"}))
+	republished, err := outbox.Flush(ctx)
+	requireNotError(t, err)
+
+	// Assert
+	require.Error(t, firstErr)
+	require.Error(t, secondErr)
+	require.Equal(t, []string{"first", "second", "first"}, published)
+	require.Equal(t, 1, republished)
+	dead := store.Dead()
+	require.Len(t, dead, 1)
+	require.Equal(t, "poison", dead[0].Event.ID)
+	require.Equal(t, 2, dead[0].Attempts)
+}
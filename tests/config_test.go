@@ -0,0 +1,35 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/config"
+)
+
+func TestDeprecatedUseCredentialsSelectsPrivateKeySigner(t *testing.T) {
+	// Arrange
+	t.Setenv("GCLOUD_STORAGE_SIGNER", "none")
+	t.Setenv("GCLOUD_STORAGE_USE_CREDENTIALS", "true")
+
+	// Act
+	appConfig, err := config.NewConfig("./../config/config.yml")
+
+	// Assert
+	requireNotError(t, err)
+	require.Equal(t, "private_key", appConfig.GCloudStorage.Signer)
+}
+
+func TestExplicitSignerWinsOverDeprecatedUseCredentials(t *testing.T) {
+	// Arrange
+	t.Setenv("GCLOUD_STORAGE_SIGNER", "iam")
+	t.Setenv("GCLOUD_STORAGE_USE_CREDENTIALS", "true")
+
+	// Act
+	appConfig, err := config.NewConfig("./../config/config.yml")
+
+	// Assert
+	requireNotError(t, err)
+	require.Equal(t, "iam", appConfig.GCloudStorage.Signer)
+}
@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/tests/doubles"
+)
+
+func TestCopiedFileIsAttachedToBothReferences(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	useCase := createUseCase(t, ctx, storage, quotas(models.QuotaLimits{}))
+	router := createFilesRouter(useCase)
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "source", "file.txt", "Hello!"))
+	source := listAttachments(t, ctx, useCase, "source")[0]
+
+	// Act
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, makeJsonRequest(t, http.MethodPost, "/api/files/"+source.ID+"/copy", map[string]string{"referenceId": "target"}))
+
+	// Assert
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	var copied models.Attachment
+	requireNotError(t, json.Unmarshal(recorder.Body.Bytes(), &copied))
+	require.NotEqual(t, source.ID, copied.ID)
+	require.Equal(t, "file.txt", copied.FileName)
+	require.Len(t, listAttachments(t, ctx, useCase, "source"), 1)
+	require.Equal(t, copied.ID, listAttachments(t, ctx, useCase, "target")[0].ID)
+	require.Equal(t, "Hello!", downloadText(t, ctx, useCase, copied.ID))
+	requireNotError(t, useCase.DeleteFile(ctx, "tenant1", source.ID))
+	require.Equal(t, "Hello!", downloadText(t, ctx, useCase, copied.ID))
+	usage, err := useCase.Usage(ctx, "tenant1", "target")
+	requireNotError(t, err)
+	require.Equal(t, int64(6), usage.Reference.Bytes)
+}
+
+func TestMovedFileIsRenamedInStorage(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	useCase := createUseCase(t, ctx, storage, quotas(models.QuotaLimits{}))
+	router := createFilesRouter(useCase)
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "source", "file.txt", "Hello!"))
+	source := listAttachments(t, ctx, useCase, "source")[0]
+
+	// Act
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, makeJsonRequest(t, http.MethodPatch, "/api/files/"+source.ID, map[string]string{"referenceId": "target", "fileName": "renamed.txt"}))
+
+	// Assert
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Empty(t, listAttachments(t, ctx, useCase, "source"))
+	moved := listAttachments(t, ctx, useCase, "target")[0]
+	require.Equal(t, source.ID, moved.ID)
+	require.Equal(t, "renamed.txt", moved.FileName)
+	require.Equal(t, "Hello!", downloadText(t, ctx, useCase, moved.ID))
+	_, oldObjectExists := storage.Files["tenant1/file.txt"]
+	require.False(t, oldObjectExists)
+	require.Contains(t, moved.Url, "renamed.txt")
+	usage, err := useCase.Usage(ctx, "tenant1", "source")
+	requireNotError(t, err)
+	require.Equal(t, 0, usage.Reference.Files)
+	require.Equal(t, 1, usage.Files)
+}
+
+func TestCopyAndMoveRejectInvalidRequests(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	useCase := createUseCase(t, ctx, doubles.NewInMemoryFileStorage(), quotas(models.QuotaLimits{MaxReferenceFiles: 1}))
+	router := createFilesRouter(useCase)
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "source", "file.txt", "Hello!"))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "full", "other.txt", "Hello!"))
+	source := listAttachments(t, ctx, useCase, "source")[0]
+	serve := func(method, path string, body map[string]string) int {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, makeJsonRequest(t, method, path, body))
+		return recorder.Code
+	}
+
+	// Act
+	missingReference := serve(http.MethodPost, "/api/files/"+source.ID+"/copy", map[string]string{})
+	pathName := serve(http.MethodPatch, "/api/files/"+source.ID, map[string]string{"fileName": "../file.txt"})
+	unknownFile := serve(http.MethodPost, "/api/files/unknown/copy", map[string]string{"referenceId": "target"})
+	overQuota := serve(http.MethodPatch, "/api/files/"+source.ID, map[string]string{"referenceId": "full"})
+
+	// Assert
+	require.Equal(t, http.StatusBadRequest, missingReference)
+	require.Equal(t, http.StatusBadRequest, pathName)
+	require.Equal(t, http.StatusNotFound, unknownFile)
+	require.Equal(t, http.StatusRequestEntityTooLarge, overQuota)
+	require.Len(t, listAttachments(t, ctx, useCase, "source"), 1)
+}
+
+func TestObjectsOfCopiesAreNotStoredObjects(t *testing.T) {
+	// Act
+	_, ok := files.ParseObjectName("tenant1/objects/file-id/file.txt")
+
+	// Assert
+	require.False(t, ok)
+}
+
+func createFilesRouter(useCase files.UseCase) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	files.AppendFileRoutes(router.Group("/api"), createStubLogger(), useCase)
+	return router
+}
+
+func makeJsonRequest(t *testing.T, method, path string, body interface{}) *http.Request {
+	content, err := json.Marshal(body)
+	requireNotError(t, err)
+	req := httptest.NewRequest(method, path, bytes.NewReader(content))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func listAttachments(t *testing.T, ctx context.Context, useCase files.UseCase, referenceID string) []models.Attachment {
+	attachments, err := useCase.ListBy(ctx, "tenant1", models.ListFilesQuery{ReferenceID: referenceID})
+	requireNotError(t, err)
+	if attachments == nil {
+		return nil
+	}
+	return *attachments
+}
+
+func downloadText(t *testing.T, ctx context.Context, useCase files.UseCase, fileID string) string {
+	content, err := useCase.DownloadFile(ctx, "tenant1", fileID)
+	requireNotError(t, err)
+	defer content.Content.Close()
+	var text strings.Builder
+	_, err = io.Copy(&text, content.Content)
+	requireNotError(t, err)
+	return text.String()
+}
@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/config"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/adapters"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/tests/doubles"
+)
+
+func TestIdenticalUploadsAreStoredOnce(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	useCase := createUseCase(t, ctx, storage, quotas(models.QuotaLimits{}), files.Deduplication(adapters.NewInMemoryContentRepository()))
+
+	// Act
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "invoice.pdf", "Hello!"))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "customer", "copy-of-invoice.pdf", "Hello!"))
+	requireNotError(t, uploadText(ctx, useCase, "tenant2", "order", "invoice.pdf", "Hello!"))
+
+	// Assert
+	require.Len(t, storage.Files, 2)
+	order := listAttachments(t, ctx, useCase, "order")
+	customer := listAttachments(t, ctx, useCase, "customer")
+	require.Equal(t, "invoice.pdf", order[0].FileName)
+	require.Equal(t, "copy-of-invoice.pdf", customer[0].FileName)
+	require.Equal(t, "Hello!", downloadText(t, ctx, useCase, customer[0].ID))
+	usage, err := useCase.Usage(ctx, "tenant1", "")
+	requireNotError(t, err)
+	require.Equal(t, int64(12), usage.Bytes)
+}
+
+func TestSharedContentIsRemovedWithItsLastFile(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	useCase := createUseCase(t, ctx, storage, quotas(models.QuotaLimits{}), files.Deduplication(adapters.NewInMemoryContentRepository()))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "invoice.pdf", "Hello!"))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "customer", "invoice.pdf", "Hello!"))
+	order := listAttachments(t, ctx, useCase, "order")[0]
+	customer := listAttachments(t, ctx, useCase, "customer")[0]
+	copied, err := useCase.CopyFile(ctx, "tenant1", models.CopyFileCommand{FileID: order.ID, ReferenceID: "archive", FileName: "renamed.pdf"})
+	requireNotError(t, err)
+
+	// Act
+	requireNotError(t, useCase.DeleteFile(ctx, "tenant1", order.ID))
+	requireNotError(t, useCase.DeleteFile(ctx, "tenant1", customer.ID))
+	filesBeforeLast := len(storage.Files)
+	contentOfLast := downloadText(t, ctx, useCase, copied.ID)
+	requireNotError(t, useCase.DeleteFile(ctx, "tenant1", copied.ID))
+
+	// Assert
+	require.Equal(t, 1, filesBeforeLast)
+	require.Equal(t, "Hello!", contentOfLast)
+	require.Empty(t, storage.Files)
+}
+
+func TestConcurrentUploadsAndDeletesKeepSharedContent(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	useCase := createUseCase(t, ctx, storage, quotas(models.QuotaLimits{}), files.Deduplication(adapters.NewInMemoryContentRepository()))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "kept", "invoice.pdf", "Hello!"))
+	var wg sync.WaitGroup
+
+	// Act
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			referenceID := fmt.Sprintf("reference-%d", i)
+			if err := uploadText(ctx, useCase, "tenant1", referenceID, "invoice.pdf", "Hello!"); err != nil {
+				return
+			}
+			for _, attachment := range listAttachments(t, ctx, useCase, referenceID) {
+				_ = useCase.DeleteFile(ctx, "tenant1", attachment.ID)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Assert
+	kept := listAttachments(t, ctx, useCase, "kept")
+	require.Len(t, storage.Files, 1)
+	require.Equal(t, "Hello!", downloadText(t, ctx, useCase, kept[0].ID))
+	requireNotError(t, useCase.DeleteFile(ctx, "tenant1", kept[0].ID))
+	require.Empty(t, storage.Files)
+}
+
+func TestInfectedDuplicateLeavesSharedContent(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	storage := doubles.NewInMemoryFileStorage()
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	pipeline := files.NewScanPipeline(adapters.NewFakeScanner(), storage, repository, createStubLogger(), 1, 10, time.Millisecond, 10)
+	pipeline.Start(ctx)
+	useCase, err := files.NewDefaultFilesUseCase(storage, repository, adapters.NewGuidBasedIdGenerator(),
+		config.GCloudStorage{UrlExpirationTime: 15}, nil, files.Scanning(pipeline), files.Deduplication(adapters.NewInMemoryContentRepository()))
+	requireNotError(t, err)
+
+	// Act
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "virus.txt", eicar))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "customer", "virus.txt", eicar))
+
+	// Assert
+	sum := sha256.Sum256([]byte(eicar))
+	sharedObject := "contents/" + hex.EncodeToString(sum[:]) + ".txt"
+	require.Eventually(t, func() bool {
+		_, err := storage.ReadFile(ctx, "tenant1", sharedObject)
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+	for _, referenceID := range []string{"order", "customer"} {
+		attachments, err := useCase.ListBy(ctx, "tenant1", models.ListFilesQuery{ReferenceID: referenceID, IncludeUnscanned: true})
+		requireNotError(t, err)
+		require.Equal(t, models.FileStatusInfected, (*attachments)[0].Status)
+		_, err = storage.ReadFile(ctx, "tenant1", "quarantine/objects/"+(*attachments)[0].ID+"/virus.txt")
+		requireNotError(t, err)
+	}
+}
+
+func TestObjectsOfSharedContentAreNotStoredObjects(t *testing.T) {
+	// Act
+	_, ok := files.ParseObjectName("tenant1/contents/2cf24dba5fb0a30e26e83b2ac5b9e29e.pdf")
+
+	// Assert
+	require.False(t, ok)
+}
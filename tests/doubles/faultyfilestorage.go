@@ -0,0 +1,140 @@
+package doubles
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+)
+
+// FaultyFileStorage injects faults into calls to the wrapped storage. Queued faults are
+// returned one per call, either instead of calling the storage or, like a lost response,
+// after the call went through; Delay holds every call until it passes or the context is done.
+type FaultyFileStorage struct {
+	next   ports.FileStorage
+	mu     sync.Mutex
+	faults []fault
+	delay  time.Duration
+	calls  int
+}
+
+type fault struct {
+	err       error
+	afterCall bool
+}
+
+func NewFaultyFileStorage(next ports.FileStorage) *FaultyFileStorage {
+	return &FaultyFileStorage{next: next}
+}
+
+func (storage *FaultyFileStorage) FailNext(faults ...error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	for _, err := range faults {
+		storage.faults = append(storage.faults, fault{err: err})
+	}
+}
+
+// FailNextAfterCall lets the next calls reach the storage and then returns the faults instead
+// of their results.
+func (storage *FaultyFileStorage) FailNextAfterCall(faults ...error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	for _, err := range faults {
+		storage.faults = append(storage.faults, fault{err: err, afterCall: true})
+	}
+}
+
+func (storage *FaultyFileStorage) SetDelay(delay time.Duration) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	storage.delay = delay
+}
+
+func (storage *FaultyFileStorage) Calls() int {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	return storage.calls
+}
+
+func (storage *FaultyFileStorage) UploadFile(ctx context.Context, tenant, fileName string, file []byte) error {
+	return storage.call(ctx, func() error {
+		return storage.next.UploadFile(ctx, tenant, fileName, file)
+	})
+}
+
+func (storage *FaultyFileStorage) ReadFile(ctx context.Context, tenant, fileName string) (io.ReadCloser, error) {
+	var content io.ReadCloser
+	err := storage.call(ctx, func() error {
+		var err error
+		content, err = storage.next.ReadFile(ctx, tenant, fileName)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+func (storage *FaultyFileStorage) GetExpiringUrl(tenant, fileName string, options models.SignedUrlOptions) (string, error) {
+	return storage.next.GetExpiringUrl(tenant, fileName, options)
+}
+
+func (storage *FaultyFileStorage) DeleteFile(ctx context.Context, tenant, fileName string) error {
+	return storage.call(ctx, func() error {
+		return storage.next.DeleteFile(ctx, tenant, fileName)
+	})
+}
+
+func (storage *FaultyFileStorage) CopyFile(ctx context.Context, tenant, sourceName, targetName string) error {
+	return storage.call(ctx, func() error {
+		return storage.next.CopyFile(ctx, tenant, sourceName, targetName)
+	})
+}
+
+func (storage *FaultyFileStorage) SetMetadata(ctx context.Context, tenant, fileName string, metadata map[string]string) error {
+	return storage.call(ctx, func() error {
+		return storage.next.SetMetadata(ctx, tenant, fileName, metadata)
+	})
+}
+
+func (storage *FaultyFileStorage) ReplaceFile(ctx context.Context, tenant, fileName string, file []byte) error {
+	replacer, ok := storage.next.(ports.FileReplacer)
+	if !ok {
+		return ports.ErrReplaceNotSupported
+	}
+	return storage.call(ctx, func() error {
+		return replacer.ReplaceFile(ctx, tenant, fileName, file)
+	})
+}
+
+func (storage *FaultyFileStorage) call(ctx context.Context, op func() error) error {
+	storage.mu.Lock()
+	storage.calls++
+	delay := storage.delay
+	var next fault
+	if len(storage.faults) > 0 {
+		next, storage.faults = storage.faults[0], storage.faults[1:]
+	}
+	storage.mu.Unlock()
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if next.err != nil && !next.afterCall {
+		return next.err
+	}
+	err := op()
+	if next.err != nil {
+		return next.err
+	}
+	return err
+}
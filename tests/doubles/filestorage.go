@@ -0,0 +1,107 @@
+package doubles
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+)
+
+type InMemoryFileStorage struct {
+	mu               sync.Mutex
+	Files            map[string][]byte
+	Metadata         map[string]map[string]string
+	Holds            map[string]bool
+	SignedUrlOptions []models.SignedUrlOptions
+}
+
+func NewInMemoryFileStorage() *InMemoryFileStorage {
+	return &InMemoryFileStorage{Files: make(map[string][]byte), Metadata: make(map[string]map[string]string), Holds: make(map[string]bool)}
+}
+
+func (storage *InMemoryFileStorage) UploadFile(_ context.Context, tenant, fileName string, file []byte) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	storage.Files[fmt.Sprintf("%s/%s", tenant, fileName)] = file
+	return nil
+}
+
+func (storage *InMemoryFileStorage) ReadFile(_ context.Context, tenant, fileName string) (io.ReadCloser, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	file, ok := storage.Files[fmt.Sprintf("%s/%s", tenant, fileName)]
+	if !ok {
+		return nil, fmt.Errorf("file %s/%s doesn't exist", tenant, fileName)
+	}
+	return io.NopCloser(bytes.NewReader(file)), nil
+}
+
+func (storage *InMemoryFileStorage) GetExpiringUrl(tenant, fileName string, options models.SignedUrlOptions) (string, error) {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	storage.SignedUrlOptions = append(storage.SignedUrlOptions, options)
+	return fmt.Sprintf("memory://%s/%s", tenant, fileName), nil
+}
+
+func (storage *InMemoryFileStorage) DeleteFile(_ context.Context, tenant, fileName string) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	if storage.Holds[fmt.Sprintf("%s/%s", tenant, fileName)] {
+		return fmt.Errorf("file %s/%s is held", tenant, fileName)
+	}
+	delete(storage.Files, fmt.Sprintf("%s/%s", tenant, fileName))
+	delete(storage.Metadata, fmt.Sprintf("%s/%s", tenant, fileName))
+	return nil
+}
+
+func (storage *InMemoryFileStorage) CopyFile(_ context.Context, tenant, sourceName, targetName string) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	file, ok := storage.Files[fmt.Sprintf("%s/%s", tenant, sourceName)]
+	if !ok {
+		return fmt.Errorf("file %s/%s doesn't exist", tenant, sourceName)
+	}
+	storage.Files[fmt.Sprintf("%s/%s", tenant, targetName)] = file
+	if metadata, ok := storage.Metadata[fmt.Sprintf("%s/%s", tenant, sourceName)]; ok {
+		storage.Metadata[fmt.Sprintf("%s/%s", tenant, targetName)] = metadata
+	}
+	return nil
+}
+
+func (storage *InMemoryFileStorage) SetMetadata(_ context.Context, tenant, fileName string, metadata map[string]string) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	if _, ok := storage.Files[fmt.Sprintf("%s/%s", tenant, fileName)]; !ok {
+		return fmt.Errorf("file %s/%s doesn't exist", tenant, fileName)
+	}
+	storage.Metadata[fmt.Sprintf("%s/%s", tenant, fileName)] = metadata
+	return nil
+}
+
+// ReplaceFile overwrites the content and keeps the metadata of the file.
+func (storage *InMemoryFileStorage) ReplaceFile(_ context.Context, tenant, fileName string, file []byte) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	if _, ok := storage.Files[fmt.Sprintf("%s/%s", tenant, fileName)]; !ok {
+		return fmt.Errorf("file %s/%s doesn't exist", tenant, fileName)
+	}
+	storage.Files[fmt.Sprintf("%s/%s", tenant, fileName)] = file
+	return nil
+}
+
+func (storage *InMemoryFileStorage) SetHold(_ context.Context, tenant, fileName string, hold bool) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	if _, ok := storage.Files[fmt.Sprintf("%s/%s", tenant, fileName)]; !ok {
+		return fmt.Errorf("file %s/%s doesn't exist", tenant, fileName)
+	}
+	if hold {
+		storage.Holds[fmt.Sprintf("%s/%s", tenant, fileName)] = true
+	} else {
+		delete(storage.Holds, fmt.Sprintf("%s/%s", tenant, fileName))
+	}
+	return nil
+}
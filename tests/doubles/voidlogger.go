@@ -1,14 +1,26 @@
 package doubles
 
+import (
+	"context"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/logger"
+)
+
 type VoidLogger struct{}
 
 func (logger *VoidLogger) Debug(message interface{}, args ...interface{}) {
 }
-func (logger *VoidLogger) Info(message string, args ...interface{}) {
+func (logger *VoidLogger) Info(message interface{}, args ...interface{}) {
 }
-func (logger *VoidLogger) Warn(message string, args ...interface{}) {
+func (logger *VoidLogger) Warn(message interface{}, args ...interface{}) {
 }
 func (logger *VoidLogger) Error(message interface{}, args ...interface{}) {
 }
 func (logger *VoidLogger) Fatal(message interface{}, args ...interface{}) {
 }
+func (logger *VoidLogger) With(fields ...logger.Field) logger.Logger {
+	return logger
+}
+func (logger *VoidLogger) Ctx(ctx context.Context) logger.Logger {
+	return logger
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/adapters"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/encryption"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/tests/doubles"
+)
+
+func TestEnvelopeEncryptedFileCanBeReadAfterKeyRotation(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	fileContent := []byte("Hello!")
+	oldKey := bytes.Repeat([]byte{1}, encryption.KeySize)
+	newKey := bytes.Repeat([]byte{2}, encryption.KeySize)
+	oldKeyring, err := encryption.NewKeyring("k1", map[string][]byte{"k1": oldKey})
+	requireNotError(t, err)
+	rotatedKeyring, err := encryption.NewKeyring("k2", map[string][]byte{"k1": oldKey, "k2": newKey})
+	requireNotError(t, err)
+	inner := doubles.NewInMemoryFileStorage()
+	err = adapters.NewEnvelopeEncryptingFileStorage(inner, map[string]*encryption.Keyring{"tenant": oldKeyring}, adapters.DefaultMaxEnvelopeFileSize).
+		UploadFile(ctx, "tenant", "file.txt", fileContent)
+	requireNotError(t, err)
+	requireNotError(t, inner.SetMetadata(ctx, "tenant", "file.txt", map[string]string{"language": "en"}))
+	storage := adapters.NewEnvelopeEncryptingFileStorage(inner, map[string]*encryption.Keyring{"tenant": rotatedKeyring}, adapters.DefaultMaxEnvelopeFileSize)
+
+	// Act
+	rotated, err := storage.RotateEncryptionKey(ctx, "tenant", "file.txt")
+	requireNotError(t, err)
+	reader, err := storage.ReadFile(ctx, "tenant", "file.txt")
+	requireNotError(t, err)
+	content, err := io.ReadAll(reader)
+	requireNotError(t, err)
+	_, urlErr := storage.GetExpiringUrl("tenant", "file.txt", models.SignedUrlOptions{})
+
+	// Assert
+	require.True(t, rotated)
+	require.Equal(t, fileContent, content)
+	require.NotContains(t, string(inner.Files["tenant/file.txt"]), string(fileContent))
+	_, err = encryption.Open(oldKeyring, inner.Files["tenant/file.txt"])
+	require.Error(t, err)
+	require.ErrorIs(t, urlErr, ports.ErrSignedUrlNotSupported)
+	require.Equal(t, map[string]string{"language": "en"}, inner.Metadata["tenant/file.txt"])
+}
+
+func TestFailedKeyRotationKeepsTheOriginalFile(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	fileContent := []byte("Hello!")
+	oldKey := bytes.Repeat([]byte{1}, encryption.KeySize)
+	oldKeyring, err := encryption.NewKeyring("k1", map[string][]byte{"k1": oldKey})
+	requireNotError(t, err)
+	rotatedKeyring, err := encryption.NewKeyring("k2", map[string][]byte{"k1": oldKey, "k2": bytes.Repeat([]byte{2}, encryption.KeySize)})
+	requireNotError(t, err)
+	inner := doubles.NewInMemoryFileStorage()
+	requireNotError(t, adapters.NewEnvelopeEncryptingFileStorage(inner, map[string]*encryption.Keyring{"tenant": oldKeyring}, adapters.DefaultMaxEnvelopeFileSize).
+		UploadFile(ctx, "tenant", "file.txt", fileContent))
+	requireNotError(t, inner.SetMetadata(ctx, "tenant", "file.txt", map[string]string{"language": "en"}))
+	faulty := doubles.NewFaultyFileStorage(inner)
+	storage := adapters.NewEnvelopeEncryptingFileStorage(faulty, map[string]*encryption.Keyring{"tenant": rotatedKeyring}, adapters.DefaultMaxEnvelopeFileSize)
+	// the read of the envelope succeeds, the upload of the rewrapped one fails
+	faulty.FailNext(nil, errors.New("connection reset"))
+
+	// Act
+	rotated, rotateErr := storage.RotateEncryptionKey(ctx, "tenant", "file.txt")
+	reader, err := storage.ReadFile(ctx, "tenant", "file.txt")
+	requireNotError(t, err)
+	content, err := io.ReadAll(reader)
+	requireNotError(t, err)
+
+	// Assert
+	require.Error(t, rotateErr)
+	require.False(t, rotated)
+	require.Equal(t, fileContent, content)
+	_, err = encryption.Open(oldKeyring, inner.Files["tenant/file.txt"])
+	requireNotError(t, err)
+	require.Equal(t, map[string]string{"language": "en"}, inner.Metadata["tenant/file.txt"])
+}
+
+func TestEnvelopeEncryptedFilesAreCappedInSize(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	keyring, err := encryption.NewKeyring("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, encryption.KeySize)})
+	requireNotError(t, err)
+	inner := doubles.NewInMemoryFileStorage()
+	requireNotError(t, adapters.NewEnvelopeEncryptingFileStorage(inner, map[string]*encryption.Keyring{"tenant": keyring}, 4096).
+		UploadFile(ctx, "tenant", "stored.txt", bytes.Repeat([]byte("a"), 4096)))
+	storage := adapters.NewEnvelopeEncryptingFileStorage(inner, map[string]*encryption.Keyring{"tenant": keyring}, 16)
+
+	// Act
+	uploadErr := storage.UploadFile(ctx, "tenant", "file.txt", bytes.Repeat([]byte("a"), 17))
+	_, readErr := storage.ReadFile(ctx, "tenant", "stored.txt")
+	plainErr := storage.UploadFile(ctx, "other", "file.txt", bytes.Repeat([]byte("a"), 17))
+
+	// Assert
+	require.ErrorIs(t, uploadErr, ports.ErrFileTooLarge)
+	require.ErrorIs(t, readErr, ports.ErrFileTooLarge)
+	require.NoError(t, plainErr)
+}
@@ -39,7 +39,7 @@ func TestPingRoute(t *testing.T) {
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Second)
 	defer cancel()
-	router, err := app.CreateHttpHandlers(ctx, createStubLogger(), appConfig)
+	router, err := app.CreateHttpHandlers(ctx, createStubLogger(), appConfig, nil, nil)
 	if err != nil {
 		t.Fail()
 	}
@@ -63,7 +63,7 @@ func TestCanUploadFileAndDownloadFromStorageByUrl(t *testing.T) {
 	setupGCSEmulator(t, ctx, appConfig)
 	createRequest := makeUploadFileRequest(t, referenceObjectId, filename, textContent)
 	getAttachmentsRequest := makeGetAttachmentsRequest(t, referenceObjectId)
-	router, err := app.CreateHttpHandlers(ctx, createStubLogger(), appConfig)
+	router, err := app.CreateHttpHandlers(ctx, createStubLogger(), appConfig, nil, nil)
 	if err != nil {
 		t.Fail()
 	}
@@ -106,7 +106,7 @@ func TestCanRemoveFile(t *testing.T) {
 	setupGCSEmulator(t, ctx, appConfig)
 	createRequest := makeUploadFileRequest(t, referenceObjectId, filename, textContent)
 	getAttachmentsRequest := makeGetAttachmentsRequest(t, referenceObjectId)
-	router, err := app.CreateHttpHandlers(ctx, createStubLogger(), appConfig)
+	router, err := app.CreateHttpHandlers(ctx, createStubLogger(), appConfig, nil, nil)
 	if err != nil {
 		t.Fail()
 	}
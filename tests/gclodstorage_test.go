@@ -2,6 +2,11 @@ package tests
 
 import (
 	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"net/http"
@@ -31,17 +36,16 @@ func TestCanUploadFileAndDownloadItBySignedUrl(t *testing.T) {
 	defer cancel()
 
 	client := createGCloudStorageClient(t, ctx)
-	service := gcloudstorage.NewGCloudStorageService(client, projectName, bucketName, &gcloudstorage.GCloudAuthCredentials{
-		AccessID:   "xxx@developer.gserviceaccount.com",
-		PrivateKey: pkey,
-	})
+	signer, err := gcloudstorage.NewPrivateKeySigner("xxx@developer.gserviceaccount.com", pkey)
+	requireNotError(t, err)
+	service := gcloudstorage.NewGCloudStorageService(client, projectName, bucketName, signer, gcloudstorage.Insecure(true))
 
 	// Act
 	err = service.CreateBucket(ctx)
 	requireNotError(t, err)
 	err = service.UploadFile(ctx, tenantName, fileName, fileContent)
 	requireNotError(t, err)
-	url, err := service.MakeSignedUrl(tenantName, fileName, 15, true)
+	url, err := service.MakeSignedUrl(tenantName, fileName, gcloudstorage.SignedUrlOptions{Expiry: 15 * time.Minute})
 	requireNotError(t, err)
 
 	// Assert
@@ -80,6 +84,27 @@ func TestCanRemoveFileFromStorage(t *testing.T) {
 	require.Equal(t, false, resp)
 }
 
+func TestPrivateKeySignerProducesVerifiableSignature(t *testing.T) {
+	// Arrange
+	pkey, err := os.ReadFile("./data/key")
+	requireNotError(t, err)
+	block, _ := pem.Decode(pkey)
+	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	requireNotError(t, err)
+	signer, err := gcloudstorage.NewPrivateKeySigner("xxx@developer.gserviceaccount.com", pkey)
+	requireNotError(t, err)
+	payload := []byte("GOOG4-RSA-SHA256")
+
+	// Act
+	signature, err := signer.SignBytes(payload)
+	requireNotError(t, err)
+
+	// Assert
+	digest := sha256.Sum256(payload)
+	require.NoError(t, rsa.VerifyPKCS1v15(&privateKey.PublicKey, crypto.SHA256, digest[:], signature))
+	require.Equal(t, "xxx@developer.gserviceaccount.com", signer.AccessID())
+}
+
 func requireNotError(t *testing.T, err error) {
 	if err != nil {
 		t.Log(err)
@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	httpRouter "github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/http"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/health"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/httpserver"
+)
+
+type pingerFunc func(ctx context.Context) error
+
+func (ping pingerFunc) Ping(ctx context.Context) error {
+	return ping(ctx)
+}
+
+func TestReadinessReportsEachDependency(t *testing.T) {
+	// Arrange
+	readiness := health.NewReadiness()
+	readiness.SetReady(true)
+	checker := health.NewChecker(50*time.Millisecond, readiness)
+	checker.Register("storage", pingerFunc(func(ctx context.Context) error { return nil }))
+	checker.Register("repository", pingerFunc(func(ctx context.Context) error { return errors.New("connection refused") }))
+	checker.Register("antivirus", pingerFunc(func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}))
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	httpRouter.AppendHealthRoutes(router, checker)
+
+	// Act
+	liveness := httptest.NewRecorder()
+	router.ServeHTTP(liveness, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	started := time.Now()
+	readinessRecorder := httptest.NewRecorder()
+	router.ServeHTTP(readinessRecorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	// Assert
+	require.Less(t, time.Since(started), 500*time.Millisecond)
+	require.Equal(t, http.StatusOK, liveness.Code)
+	require.Equal(t, http.StatusServiceUnavailable, readinessRecorder.Code)
+	var report health.Report
+	requireNotError(t, json.Unmarshal(readinessRecorder.Body.Bytes(), &report))
+	require.Equal(t, health.StatusDown, report.Status)
+	require.True(t, report.Ready)
+	require.Equal(t, health.StatusUp, report.Checks["storage"].Status)
+	require.Equal(t, "connection refused", report.Checks["repository"].Error)
+	require.Equal(t, health.StatusDown, report.Checks["antivirus"].Status)
+}
+
+func TestServerIsNotReadyOnceShuttingDown(t *testing.T) {
+	// Arrange
+	readiness := health.NewReadiness()
+	checker := health.NewChecker(time.Second, readiness)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	httpRouter.AppendHealthRoutes(router, checker)
+	server := httpserver.New(router, httpserver.Port("0"), httpserver.Readiness(readiness))
+	ready := httptest.NewRecorder()
+	router.ServeHTTP(ready, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	// Act
+	requireNotError(t, server.Shutdown())
+
+	// Assert
+	require.Equal(t, http.StatusOK, ready.Code)
+	notReady := httptest.NewRecorder()
+	router.ServeHTTP(notReady, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, http.StatusServiceUnavailable, notReady.Code)
+}
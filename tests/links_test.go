@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	auditModels "github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/auditlog/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/audit"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/tests/doubles"
+)
+
+func TestLinkedFileIsListedUnderEveryReference(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	useCase := createUseCase(t, ctx, storage, quotas(models.QuotaLimits{}))
+	router := createFilesRouter(useCase)
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "invoice.pdf", "Hello!"))
+	file := listAttachments(t, ctx, useCase, "order")[0]
+
+	// Act
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/api/files/"+file.ID+"/references/customer", nil))
+	requireNotError(t, useCase.LinkFile(ctx, "tenant1", file.ID, "customer"))
+
+	// Assert
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+	require.Equal(t, file.ID, listAttachments(t, ctx, useCase, "order")[0].ID)
+	linked := listAttachments(t, ctx, useCase, "customer")
+	require.Len(t, linked, 1)
+	require.Equal(t, file.ID, linked[0].ID)
+	require.Len(t, storage.Files, 1)
+	usage, err := useCase.Usage(ctx, "tenant1", "customer")
+	requireNotError(t, err)
+	require.Equal(t, 0, usage.Reference.Files)
+	require.Equal(t, 1, usage.Files)
+}
+
+func TestFileIsDeletedWithItsLastLink(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	useCase := createUseCase(t, ctx, storage, quotas(models.QuotaLimits{}))
+	router := createFilesRouter(useCase)
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "invoice.pdf", "Hello!"))
+	file := listAttachments(t, ctx, useCase, "order")[0]
+	requireNotError(t, useCase.LinkFile(ctx, "tenant1", file.ID, "customer"))
+	unlink := func(referenceID string) int {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/api/files/"+file.ID+"/references/"+referenceID, nil))
+		return recorder.Code
+	}
+
+	// Act
+	ownerUnlinked := unlink("order")
+	filesAfterOwner := len(storage.Files)
+	customerUsage, err := useCase.Usage(ctx, "tenant1", "customer")
+	requireNotError(t, err)
+	lastUnlinked := unlink("customer")
+	unknownLink := unlink("customer")
+
+	// Assert
+	require.Equal(t, http.StatusNoContent, ownerUnlinked)
+	require.Equal(t, 1, filesAfterOwner)
+	require.Equal(t, 1, customerUsage.Reference.Files)
+	require.Equal(t, http.StatusNoContent, lastUnlinked)
+	require.Empty(t, storage.Files)
+	require.Empty(t, listAttachments(t, ctx, useCase, "customer"))
+	require.Equal(t, http.StatusNotFound, unknownLink)
+	usage, err := useCase.Usage(ctx, "tenant1", "")
+	requireNotError(t, err)
+	require.Equal(t, 0, usage.Files)
+}
+
+func TestUnlinkingUnknownReferenceKeepsFile(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	useCase := createUseCase(t, ctx, storage, quotas(models.QuotaLimits{}))
+	router := createFilesRouter(useCase)
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "invoice.pdf", "Hello!"))
+	file := listAttachments(t, ctx, useCase, "order")[0]
+
+	// Act
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/api/files/"+file.ID+"/references/customer", nil))
+
+	// Assert
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	require.Len(t, listAttachments(t, ctx, useCase, "order"), 1)
+	require.Len(t, storage.Files, 1)
+}
+
+func TestDeletingLinkedFileRemovesItFromEveryReference(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	useCase := createUseCase(t, ctx, storage, quotas(models.QuotaLimits{}))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "invoice.pdf", "Hello!"))
+	file := listAttachments(t, ctx, useCase, "order")[0]
+	requireNotError(t, useCase.LinkFile(ctx, "tenant1", file.ID, "customer"))
+
+	// Act
+	err := useCase.DeleteFile(ctx, "tenant1", file.ID)
+
+	// Assert
+	requireNotError(t, err)
+	require.Empty(t, listAttachments(t, ctx, useCase, "order"))
+	require.Empty(t, listAttachments(t, ctx, useCase, "customer"))
+	require.Empty(t, storage.Files)
+}
+
+func TestUnlinkIsReportedOnlyOnceTheFileIsDeleted(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	inner := doubles.NewInMemoryFileStorage()
+	storage := doubles.NewFaultyFileStorage(inner)
+	auditUseCase := createAuditUseCase(t, ctx, 0)
+	useCase := createUseCase(t, ctx, storage, files.Audit(auditUseCase))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "invoice.pdf", "Hello!"))
+	file := listAttachments(t, ctx, useCase, "order")[0]
+	storage.FailNext(errors.New("storage unavailable"))
+
+	// Act
+	err := useCase.UnlinkFile(ctx, "tenant1", file.ID, "order")
+	entries, listErr := auditUseCase.ListBy(ctx, "tenant1", auditModels.ListEntriesQuery{})
+	requireNotError(t, listErr)
+
+	// Assert
+	require.Error(t, err)
+	for _, entry := range *entries {
+		require.NotEqual(t, audit.ActionUnlink, entry.Action)
+		require.NotEqual(t, audit.ActionDelete, entry.Action)
+	}
+}
@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	httpRouter "github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/http"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/logger"
+)
+
+func TestLoggerWritesStructuredEntriesAtTheirLevel(t *testing.T) {
+	// Arrange
+	var output bytes.Buffer
+	log := logger.NewZerologLogger("info", logger.Output(&output))
+	ctx := logger.ContextWithFields(context.Background(), logger.String("request_id", "request-1"))
+
+	// Act
+	log.Debug("hidden")
+	log.Ctx(ctx).Warn(errors.New("queue is full"), "files - uploadFile", logger.Int("queued", 3))
+	log.Error("failed", logger.Err(errors.New("boom")))
+
+	// Assert
+	entries := readLogEntries(t, &output)
+	require.Len(t, entries, 2)
+	require.Equal(t, "warn", entries[0]["level"])
+	require.Equal(t, "queue is full", entries[0]["message"])
+	require.Equal(t, "files - uploadFile", entries[0]["source"])
+	require.Equal(t, "request-1", entries[0]["request_id"])
+	require.Equal(t, float64(3), entries[0]["queued"])
+	require.Contains(t, entries[0]["caller"], "logger_test.go")
+	require.Equal(t, "error", entries[1]["level"])
+	require.Equal(t, "boom", entries[1]["error"])
+	require.NotContains(t, entries[1], "request_id")
+}
+
+func TestAccessLogIncludesRequestContext(t *testing.T) {
+	// Arrange
+	var output bytes.Buffer
+	log := logger.NewZerologLogger("info", logger.Output(&output))
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(httpRouter.RequestID(), httpRouter.AccessLog(log), httpRouter.Recovery(log))
+	routerGroup := router.Group("/api")
+	routerGroup.Use(httpRouter.Actor(nil))
+	routerGroup.GET("/files/:id", func(ginCtx *gin.Context) {
+		ginCtx.Status(http.StatusNotFound)
+	})
+	routerGroup.GET("/panic", func(ginCtx *gin.Context) {
+		panic("unexpected")
+	})
+	request := httptest.NewRequest(http.MethodGet, "/api/files/1", nil)
+	request.Header.Set(httpRouter.HeaderRequestID, "request-1")
+
+	// Act
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	panicRecorder := httptest.NewRecorder()
+	router.ServeHTTP(panicRecorder, httptest.NewRequest(http.MethodGet, "/api/panic", nil))
+
+	// Assert
+	require.Equal(t, "request-1", recorder.Header().Get(httpRouter.HeaderRequestID))
+	require.Equal(t, http.StatusInternalServerError, panicRecorder.Code)
+	entries := readLogEntries(t, &output)
+	require.Len(t, entries, 3)
+	require.Equal(t, "warn", entries[0]["level"])
+	require.Equal(t, "request-1", entries[0]["request_id"])
+	require.Equal(t, "tenant1", entries[0]["tenant"])
+	require.Equal(t, "UserId", entries[0]["user"])
+	require.Equal(t, "/api/files/:id", entries[0]["route"])
+	require.Equal(t, float64(http.StatusNotFound), entries[0]["status"])
+	require.Equal(t, "panic: unexpected", entries[1]["message"])
+	require.Equal(t, panicRecorder.Header().Get(httpRouter.HeaderRequestID), entries[1]["request_id"])
+	require.Equal(t, "error", entries[2]["level"])
+}
+
+func readLogEntries(t *testing.T, output *bytes.Buffer) []map[string]interface{} {
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		requireNotError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
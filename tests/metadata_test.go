@@ -0,0 +1,167 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/tests/doubles"
+)
+
+func TestUploadedLabelsAreStoredOnFileAndObject(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	useCase := createUseCase(t, ctx, storage, quotas(models.QuotaLimits{}))
+	router := createFilesRouter(useCase)
+
+	// Act
+	invalid := httptest.NewRecorder()
+	router.ServeHTTP(invalid, makeLabelledUploadRequest(t, "order", "invoice.pdf", url.Values{
+		"metadata[documentType]": {"invoice"},
+	}))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, makeLabelledUploadRequest(t, "order", "invoice.pdf", url.Values{
+		"tags":                    {"signed", "urgent", "signed"},
+		"metadata[document-type]": {"invoice"},
+		"metadata[language]":      {"en"},
+	}))
+
+	// Assert
+	require.Equal(t, http.StatusBadRequest, invalid.Code)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+	file := listAttachments(t, ctx, useCase, "order")[0]
+	require.Equal(t, []string{"signed", "urgent"}, file.Tags)
+	require.Equal(t, map[string]string{"document-type": "invoice", "language": "en"}, file.Metadata)
+	require.Equal(t, map[string]string{"document-type": "invoice", "language": "en", "tags": "signed,urgent"}, storage.Metadata["tenant1/invoice.pdf"])
+}
+
+func TestMetadataIsMergedAndTagsReplacedOnPatch(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	useCase := createUseCase(t, ctx, storage, quotas(models.QuotaLimits{}))
+	router := createFilesRouter(useCase)
+	requireNotError(t, useCase.UploadFile(ctx, "tenant1", models.UploadFileCommand{
+		FileName:    "invoice.pdf",
+		ReferenceID: "order",
+		File:        bytes.NewReader([]byte("Hello!")),
+		Metadata:    map[string]string{"document-type": "invoice", "language": "en"},
+		Tags:        []string{"draft"},
+	}))
+	file := listAttachments(t, ctx, useCase, "order")[0]
+
+	// Act
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, makeJsonRequest(t, http.MethodPatch, "/api/files/"+file.ID+"/metadata", map[string]interface{}{
+		"metadata": map[string]string{"language": "", "customer": "acme"},
+		"tags":     []string{"signed"},
+	}))
+
+	// Assert
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var updated models.Attachment
+	requireNotError(t, json.Unmarshal(recorder.Body.Bytes(), &updated))
+	require.Equal(t, map[string]string{"document-type": "invoice", "customer": "acme"}, updated.Metadata)
+	require.Equal(t, []string{"signed"}, updated.Tags)
+	require.Equal(t, map[string]string{"document-type": "invoice", "customer": "acme", "tags": "signed"}, storage.Metadata["tenant1/invoice.pdf"])
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, makeJsonRequest(t, http.MethodPatch, "/api/files/"+file.ID+"/metadata", map[string]interface{}{"tags": []string{"Not A Tag"}}))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, makeJsonRequest(t, http.MethodPatch, "/api/files/unknown/metadata", map[string]interface{}{}))
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestFilesAreSearchedByTagsAndMetadataWithinTenant(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	useCase := createUseCase(t, ctx, storage, quotas(models.QuotaLimits{}))
+	router := createFilesRouter(useCase)
+	upload := func(tenant, referenceID, fileName, language string, tags ...string) {
+		requireNotError(t, useCase.UploadFile(ctx, tenant, models.UploadFileCommand{
+			FileName:    fileName,
+			ReferenceID: referenceID,
+			File:        bytes.NewReader([]byte(fileName)),
+			Metadata:    map[string]string{"language": language},
+			Tags:        tags,
+		}))
+	}
+	upload("tenant1", "order", "invoice-en.pdf", "en", "invoice", "signed")
+	upload("tenant1", "customer", "contract-en.pdf", "en", "contract", "signed")
+	upload("tenant1", "order", "invoice-pl.pdf", "pl", "invoice", "signed")
+	upload("tenant2", "order", "invoice-en.pdf", "en", "invoice", "signed")
+	search := func(query string) (int, []models.Attachment) {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/files/search?"+query, nil))
+		var attachments []models.Attachment
+		if recorder.Code == http.StatusOK {
+			requireNotError(t, json.Unmarshal(recorder.Body.Bytes(), &attachments))
+		}
+		return recorder.Code, attachments
+	}
+
+	// Act
+	_, signed := search("tag=signed")
+	_, signedInEnglish := search("tag=signed&metadata[language]=en")
+	_, englishInvoices := search("tag=invoice&metadata[language]=en")
+	emptyCode, _ := search("")
+
+	// Assert
+	require.Len(t, signed, 3)
+	require.Len(t, signedInEnglish, 2)
+	require.Len(t, englishInvoices, 1)
+	require.Equal(t, "invoice-en.pdf", englishInvoices[0].FileName)
+	require.NotEmpty(t, englishInvoices[0].Url)
+	require.Equal(t, http.StatusBadRequest, emptyCode)
+}
+
+func TestCopiedFileKeepsLabels(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	useCase := createUseCase(t, ctx, storage, quotas(models.QuotaLimits{}))
+	requireNotError(t, useCase.UploadFile(ctx, "tenant1", models.UploadFileCommand{
+		FileName:    "invoice.pdf",
+		ReferenceID: "order",
+		File:        bytes.NewReader([]byte("Hello!")),
+		Tags:        []string{"signed"},
+	}))
+	source := listAttachments(t, ctx, useCase, "order")[0]
+
+	// Act
+	copied, err := useCase.CopyFile(ctx, "tenant1", models.CopyFileCommand{FileID: source.ID, ReferenceID: "archive"})
+
+	// Assert
+	requireNotError(t, err)
+	require.Equal(t, []string{"signed"}, listAttachments(t, ctx, useCase, "archive")[0].Tags)
+	require.Equal(t, map[string]string{"tags": "signed"}, storage.Metadata["tenant1/objects/"+copied.ID+"/invoice.pdf"])
+}
+
+func makeLabelledUploadRequest(t *testing.T, referenceObjectId, filename string, fields url.Values) *http.Request {
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	requireNotError(t, writer.WriteField("referenceObjectId", referenceObjectId))
+	for name, values := range fields {
+		for _, value := range values {
+			requireNotError(t, writer.WriteField(name, value))
+		}
+	}
+	part, err := writer.CreateFormFile("file", filename)
+	requireNotError(t, err)
+	_, err = part.Write([]byte("Hello!"))
+	requireNotError(t, err)
+	requireNotError(t, writer.Close())
+	req := httptest.NewRequest(http.MethodPost, "/api/files", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
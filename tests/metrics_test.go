@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/config"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/adapters"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	httpRouter "github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/http"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/metrics"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/tests/doubles"
+)
+
+func TestMetricsExposeRequestsAndStorageCalls(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	appMetrics := metrics.New()
+	storage := doubles.NewInMemoryFileStorage()
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	useCase, err := files.NewDefaultFilesUseCase(adapters.NewInstrumentedFileStorage(storage, appMetrics),
+		adapters.NewInstrumentedFileRepository(repository, appMetrics), adapters.NewGuidBasedIdGenerator(),
+		config.GCloudStorage{UrlExpirationTime: 15}, nil)
+	requireNotError(t, err)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(httpRouter.Metrics(appMetrics))
+	router.GET("/metrics", gin.WrapH(appMetrics.Handler()))
+	files.AppendFileRoutes(router.Group("/api"), createStubLogger(), useCase)
+	err = useCase.UploadFile(ctx, "tenant1", models.UploadFileCommand{FileName: "file.txt", ReferenceID: "reference", File: bytes.NewReader([]byte("Hello!"))})
+	requireNotError(t, err)
+	attachments, err := useCase.ListBy(ctx, "tenant1", models.ListFilesQuery{ReferenceID: "reference"})
+	requireNotError(t, err)
+	fileID := (*attachments)[0].ID
+
+	// Act
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/files/"+fileID+"/content", nil))
+	delete(storage.Files, "tenant1/file.txt")
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/files/"+fileID+"/content", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	// Assert
+	body := recorder.Body.String()
+	require.Contains(t, body, `http_request_duration_seconds_count{method="GET",route="/api/files/:id/content",status="200"} 1`)
+	require.Contains(t, body, `http_request_duration_seconds_count{method="GET",route="/api/files/:id/content",status="500"} 1`)
+	require.Contains(t, body, `http_request_duration_seconds_count{method="GET",route="unmatched",status="404"} 1`)
+	require.Contains(t, body, "file_upload_bytes_sum 6")
+	require.Contains(t, body, "file_upload_duration_seconds_count 1")
+	require.Contains(t, body, "file_uploads_in_flight 0")
+	require.Contains(t, body, "file_download_bytes_sum 6")
+	require.Contains(t, body, `port_call_duration_seconds_count{operation="ReadFile",port="file_storage"} 2`)
+	require.Contains(t, body, `port_call_errors_total{operation="ReadFile",port="file_storage"} 1`)
+	require.Contains(t, body, `port_call_duration_seconds_count{operation="Add",port="file_repository"} 1`)
+}
@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/notifications"
+	notificationsModels "github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/notifications/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/tests/doubles"
+)
+
+func TestStorageNotificationsKeepExternalFilesRegistered(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	requireNotError(t, storage.UploadFile(ctx, "tenant1", "ref-1/report.txt", []byte("Hello!")))
+	useCase := createUseCase(t, ctx, storage)
+	notificationsUseCase, err := notifications.NewDefaultNotificationsUseCase(useCase, "bucket")
+	requireNotError(t, err)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	notifications.AppendNotificationRoutes(router.Group("/api"), createStubLogger(), notificationsUseCase, "secret-token")
+	push := func(token string, attributes map[string]string) int {
+		body, err := json.Marshal(notificationsModels.PushRequest{Message: notificationsModels.PushMessage{Attributes: attributes, MessageID: "1"}})
+		requireNotError(t, err)
+		request := httptest.NewRequest(http.MethodPost, "/api/notifications/storage?token="+token, bytes.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+	listReference := func() []models.Attachment {
+		attachments, err := useCase.ListBy(ctx, "tenant1", models.ListFilesQuery{ReferenceID: "ref-1"})
+		requireNotError(t, err)
+		return *attachments
+	}
+	finalize := map[string]string{"eventType": "OBJECT_FINALIZE", "bucketId": "bucket", "objectId": "tenant1/ref-1/report.txt"}
+
+	// Act & Assert
+	require.Equal(t, http.StatusUnauthorized, push("wrong", finalize))
+	require.Equal(t, http.StatusNoContent, push("secret-token", finalize))
+	require.Equal(t, http.StatusNoContent, push("secret-token", finalize))
+	require.Equal(t, http.StatusNoContent, push("secret-token", map[string]string{"eventType": "OBJECT_FINALIZE", "bucketId": "bucket", "objectId": "tenant1/thumbnails/128/x.jpg"}))
+	require.Equal(t, http.StatusNoContent, push("secret-token", map[string]string{"eventType": "OBJECT_FINALIZE", "bucketId": "other", "objectId": "tenant1/ref-1/other.txt"}))
+	attachments := listReference()
+	require.Len(t, attachments, 1)
+	require.Equal(t, "report.txt", attachments[0].FileName)
+	require.Equal(t, "Hello!", downloadText(t, ctx, useCase, attachments[0].ID))
+	thumbnails, err := useCase.ListBy(ctx, "tenant1", models.ListFilesQuery{ReferenceID: "thumbnails"})
+	requireNotError(t, err)
+	require.Empty(t, *thumbnails)
+
+	require.Equal(t, http.StatusNoContent, push("secret-token", map[string]string{"eventType": "OBJECT_DELETE", "bucketId": "bucket", "objectId": "tenant1/ref-1/report.txt", "overwrittenByGeneration": "2"}))
+	require.Len(t, listReference(), 1)
+	requireNotError(t, useCase.SetLegalHold(ctx, "tenant1", attachments[0].ID, true))
+	require.Equal(t, http.StatusNoContent, push("secret-token", map[string]string{"eventType": "OBJECT_DELETE", "bucketId": "bucket", "objectId": "tenant1/ref-1/report.txt"}))
+	require.Len(t, listReference(), 1)
+	requireNotError(t, useCase.SetLegalHold(ctx, "tenant1", attachments[0].ID, false))
+	require.Equal(t, http.StatusNoContent, push("secret-token", map[string]string{"eventType": "OBJECT_DELETE", "bucketId": "bucket", "objectId": "tenant1/ref-1/report.txt"}))
+	require.Empty(t, listReference())
+	require.Equal(t, http.StatusBadRequest, push("secret-token", map[string]string{"bucketId": "bucket"}))
+}
+
+func TestStorageNotificationsAreDisabledWithoutToken(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	useCase := createUseCase(t, ctx, doubles.NewInMemoryFileStorage())
+	notificationsUseCase, err := notifications.NewDefaultNotificationsUseCase(useCase, "bucket")
+	requireNotError(t, err)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	notifications.AppendNotificationRoutes(router.Group("/api"), createStubLogger(), notificationsUseCase, "")
+	body, err := json.Marshal(notificationsModels.PushRequest{Message: notificationsModels.PushMessage{
+		Attributes: map[string]string{"eventType": "OBJECT_FINALIZE", "bucketId": "bucket", "objectId": "tenant1/ref-1/report.txt"},
+		MessageID:  "1",
+	}})
+	requireNotError(t, err)
+
+	// Act
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/notifications/storage", bytes.NewReader(body)))
+
+	// Assert
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestReferencesCantTakeNamesOfServicePrefixes(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	useCase := createUseCase(t, ctx, doubles.NewInMemoryFileStorage())
+
+	// Act
+	err := uploadText(ctx, useCase, "tenant1", "thumbnails", "report.txt", "Hello!")
+	_, ok := files.ParseObjectName("tenant1/thumbnails/report.txt")
+
+	// Assert
+	require.ErrorIs(t, err, files.ErrReservedReference)
+	require.False(t, ok)
+	require.Empty(t, listAttachments(t, ctx, useCase, "thumbnails"))
+}
@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/config"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/adapters"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/tests/doubles"
+)
+
+func TestUploadOverTenantQuotaIsRejectedBeforeStoring(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	useCase := createUseCase(t, ctx, storage, quotas(models.QuotaLimits{MaxBytes: 10}))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "reference", "first.txt", "123456"))
+
+	// Act
+	err := uploadText(ctx, useCase, "tenant1", "reference", "second.txt", "123456")
+
+	// Assert
+	require.True(t, errors.Is(err, files.ErrQuotaExceeded))
+	_, err = storage.ReadFile(ctx, "tenant1", "second.txt")
+	require.Error(t, err)
+	usage, err := useCase.Usage(ctx, "tenant1", "")
+	requireNotError(t, err)
+	require.Equal(t, int64(6), usage.Bytes)
+	require.Equal(t, 1, usage.Files)
+}
+
+func TestReferenceQuotaAndTenantOverrides(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	tenants := map[string]config.Tenant{"tenant2": {Quota: config.Quota{MaxReferenceFiles: 2}}}
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	useCase, err := files.NewDefaultFilesUseCase(doubles.NewInMemoryFileStorage(), repository, adapters.NewGuidBasedIdGenerator(),
+		config.GCloudStorage{UrlExpirationTime: 15}, tenants, quotas(models.QuotaLimits{MaxReferenceFiles: 1}))
+	requireNotError(t, err)
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "reference", "first.txt", "a"))
+	requireNotError(t, uploadText(ctx, useCase, "tenant2", "reference", "first.txt", "a"))
+
+	// Act
+	sameReferenceErr := uploadText(ctx, useCase, "tenant1", "reference", "second.txt", "a")
+	otherReferenceErr := uploadText(ctx, useCase, "tenant1", "other", "second.txt", "a")
+	overriddenErr := uploadText(ctx, useCase, "tenant2", "reference", "second.txt", "a")
+
+	// Assert
+	require.True(t, errors.Is(sameReferenceErr, files.ErrQuotaExceeded))
+	requireNotError(t, otherReferenceErr)
+	requireNotError(t, overriddenErr)
+}
+
+func TestDeletedFilesReleaseQuota(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	useCase := createUseCase(t, ctx, doubles.NewInMemoryFileStorage(), quotas(models.QuotaLimits{MaxFiles: 1}))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "reference", "first.txt", "Hello!"))
+	attachments, err := useCase.ListBy(ctx, "tenant1", models.ListFilesQuery{ReferenceID: "reference"})
+	requireNotError(t, err)
+
+	// Act
+	requireNotError(t, useCase.DeleteFile(ctx, "tenant1", (*attachments)[0].ID))
+	err = uploadText(ctx, useCase, "tenant1", "reference", "second.txt", "Hello!")
+
+	// Assert
+	requireNotError(t, err)
+}
+
+func TestStoredFilesCountTowardsUsage(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	useCase := createUseCase(t, ctx, doubles.NewInMemoryFileStorage(), quotas(models.QuotaLimits{MaxFiles: 1}))
+	object := models.StoredObject{Tenant: "tenant1", ReferenceID: "reference", FileName: "report.pdf", ObjectName: "reference/report.pdf", Size: 42}
+
+	// Act
+	requireNotError(t, useCase.RegisterStoredFile(ctx, object))
+	uploadErr := uploadText(ctx, useCase, "tenant1", "reference", "second.txt", "a")
+	registered, err := useCase.Usage(ctx, "tenant1", "reference")
+	requireNotError(t, err)
+	requireNotError(t, useCase.UnregisterStoredFile(ctx, object))
+	unregistered, err := useCase.Usage(ctx, "tenant1", "reference")
+	requireNotError(t, err)
+
+	// Assert
+	require.True(t, errors.Is(uploadErr, files.ErrQuotaExceeded))
+	require.Equal(t, int64(42), registered.Bytes)
+	require.Equal(t, int64(42), registered.Reference.Bytes)
+	require.Equal(t, 0, unregistered.Files)
+	require.Equal(t, 0, unregistered.Reference.Files)
+}
+
+func TestUsageRoute(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	useCase := createUseCase(t, ctx, doubles.NewInMemoryFileStorage(), quotas(models.QuotaLimits{MaxBytes: 100, MaxReferenceFiles: 1}))
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	files.AppendFileRoutes(router.Group("/api"), createStubLogger(), useCase)
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "reference", "first.txt", "Hello!"))
+
+	// Act
+	usageRecorder := httptest.NewRecorder()
+	router.ServeHTTP(usageRecorder, httptest.NewRequest(http.MethodGet, "/api/tenants/tenant1/usage?referenceId=reference", nil))
+	otherTenantRecorder := httptest.NewRecorder()
+	router.ServeHTTP(otherTenantRecorder, httptest.NewRequest(http.MethodGet, "/api/tenants/tenant2/usage", nil))
+	uploadRecorder := httptest.NewRecorder()
+	router.ServeHTTP(uploadRecorder, makeUploadFileRequest(t, "reference", "second.txt", "Hello!"))
+
+	// Assert
+	require.Equal(t, http.StatusOK, usageRecorder.Code)
+	var usage models.Usage
+	requireNotError(t, json.Unmarshal(usageRecorder.Body.Bytes(), &usage))
+	require.Equal(t, models.Usage{
+		Tenant:    "tenant1",
+		Bytes:     6,
+		Files:     1,
+		MaxBytes:  100,
+		Reference: &models.ReferenceUsage{ReferenceID: "reference", Bytes: 6, Files: 1, MaxFiles: 1},
+	}, usage)
+	require.Equal(t, http.StatusNotFound, otherTenantRecorder.Code)
+	require.Equal(t, http.StatusRequestEntityTooLarge, uploadRecorder.Code)
+}
+
+func uploadText(ctx context.Context, useCase files.UseCase, tenant, referenceID, fileName, content string) error {
+	return useCase.UploadFile(ctx, tenant, models.UploadFileCommand{
+		CreatorId:   "UserId",
+		FileName:    fileName,
+		ReferenceID: referenceID,
+		File:        bytes.NewReader([]byte(content)),
+	})
+}
+
+func quotas(limits models.QuotaLimits) files.Option {
+	return files.Quotas(adapters.NewInMemoryQuotaStore(), limits)
+}
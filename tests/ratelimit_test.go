@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	httpRouter "github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/http"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/ratelimit"
+)
+
+func TestRequestsOverRateLimitAreRejectedPerClient(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	limit := ratelimit.Limit{Rate: 0.5, Burst: 2}
+	router.Use(httpRouter.RateLimit(createStubLogger(), ratelimit.NewInMemoryStore(), limit, httpRouter.ClientKey([]string{"client-a", "client-b"})))
+	router.GET("/limited", func(ginCtx *gin.Context) { ginCtx.Status(http.StatusNoContent) })
+	request := func(apiKey string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+		req.Header.Set(httpRouter.HeaderApiKey, apiKey)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// Act
+	first := request("client-a")
+	second := request("client-a")
+	limited := request("client-a")
+	otherClient := request("client-b")
+	unknownKey := request("forged")
+	anotherUnknownKey := request("forged-again")
+	limitedUnknownKey := request("forged-once-more")
+
+	// Assert
+	require.Equal(t, http.StatusNoContent, first.Code)
+	require.Equal(t, http.StatusNoContent, second.Code)
+	require.Equal(t, http.StatusTooManyRequests, limited.Code)
+	require.Equal(t, "2", limited.Header().Get("Retry-After"))
+	require.Equal(t, http.StatusNoContent, otherClient.Code)
+	require.Equal(t, http.StatusNoContent, unknownKey.Code)
+	require.Equal(t, http.StatusNoContent, anotherUnknownKey.Code)
+	require.Equal(t, http.StatusTooManyRequests, limitedUnknownKey.Code)
+}
+
+func TestTokensAreRefilledOverTime(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	store := ratelimit.NewInMemoryStore()
+	limit := ratelimit.Limit{Rate: 1000, Burst: 1}
+	_, err := store.Take(ctx, "key", limit)
+	requireNotError(t, err)
+	result, err := store.Take(ctx, "key", limit)
+	requireNotError(t, err)
+	require.False(t, result.Allowed)
+
+	// Act
+	time.Sleep(result.RetryAfter)
+	refilled, err := store.Take(ctx, "key", limit)
+
+	// Assert
+	requireNotError(t, err)
+	require.True(t, refilled.Allowed)
+}
+
+func TestConcurrentUploadsOverCapAreRejected(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	limiter := ratelimit.NewConcurrencyLimiter(1)
+	entered, release := make(chan struct{}), make(chan struct{})
+	router.POST("/upload", httpRouter.ConcurrentUploads(limiter, httpRouter.TenantKey), func(ginCtx *gin.Context) {
+		entered <- struct{}{}
+		<-release
+		ginCtx.Status(http.StatusNoContent)
+	})
+	firstRecorder := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		router.ServeHTTP(firstRecorder, httptest.NewRequest(http.MethodPost, "/upload", nil))
+		close(done)
+	}()
+	<-entered
+
+	// Act
+	rejected := httptest.NewRecorder()
+	router.ServeHTTP(rejected, httptest.NewRequest(http.MethodPost, "/upload", nil))
+	close(release)
+	<-done
+	go func() { <-entered }()
+	afterRelease := httptest.NewRecorder()
+	router.ServeHTTP(afterRelease, httptest.NewRequest(http.MethodPost, "/upload", nil))
+
+	// Assert
+	require.Equal(t, http.StatusTooManyRequests, rejected.Code)
+	require.Equal(t, "1", rejected.Header().Get("Retry-After"))
+	require.Equal(t, http.StatusNoContent, firstRecorder.Code)
+	require.Equal(t, http.StatusNoContent, afterRelease.Code)
+}
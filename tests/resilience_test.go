@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/config"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/adapters"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/gcloudstorage"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/resilience"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/tests/doubles"
+)
+
+func TestTransientStorageErrorsAreRetried(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	faulty := doubles.NewFaultyFileStorage(storage)
+	faulty.FailNext(&googleapi.Error{Code: http.StatusServiceUnavailable}, &googleapi.Error{Code: http.StatusTooManyRequests})
+	resilient := adapters.NewResilientFileStorage(faulty, createRetry(3), nil, adapters.StorageTimeouts{})
+
+	// Act
+	err := resilient.UploadFile(ctx, "tenant1", "file.txt", []byte("Hello!"))
+
+	// Assert
+	requireNotError(t, err)
+	require.Equal(t, 3, faulty.Calls())
+	require.Equal(t, []byte("Hello!"), storage.Files["tenant1/file.txt"])
+}
+
+func TestPermanentStorageErrorsAreNotRetried(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	faulty := doubles.NewFaultyFileStorage(doubles.NewInMemoryFileStorage())
+	faulty.FailNext(&googleapi.Error{Code: http.StatusForbidden})
+	resilient := adapters.NewResilientFileStorage(faulty, createRetry(3), nil, adapters.StorageTimeouts{})
+
+	// Act
+	err := resilient.DeleteFile(ctx, "tenant1", "file.txt")
+
+	// Assert
+	var apiErr *googleapi.Error
+	require.True(t, errors.As(err, &apiErr))
+	require.Equal(t, http.StatusForbidden, apiErr.Code)
+	require.Equal(t, 1, faulty.Calls())
+}
+
+func TestStorageAttemptsAreBoundedByTimeout(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	faulty := doubles.NewFaultyFileStorage(doubles.NewInMemoryFileStorage())
+	faulty.SetDelay(time.Second)
+	resilient := adapters.NewResilientFileStorage(faulty, createRetry(2), nil, adapters.StorageTimeouts{Upload: 10 * time.Millisecond})
+
+	// Act
+	start := time.Now()
+	err := resilient.UploadFile(ctx, "tenant1", "file.txt", []byte("Hello!"))
+
+	// Assert
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+	require.Equal(t, 2, faulty.Calls())
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestRetriesOfUploadsAndDeletesThatWentThroughSucceed(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	faulty := doubles.NewFaultyFileStorage(storage)
+	resilient := adapters.NewResilientFileStorage(faulty, createRetry(3), nil, adapters.StorageTimeouts{})
+	faulty.FailNextAfterCall(context.DeadlineExceeded)
+	faulty.FailNext(fmt.Errorf("precondition failed; %w", ports.ErrFileExists))
+
+	// Act
+	uploadErr := resilient.UploadFile(ctx, "tenant1", "file.txt", []byte("Hello!"))
+	stored := storage.Files["tenant1/file.txt"]
+	faulty.FailNextAfterCall(&googleapi.Error{Code: http.StatusServiceUnavailable})
+	faulty.FailNext(fmt.Errorf("object doesn't exist; %w", ports.ErrFileNotFound))
+	deleteErr := resilient.DeleteFile(ctx, "tenant1", "file.txt")
+	faulty.FailNext(fmt.Errorf("precondition failed; %w", ports.ErrFileExists))
+	existingErr := resilient.UploadFile(ctx, "tenant1", "other.txt", []byte("Hello!"))
+	faulty.FailNext(fmt.Errorf("object doesn't exist; %w", ports.ErrFileNotFound))
+	missingErr := resilient.DeleteFile(ctx, "tenant1", "missing.txt")
+
+	// Assert
+	requireNotError(t, uploadErr)
+	requireNotError(t, deleteErr)
+	require.Equal(t, []byte("Hello!"), stored)
+	require.NotContains(t, storage.Files, "tenant1/file.txt")
+	require.ErrorIs(t, existingErr, ports.ErrFileExists)
+	require.ErrorIs(t, missingErr, ports.ErrFileNotFound)
+	require.Equal(t, 6, faulty.Calls())
+}
+
+func TestOpenCircuitStopsStorageCalls(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	faulty := doubles.NewFaultyFileStorage(doubles.NewInMemoryFileStorage())
+	unavailable := &googleapi.Error{Code: http.StatusServiceUnavailable}
+	faulty.FailNext(unavailable, unavailable)
+	breaker := resilience.NewCircuitBreaker(2, 50*time.Millisecond)
+	resilient := adapters.NewResilientFileStorage(faulty, createRetry(1), breaker, adapters.StorageTimeouts{})
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	useCase, err := files.NewDefaultFilesUseCase(resilient, repository, adapters.NewGuidBasedIdGenerator(), config.GCloudStorage{UrlExpirationTime: 15}, nil)
+	requireNotError(t, err)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	files.AppendFileRoutes(router.Group("/api"), createStubLogger(), useCase)
+	for i := 0; i < 2; i++ {
+		require.Error(t, resilient.UploadFile(ctx, "tenant1", "file.txt", []byte("Hello!")))
+	}
+
+	// Act
+	openErr := resilient.UploadFile(ctx, "tenant1", "file.txt", []byte("Hello!"))
+	uploadRecorder := httptest.NewRecorder()
+	router.ServeHTTP(uploadRecorder, makeUploadFileRequest(t, "reference", "file.txt", "Hello!"))
+	callsWhileOpen := faulty.Calls()
+	time.Sleep(60 * time.Millisecond)
+	probeErr := resilient.UploadFile(ctx, "tenant1", "file.txt", []byte("Hello!"))
+
+	// Assert
+	require.True(t, errors.Is(openErr, ports.ErrStorageUnavailable))
+	require.Equal(t, http.StatusServiceUnavailable, uploadRecorder.Code)
+	require.Equal(t, 2, callsWhileOpen)
+	requireNotError(t, probeErr)
+	require.Equal(t, resilience.StateClosed, breaker.State())
+}
+
+func TestBackoffGrowsWithJitterUpToMax(t *testing.T) {
+	// Arrange
+	backoff := resilience.Backoff{Initial: 100 * time.Millisecond, Max: time.Second, Multiplier: 2}
+
+	// Act
+	first, third, capped := backoff.Delay(1), backoff.Delay(3), backoff.Delay(10)
+
+	// Assert
+	require.GreaterOrEqual(t, first, 50*time.Millisecond)
+	require.LessOrEqual(t, first, 100*time.Millisecond)
+	require.GreaterOrEqual(t, third, 200*time.Millisecond)
+	require.LessOrEqual(t, third, 400*time.Millisecond)
+	require.GreaterOrEqual(t, capped, 500*time.Millisecond)
+	require.LessOrEqual(t, capped, time.Second)
+}
+
+func createRetry(maxAttempts int) resilience.Retry {
+	return resilience.Retry{
+		MaxAttempts: maxAttempts,
+		Backoff:     resilience.Backoff{Initial: time.Millisecond, Max: 5 * time.Millisecond},
+		Retryable:   gcloudstorage.IsRetryable,
+	}
+}
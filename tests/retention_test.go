@@ -0,0 +1,257 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	auditModels "github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/auditlog/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/adapters"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/access"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/audit"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/tests/doubles"
+)
+
+func TestFileOnLegalHoldCantBeDeletedUntilReleased(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	useCase := createUseCase(t, ctx, storage, files.Retention(adapters.NewInMemoryRetentionStore()), files.ObjectHolds(storage))
+	router := createFilesRouter(useCase)
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "contract.txt", "Signed"))
+	file := listAttachments(t, ctx, useCase, "order")[0]
+
+	// Act
+	held := httptest.NewRecorder()
+	router.ServeHTTP(held, httptest.NewRequest(http.MethodPut, "/api/files/"+file.ID+"/legal-hold", nil))
+	deletedWhileHeld := httptest.NewRecorder()
+	router.ServeHTTP(deletedWhileHeld, httptest.NewRequest(http.MethodDelete, "/api/files/"+file.ID, nil))
+	_, movedErr := useCase.MoveFile(ctx, "tenant1", models.MoveFileCommand{FileID: file.ID, FileName: "renamed.txt"})
+	unlinkErr := useCase.UnlinkFile(ctx, "tenant1", file.ID, "order")
+	heldAttachment := listAttachments(t, ctx, useCase, "order")[0]
+	objectHeld := storage.Holds["tenant1/contract.txt"]
+	released := httptest.NewRecorder()
+	router.ServeHTTP(released, httptest.NewRequest(http.MethodDelete, "/api/files/"+file.ID+"/legal-hold", nil))
+	deleted := httptest.NewRecorder()
+	router.ServeHTTP(deleted, httptest.NewRequest(http.MethodDelete, "/api/files/"+file.ID, nil))
+
+	// Assert
+	require.Equal(t, http.StatusNoContent, held.Code)
+	require.Equal(t, http.StatusConflict, deletedWhileHeld.Code)
+	require.ErrorIs(t, movedErr, files.ErrFileOnLegalHold)
+	require.ErrorIs(t, unlinkErr, files.ErrFileOnLegalHold)
+	require.True(t, heldAttachment.LegalHold)
+	require.True(t, objectHeld)
+	require.Equal(t, http.StatusNoContent, released.Code)
+	require.Equal(t, http.StatusNoContent, deleted.Code)
+	require.Empty(t, storage.Files)
+	require.Empty(t, storage.Holds)
+}
+
+func TestRetainedFileCantBeDeletedNorMovedAway(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	useCase := createUseCaseOver(t, doubles.NewInMemoryFileStorage(), repository, files.Retention(adapters.NewInMemoryRetentionStore()))
+	requireNotError(t, useCase.SetRetentionRule(ctx, "tenant1", models.RetentionRule{RetainDays: 30}))
+	requireNotError(t, useCase.SetRetentionRule(ctx, "tenant1", models.RetentionRule{ReferenceID: "drafts"}))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "invoice.txt", "Paid"))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "old.txt", "Paid long ago"))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "drafts", "draft.txt", "Unpaid"))
+	invoice := listAttachments(t, ctx, useCase, "order")[0]
+	old := listAttachments(t, ctx, useCase, "order")[1]
+	backdate(t, ctx, repository, old.ID, 31)
+	draft := listAttachments(t, ctx, useCase, "drafts")[0]
+
+	// Act
+	deleteErr := useCase.DeleteFile(ctx, "tenant1", invoice.ID)
+	_, moveErr := useCase.MoveFile(ctx, "tenant1", models.MoveFileCommand{FileID: invoice.ID, ReferenceID: "drafts"})
+	_, renameErr := useCase.MoveFile(ctx, "tenant1", models.MoveFileCommand{FileID: invoice.ID, FileName: "paid.txt"})
+	oldDeleteErr := useCase.DeleteFile(ctx, "tenant1", old.ID)
+	draftDeleteErr := useCase.DeleteFile(ctx, "tenant1", draft.ID)
+
+	// Assert
+	require.ErrorIs(t, deleteErr, files.ErrFileRetained)
+	require.ErrorIs(t, moveErr, files.ErrFileRetained)
+	requireNotError(t, renameErr)
+	requireNotError(t, oldDeleteErr)
+	requireNotError(t, draftDeleteErr)
+	require.Len(t, listAttachments(t, ctx, useCase, "order"), 1)
+}
+
+func TestExpiredFilesAreDeletedUnlessOnLegalHold(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	useCase := createUseCaseOver(t, storage, repository, files.Retention(adapters.NewInMemoryRetentionStore()), files.ObjectHolds(storage))
+	requireNotError(t, useCase.SetRetentionRule(ctx, "tenant1", models.RetentionRule{ReferenceID: "logs", ExpireDays: 7}))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "logs", "expired.log", "Old"))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "logs", "held.log", "Old but held"))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "logs", "recent.log", "New"))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "invoice.txt", "Old but not expiring"))
+	logs := listAttachments(t, ctx, useCase, "logs")
+	backdate(t, ctx, repository, logs[0].ID, 7)
+	backdate(t, ctx, repository, logs[1].ID, 8)
+	backdate(t, ctx, repository, listAttachments(t, ctx, useCase, "order")[0].ID, 100)
+	requireNotError(t, useCase.SetLegalHold(ctx, "tenant1", logs[1].ID, true))
+
+	// Act
+	deleted, err := useCase.DeleteExpiredFiles(ctx)
+
+	// Assert
+	requireNotError(t, err)
+	require.Equal(t, 1, deleted)
+	remaining := listAttachments(t, ctx, useCase, "logs")
+	require.Len(t, remaining, 2)
+	require.Equal(t, "held.log", remaining[0].FileName)
+	require.Equal(t, "recent.log", remaining[1].FileName)
+	require.Len(t, listAttachments(t, ctx, useCase, "order"), 1)
+	require.NotContains(t, storage.Files, "tenant1/expired.log")
+}
+
+func TestRetentionRulesAreManagedPerTenant(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	auditUseCase := createAuditUseCase(t, ctx, 0)
+	useCase := createUseCase(t, ctx, doubles.NewInMemoryFileStorage(), files.Retention(adapters.NewInMemoryRetentionStore()), files.Audit(auditUseCase))
+	router := createFilesRouter(useCase)
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// Act
+	tenantRule := serve(makeJsonRequest(t, http.MethodPut, "/api/retention", map[string]interface{}{"retainDays": 365}))
+	referenceRule := serve(makeJsonRequest(t, http.MethodPut, "/api/retention",
+		map[string]interface{}{"referenceId": "logs", "retainDays": 7, "expireDays": 30}))
+	expiringEarly := serve(makeJsonRequest(t, http.MethodPut, "/api/retention",
+		map[string]interface{}{"retainDays": 30, "expireDays": 7}))
+	negative := serve(makeJsonRequest(t, http.MethodPut, "/api/retention", map[string]interface{}{"retainDays": -1}))
+	removed := serve(httptest.NewRequest(http.MethodDelete, "/api/retention", nil))
+	removedAgain := serve(httptest.NewRequest(http.MethodDelete, "/api/retention", nil))
+	rules, err := useCase.ListRetentionRules(ctx, "tenant1")
+	requireNotError(t, err)
+	otherRules, err := useCase.ListRetentionRules(ctx, "tenant2")
+	requireNotError(t, err)
+	entries, err := auditUseCase.ListBy(ctx, "tenant1", auditModels.ListEntriesQuery{})
+	requireNotError(t, err)
+
+	// Assert
+	require.Equal(t, http.StatusNoContent, tenantRule.Code)
+	require.Equal(t, http.StatusNoContent, referenceRule.Code)
+	require.Equal(t, http.StatusBadRequest, expiringEarly.Code)
+	require.Equal(t, http.StatusBadRequest, negative.Code)
+	require.Equal(t, http.StatusNoContent, removed.Code)
+	require.Equal(t, http.StatusNotFound, removedAgain.Code)
+	require.Equal(t, []models.RetentionRule{{ReferenceID: "logs", RetainDays: 7, ExpireDays: 30}}, rules)
+	require.Empty(t, otherRules)
+	require.Len(t, *entries, 3)
+	require.Equal(t, audit.ActionUnsetRetention, (*entries)[0].Action)
+	require.Equal(t, "logs", (*entries)[1].ReferenceID)
+	require.Equal(t, audit.ActionSetRetention, (*entries)[2].Action)
+}
+
+func TestRulesOfLinkedReferencesApplyToFiles(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	useCase := createUseCaseOver(t, doubles.NewInMemoryFileStorage(), repository, files.Retention(adapters.NewInMemoryRetentionStore()))
+	requireNotError(t, useCase.SetRetentionRule(ctx, "tenant1", models.RetentionRule{ReferenceID: "logs", ExpireDays: 7}))
+	requireNotError(t, useCase.SetRetentionRule(ctx, "tenant1", models.RetentionRule{ReferenceID: "case", RetainDays: 30}))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "logs", "evidence.log", "Kept for the case"))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "logs", "noise.log", "Expired"))
+	logs := listAttachments(t, ctx, useCase, "logs")
+	requireNotError(t, useCase.LinkFile(ctx, "tenant1", logs[0].ID, "case"))
+	backdate(t, ctx, repository, logs[0].ID, 10)
+	backdate(t, ctx, repository, logs[1].ID, 10)
+
+	// Act
+	deleteErr := useCase.DeleteFile(ctx, "tenant1", logs[0].ID)
+	unlinkErr := useCase.UnlinkFile(ctx, "tenant1", logs[0].ID, "case")
+	deleted, err := useCase.DeleteExpiredFiles(ctx)
+
+	// Assert
+	require.ErrorIs(t, deleteErr, files.ErrFileRetained)
+	require.ErrorIs(t, unlinkErr, files.ErrFileRetained)
+	requireNotError(t, err)
+	require.Equal(t, 1, deleted)
+	remaining := listAttachments(t, ctx, useCase, "logs")
+	require.Len(t, remaining, 1)
+	require.Equal(t, "evidence.log", remaining[0].FileName)
+}
+
+func TestExpirationGoesOnPastFilesItFailsToDelete(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	inner := doubles.NewInMemoryFileStorage()
+	storage := doubles.NewFaultyFileStorage(inner)
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	useCase := createUseCaseOver(t, storage, repository, files.Retention(adapters.NewInMemoryRetentionStore()))
+	requireNotError(t, useCase.SetRetentionRule(ctx, "tenant1", models.RetentionRule{ExpireDays: 7}))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "logs", "first.log", "Old"))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "logs", "second.log", "Old"))
+	for _, file := range listAttachments(t, ctx, useCase, "logs") {
+		backdate(t, ctx, repository, file.ID, 8)
+	}
+	storage.FailNext(errors.New("storage unavailable"))
+
+	// Act
+	deleted, err := useCase.DeleteExpiredFiles(ctx)
+
+	// Assert
+	require.Error(t, err)
+	require.Equal(t, 1, deleted)
+	require.Contains(t, inner.Files, "tenant1/first.log")
+	require.NotContains(t, inner.Files, "tenant1/second.log")
+}
+
+// backdate moves the upload of the file the given number of days back.
+func backdate(t *testing.T, ctx context.Context, repository *adapters.InMemoryFilesRepository, fileID string, days int) {
+	file, err := repository.ReadBy(ctx, "tenant1", fileID)
+	requireNotError(t, err)
+	file.CreatedAt = time.Now().AddDate(0, 0, -days).Unix()
+	requireNotError(t, repository.Update(ctx, "tenant1", file))
+}
+
+func TestRetentionRulesAreSetByOwnersAndAdmins(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	useCase := createUseCase(t, ctx, doubles.NewInMemoryFileStorage(), files.Retention(adapters.NewInMemoryRetentionStore()),
+		files.AccessControl(adapters.NewInMemoryReferenceAccessStore()))
+	alice := access.WithCaller(ctx, access.Caller{ID: "alice"})
+	bob := access.WithCaller(ctx, access.Caller{ID: "bob"})
+	admin := access.WithCaller(ctx, access.Caller{ID: "carol", Groups: []string{access.AdminsGroup}})
+	requireNotError(t, uploadText(alice, useCase, "tenant1", "order", "invoice.txt", "Paid"))
+	orderRule := models.RetentionRule{ReferenceID: "order", RetainDays: 30}
+	tenantRule := models.RetentionRule{RetainDays: 365}
+
+	// Act
+	setByBob := useCase.SetRetentionRule(bob, "tenant1", orderRule)
+	setByAlice := useCase.SetRetentionRule(alice, "tenant1", orderRule)
+	removedByBob := useCase.RemoveRetentionRule(bob, "tenant1", "order")
+	tenantSetByAlice := useCase.SetRetentionRule(alice, "tenant1", tenantRule)
+	tenantSetByAdmin := useCase.SetRetentionRule(admin, "tenant1", tenantRule)
+	rules, err := useCase.ListRetentionRules(ctx, "tenant1")
+	requireNotError(t, err)
+
+	// Assert
+	require.ErrorIs(t, setByBob, files.ErrAccessDenied)
+	require.NoError(t, setByAlice)
+	require.ErrorIs(t, removedByBob, files.ErrAccessDenied)
+	require.ErrorIs(t, tenantSetByAlice, files.ErrAccessDenied)
+	require.NoError(t, tenantSetByAdmin)
+	require.ElementsMatch(t, []models.RetentionRule{orderRule, tenantRule}, rules)
+}
@@ -0,0 +1,282 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/config"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/adapters"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/clamav"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/encryption"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/tests/doubles"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+func TestInfectedFileIsQuarantinedAndHiddenFromList(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	storage := doubles.NewInMemoryFileStorage()
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	pipeline := files.NewScanPipeline(adapters.NewFakeScanner(), storage, repository, createStubLogger(), 1, 10, time.Millisecond, 10)
+	pipeline.Start(ctx)
+	useCase, err := files.NewDefaultFilesUseCase(storage, repository, adapters.NewGuidBasedIdGenerator(),
+		config.GCloudStorage{UrlExpirationTime: 15}, nil, files.Scanning(pipeline))
+	requireNotError(t, err)
+
+	// Act
+	err = useCase.UploadFile(ctx, "tenant", models.UploadFileCommand{FileName: "clean.txt", ReferenceID: "reference", File: bytes.NewReader([]byte("Hello!"))})
+	requireNotError(t, err)
+	err = useCase.UploadFile(ctx, "tenant", models.UploadFileCommand{FileName: "virus.txt", ReferenceID: "reference", File: bytes.NewReader([]byte(eicar))})
+	requireNotError(t, err)
+
+	// Assert
+	require.Eventually(t, func() bool {
+		attachments, err := useCase.ListBy(ctx, "tenant", models.ListFilesQuery{ReferenceID: "reference", IncludeUnscanned: true})
+		return err == nil && len(*attachments) == 2 &&
+			(*attachments)[0].Status == models.FileStatusClean && (*attachments)[1].Status == models.FileStatusInfected
+	}, time.Second, 10*time.Millisecond)
+	attachments, err := useCase.ListBy(ctx, "tenant", models.ListFilesQuery{ReferenceID: "reference"})
+	requireNotError(t, err)
+	require.Len(t, *attachments, 1)
+	require.Equal(t, "clean.txt", (*attachments)[0].FileName)
+	require.Contains(t, storage.Files, "tenant/quarantine/virus.txt")
+	require.NotContains(t, storage.Files, "tenant/virus.txt")
+	_, err = useCase.DownloadFile(ctx, "tenant", "missing")
+	require.ErrorIs(t, err, files.ErrFileNotFound)
+}
+
+func TestQuarantinedFileOfEncryptedTenantStaysEncrypted(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	keyring, err := encryption.NewKeyring("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, encryption.KeySize)})
+	requireNotError(t, err)
+	inner := doubles.NewInMemoryFileStorage()
+	storage := adapters.NewEnvelopeEncryptingFileStorage(inner, map[string]*encryption.Keyring{"tenant": keyring}, adapters.DefaultMaxEnvelopeFileSize)
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	pipeline := files.NewScanPipeline(adapters.NewFakeScanner(), storage, repository, createStubLogger(), 1, 10, time.Millisecond, 10)
+	pipeline.Start(ctx)
+	useCase, err := files.NewDefaultFilesUseCase(storage, repository, adapters.NewGuidBasedIdGenerator(),
+		config.GCloudStorage{UrlExpirationTime: 15}, nil, files.Scanning(pipeline))
+	requireNotError(t, err)
+
+	// Act
+	requireNotError(t, uploadText(ctx, useCase, "tenant", "reference", "virus.txt", eicar))
+
+	// Assert
+	require.Eventually(t, func() bool {
+		attachments, err := useCase.ListBy(ctx, "tenant", models.ListFilesQuery{ReferenceID: "reference", IncludeUnscanned: true})
+		return err == nil && len(*attachments) == 1 && (*attachments)[0].Status == models.FileStatusInfected
+	}, time.Second, 10*time.Millisecond)
+	require.Contains(t, inner.Files, "tenant/quarantine/virus.txt")
+	require.NotContains(t, string(inner.Files["tenant/quarantine/virus.txt"]), eicar)
+	content, err := encryption.Open(keyring, inner.Files["tenant/quarantine/virus.txt"])
+	requireNotError(t, err)
+	require.Equal(t, eicar, string(content))
+}
+
+func TestFileIsScannedAgainAfterScannerFailure(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	storage := doubles.NewInMemoryFileStorage()
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	scanner := &flakyScanner{next: adapters.NewFakeScanner(), failures: 3}
+	pipeline := files.NewScanPipeline(scanner, storage, repository, createStubLogger(), 1, 10, time.Millisecond, 10)
+	pipeline.Start(ctx)
+	useCase, err := files.NewDefaultFilesUseCase(storage, repository, adapters.NewGuidBasedIdGenerator(),
+		config.GCloudStorage{UrlExpirationTime: 15}, nil, files.Scanning(pipeline))
+	requireNotError(t, err)
+
+	// Act
+	requireNotError(t, uploadText(ctx, useCase, "tenant", "reference", "clean.txt", "Hello!"))
+
+	// Assert
+	require.Eventually(t, func() bool {
+		attachments, err := useCase.ListBy(ctx, "tenant", models.ListFilesQuery{ReferenceID: "reference", IncludeUnscanned: true})
+		return err == nil && len(*attachments) == 1 && (*attachments)[0].Status == models.FileStatusClean
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, 4, scanner.Calls())
+}
+
+func TestFileIsMarkedAsScanFailedAfterTooManyScannerFailures(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	storage := doubles.NewInMemoryFileStorage()
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	scanner := &flakyScanner{next: adapters.NewFakeScanner(), failures: 100}
+	pipeline := files.NewScanPipeline(scanner, storage, repository, createStubLogger(), 1, 10, time.Millisecond, 3)
+	pipeline.Start(ctx)
+	useCase, err := files.NewDefaultFilesUseCase(storage, repository, adapters.NewGuidBasedIdGenerator(),
+		config.GCloudStorage{UrlExpirationTime: 15}, nil, files.Scanning(pipeline))
+	requireNotError(t, err)
+
+	// Act
+	requireNotError(t, uploadText(ctx, useCase, "tenant", "reference", "clean.txt", "Hello!"))
+
+	// Assert
+	require.Eventually(t, func() bool {
+		attachments, err := useCase.ListBy(ctx, "tenant", models.ListFilesQuery{ReferenceID: "reference", IncludeUnscanned: true})
+		return err == nil && len(*attachments) == 1 && (*attachments)[0].Status == models.FileStatusScanFailed
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	pipeline.Wait()
+	require.Equal(t, 3, scanner.Calls())
+}
+
+func TestScanDoesNotOverwriteChangesMadeWhileScanning(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	storage := doubles.NewInMemoryFileStorage()
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	racing := &racingRepository{FileRepository: repository}
+	pipeline := files.NewScanPipeline(adapters.NewFakeScanner(), storage, racing, createStubLogger(), 1, 10, time.Millisecond, 10)
+	useCase := createUseCaseOver(t, storage, repository, files.Scanning(pipeline))
+	tags := []string{"invoice"}
+	racing.afterRead = func(fileID string) error {
+		_, err := useCase.UpdateMetadata(ctx, "tenant1", models.UpdateMetadataCommand{FileID: fileID, Tags: &tags})
+		return err
+	}
+
+	// Act
+	pipeline.Start(ctx)
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "invoice.txt", "Paid"))
+
+	// Assert
+	require.Eventually(t, func() bool {
+		file, err := repository.ReadBy(ctx, "tenant1", racing.FileID())
+		return err == nil && file != nil && file.Status == models.FileStatusClean
+	}, time.Second, 10*time.Millisecond)
+	requireNotError(t, racing.Err())
+	file, err := repository.ReadBy(ctx, "tenant1", racing.FileID())
+	requireNotError(t, err)
+	require.Equal(t, tags, file.Tags)
+}
+
+// racingRepository lets a user change the file right after the pipeline has read it.
+type racingRepository struct {
+	ports.FileRepository
+	afterRead func(fileID string) error
+	mu        sync.Mutex
+	fileID    string
+	err       error
+}
+
+func (repository *racingRepository) ReadBy(ctx context.Context, tenant, fileID string) (*models.File, error) {
+	file, err := repository.FileRepository.ReadBy(ctx, tenant, fileID)
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	if err == nil && repository.fileID == "" {
+		repository.fileID = fileID
+		repository.err = repository.afterRead(fileID)
+	}
+	return file, err
+}
+
+func (repository *racingRepository) FileID() string {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	return repository.fileID
+}
+
+func (repository *racingRepository) Err() error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	return repository.err
+}
+
+// flakyScanner fails the first scans, e.g. while clamd is restarting.
+type flakyScanner struct {
+	next     ports.Scanner
+	mu       sync.Mutex
+	failures int
+	calls    int
+}
+
+func (scanner *flakyScanner) Scan(ctx context.Context, content io.Reader) (models.ScanResult, error) {
+	scanner.mu.Lock()
+	scanner.calls++
+	failing := scanner.calls <= scanner.failures
+	scanner.mu.Unlock()
+	if failing {
+		return models.ScanResult{}, errors.New("connection refused")
+	}
+	return scanner.next.Scan(ctx, content)
+}
+
+func (scanner *flakyScanner) Calls() int {
+	scanner.mu.Lock()
+	defer scanner.mu.Unlock()
+	return scanner.calls
+}
+
+func TestClamAVClientStreamsContentInChunks(t *testing.T) {
+	// Arrange
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	requireNotError(t, err)
+	defer listener.Close()
+	received := make(chan []byte, 1)
+	go serveClamdInstream(listener, received)
+	client := clamav.NewClient(listener.Addr().String(), time.Second)
+
+	// Act
+	result, err := client.Scan(context.Background(), bytes.NewReader([]byte(eicar)))
+
+	// Assert
+	requireNotError(t, err)
+	require.True(t, result.Infected)
+	require.Equal(t, "Eicar-Test-Signature", result.Signature)
+	require.Equal(t, []byte(eicar), <-received)
+}
+
+func serveClamdInstream(listener net.Listener, received chan<- []byte) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	if _, err := reader.ReadString('\x00'); err != nil {
+		return
+	}
+	var content []byte
+	size := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(reader, size); err != nil {
+			return
+		}
+		chunkSize := binary.BigEndian.Uint32(size)
+		if chunkSize == 0 {
+			break
+		}
+		chunk := make([]byte, chunkSize)
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			return
+		}
+		content = append(content, chunk...)
+	}
+	received <- content
+	_, _ = conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+}
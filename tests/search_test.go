@@ -0,0 +1,203 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/config"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/adapters"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/tests/doubles"
+)
+
+func TestFilesAreFoundByNameTagsAndTextWithinTenant(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	useCase := createUseCaseOver(t, doubles.NewInMemoryFileStorage(), repository, indexing(t, ctx, repository))
+	router := createFilesRouter(useCase)
+	report, err := os.ReadFile("./data/report.pdf")
+	requireNotError(t, err)
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "notes.txt", "Quarterly revenue grew by a tenth"))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "report.pdf", string(report)))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "customer", "Invoice-2023.pdf", "not really a pdf"))
+	requireNotError(t, useCase.UploadFile(ctx, "tenant1", models.UploadFileCommand{
+		FileName:    "contract.docx",
+		ReferenceID: "customer",
+		File:        bytes.NewReader([]byte("Quarterly")),
+		Tags:        []string{"signed"},
+	}))
+	requireNotError(t, uploadText(ctx, useCase, "tenant2", "order", "notes.txt", "Quarterly revenue grew by a tenth"))
+	search := func(query url.Values) []string {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/files/search?"+query.Encode(), nil))
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var attachments []models.Attachment
+		requireNotError(t, json.Unmarshal(recorder.Body.Bytes(), &attachments))
+		var fileNames []string
+		for _, attachment := range attachments {
+			fileNames = append(fileNames, attachment.FileName)
+		}
+		return fileNames
+	}
+	require.Eventually(t, func() bool {
+		return len(search(url.Values{"q": {"quarterly"}})) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	// Act
+	byText := search(url.Values{"q": {"QUARTERLY revenue"}})
+	byTextOfPdf := search(url.Values{"q": {"revenue report"}})
+	byName := search(url.Values{"q": {"invoice 2023"}})
+	byTag := search(url.Values{"q": {"signed"}})
+	byTextAndTag := search(url.Values{"q": {"quarterly"}, "tag": {"signed"}})
+	unknown := search(url.Values{"q": {"quarterly invoice"}})
+
+	// Assert
+	require.ElementsMatch(t, []string{"notes.txt", "report.pdf"}, byText)
+	require.Equal(t, []string{"report.pdf"}, byTextOfPdf)
+	require.Equal(t, []string{"Invoice-2023.pdf"}, byName)
+	require.Equal(t, []string{"contract.docx"}, byTag)
+	require.Empty(t, byTextAndTag)
+	require.Empty(t, unknown)
+}
+
+func TestSearchIndexFollowsChangesOfFiles(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	useCase := createUseCaseOver(t, doubles.NewInMemoryFileStorage(), repository, indexing(t, ctx, repository))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "notes.txt", "Quarterly revenue grew by a tenth"))
+	file := listAttachments(t, ctx, useCase, "order")[0]
+	require.Eventually(t, func() bool {
+		return len(searchText(t, ctx, useCase, "revenue")) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// Act
+	_, err = useCase.MoveFile(ctx, "tenant1", models.MoveFileCommand{FileID: file.ID, FileName: "minutes.txt"})
+	requireNotError(t, err)
+	tags := []string{"board"}
+	_, err = useCase.UpdateMetadata(ctx, "tenant1", models.UpdateMetadataCommand{FileID: file.ID, Tags: &tags})
+	requireNotError(t, err)
+	copied, err := useCase.CopyFile(ctx, "tenant1", models.CopyFileCommand{FileID: file.ID, ReferenceID: "archive", FileName: "copy.txt"})
+	requireNotError(t, err)
+	renamedAndTagged := searchText(t, ctx, useCase, "minutes board revenue")
+	requireNotError(t, useCase.DeleteFile(ctx, "tenant1", file.ID))
+
+	// Assert
+	require.Len(t, renamedAndTagged, 1)
+	require.Equal(t, file.ID, renamedAndTagged[0].ID)
+	require.Empty(t, searchText(t, ctx, useCase, "notes"))
+	found := searchText(t, ctx, useCase, "revenue board")
+	require.Len(t, found, 1)
+	require.Equal(t, copied.ID, found[0].ID)
+}
+
+func TestInfectedFilesAreNotIndexed(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	storage := doubles.NewInMemoryFileStorage()
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	searchIndex, err := adapters.NewBleveSearchIndex("")
+	requireNotError(t, err)
+	indexPipeline := files.NewIndexPipeline(searchIndex, repository, createStubLogger(), 1, 10)
+	indexPipeline.Start(ctx)
+	scanPipeline := files.NewScanPipeline(adapters.NewFakeScanner(), storage, repository, createStubLogger(), 1, 10, time.Millisecond, 10)
+	scanPipeline.Start(ctx)
+	useCase, err := files.NewDefaultFilesUseCase(storage, repository, adapters.NewGuidBasedIdGenerator(),
+		config.GCloudStorage{UrlExpirationTime: 15}, nil, files.Scanning(scanPipeline), files.Indexing(indexPipeline))
+	requireNotError(t, err)
+
+	// Act
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "virus.txt", eicar))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "antivirus.txt", "Hello!"))
+
+	// Assert
+	var found *[]models.Attachment
+	require.Eventually(t, func() bool {
+		found, err = useCase.SearchFiles(ctx, "tenant1", models.SearchFilesQuery{Text: "antivirus", IncludeUnscanned: true})
+		return err == nil && len(*found) == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, "antivirus.txt", (*found)[0].FileName)
+	require.Eventually(t, func() bool {
+		attachments, err := useCase.ListBy(ctx, "tenant1", models.ListFilesQuery{ReferenceID: "order", IncludeUnscanned: true})
+		return err == nil && (*attachments)[0].Status == models.FileStatusInfected
+	}, time.Second, 10*time.Millisecond)
+	found, err = useCase.SearchFiles(ctx, "tenant1", models.SearchFilesQuery{Text: "virus", IncludeUnscanned: true})
+	requireNotError(t, err)
+	require.Empty(t, *found)
+}
+
+func TestSearchByTextWithoutIndexIsNotImplemented(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	useCase := createUseCase(t, ctx, doubles.NewInMemoryFileStorage(), quotas(models.QuotaLimits{}))
+	router := createFilesRouter(useCase)
+
+	// Act
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/files/search?q=invoice", nil))
+
+	// Assert
+	require.Equal(t, http.StatusNotImplemented, recorder.Code)
+}
+
+func TestSearchIndexOnDiskIsKeptAcrossRestarts(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "search.bleve")
+	searchIndex, err := adapters.NewBleveSearchIndex(path)
+	requireNotError(t, err)
+	requireNotError(t, searchIndex.Index(ctx, "tenant1", models.SearchDocument{
+		FileID:   "file",
+		FileName: "notes.txt",
+		Tags:     []string{"board"},
+		Text:     "Quarterly revenue",
+	}))
+	requireNotError(t, searchIndex.Close())
+
+	// Act
+	reopened, err := adapters.NewBleveSearchIndex(path)
+	requireNotError(t, err)
+	defer reopened.Close()
+	found, err := reopened.Search(ctx, "tenant1", "revenue", 10)
+	requireNotError(t, err)
+	document, err := reopened.Read(ctx, "tenant1", "file")
+	requireNotError(t, err)
+
+	// Assert
+	require.Equal(t, []string{"file"}, found)
+	require.Equal(t, &models.SearchDocument{FileID: "file", FileName: "notes.txt", Tags: []string{"board"}, Text: "Quarterly revenue"}, document)
+}
+
+// indexing enables search over an in-memory index kept up to date in the background until ctx is done.
+func indexing(t *testing.T, ctx context.Context, repository ports.FileRepository) files.Option {
+	searchIndex, err := adapters.NewBleveSearchIndex("")
+	requireNotError(t, err)
+	pipeline := files.NewIndexPipeline(searchIndex, repository, createStubLogger(), 1, 10)
+	pipeline.Start(ctx)
+	return files.Indexing(pipeline)
+}
+
+func searchText(t *testing.T, ctx context.Context, useCase files.UseCase, text string) []models.Attachment {
+	found, err := useCase.SearchFiles(ctx, "tenant1", models.SearchFilesQuery{Text: text})
+	requireNotError(t, err)
+	return *found
+}
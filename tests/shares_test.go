@@ -0,0 +1,265 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/adapters"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/encryption"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/tests/doubles"
+)
+
+func TestSharedFileIsRedirectedToShortLivedUrlUntilDownloadsRunOut(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	useCase := createUseCase(t, ctx, storage, sharing(adapters.NewInMemoryShareRepository()))
+	router := createFilesRouter(useCase)
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "invoice.txt", "Paid"))
+	file := listAttachments(t, ctx, useCase, "order")[0]
+	created := httptest.NewRecorder()
+	router.ServeHTTP(created, makeJsonRequest(t, http.MethodPost, "/api/files/"+file.ID+"/shares", map[string]interface{}{
+		"expiresIn":    60,
+		"maxDownloads": 2,
+	}))
+	require.Equal(t, http.StatusCreated, created.Code)
+	var link models.ShareLink
+	requireNotError(t, json.Unmarshal(created.Body.Bytes(), &link))
+	storage.SignedUrlOptions = nil
+
+	// Act
+	var codes []int
+	var locations []string
+	for i := 0; i < 3; i++ {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, link.Url, nil))
+		codes = append(codes, recorder.Code)
+		locations = append(locations, recorder.Header().Get("Location"))
+	}
+	shares, err := useCase.ListShares(ctx, "tenant1", file.ID)
+	requireNotError(t, err)
+
+	// Assert
+	require.Equal(t, "/api/shares/"+link.Token, link.Url)
+	require.Equal(t, 2, link.MaxDownloads)
+	require.False(t, link.PasswordProtected)
+	require.Equal(t, []int{http.StatusFound, http.StatusFound, http.StatusGone}, codes)
+	require.Equal(t, "memory://tenant1/invoice.txt", locations[0])
+	require.Len(t, storage.SignedUrlOptions, 2)
+	require.Equal(t, time.Minute, storage.SignedUrlOptions[0].Expiry)
+	require.Empty(t, shares)
+}
+
+func TestProtectedShareIsOpenedWithPasswordOnly(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	useCase := createUseCase(t, ctx, doubles.NewInMemoryFileStorage(), sharing(adapters.NewInMemoryShareRepository()))
+	router := createFilesRouter(useCase)
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "invoice.txt", "Paid"))
+	file := listAttachments(t, ctx, useCase, "order")[0]
+	link, err := useCase.CreateShare(ctx, "tenant1", models.CreateShareCommand{FileID: file.ID, ExpiresIn: time.Hour, Password: "secret"})
+	requireNotError(t, err)
+	openWith := func(password string) int {
+		form := url.Values{"password": {password}}
+		req := httptest.NewRequest(http.MethodPost, "/api/shares/"+link.Token, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	// Act
+	withoutPassword := httptest.NewRecorder()
+	router.ServeHTTP(withoutPassword, httptest.NewRequest(http.MethodGet, "/api/shares/"+link.Token, nil))
+	wrongPassword := openWith("guess")
+	rightPassword := openWith("secret")
+	shares, err := useCase.ListShares(ctx, "tenant1", file.ID)
+	requireNotError(t, err)
+
+	// Assert
+	require.True(t, link.PasswordProtected)
+	require.Equal(t, http.StatusUnauthorized, withoutPassword.Code)
+	require.Equal(t, http.StatusUnauthorized, wrongPassword)
+	require.Equal(t, http.StatusFound, rightPassword)
+	require.Len(t, shares, 1)
+	require.Equal(t, 1, shares[0].Downloads)
+}
+
+func TestRevokedExpiredAndDeletedSharesCantBeOpened(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	shareRepository := adapters.NewInMemoryShareRepository()
+	useCase := createUseCase(t, ctx, doubles.NewInMemoryFileStorage(), sharing(shareRepository))
+	router := createFilesRouter(useCase)
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "invoice.txt", "Paid"))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "receipt.txt", "Paid too"))
+	attachments := listAttachments(t, ctx, useCase, "order")
+	revoked, err := useCase.CreateShare(ctx, "tenant1", models.CreateShareCommand{FileID: attachments[0].ID, ExpiresIn: time.Hour})
+	requireNotError(t, err)
+	active, err := useCase.CreateShare(ctx, "tenant1", models.CreateShareCommand{FileID: attachments[0].ID, ExpiresIn: time.Hour})
+	requireNotError(t, err)
+	expired, err := useCase.CreateShare(ctx, "tenant1", models.CreateShareCommand{FileID: attachments[0].ID, ExpiresIn: time.Hour})
+	requireNotError(t, err)
+	expiredShare, err := shareRepository.ReadBy(ctx, expired.Token)
+	requireNotError(t, err)
+	expiredShare.Token = "expired"
+	expiredShare.ExpiresAt = time.Now().Add(-time.Second).Unix()
+	requireNotError(t, shareRepository.Add(ctx, expiredShare))
+	deleted, err := useCase.CreateShare(ctx, "tenant1", models.CreateShareCommand{FileID: attachments[1].ID, ExpiresIn: time.Hour})
+	requireNotError(t, err)
+	open := func(token string) int {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/shares/"+token, nil))
+		return recorder.Code
+	}
+
+	// Act
+	revokedCode := httptest.NewRecorder()
+	router.ServeHTTP(revokedCode, httptest.NewRequest(http.MethodDelete, "/api/files/"+attachments[0].ID+"/shares/"+revoked.Token, nil))
+	revokedAgain := useCase.RevokeShare(ctx, "tenant1", revoked.Token)
+	otherTenant := useCase.RevokeShare(ctx, "tenant2", active.Token)
+	requireNotError(t, useCase.DeleteFile(ctx, "tenant1", attachments[1].ID))
+	listed := httptest.NewRecorder()
+	router.ServeHTTP(listed, httptest.NewRequest(http.MethodGet, "/api/files/"+attachments[0].ID+"/shares", nil))
+	var links []models.ShareLink
+	requireNotError(t, json.Unmarshal(listed.Body.Bytes(), &links))
+
+	// Assert
+	require.Equal(t, http.StatusNoContent, revokedCode.Code)
+	require.ErrorIs(t, revokedAgain, files.ErrShareNotFound)
+	require.ErrorIs(t, otherTenant, files.ErrShareNotFound)
+	require.Equal(t, http.StatusNotFound, open(revoked.Token))
+	require.Equal(t, http.StatusGone, open("expired"))
+	require.Equal(t, http.StatusNotFound, open(deleted.Token))
+	require.Equal(t, http.StatusNotFound, open("unknown"))
+	require.Equal(t, http.StatusFound, open(active.Token))
+	require.Len(t, links, 2)
+	require.ElementsMatch(t, []string{active.Token, expired.Token}, []string{links[0].Token, links[1].Token})
+}
+
+func TestShareOfFileThatCantBeSignedStreamsContent(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	keyring, err := encryption.NewKeyring("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, encryption.KeySize)})
+	requireNotError(t, err)
+	storage := adapters.NewEnvelopeEncryptingFileStorage(doubles.NewInMemoryFileStorage(), map[string]*encryption.Keyring{"tenant1": keyring}, adapters.DefaultMaxEnvelopeFileSize)
+	useCase := createUseCase(t, ctx, storage, sharing(adapters.NewInMemoryShareRepository()))
+	router := createFilesRouter(useCase)
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "invoice.txt", "Paid"))
+	link, err := useCase.CreateShare(ctx, "tenant1", models.CreateShareCommand{
+		FileID:    listAttachments(t, ctx, useCase, "order")[0].ID,
+		ExpiresIn: time.Hour,
+	})
+	requireNotError(t, err)
+
+	// Act
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/shares/"+link.Token, nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "Paid", recorder.Body.String())
+	require.Equal(t, `attachment; filename="invoice.txt"`, recorder.Header().Get("Content-Disposition"))
+}
+
+func TestProtectedShareLocksAfterTooManyWrongPasswords(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	useCase := createUseCase(t, ctx, doubles.NewInMemoryFileStorage(), sharing(adapters.NewInMemoryShareRepository()))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "invoice.txt", "Paid"))
+	link, err := useCase.CreateShare(ctx, "tenant1", models.CreateShareCommand{
+		FileID:    listAttachments(t, ctx, useCase, "order")[0].ID,
+		ExpiresIn: time.Hour,
+		Password:  "secret",
+	})
+	requireNotError(t, err)
+	var guessErrs []error
+	for i := 0; i < 5; i++ {
+		_, err := useCase.OpenShare(ctx, link.Token, "guess")
+		guessErrs = append(guessErrs, err)
+	}
+
+	// Act
+	_, err = useCase.OpenShare(ctx, link.Token, "secret")
+
+	// Assert
+	for _, guessErr := range guessErrs {
+		require.ErrorIs(t, guessErr, files.ErrSharePasswordInvalid)
+	}
+	require.ErrorIs(t, err, files.ErrShareLocked)
+}
+
+func TestShareIsNotUsedUpWhenTheFileCantBeServed(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	keyring, err := encryption.NewKeyring("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, encryption.KeySize)})
+	requireNotError(t, err)
+	faulty := doubles.NewFaultyFileStorage(doubles.NewInMemoryFileStorage())
+	storage := adapters.NewEnvelopeEncryptingFileStorage(faulty, map[string]*encryption.Keyring{"tenant1": keyring}, adapters.DefaultMaxEnvelopeFileSize)
+	useCase := createUseCase(t, ctx, storage, sharing(adapters.NewInMemoryShareRepository()))
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "invoice.txt", "Paid"))
+	link, err := useCase.CreateShare(ctx, "tenant1", models.CreateShareCommand{
+		FileID:       listAttachments(t, ctx, useCase, "order")[0].ID,
+		ExpiresIn:    time.Hour,
+		MaxDownloads: 1,
+	})
+	requireNotError(t, err)
+	faulty.FailNext(errors.New("storage unavailable"))
+
+	// Act
+	_, failedErr := useCase.OpenShare(ctx, link.Token, "")
+	shared, err := useCase.OpenShare(ctx, link.Token, "")
+
+	// Assert
+	require.Error(t, failedErr)
+	requireNotError(t, err)
+	content, err := io.ReadAll(shared.Content.Content)
+	requireNotError(t, err)
+	require.Equal(t, "Paid", string(content))
+}
+
+func TestShareIsValidatedAgainstLimits(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	useCase := createUseCase(t, ctx, doubles.NewInMemoryFileStorage(), sharing(adapters.NewInMemoryShareRepository()))
+	router := createFilesRouter(useCase)
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "order", "invoice.txt", "Paid"))
+	file := listAttachments(t, ctx, useCase, "order")[0]
+	create := func(body map[string]interface{}) int {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, makeJsonRequest(t, http.MethodPost, "/api/files/"+file.ID+"/shares", body))
+		return recorder.Code
+	}
+
+	// Act
+	tooLong := create(map[string]interface{}{"expiresIn": 8 * 24 * 60})
+	withoutExpiration := create(map[string]interface{}{"maxDownloads": 1})
+	negativeDownloads := create(map[string]interface{}{"expiresIn": 60, "maxDownloads": -1})
+	unknownFile := httptest.NewRecorder()
+	router.ServeHTTP(unknownFile, makeJsonRequest(t, http.MethodPost, "/api/files/unknown/shares", map[string]interface{}{"expiresIn": 60}))
+
+	// Assert
+	require.Equal(t, http.StatusBadRequest, tooLong)
+	require.Equal(t, http.StatusBadRequest, withoutExpiration)
+	require.Equal(t, http.StatusBadRequest, negativeDownloads)
+	require.Equal(t, http.StatusNotFound, unknownFile.Code)
+}
+
+// sharing enables shares lasting up to a week, served by urls valid for a minute.
+func sharing(repository ports.ShareRepository) files.Option {
+	return files.Sharing(repository, 7*24*time.Hour, time.Minute)
+}
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/config"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/adapters"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/tests/doubles"
+)
+
+func TestUploadedImageGetsThumbnails(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	storage := doubles.NewInMemoryFileStorage()
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	pipeline := files.NewThumbnailPipeline(storage, repository, createStubLogger(), []int{32}, 1, 10)
+	pipeline.Start(ctx)
+	useCase, err := files.NewDefaultFilesUseCase(storage, repository, adapters.NewGuidBasedIdGenerator(),
+		config.GCloudStorage{UrlExpirationTime: 15}, nil, files.Thumbnails(pipeline))
+	requireNotError(t, err)
+	picture := new(bytes.Buffer)
+	requireNotError(t, png.Encode(picture, image.NewRGBA(image.Rect(0, 0, 200, 100))))
+
+	// Act
+	err = useCase.UploadFile(ctx, "tenant", models.UploadFileCommand{FileName: "picture.png", ReferenceID: "reference", File: picture})
+	requireNotError(t, err)
+	err = useCase.UploadFile(ctx, "tenant", models.UploadFileCommand{FileName: "notes.txt", ReferenceID: "reference", File: bytes.NewReader([]byte("Hello!"))})
+	requireNotError(t, err)
+
+	// Assert
+	var attachments *[]models.Attachment
+	require.Eventually(t, func() bool {
+		attachments, err = useCase.ListBy(ctx, "tenant", models.ListFilesQuery{ReferenceID: "reference"})
+		return err == nil && len((*attachments)[0].Thumbnails) == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, 32, (*attachments)[0].Thumbnails[0].Size)
+	require.Empty(t, (*attachments)[1].Thumbnails)
+	thumbnail, err := png.DecodeConfig(bytes.NewReader(storage.Files["tenant/thumbnails/32/picture.png.png"]))
+	requireNotError(t, err)
+	require.Equal(t, 32, thumbnail.Width)
+	require.Equal(t, 16, thumbnail.Height)
+}
+
+func TestCopiedImageKeepsThumbnails(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	storage := doubles.NewInMemoryFileStorage()
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	pipeline := files.NewThumbnailPipeline(storage, repository, createStubLogger(), []int{32}, 1, 10)
+	pipeline.Start(ctx)
+	useCase, err := files.NewDefaultFilesUseCase(storage, repository, adapters.NewGuidBasedIdGenerator(),
+		config.GCloudStorage{UrlExpirationTime: 15}, nil, files.Thumbnails(pipeline))
+	requireNotError(t, err)
+	picture := new(bytes.Buffer)
+	requireNotError(t, png.Encode(picture, image.NewRGBA(image.Rect(0, 0, 200, 100))))
+	err = useCase.UploadFile(ctx, "tenant", models.UploadFileCommand{FileName: "picture.png", ReferenceID: "reference", File: picture})
+	requireNotError(t, err)
+	var attachments *[]models.Attachment
+	require.Eventually(t, func() bool {
+		attachments, err = useCase.ListBy(ctx, "tenant", models.ListFilesQuery{ReferenceID: "reference"})
+		return err == nil && len((*attachments)[0].Thumbnails) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// Act
+	copied, err := useCase.CopyFile(ctx, "tenant", models.CopyFileCommand{FileID: (*attachments)[0].ID, ReferenceID: "other"})
+	requireNotError(t, err)
+
+	// Assert
+	copies, err := useCase.ListBy(ctx, "tenant", models.ListFilesQuery{ReferenceID: "other"})
+	requireNotError(t, err)
+	require.Len(t, (*copies)[0].Thumbnails, 1)
+	require.Contains(t, storage.Files, "tenant/thumbnails/32/objects/"+copied.ID+"/picture.png.png")
+}
+
+func TestChangesToFilesKeepThumbnailsMadeMeanwhile(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	racing := &racingRepository{FileRepository: repository}
+	useCase := createUseCaseOver(t, storage, racing)
+	thumbnails := []models.Thumbnail{{Size: 32, FileName: "thumbnails/32/picture.png.png"}}
+	racing.afterRead = func(fileID string) error {
+		return repository.UpdateThumbnails(ctx, "tenant1", fileID, thumbnails)
+	}
+	requireNotError(t, uploadText(ctx, useCase, "tenant1", "reference", "picture.png", "picture"))
+	attachments := listAttachments(t, ctx, useCase, "reference")
+	tags := []string{"holiday"}
+
+	// Act
+	_, err = useCase.UpdateMetadata(ctx, "tenant1", models.UpdateMetadataCommand{FileID: attachments[0].ID, Tags: &tags})
+	requireNotError(t, err)
+
+	// Assert
+	requireNotError(t, racing.Err())
+	file, err := repository.ReadBy(ctx, "tenant1", attachments[0].ID)
+	requireNotError(t, err)
+	require.Equal(t, thumbnails, file.Thumbnails)
+	require.Equal(t, tags, file.Tags)
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/config"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/adapters"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/tracing"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/tests/doubles"
+)
+
+func TestRequestSpansContinueIncomingTraceDownToStorage(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	tracer := provider.Tracer("tests")
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	defaultUseCase, err := files.NewDefaultFilesUseCase(adapters.NewTracedFileStorage(doubles.NewInMemoryFileStorage(), tracer),
+		adapters.NewTracedFileRepository(repository, tracer), adapters.NewGuidBasedIdGenerator(),
+		config.GCloudStorage{UrlExpirationTime: 15}, nil)
+	requireNotError(t, err)
+	useCase := files.NewTracedUseCase(defaultUseCase, tracer)
+	requireNotError(t, useCase.UploadFile(ctx, "tenant1", models.UploadFileCommand{FileName: "file.txt", ReferenceID: "reference", File: bytes.NewReader([]byte("Hello!"))}))
+	attachments, err := useCase.ListBy(ctx, "tenant1", models.ListFilesQuery{ReferenceID: "reference"})
+	requireNotError(t, err)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(otelgin.Middleware("tests", otelgin.WithTracerProvider(provider)))
+	files.AppendFileRoutes(router.Group("/api"), createStubLogger(), useCase)
+	request := httptest.NewRequest(http.MethodGet, "/api/files/"+(*attachments)[0].ID+"/content", nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	// Act
+	router.ServeHTTP(httptest.NewRecorder(), request)
+
+	// Assert
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID().String() == "4bf92f3577b34da6a3ce929d0e0e4736" {
+			spans[span.Name()] = span
+		}
+	}
+	handlerSpan, useCaseSpan, storageSpan := spans["/api/files/:id/content"], spans["UseCase.DownloadFile"], spans["FileStorage.ReadFile"]
+	require.NotNil(t, handlerSpan)
+	require.NotNil(t, useCaseSpan)
+	require.NotNil(t, storageSpan)
+	require.Equal(t, "00f067aa0ba902b7", handlerSpan.Parent().SpanID().String())
+	require.Equal(t, handlerSpan.SpanContext().SpanID(), useCaseSpan.Parent().SpanID())
+	require.Equal(t, useCaseSpan.SpanContext().SpanID(), storageSpan.Parent().SpanID())
+	require.Contains(t, storageSpan.Attributes(), tracing.AttributeTenant.String("tenant1"))
+	require.Contains(t, useCaseSpan.Attributes(), tracing.AttributeFileID.String((*attachments)[0].ID))
+	require.NotNil(t, spans["FileRepository.ReadBy"])
+}
@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/config"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/adapters"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/ports"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/tests/doubles"
+)
+
+func TestListByUsesTenantUrlExpiration(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	storage := doubles.NewInMemoryFileStorage()
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	useCase, err := files.NewDefaultFilesUseCase(storage, repository, adapters.NewGuidBasedIdGenerator(),
+		config.GCloudStorage{UrlExpirationTime: 120, MaxUrlExpirationTime: 1440},
+		map[string]config.Tenant{"tenant1": {UrlExpirationTime: 10, MaxUrlExpirationTime: 30}})
+	requireNotError(t, err)
+	err = useCase.UploadFile(ctx, "tenant1", models.UploadFileCommand{
+		CreatorId:   "UserId",
+		FileName:    "file.txt",
+		ReferenceID: "reference",
+		File:        bytes.NewReader([]byte("Hello!")),
+	})
+	requireNotError(t, err)
+
+	// Act
+	_, err = useCase.ListBy(ctx, "tenant1", models.ListFilesQuery{ReferenceID: "reference"})
+	requireNotError(t, err)
+	_, err = useCase.ListBy(ctx, "tenant1", models.ListFilesQuery{ReferenceID: "reference", UrlExpiresIn: 5 * time.Minute})
+	requireNotError(t, err)
+	_, tooLongErr := useCase.ListBy(ctx, "tenant1", models.ListFilesQuery{ReferenceID: "reference", UrlExpiresIn: 31 * time.Minute})
+
+	// Assert
+	require.Len(t, storage.SignedUrlOptions, 2)
+	require.Equal(t, 10*time.Minute, storage.SignedUrlOptions[0].Expiry)
+	require.Equal(t, 5*time.Minute, storage.SignedUrlOptions[1].Expiry)
+	require.ErrorIs(t, tooLongErr, files.ErrUrlExpirationTooLong)
+}
+
+// createUseCase creates the use case over the storage and an in-memory repository, with the
+// features under test enabled by opts. Signed urls expire after 15 minutes.
+func createUseCase(t *testing.T, ctx context.Context, storage ports.FileStorage, opts ...files.Option) *files.DefaultFilesUseCase {
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	return createUseCaseOver(t, storage, repository, opts...)
+}
+
+// createUseCaseOver is createUseCase for tests that reach into the repository.
+func createUseCaseOver(t *testing.T, storage ports.FileStorage, repository ports.FileRepository, opts ...files.Option) *files.DefaultFilesUseCase {
+	useCase, err := files.NewDefaultFilesUseCase(storage, repository, adapters.NewGuidBasedIdGenerator(),
+		config.GCloudStorage{UrlExpirationTime: 15}, nil, opts...)
+	requireNotError(t, err)
+	return useCase
+}
@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/config"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/adapters"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/files/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/pkg/events"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/webhooks"
+	webhooksAdapters "github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/webhooks/adapters"
+	webhooksModels "github.com/marcinlovescode/go-gcloudstorage-fileupload/internal/webhooks/models"
+	"github.com/marcinlovescode/go-gcloudstorage-fileupload/tests/doubles"
+)
+
+func TestUploadedFileIsDeliveredToWebhooks(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	secret := "0123456789abcdef"
+	var attempts int32
+	verified := make(chan bool, 1)
+	flakyReceiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(webhooks.HeaderTimestamp), 10, 64)
+		verified <- r.Header.Get(webhooks.HeaderSignature) == webhooks.Sign(secret, timestamp, body)
+	}))
+	defer flakyReceiver.Close()
+	rejectingReceiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer rejectingReceiver.Close()
+
+	idGen := adapters.NewGuidBasedIdGenerator()
+	subscriptions, err := webhooksAdapters.NewInMemorySubscriptionRepository(ctx)
+	requireNotError(t, err)
+	deadLetters, err := webhooksAdapters.NewInMemoryDeadLetterStore(ctx)
+	requireNotError(t, err)
+	webhooksUseCase, err := webhooks.NewDefaultWebhooksUseCase(subscriptions, deadLetters, idGen, true)
+	requireNotError(t, err)
+	dispatcher := webhooks.NewDispatcher(subscriptions, deadLetters, idGen, createStubLogger(), webhooks.DeliveryPolicy{
+		Workers: 2, QueueSize: 10, MaxAttempts: 3, InitialBackoff: time.Millisecond, Timeout: time.Second, AllowPrivateTargets: true,
+	})
+	dispatcher.Start(ctx)
+	bus := events.NewBus(createStubLogger())
+	bus.Subscribe(dispatcher.Handle)
+	for _, url := range []string{flakyReceiver.URL, rejectingReceiver.URL} {
+		_, err = webhooksUseCase.CreateSubscription(ctx, "tenant", webhooksModels.CreateSubscriptionCommand{Url: url, Secret: secret})
+		requireNotError(t, err)
+	}
+	repository, err := adapters.NewInMemoryFilesRepository(ctx)
+	requireNotError(t, err)
+	useCase, err := files.NewDefaultFilesUseCase(doubles.NewInMemoryFileStorage(), repository, idGen,
+		config.GCloudStorage{UrlExpirationTime: 15}, nil, files.Events(bus))
+	requireNotError(t, err)
+
+	// Act
+	err = useCase.UploadFile(ctx, "tenant", models.UploadFileCommand{FileName: "file.txt", ReferenceID: "reference", File: bytes.NewReader([]byte("Hello!"))})
+	requireNotError(t, err)
+
+	// Assert
+	select {
+	case ok := <-verified:
+		require.True(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("webhook wasn't delivered")
+	}
+	require.Eventually(t, func() bool {
+		letters, err := webhooksUseCase.ListDeadLetters(ctx, "tenant")
+		return err == nil && len(*letters) == 1 && (*letters)[0].Delivery.Url == rejectingReceiver.URL && (*letters)[0].Delivery.Attempts == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+}
+
+func TestWebhooksDoNotReachPrivateAddresses(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var received int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&received, 1)
+	}))
+	defer receiver.Close()
+	idGen := adapters.NewGuidBasedIdGenerator()
+	subscriptions, err := webhooksAdapters.NewInMemorySubscriptionRepository(ctx)
+	requireNotError(t, err)
+	deadLetters, err := webhooksAdapters.NewInMemoryDeadLetterStore(ctx)
+	requireNotError(t, err)
+	webhooksUseCase, err := webhooks.NewDefaultWebhooksUseCase(subscriptions, deadLetters, idGen, false)
+	requireNotError(t, err)
+	dispatcher := webhooks.NewDispatcher(subscriptions, deadLetters, idGen, createStubLogger(), webhooks.DeliveryPolicy{
+		Workers: 1, QueueSize: 10, MaxAttempts: 3, InitialBackoff: time.Millisecond, Timeout: time.Second,
+	})
+	dispatcher.Start(ctx)
+	// Stored directly, as if the name had resolved to a public address when it was subscribed.
+	requireNotError(t, subscriptions.Add(ctx, "tenant", &webhooksModels.Subscription{ID: "rebound", Tenant: "tenant", Url: receiver.URL, Secret: "0123456789abcdef"}))
+
+	// Act
+	var rejected []string
+	for _, url := range []string{
+		"http://169.254.169.254/computeMetadata/v1/",
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://10.0.0.1/hook",
+		"http://[::1]/hook",
+		receiver.URL,
+	} {
+		_, err = webhooksUseCase.CreateSubscription(ctx, "tenant", webhooksModels.CreateSubscriptionCommand{Url: url, Secret: "0123456789abcdef"})
+		if errors.Is(err, webhooks.ErrInvalidSubscription) {
+			rejected = append(rejected, url)
+		}
+	}
+	_, err = webhooksUseCase.CreateSubscription(ctx, "other", webhooksModels.CreateSubscriptionCommand{Url: "https://hooks.example.com/files", Secret: "0123456789abcdef"})
+	requireNotError(t, err)
+	requireNotError(t, dispatcher.Handle(ctx, events.Event{ID: "event", Type: events.FileUploaded, Tenant: "tenant"}))
+
+	// Assert
+	require.Len(t, rejected, 6)
+	require.Eventually(t, func() bool {
+		letters, err := webhooksUseCase.ListDeadLetters(ctx, "tenant")
+		if err != nil {
+			return false
+		}
+		for _, letter := range *letters {
+			if letter.Delivery.Url == receiver.URL {
+				return letter.Delivery.Attempts == 1
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+	require.Zero(t, atomic.LoadInt32(&received))
+}